@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/google/uuid"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type ArtistListConfig struct {
+	Limit  int32
+	Offset int32
+}
+
+var (
+	artistCmd = &cobra.Command{
+		Use:   "artist",
+		Short: "browse and edit artists",
+	}
+	artistListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list artists ordered by sort name",
+		Run:   WrapCommandWithResources(listArtists, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	artistListCfg = ArtistListConfig{}
+	artistShowCmd = &cobra.Command{
+		Use:   "show <name>",
+		Short: "show an artist and the tracks they are credited on",
+		Args:  cobra.ExactArgs(1),
+		Run:   WrapCommandWithResources(showArtist, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	artistAddCmd = &cobra.Command{
+		Use:   "add <name>",
+		Short: "add an artist before their tracks are uploaded, credits with separators such as \"Earth, Wind & Fire\" are then kept together",
+		Args:  cobra.ExactArgs(1),
+		Run:   WrapCommandWithResources(addArtist, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	artistAliasCmd = &cobra.Command{
+		Use:   "alias <name> <alias>",
+		Short: "add an alternative spelling for the artist, future credits with the alias are linked to the artist",
+		Args:  cobra.ExactArgs(2),
+		Run:   WrapCommandWithResources(aliasArtist, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	artistSortNameCmd = &cobra.Command{
+		Use:   "sort-name <name> <sort name>",
+		Short: "override the sort name of the artist",
+		Args:  cobra.ExactArgs(2),
+		Run:   WrapCommandWithResources(setArtistSortName, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	backfillArtistsCmd = &cobra.Command{
+		Use:   "artists",
+		Short: "parse artist credits of tracks that are not linked to any artist",
+		Run:   WrapCommandWithResources(backfillArtists, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+)
+
+func getArtistCmd() *cobra.Command {
+	artistListCmd.PersistentFlags().Int32VarP(&artistListCfg.Limit, "limit", "l", 50, "number of artists to list")
+	artistListCmd.PersistentFlags().Int32VarP(&artistListCfg.Offset, "offset", "o", 0, "number of artists to skip")
+	artistCmd.AddCommand(artistListCmd)
+	artistCmd.AddCommand(artistShowCmd)
+	artistCmd.AddCommand(artistAddCmd)
+	artistCmd.AddCommand(artistAliasCmd)
+	artistCmd.AddCommand(artistSortNameCmd)
+	return artistCmd
+}
+
+func listArtists(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	artists, err := app.DB.ListArtists(ctx, db.ListArtistsParams{Limit: artistListCfg.Limit, Offset: artistListCfg.Offset})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list artists")
+		return
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.AppendHeader(table.Row{"Name", "Sort Name", "Aliases", "Tracks"})
+	for _, artist := range artists {
+		t.AppendRow(table.Row{artist.Name, artist.SortName, strings.Join(artist.Aliases, ", "), artist.TrackCount})
+	}
+	t.Render()
+}
+
+func showArtist(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	artist, err := app.DB.GetArtistByMatchNameOrAlias(ctx, internal.ArtistMatchName(args[0]))
+	if err != nil {
+		log.Error().Err(err).Str("name", args[0]).Msg("failed to get artist")
+		return
+	}
+	tracks, err := app.DB.GetTracksByArtistID(ctx, artist.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get tracks")
+		return
+	}
+	fmt.Printf("%s (%s)\n", artist.Name, artist.SortName)
+	if len(artist.Aliases) > 0 {
+		fmt.Printf("also known as: %s\n", strings.Join(artist.Aliases, ", "))
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.AppendHeader(table.Row{"Title", "Album", "Role", "Length"})
+	for _, track := range tracks {
+		var trackInfo internal.ExifInfo
+		if err := json.Unmarshal(track.Info, &trackInfo); err != nil {
+			log.Error().Err(err).Msg("failed to parse track info")
+			return
+		}
+		seconds, _ := track.TotalDuration.Float64Value()
+		t.AppendRow(table.Row{
+			trackInfo.Title,
+			track.AlbumName,
+			track.Role,
+			fmt.Sprintf("%d:%02d", int(seconds.Float64/60), int(seconds.Float64)%60),
+		})
+	}
+	t.Render()
+}
+
+func addArtist(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	name := strings.TrimSpace(args[0])
+	if _, err := app.DB.UpsertArtist(ctx, db.UpsertArtistParams{
+		ID:        uuid.NewString(),
+		Name:      name,
+		SortName:  internal.ArtistSortName(name),
+		MatchName: internal.ArtistMatchName(name),
+	}); err != nil {
+		log.Error().Err(err).Msg("failed to add artist")
+		return
+	}
+	fmt.Printf("added %s\n", name)
+}
+
+func aliasArtist(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	artist, err := app.DB.GetArtistByMatchNameOrAlias(ctx, internal.ArtistMatchName(args[0]))
+	if err != nil {
+		log.Error().Err(err).Str("name", args[0]).Msg("failed to get artist")
+		return
+	}
+	if err := app.DB.AddArtistAlias(ctx, db.AddArtistAliasParams{ID: artist.ID, Alias: internal.ArtistMatchName(args[1])}); err != nil {
+		log.Error().Err(err).Msg("failed to add alias")
+		return
+	}
+	fmt.Printf("%s is now also known as %s\n", artist.Name, args[1])
+}
+
+func setArtistSortName(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	artist, err := app.DB.GetArtistByMatchNameOrAlias(ctx, internal.ArtistMatchName(args[0]))
+	if err != nil {
+		log.Error().Err(err).Str("name", args[0]).Msg("failed to get artist")
+		return
+	}
+	if err := app.DB.SetArtistSortName(ctx, db.SetArtistSortNameParams{ID: artist.ID, SortName: args[1]}); err != nil {
+		log.Error().Err(err).Msg("failed to set sort name")
+		return
+	}
+}
+
+func backfillArtists(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	tracks, err := app.DB.GetTracksWithoutArtists(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get tracks without artists")
+		return
+	}
+	for _, track := range tracks {
+		var trackInfo internal.ExifInfo
+		if err := json.Unmarshal(track.Info, &trackInfo); err != nil {
+			log.Error().Err(err).Str("track_id", track.ID).Msg("failed to parse track info")
+			continue
+		}
+		if err := internal.LinkTrackArtists(ctx, app.DB, track.ID, trackInfo.Artist, trackInfo.Title); err != nil {
+			log.Error().Err(err).Str("track_id", track.ID).Msg("failed to link artists")
+			continue
+		}
+	}
+	fmt.Printf("linked artists of %d tracks\n", len(tracks))
+}
@@ -10,7 +10,9 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/caner-cetin/strafe/internal"
@@ -50,6 +52,15 @@ type UploadConfig struct {
 	IsInstrumental bool
 	DryRun         bool
 	CoverArtPath   string
+	AudioPath      string
+	// .lrc or text file, the file next to the audio with the .lrc extension is used if it exists
+	LyricsPath string
+	// installs audio-separator and splits the audio again without asking, for workers
+	NonInteractive bool
+	// prints progress events as NDJSON instead of the spinner and the logs of the tools
+	JSONEvents bool
+	// looks the audio up on musicbrainz, musicbrainz.enabled in the config turns it on for every upload
+	MusicBrainz bool
 }
 
 type ModelsConfig struct {
@@ -61,7 +72,7 @@ var (
 		Use:   "upload -i audio -c cover",
 		Short: "processes and uploads audio",
 		Long:  `processes and uploads audio file given with -i / --input flag. requires strafe docker image.`,
-		Run:   WrapCommandWithResources(processAndUploadAudio, ResourceConfig{Resources: []ResourceType{ResourceDocker, ResourceDatabase, ResourceS3}}),
+		Run:   WrapCommandWithResources(processAndUploadAudio, ResourceConfig{Resources: []ResourceType{ResourceDocker, ResourceDatabase, ResourceStorage}}),
 	}
 	uploadCfg = UploadConfig{}
 	modelsCmd = &cobra.Command{
@@ -83,6 +94,9 @@ func getAudioRootCmd() *cobra.Command {
 	uploadCmd.PersistentFlags().BoolVar(&uploadCfg.UseGPU, "gpu", false, "use gpu during audio separation")
 	uploadCmd.PersistentFlags().BoolVarP(&uploadCfg.DryRun, "dry_run", "d", false, "files and metadata will not be uploaded to S3 and database")
 	uploadCmd.PersistentFlags().StringVarP(&uploadCfg.CoverArtPath, "cover_art", "c", "", "cover art for the tracks album, required if album does not exist yet.")
+	uploadCmd.PersistentFlags().StringVar(&uploadCfg.LyricsPath, "lyrics", "", "lyrics as LRC or plain text, lyrics embedded in the audio are used otherwise")
+	uploadCmd.PersistentFlags().BoolVar(&uploadCfg.JSONEvents, "json-events", false, "print progress as one json event per line instead of the spinner, never prompts")
+	uploadCmd.PersistentFlags().BoolVar(&uploadCfg.MusicBrainz, "musicbrainz", false, "fill missing tags from musicbrainz and fetch the cover of new albums from the cover art archive")
 
 	modelsCmd.PersistentFlags().StringVar(&modelsCfg.Source, "src", "https://raw.githubusercontent.com/nomadkaraoke/python-audio-separator/refs/heads/main/audio_separator/models.json", "model source")
 
@@ -136,13 +150,29 @@ type audioProcessor struct {
 		exif string
 		// entrypoint bash script for docker container
 		entrypoint string
+		// directory of the cover downloaded from the cover art archive, empty if none is downloaded
+		cover string
 	}
 	// output of exifinfo
-	info        internal.ExifInfo
+	info internal.ExifInfo
+	// nil if neither the audio nor a sidecar has lyrics
+	lyrics       *internal.Lyrics
+	lyricsSource internal.LyricsSource
+	// nil if enrichment is off or musicbrainz has no matching recording
+	match       *internal.MusicBrainzMatch
 	db_record   db.InsertTrackParams
 	audioFormat string
 	spinner     *spinner.Spinner
-	conditions  struct {
+	// uv, audio-separator and container logs are written to output
+	output io.Writer
+	// receives the progress of the pipeline if set, events are sent from more than one goroutine
+	events func(internal.ProgressEvent)
+	// stage the pipeline is at, see internal.IngestStage*
+	stage   string
+	stageMu sync.Mutex
+	// bytes of segments and cover art uploaded so far
+	uploaded   int64
+	conditions struct {
 		// set to true if the album is uploaded for the first time
 		// and the album is inserted at the same time with track is inserted
 		//
@@ -157,63 +187,129 @@ func processAndUploadAudio(cmd *cobra.Command, args []string) {
 	ctx := cmd.Context()
 	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
 
+	var cfg = uploadCfg
+	cfg.AudioPath = audioPath
 	processor := &audioProcessor{
-		cfg:     uploadCfg,
+		cfg:     cfg,
 		app:     app,
 		ctx:     cmd.Context(),
+		output:  os.Stdout,
 		spinner: spinner.New(spinner.CharSets[12], 100*time.Millisecond),
 	}
+	if cfg.JSONEvents {
+		var mu sync.Mutex
+		encoder := json.NewEncoder(os.Stdout)
+		processor.cfg.NonInteractive = true
+		processor.events = func(event internal.ProgressEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			encoder.Encode(event)
+		}
+		processor.output = internal.NewProgressWriter(processor.emit)
+		processor.spinner = spinner.New(spinner.CharSets[12], 100*time.Millisecond, spinner.WithWriter(io.Discard))
+	}
 	processor.spinner.Prefix = "initializing "
 	processor.spinner.Start()
 	defer processor.spinner.Stop()
-	if err := processor.setupAudioSeparator(); err != nil {
-		log.Error().Err(err).Msg("failed to setup audio separator")
+	if err := processor.run(); err != nil {
+		processor.emit(internal.ProgressEvent{Type: internal.ProgressFailed, Message: err.Error()})
+		log.Error().Err(err).Msg("failed to process audio")
 		return
 	}
-	if err := processor.preparePaths(); err != nil {
-		log.Error().Err(err).Msg("failed to prepare mount paths")
+	if cfg.JSONEvents {
+		processor.emit(internal.ProgressEvent{Type: internal.ProgressDone, TrackID: processor.db_record.ID})
 		return
 	}
-	processor.prepareMounts()
+	fmt.Println(color.GreenString("goodbye!"))
+}
+
+// run splits and analyzes the audio, then uploads the segments and inserts the track unless it is a dry run.
+// the id of the inserted track is p.db_record.ID
+func (p *audioProcessor) run() error {
+	p.setStage(internal.IngestStagePreparing)
+	if err := p.setupAudioSeparator(); err != nil {
+		return fmt.Errorf("failed to setup audio separator: %w", err)
+	}
+	if err := p.preparePaths(); err != nil {
+		return fmt.Errorf("failed to prepare mount paths: %w", err)
+	}
+	p.prepareMounts()
 	defer func() {
-		if err := processor.deleteTemps(); err != nil {
+		if err := p.deleteTemps(); err != nil {
 			log.Error().Err(err).Msg("failed to delete temporary files")
-			return
 		}
 	}()
 
-	if err := processor.splitAudio(); err != nil {
-		log.Error().Err(err).Msg("failed to split audio file")
-		return
+	p.setStage(internal.IngestStageSplitting)
+	if err := p.splitAudio(); err != nil {
+		return fmt.Errorf("failed to split audio file: %w", err)
+	}
+	p.setStage(internal.IngestStageAnalyzing)
+	p.spinner.Prefix = "initializing container "
+	statusCh, errCh, err := p.runContainer()
+	if p.container != nil {
+		defer func() {
+			// removed even if the run was cancelled
+			if err := removeContainer(context.WithoutCancel(p.ctx), p.container, nil, p.app.Docker); err != nil {
+				log.Error().Err(err).Msg("failed to remove container")
+			}
+		}()
 	}
-	processor.spinner.Prefix = "initializing container "
-
-	statusCh, errCh, err := processor.runContainer()
 	if err != nil {
-		processor.spinner.Stop()
-		log.Error().Err(err).Msg("error in container")
-		return
+		p.spinner.Stop()
+		return fmt.Errorf("error in container: %w", err)
 	}
-	defer func() {
-		if err := removeContainer(ctx, processor.container, nil, app.Docker); err != nil {
-			log.Error().Err(err).Msg("failed to remove container")
-			return
-		}
-	}()
 	select {
 	case err := <-errCh:
 		if err != nil {
-			processor.spinner.Stop()
-			log.Error().Err(err).Msg("error in container")
-			return
+			p.spinner.Stop()
+			return fmt.Errorf("error in container: %w", err)
 		}
 	case <-statusCh:
-		processor.spinner.Stop()
-		if err := processor.processResults(ctx); err != nil {
-			log.Error().Err(err).Msg("failed to process results")
+		p.spinner.Stop()
+		if err := p.processResults(p.ctx); err != nil {
+			return fmt.Errorf("failed to process results: %w", err)
 		}
 	}
-	fmt.Println(color.GreenString("goodbye!"))
+	p.setStage("")
+	return nil
+}
+
+// setStage finishes the current stage and starts the next one, an empty stage only finishes the current one
+func (p *audioProcessor) setStage(stage string) {
+	p.stageMu.Lock()
+	previous := p.stage
+	p.stage = stage
+	p.stageMu.Unlock()
+	if previous != "" {
+		p.emit(internal.ProgressEvent{Type: internal.ProgressStageFinished, Stage: previous})
+	}
+	if stage != "" {
+		p.emit(internal.ProgressEvent{Type: internal.ProgressStageStarted, Stage: stage})
+	}
+}
+
+// emit sends the event to p.events, events without a stage belong to the current stage
+func (p *audioProcessor) emit(event internal.ProgressEvent) {
+	if p.events == nil {
+		return
+	}
+	if event.Stage == "" {
+		p.stageMu.Lock()
+		event.Stage = p.stage
+		p.stageMu.Unlock()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	p.events(event)
+}
+
+// emitUpload reports the bytes uploaded after every object
+func (p *audioProcessor) emitUpload(size int64, total int64) {
+	p.uploaded += size
+	percent := float64(p.uploaded) / float64(max(total, 1)) * 100
+	p.emit(internal.ProgressEvent{Type: internal.ProgressUpdate, Percent: &percent, Bytes: p.uploaded, TotalBytes: total})
 }
 
 func (p *audioProcessor) setupAudioSeparator() error {
@@ -225,27 +321,29 @@ func (p *audioProcessor) setupAudioSeparator() error {
 		return fmt.Errorf("uv is not installed! %w", err)
 	}
 	p.spinner.Prefix = "checking installed pip packages "
-	output, err := exec.Command(uvPath, "pip", "list").Output()
+	output, err := exec.CommandContext(p.ctx, uvPath, "pip", "list").Output()
 	if err != nil {
 		return fmt.Errorf("installed package check failed: %w", err)
 	}
 	separatorPkg := "audio-separator"
 	if !strings.Contains(string(output), separatorPkg) {
-		p.spinner.Stop()
-		fmt.Printf("audio-separator package is not installed, should we install it? [Y/n] ")
-		conf, _ := bufio.NewReader(os.Stdin).ReadString('\n')
-		if strings.ToLower(strings.TrimSpace(conf)) == "n" {
-			return fmt.Errorf("audio separator is required for vocal and instrument split")
+		if !p.cfg.NonInteractive {
+			p.spinner.Stop()
+			fmt.Printf("audio-separator package is not installed, should we install it? [Y/n] ")
+			conf, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if strings.ToLower(strings.TrimSpace(conf)) == "n" {
+				return fmt.Errorf("audio separator is required for vocal and instrument split")
+			}
+			p.spinner.Start()
 		}
-		p.spinner.Start()
 		p.spinner.Prefix = "installing audio separator package "
 		pkgSpec := "audio-separator[cpu]"
-		if uploadCfg.UseGPU {
+		if p.cfg.UseGPU {
 			pkgSpec = "audio-separator[gpu]"
 		}
-		cd := exec.Command(uvPath, "pip", "install", "--system", "onnxruntime", pkgSpec)
-		cd.Stdout = os.Stdout
-		cd.Stderr = os.Stderr
+		cd := exec.CommandContext(p.ctx, uvPath, "pip", "install", "--system", "onnxruntime", pkgSpec)
+		cd.Stdout = p.output
+		cd.Stderr = p.output
 		if err := cd.Run(); err != nil {
 			return fmt.Errorf("failed to install %s: %w", pkgSpec, err)
 		}
@@ -255,9 +353,9 @@ func (p *audioProcessor) setupAudioSeparator() error {
 
 func (p *audioProcessor) preparePaths() error {
 	var err error
-	audioSeparatorOutputDirectoryNoSuffix := strings.TrimSuffix(uploadCfg.OutputDir, string(os.PathSeparator))
-	hostAudioSplitByPath := strings.Split(audioPath, string(os.PathSeparator))
-	hostAudioPathSplit := strings.Split(audioPath, ".")
+	audioSeparatorOutputDirectoryNoSuffix := strings.TrimSuffix(p.cfg.OutputDir, string(os.PathSeparator))
+	hostAudioSplitByPath := strings.Split(p.cfg.AudioPath, string(os.PathSeparator))
+	hostAudioPathSplit := strings.Split(p.cfg.AudioPath, ".")
 	p.audioFormat = hostAudioPathSplit[len(hostAudioPathSplit)-1]
 	if p.audioFormat == "" {
 		return fmt.Errorf("cannot determine audio format from file extension")
@@ -277,7 +375,7 @@ func (p *audioProcessor) preparePaths() error {
 		return fmt.Errorf("failed to create vocal segments directory: %w", err)
 	}
 
-	p.paths.audio = audioPath
+	p.paths.audio = p.cfg.AudioPath
 	if _, err = os.Stat(p.paths.audio); os.IsNotExist(err) {
 		return fmt.Errorf("audio file %s not found: %w", p.paths.audio, err)
 	}
@@ -355,6 +453,11 @@ func (p *audioProcessor) deleteTemps() error {
 	if err = os.Remove(p.paths.exif); err != nil {
 		return fmt.Errorf("failed to remove exif file: %w", err)
 	}
+	if p.paths.cover != "" {
+		if err = os.RemoveAll(p.paths.cover); err != nil {
+			return fmt.Errorf("failed to remove cover directory: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -366,29 +469,32 @@ func (p *audioProcessor) splitAudio() error {
 	cdArgs := []string{
 		"--with", "onnxruntime",
 		"audio-separator",
-		"-m", uploadCfg.ModelCheckpoint,
+		"-m", p.cfg.ModelCheckpoint,
 		"--output_format", strings.ToUpper(p.audioFormat),
-		"--output_dir", uploadCfg.OutputDir,
+		"--output_dir", p.cfg.OutputDir,
 		"--custom_output_names", fmt.Sprintf(`{"Vocals": "%s", "Instrumental": "%s"}`, p.paths.stems.vocal.filename, p.paths.stems.instrumental.filename),
-		audioPath,
+		p.cfg.AudioPath,
 	}
-	cd := exec.Command(uvxPath, cdArgs...)
-	cd.Stdout = os.Stdout
-	cd.Stderr = os.Stderr
+	cd := exec.CommandContext(p.ctx, uvxPath, cdArgs...)
+	cd.Stdout = p.output
+	cd.Stderr = p.output
 	p.spinner.Stop()
 	if _, err := os.Stat(p.paths.stems.vocal.path); err == nil {
 		if _, err := os.Stat(p.paths.stems.instrumental.path); err == nil {
-			fmt.Printf("vocal and instrumental stem files exists, should we split the audio anyways? [y/N] ")
-			conf, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			var conf = "y"
+			if !p.cfg.NonInteractive {
+				fmt.Printf("vocal and instrumental stem files exists, should we split the audio anyways? [y/N] ")
+				conf, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+			}
 			if strings.ToLower(strings.TrimSpace(conf)) == "y" {
 				if err := cd.Run(); err != nil {
-					return fmt.Errorf("failed to split audio %s: %w", audioPath, err)
+					return fmt.Errorf("failed to split audio %s: %w", p.cfg.AudioPath, err)
 				}
 			}
 		}
 	} else {
 		if err := cd.Run(); err != nil {
-			return fmt.Errorf("failed to split audio %s: %w", audioPath, err)
+			return fmt.Errorf("failed to split audio %s: %w", p.cfg.AudioPath, err)
 		}
 	}
 	p.spinner.Start()
@@ -396,15 +502,16 @@ func (p *audioProcessor) splitAudio() error {
 }
 
 func (p *audioProcessor) runContainer() (<-chan container.WaitResponse, <-chan error, error) {
+	q := internal.ShellQuote
 	scripts := []string{
-		fmt.Sprintf(`exiftool "%s" -json > "%s"`, audioPath, p.paths.exif),
-		fmt.Sprintf(`audiowaveform -i "%s" --pixels-per-second %d --output-format json > "%s"`, p.paths.stems.vocal.path, uploadCfg.WaveformPPS, p.paths.waveform.vocal),
-		fmt.Sprintf(`audiowaveform -i "%s" --pixels-per-second %d --output-format json > "%s"`, p.paths.stems.instrumental.path, uploadCfg.WaveformPPS, p.paths.waveform.instrumental),
-		fmt.Sprintf(`aubio tempo -i "%s" > "%s"`, audioPath, p.paths.tempo),
-		fmt.Sprintf(`keyfinder-cli "%s" > "%s"`, audioPath, p.paths.key),
-		fmt.Sprintf(`ffmpeg -i "%s" -c:a aac -b:a 320k -f segment -segment_time 40 -segment_list "%s/playlist.m3u8" -segment_format mpegts "%s/%%03d.ts"`, p.paths.stems.instrumental.path, p.paths.segments.instrumental, p.paths.segments.instrumental),
-		fmt.Sprintf(`ffmpeg -i "%s" -c:a aac -b:a 320k -f segment -segment_time 40 -segment_list "%s/playlist.m3u8" -segment_format mpegts "%s/%%03d.ts"`, p.paths.stems.vocal.path, p.paths.segments.vocal, p.paths.segments.vocal),
-		fmt.Sprintf(`ffprobe -i "%s" -show_entries format=duration -of default=noprint_wrappers=1:nokey=1 -v error > "%s"`, audioPath, p.paths.duration),
+		fmt.Sprintf(`exiftool %s -json > %s`, q(p.cfg.AudioPath), q(p.paths.exif)),
+		fmt.Sprintf(`audiowaveform -i %s --pixels-per-second %d --output-format json > %s`, q(p.paths.stems.vocal.path), p.cfg.WaveformPPS, q(p.paths.waveform.vocal)),
+		fmt.Sprintf(`audiowaveform -i %s --pixels-per-second %d --output-format json > %s`, q(p.paths.stems.instrumental.path), p.cfg.WaveformPPS, q(p.paths.waveform.instrumental)),
+		fmt.Sprintf(`aubio tempo -i %s > %s`, q(p.cfg.AudioPath), q(p.paths.tempo)),
+		fmt.Sprintf(`keyfinder-cli %s > %s`, q(p.cfg.AudioPath), q(p.paths.key)),
+		fmt.Sprintf(`ffmpeg -i %s -c:a aac -b:a 320k -f segment -segment_time 40 -segment_list %s -segment_format mpegts %s`, q(p.paths.stems.instrumental.path), q(p.paths.segments.instrumental+"/playlist.m3u8"), q(p.paths.segments.instrumental+"/%03d.ts")),
+		fmt.Sprintf(`ffmpeg -i %s -c:a aac -b:a 320k -f segment -segment_time 40 -segment_list %s -segment_format mpegts %s`, q(p.paths.stems.vocal.path), q(p.paths.segments.vocal+"/playlist.m3u8"), q(p.paths.segments.vocal+"/%03d.ts")),
+		fmt.Sprintf(`ffprobe -i %s -show_entries format=duration -of default=noprint_wrappers=1:nokey=1 -v error > %s`, q(p.cfg.AudioPath), q(p.paths.duration)),
 	}
 	var err error
 	err = os.WriteFile(p.paths.entrypoint, []byte(strings.Join(scripts, "\n")), 0755)
@@ -436,11 +543,11 @@ func (p *audioProcessor) runContainer() (<-chan container.WaitResponse, <-chan e
 		for scanner.Scan() {
 			line := scanner.Text()
 			s.Stop()
-			fmt.Println(line)
+			fmt.Fprintln(p.output, line)
 			s.Start()
 		}
 		if err := scanner.Err(); err != nil {
-			fmt.Printf("error scanning logs: %v\n", err)
+			fmt.Fprintf(p.output, "error scanning logs: %v\n", err)
 		}
 	}(stdout, p.spinner)
 	p.spinner.Prefix = "waiting for container to finish"
@@ -470,23 +577,63 @@ func (p *audioProcessor) processResults(ctx context.Context) error {
 	if err := p.loadTempo(); err != nil {
 		return fmt.Errorf("failed to load tempo: %w", err)
 	}
-	if !uploadCfg.DryRun {
+	if err := p.loadLyrics(); err != nil {
+		return fmt.Errorf("failed to load lyrics: %w", err)
+	}
+	if p.cfg.MusicBrainz || viper.GetBool(internal.MUSICBRAINZ_ENABLED) {
+		p.setStage(internal.IngestStageEnriching)
+		if err := p.enrich(ctx); err != nil {
+			return fmt.Errorf("failed to enrich metadata: %w", err)
+		}
+	}
+	if !p.cfg.DryRun {
 		if err := p.loadOrCreateAlbum(ctx); err != nil {
 			return fmt.Errorf("failed to load or create album: %w", err)
 		}
 		p.db_record.ID = uuid.NewString()
-		p.db_record.Instrumental = pgtype.Bool{Bool: uploadCfg.IsInstrumental, Valid: true}
-		p.db_record.AlbumName = pgtype.Text{String: p.info.Album, Valid: true}
+		p.db_record.Instrumental = p.cfg.IsInstrumental
+		p.setStage(internal.IngestStageUploading)
 		if err := p.upload(); err != nil {
 			return fmt.Errorf("failed to upload: %w", err)
 		}
-		if err := p.app.DB.InsertTrack(ctx, p.db_record); err != nil {
-			return fmt.Errorf("failed to insert track: %w", err)
+		p.setStage(internal.IngestStageSaving)
+		if err := p.insertTrack(ctx); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// inserts the track and links the credited artists in the same transaction
+func (p *audioProcessor) insertTrack(ctx context.Context) error {
+	tx, err := p.app.Conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := p.app.DB.WithTx(tx)
+	if err := qtx.InsertTrack(ctx, p.db_record); err != nil {
+		return fmt.Errorf("failed to insert track: %w", err)
+	}
+	if err := internal.LinkTrackArtists(ctx, qtx, p.db_record.ID, p.info.Artist, p.info.Title); err != nil {
+		return fmt.Errorf("failed to link artists: %w", err)
+	}
+	if p.lyrics != nil {
+		if err := internal.SaveLyrics(ctx, qtx, p.db_record.ID, *p.lyrics, p.lyricsSource); err != nil {
+			return fmt.Errorf("failed to save lyrics: %w", err)
+		}
+	}
+	if p.match != nil {
+		if err := p.saveMatch(ctx, qtx); err != nil {
+			return fmt.Errorf("failed to save musicbrainz ids: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (p *audioProcessor) loadExifInfo() error {
 	// 1 element array, as we pass one single audio
 	exifInfoArrayBytes, err := os.ReadFile(p.paths.exif)
@@ -503,6 +650,46 @@ func (p *audioProcessor) loadExifInfo() error {
 	return nil
 }
 
+// loadLyrics prefers the given lyrics file or the .lrc next to the audio, then the ID3 tag and the lyrics tags of
+// other formats. audio without lyrics is not an error.
+func (p *audioProcessor) loadLyrics() error {
+	sidecar := p.cfg.LyricsPath
+	if sidecar == "" {
+		candidate := strings.TrimSuffix(p.cfg.AudioPath, filepath.Ext(p.cfg.AudioPath)) + ".lrc"
+		if _, err := os.Stat(candidate); err == nil {
+			sidecar = candidate
+		}
+	}
+	if sidecar != "" {
+		contents, err := os.ReadFile(sidecar)
+		if err != nil {
+			return fmt.Errorf("failed to read lyrics file: %w", err)
+		}
+		lyrics := internal.ParseLyrics(string(contents))
+		if lyrics.Plain != "" {
+			p.lyrics, p.lyricsSource = &lyrics, internal.LyricsSourceSidecar
+			return nil
+		}
+	}
+	lyrics, source, err := internal.ReadID3Lyrics(p.cfg.AudioPath)
+	if err == nil {
+		p.lyrics, p.lyricsSource = &lyrics, source
+		return nil
+	}
+	if !errors.Is(err, internal.ErrNoLyrics) {
+		// a broken tag should not fail the upload, the lyrics can be set later
+		log.Warn().Err(err).Msg("failed to read embedded lyrics")
+	}
+	for _, key := range []string{"Lyrics", "UnsyncedLyrics", "Unsyncedlyrics"} {
+		if text := fastjson.GetString(p.db_record.Info, key); strings.TrimSpace(text) != "" {
+			lyrics := internal.ParseLyrics(text)
+			p.lyrics, p.lyricsSource = &lyrics, internal.LyricsSourceTag
+			return nil
+		}
+	}
+	return nil
+}
+
 func (p *audioProcessor) loadWaveforms() error {
 	instrumentalWFBytes, err := os.ReadFile(p.paths.waveform.instrumental)
 	if err != nil {
@@ -543,7 +730,7 @@ func (p *audioProcessor) loadKey() error {
 	if err != nil {
 		return fmt.Errorf("failed to read key: %w", err)
 	}
-	p.db_record.Key = pgtype.Text{String: strings.TrimSpace(strings.ReplaceAll(string(keyBytes), "\n", "")), Valid: true}
+	p.db_record.Key = strings.TrimSpace(strings.ReplaceAll(string(keyBytes), "\n", ""))
 	return nil
 }
 
@@ -560,62 +747,48 @@ func (p *audioProcessor) loadTempo() error {
 	return nil
 }
 
-// inserts album if the name does not exist
+// inserts album if no album with the same name and artist exists.
+// concurrent uploads of the same album resolve to the same row, the upload that inserts the album uploads the cover art.
 func (p *audioProcessor) loadOrCreateAlbum(ctx context.Context) error {
-	var albumId string
 	tx, err := p.app.Conn.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
-	defer func() {
-		if err := tx.Rollback(ctx); err != nil {
-			log.Error().Err(err).Msg("failed to rollback transaction")
-		}
-	}()
+	defer tx.Rollback(ctx)
 	qtx := p.app.DB.WithTx(tx)
-	albumId, err = qtx.GetAlbumIDByNameAndArtist(ctx,
-		db.GetAlbumIDByNameAndArtistParams{
-			Name:   pgtype.Text{String: p.info.Album, Valid: true},
-			Artist: pgtype.Text{String: p.info.Artist, Valid: true}},
-	)
-	p.conditions.shouldUploadCoverArt = false
+	var cover pgtype.Text
+	if p.cfg.CoverArtPath != "" {
+		cover = pgtype.Text{String: p.coverArtS3Key(), Valid: true}
+	}
+	album, err := qtx.UpsertAlbum(ctx, db.UpsertAlbumParams{
+		ID:     uuid.NewString(),
+		Name:   p.info.Album,
+		Cover:  cover,
+		Artist: p.info.Artist,
+		Year:   pgtype.Int4{Int32: int32(p.info.Year), Valid: p.info.Year != 0},
+		Genre:  pgtype.Text{String: p.info.Genre, Valid: p.info.Genre != ""},
+	})
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			if p.cfg.CoverArtPath == "" {
-				return fmt.Errorf("corresponding album does not exist in database, and cover art path is not given with the command")
-			}
-			albumId, err = qtx.InsertAlbum(ctx, db.InsertAlbumParams{
-				ID:     uuid.NewString(),
-				Name:   pgtype.Text{String: p.info.Album, Valid: true},
-				Cover:  pgtype.Text{String: p.coverArtS3Key(), Valid: true},
-				Artist: pgtype.Text{String: p.info.Artist, Valid: true},
-			})
-			if err != nil {
-				return fmt.Errorf("failed to insert album: %w", err)
-			}
-			err = tx.Commit(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to commit transaction: %w", err)
-			}
-			p.conditions.shouldUploadCoverArt = true
-		} else {
-			return fmt.Errorf("failed to get album id: %w", err)
-		}
+		return fmt.Errorf("failed to upsert album: %w", err)
+	}
+	if album.Inserted && p.cfg.CoverArtPath == "" {
+		return fmt.Errorf("corresponding album does not exist in database, and cover art path is not given with the command")
 	}
-	p.db_record.AlbumID = pgtype.Text{String: albumId, Valid: true}
-	p.db_record.AlbumName = pgtype.Text{String: p.info.Album, Valid: true}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	p.conditions.shouldUploadCoverArt = album.Inserted
+	p.db_record.AlbumID = album.ID
+	p.db_record.AlbumName = p.info.Album
 	return nil
 }
 
 func (p *audioProcessor) coverArtS3Key() string {
-	coverArtPathSplit := strings.Split(uploadCfg.CoverArtPath, string(os.PathSeparator))
+	coverArtPathSplit := strings.Split(p.cfg.CoverArtPath, string(os.PathSeparator))
 	// last trim suffix for sanity check
 	return fmt.Sprintf("%s/%s/%s", p.info.Artist, p.info.Album, strings.TrimSuffix(coverArtPathSplit[len(coverArtPathSplit)-1], string(os.PathSeparator)))
 }
 func (p *audioProcessor) upload() error {
-	if !viper.IsSet(internal.S3_BUCKET_NAME) {
-		return fmt.Errorf("s3 bucket name is not set")
-	}
 	vocals, err := os.ReadDir(p.paths.segments.vocal)
 	if err != nil {
 		return fmt.Errorf("failed to read vocal segments directory: %w", err)
@@ -624,6 +797,33 @@ func (p *audioProcessor) upload() error {
 	if err != nil {
 		return fmt.Errorf("failed to read instrumental segments directory: %w", err)
 	}
+	var total int64
+	sizes := func(files []os.DirEntry) error {
+		for _, file := range files {
+			info, err := file.Info()
+			if err != nil {
+				return fmt.Errorf("failed to stat segment file %s: %w", file.Name(), err)
+			}
+			total += info.Size()
+		}
+		return nil
+	}
+	if !p.cfg.IsInstrumental {
+		if err := sizes(vocals); err != nil {
+			return err
+		}
+	}
+	if err := sizes(instrumentals); err != nil {
+		return err
+	}
+	var coverArtBytes []byte
+	if p.conditions.shouldUploadCoverArt {
+		coverArtBytes, err = os.ReadFile(p.cfg.CoverArtPath)
+		if err != nil {
+			return fmt.Errorf("failed to read cover art file: %w", err)
+		}
+		total += int64(len(coverArtBytes))
+	}
 	uploadSegments := func(s3Folder string, files []os.DirEntry) error {
 		for _, segment := range files {
 			var s3path = fmt.Sprintf("%s/%s/%s/%s/%s", p.info.Artist, p.info.Album, p.info.Title, s3Folder, segment.Name())
@@ -634,20 +834,21 @@ func (p *audioProcessor) upload() error {
 				segmentBytes, err = os.ReadFile(fmt.Sprintf("%s/%s", strings.TrimSuffix(p.paths.segments.vocal, string(os.PathSeparator)), segment.Name()))
 			} else {
 				p.paths.segments.s3.instrumental = s3path
-				p.db_record.InstrumentalFolderPath = pgtype.Text{String: s3path, Valid: true}
+				p.db_record.InstrumentalFolderPath = s3path
 				segmentBytes, err = os.ReadFile(fmt.Sprintf("%s/%s", strings.TrimSuffix(p.paths.segments.instrumental, string(os.PathSeparator)), segment.Name()))
 			}
 			if err != nil {
 				return fmt.Errorf("failed to read segment file: %w", err)
 			}
-			_, err = p.app.UploadObject(p.ctx, viper.GetString(internal.S3_BUCKET_NAME), s3path, segmentBytes)
+			err = p.app.Store.Put(p.ctx, s3path, segmentBytes)
 			if err != nil {
 				return fmt.Errorf("failed to upload segment to s3: %w", err)
 			}
+			p.emitUpload(int64(len(segmentBytes)), total)
 		}
 		return nil
 	}
-	if !uploadCfg.IsInstrumental {
+	if !p.cfg.IsInstrumental {
 		if err := uploadSegments("vocal", vocals); err != nil {
 			return fmt.Errorf("failed to upload vocal segments: %w", err)
 		}
@@ -656,14 +857,11 @@ func (p *audioProcessor) upload() error {
 		return fmt.Errorf("failed to upload instrumental segments: %w", err)
 	}
 	if p.conditions.shouldUploadCoverArt {
-		coverArtBytes, err := os.ReadFile(uploadCfg.CoverArtPath)
-		if err != nil {
-			return fmt.Errorf("failed to read cover art file: %w", err)
-		}
-		_, err = p.app.UploadObject(p.ctx, viper.GetString(internal.S3_BUCKET_NAME), p.coverArtS3Key(), coverArtBytes)
+		err = p.app.Store.Put(p.ctx, p.coverArtS3Key(), coverArtBytes)
 		if err != nil {
 			return fmt.Errorf("failed to upload cover art to s3: %w", err)
 		}
+		p.emitUpload(int64(len(coverArtBytes)), total)
 	}
 	return nil
 }
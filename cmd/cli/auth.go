@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+	"github.com/caner-cetin/strafe/pkg/server/endpoints"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+type AuthLoginConfig struct {
+	Server   string
+	Username string
+}
+
+var (
+	authCmd = &cobra.Command{
+		Use:   "auth",
+		Short: "log in to a strafe server and manage its users",
+	}
+	authLoginCmd = &cobra.Command{
+		Use:   "login",
+		Short: "exchange the username and password for a token that is stored for calling the server",
+		Run:   WrapCommandWithResources(login, ResourceConfig{}),
+	}
+	authLoginCfg  = AuthLoginConfig{}
+	authLogoutCmd = &cobra.Command{
+		Use:   "logout",
+		Short: "revoke the stored token and remove it",
+		Run:   WrapCommandWithResources(logout, ResourceConfig{}),
+	}
+	authWhoamiCmd = &cobra.Command{
+		Use:   "whoami",
+		Short: "print the user the stored token belongs to",
+		Run:   WrapCommandWithResources(whoami, ResourceConfig{}),
+	}
+	authUserCmd = &cobra.Command{
+		Use:   "user",
+		Short: "manage users of the database",
+	}
+	authUserAddCmd = &cobra.Command{
+		Use:   "add [username]",
+		Short: "add a user, credentials.username and credentials.password are used if not given",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   WrapCommandWithResources(addUser, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	authUserPasswdCmd = &cobra.Command{
+		Use:   "passwd <username>",
+		Short: "change the password of the user and revoke their tokens",
+		Args:  cobra.ExactArgs(1),
+		Run:   WrapCommandWithResources(changePassword, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	authUserListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list users",
+		Run:   WrapCommandWithResources(listUsers, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+)
+
+func getAuthRootCmd() *cobra.Command {
+	authLoginCmd.PersistentFlags().StringVar(&authLoginCfg.Server, "server", "", "url of the strafe server, remote.url by default")
+	authLoginCmd.PersistentFlags().StringVarP(&authLoginCfg.Username, "username", "u", "", "credentials.username by default")
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authLogoutCmd)
+	authCmd.AddCommand(authWhoamiCmd)
+	authUserCmd.AddCommand(authUserAddCmd)
+	authUserCmd.AddCommand(authUserPasswdCmd)
+	authUserCmd.AddCommand(authUserListCmd)
+	authCmd.AddCommand(authUserCmd)
+	return authCmd
+}
+
+func login(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	var server = authLoginCfg.Server
+	if server == "" {
+		server = viper.GetString(internal.REMOTE_URL)
+	}
+	if server == "" {
+		log.Error().Msgf("--server is required when %s is not set", internal.REMOTE_URL)
+		return
+	}
+	server = strings.TrimSuffix(server, "/")
+	var username = authLoginCfg.Username
+	if username == "" {
+		username = viper.GetString(internal.CREDENTIALS_USERNAME)
+	}
+	if username == "" {
+		log.Error().Msgf("--username is required when %s is not set", internal.CREDENTIALS_USERNAME)
+		return
+	}
+	password := viper.GetString(internal.CREDENTIALS_PASSWORD)
+	if password == "" || authLoginCfg.Username != "" && authLoginCfg.Username != viper.GetString(internal.CREDENTIALS_USERNAME) {
+		var err error
+		if password, err = readPassword(fmt.Sprintf("password of %s: ", username)); err != nil {
+			log.Error().Err(err).Msg("failed to read password")
+			return
+		}
+	}
+	hostname, _ := os.Hostname()
+	body, err := json.Marshal(endpoints.IssueTokenRequest{Username: username, Password: password, Name: "strafe cli on " + hostname})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to encode login request")
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server+"/auth/token", bytes.NewReader(body))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create login request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var token endpoints.TokenResponse
+	if err := doRemote(req, http.StatusCreated, &token); err != nil {
+		log.Error().Err(err).Str("server", server).Msg("failed to log in")
+		return
+	}
+	var credentials = internal.RemoteCredentials{Server: server, Username: token.User.Username, Token: token.Token, ExpiresAt: token.ExpiresAt}
+	if err := internal.SaveRemoteCredentials(credentials); err != nil {
+		log.Error().Err(err).Msg("failed to store token")
+		return
+	}
+	event := log.Info().Str("server", server).Str("user", token.User.Username)
+	if token.ExpiresAt != nil {
+		event = event.Time("expires_at", *token.ExpiresAt)
+	}
+	event.Msg("logged in")
+}
+
+func logout(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	credentials, err := internal.LoadRemoteCredentials()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load stored token")
+		return
+	}
+	req, err := credentials.NewRequest(ctx, http.MethodDelete, "/auth/token", nil)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create logout request")
+		return
+	}
+	// the token is removed either way, a token the server does not know anymore is useless
+	if err := doRemote(req, http.StatusNoContent, nil); err != nil {
+		log.Warn().Err(err).Str("server", credentials.Server).Msg("failed to revoke token")
+	}
+	if err := internal.RemoveRemoteCredentials(); err != nil {
+		log.Error().Err(err).Msg("failed to remove stored token")
+		return
+	}
+	log.Info().Str("server", credentials.Server).Msg("logged out")
+}
+
+func whoami(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	credentials, err := internal.LoadRemoteCredentials()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load stored token")
+		return
+	}
+	req, err := credentials.NewRequest(ctx, http.MethodGet, "/auth/me", nil)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create request")
+		return
+	}
+	var user internal.User
+	if err := doRemote(req, http.StatusOK, &user); err != nil {
+		log.Error().Err(err).Str("server", credentials.Server).Msg("failed to get user")
+		return
+	}
+	fmt.Printf("%s on %s\n", user.Username, credentials.Server)
+}
+
+func addUser(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var (
+		username = viper.GetString(internal.CREDENTIALS_USERNAME)
+		password = viper.GetString(internal.CREDENTIALS_PASSWORD)
+	)
+	if len(args) == 1 && args[0] != username {
+		username, password = args[0], ""
+	}
+	if strings.TrimSpace(username) == "" {
+		log.Error().Msgf("username is required when %s is not set", internal.CREDENTIALS_USERNAME)
+		return
+	}
+	if password == "" {
+		var err error
+		if password, err = readNewPassword(username); err != nil {
+			log.Error().Err(err).Msg("failed to read password")
+			return
+		}
+	}
+	hash, err := internal.HashPassword(password)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to hash password")
+		return
+	}
+	user, err := app.DB.CreateUser(ctx, db.CreateUserParams{Username: strings.TrimSpace(username), PasswordHash: hash})
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to add user")
+		return
+	}
+	log.Info().Str("username", user.Username).Str("id", user.ID).Msg("added user")
+}
+
+func changePassword(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	user, err := app.DB.GetUserByUsername(ctx, args[0])
+	if err != nil {
+		log.Error().Err(err).Str("username", args[0]).Msg("failed to get user")
+		return
+	}
+	password, err := readNewPassword(user.Username)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read password")
+		return
+	}
+	hash, err := internal.HashPassword(password)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to hash password")
+		return
+	}
+	tx, err := app.Conn.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to begin transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := app.DB.WithTx(tx)
+	if _, err := qtx.SetUserPassword(ctx, db.SetUserPasswordParams{ID: user.ID, PasswordHash: hash}); err != nil {
+		log.Error().Err(err).Msg("failed to change password")
+		return
+	}
+	revoked, err := qtx.DeleteUserAPITokens(ctx, user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to revoke tokens")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to commit transaction")
+		return
+	}
+	log.Info().Str("username", user.Username).Int64("revoked_tokens", revoked).Msg("changed password")
+}
+
+func listUsers(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	users, err := app.DB.ListUsers(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list users")
+		return
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.AppendHeader(table.Row{"Username", "Active Tokens", "Last Used", "Created"})
+	for _, user := range users {
+		var lastUsed string
+		if user.LastUsedAt.Valid {
+			lastUsed = user.LastUsedAt.Time.Format("2006-01-02 15:04")
+		}
+		t.AppendRow(table.Row{user.Username, user.ActiveTokens, lastUsed, user.CreatedAt.Time.Format("2006-01-02 15:04")})
+	}
+	t.Render()
+}
+
+// doRemote sends the request to the strafe server and decodes the json response into out unless it is nil,
+// responses other than the expected status are returned as errors with the message of the server
+func doRemote(req *http.Request, expected int, out any) error {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != expected {
+		var message internal.ErrorResponse
+		if err := json.NewDecoder(res.Body).Decode(&message); err != nil || message.Message == "" {
+			return fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, res.Status)
+		}
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, res.Status, message.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// readPassword reads the password without echoing it, or a line of stdin if it is not a terminal
+func readPassword(prompt string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
+
+func readNewPassword(username string) (string, error) {
+	password, err := readPassword(fmt.Sprintf("new password of %s: ", username))
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		confirmation, err := readPassword("repeat the password: ")
+		if err != nil {
+			return "", err
+		}
+		if confirmation != password {
+			return "", fmt.Errorf("passwords do not match")
+		}
+	}
+	return password, nil
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/fatih/color"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type BenchRandomConfig struct {
+	Runs      int
+	Synthetic int
+	Legacy    bool
+}
+
+var (
+	benchCmd = &cobra.Command{
+		Use:   "bench",
+		Short: "measure query latency",
+	}
+	benchRandomCmd = &cobra.Command{
+		Use:   "random",
+		Short: "measure the latency of random track selection, optionally on synthetic tracks that are rolled back afterwards",
+		Run:   WrapCommandWithResources(benchRandom, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	benchRandomCfg = BenchRandomConfig{}
+)
+
+type benchSelection struct {
+	name string
+	// listener the picks are recorded for, selections do not share a listening history
+	anonID string
+	pick   func(anonID string) (string, error)
+}
+
+func getBenchCmd() *cobra.Command {
+	benchRandomCmd.PersistentFlags().IntVarP(&benchRandomCfg.Runs, "runs", "n", 200, "number of picks to measure")
+	benchRandomCmd.PersistentFlags().IntVarP(&benchRandomCfg.Synthetic, "synthetic", "s", 0, "number of synthetic tracks to insert before measuring, e.g. 100000")
+	benchRandomCmd.PersistentFlags().BoolVar(&benchRandomCfg.Legacy, "legacy", true, "also measure the ORDER BY RANDOM() selection random_key replaced")
+	benchCmd.AddCommand(benchRandomCmd)
+	return benchCmd
+}
+
+// benchRandom runs everything in a transaction that is rolled back, synthetic tracks and the listening
+// history of the picks are never committed
+func benchRandom(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	tx, err := app.Conn.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to begin transaction")
+		return
+	}
+	defer tx.Rollback(context.Background())
+	qtx := app.DB.WithTx(tx)
+	if benchRandomCfg.Synthetic > 0 {
+		seedStart := time.Now()
+		if err := db.SeedBenchmarkTracks(ctx, tx, benchRandomCfg.Synthetic); err != nil {
+			log.Error().Err(err).Msg("failed to insert synthetic tracks")
+			return
+		}
+		log.Info().Int("tracks", benchRandomCfg.Synthetic).Dur("took", time.Since(seedStart)).Msg("inserted synthetic tracks")
+	}
+	count, err := qtx.GetTrackCount(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to count tracks")
+		return
+	}
+	if count == 0 {
+		fmt.Println(color.YellowString("library is empty, use --synthetic to measure on synthetic tracks"))
+		return
+	}
+
+	// every pick is recorded like the server does, later picks skip more listened tracks.
+	// the runs are capped so that every pick finds an unlistened track.
+	var runs = min(benchRandomCfg.Runs, int(count))
+	var selections = []benchSelection{
+		{"random_key", fmt.Sprintf("strafe-bench-%d", time.Now().UnixNano()), func(anonID string) (string, error) {
+			track, err := qtx.PickRandomUnlistenedTrack(ctx, db.GetRandomUnlistenedTrackParams{AnonID: anonID})
+			return track.ID, err
+		}},
+	}
+	if benchRandomCfg.Legacy {
+		selections = append(selections, benchSelection{"order by random()", fmt.Sprintf("strafe-bench-legacy-%d", time.Now().UnixNano()), func(anonID string) (string, error) {
+			return db.OrderByRandomUnlistenedTrack(ctx, tx, anonID)
+		}})
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.SetTitle(fmt.Sprintf("%d picks from %d tracks", runs, count))
+	t.AppendHeader(table.Row{"Selection", "p50", "p95", "p99", "Max", "Mean"})
+	for _, selection := range selections {
+		latencies := make([]time.Duration, 0, runs)
+		for range runs {
+			start := time.Now()
+			trackID, err := selection.pick(selection.anonID)
+			if err != nil {
+				log.Error().Err(err).Str("selection", selection.name).Msg("failed to pick a random track")
+				return
+			}
+			latencies = append(latencies, time.Since(start))
+			err = qtx.RecordListeningHistory(ctx, db.RecordListeningHistoryParams{
+				TrackID:    trackID,
+				AnonID:     selection.anonID,
+				ListenedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("failed to record listening history")
+				return
+			}
+		}
+		slices.Sort(latencies)
+		var total time.Duration
+		for _, latency := range latencies {
+			total += latency
+		}
+		t.AppendRow(table.Row{
+			selection.name,
+			percentile(latencies, 0.50),
+			percentile(latencies, 0.95),
+			percentile(latencies, 0.99),
+			latencies[len(latencies)-1],
+			total / time.Duration(len(latencies)),
+		})
+	}
+	t.Render()
+}
+
+// percentile of sorted latencies, nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	index := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[max(0, min(index, len(sorted)-1))]
+}
@@ -65,6 +65,20 @@ func displayConfig(cmd *cobra.Command, args []string) {
 		secretColor.Sprint(password),
 	})
 
+	section = sectionColor.Sprint("Remote")
+	table.Append([]string{
+		section,
+		keyColor.Sprint("URL"),
+		valueColor.Sprint(viper.GetString(internal.REMOTE_URL)),
+	})
+	if path, err := internal.RemoteCredentialsPath(); err == nil {
+		table.Append([]string{
+			"",
+			keyColor.Sprint("Token File"),
+			valueColor.Sprint(path),
+		})
+	}
+
 	section = sectionColor.Sprint("Docker")
 	table.Append([]string{
 		section,
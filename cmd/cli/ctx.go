@@ -15,7 +15,7 @@ type ResourceType int
 const (
 	ResourceDatabase ResourceType = iota
 	ResourceDocker
-	ResourceS3
+	ResourceStorage
 )
 
 type ResourceConfig struct {
@@ -48,9 +48,9 @@ func WrapCommandWithResources(fn func(cmd *cobra.Command, args []string), config
 					log.Error().Err(err).Msg("failed to initialize docker")
 					return
 				}
-			case ResourceS3:
-				if err := appCtx.InitializeS3(); err != nil {
-					log.Error().Err(err).Msg("failed to initialize s3")
+			case ResourceStorage:
+				if err := appCtx.InitializeStorage(); err != nil {
+					log.Error().Err(err).Msg("failed to initialize storage")
 					return
 				}
 			}
@@ -58,10 +58,7 @@ func WrapCommandWithResources(fn func(cmd *cobra.Command, args []string), config
 		}
 		defer func() {
 			if appCtx.Conn != nil {
-				if err := appCtx.Conn.Close(ctx); err != nil {
-					log.Error().Err(err).Msg("failed to close database connection")
-					return
-				}
+				appCtx.Conn.Close()
 			}
 			if appCtx.Docker != nil {
 				if err := appCtx.Docker.Close(); err != nil {
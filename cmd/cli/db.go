@@ -5,16 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"image"
+	"os"
 	"strings"
 
 	"github.com/caner-cetin/strafe/internal"
 	"github.com/caner-cetin/strafe/pkg/db"
 
+	"github.com/fatih/color"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jedib0t/go-pretty/table"
 	"github.com/qeesung/image2ascii/convert"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
@@ -39,17 +41,67 @@ var (
 	searchAlbumCmd = &cobra.Command{
 		Use:   "album",
 		Short: "search album",
-		Run:   WrapCommandWithResources(searchAlbum, ResourceConfig{Resources: []ResourceType{ResourceDatabase, ResourceS3}}),
+		Run:   WrapCommandWithResources(searchAlbum, ResourceConfig{Resources: []ResourceType{ResourceDatabase, ResourceStorage}}),
 	}
 	searchAlbumCfg = SearchAlbumConfig{}
 )
 
+// SearchTrackConfig contains configuration for track search operations
+type SearchTrackConfig struct {
+	Limit int32
+}
+
+var (
+	searchTrackCmd = &cobra.Command{
+		Use:   "track <query>",
+		Short: "search tracks by title, artist, album and genre, tolerates typos and partially typed words",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   WrapCommandWithResources(searchTrack, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	searchTrackCfg = SearchTrackConfig{}
+)
+
+var (
+	checkCmd = &cobra.Command{
+		Use:   "check",
+		Short: "report rows that violate the foreign keys, uniqueness and NOT NULL constraints before migrating",
+		Run:   WrapCommandWithResources(checkConstraints, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "apply pending database migrations",
+		Run:   WrapCommandWithResources(migrateDatabase, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	backfillCmd = &cobra.Command{
+		Use:   "backfill",
+		Short: "recalculate derived columns for existing records",
+	}
+	backfillAlbumsCmd = &cobra.Command{
+		Use:   "albums",
+		Short: "recalculate track count, total duration, disc count, year and genre of every album",
+		Run:   WrapCommandWithResources(backfillAlbums, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+)
+
 func getDBRootCmd() *cobra.Command {
 	searchAlbumCmd.PersistentFlags().StringVarP(&searchAlbumCfg.Artist, "artist", "a", "", "artist name")
 	searchAlbumCmd.PersistentFlags().StringVarP(&searchAlbumCfg.Name, "name", "n", "", "album name")
 	searchCmd.AddCommand(searchAlbumCmd)
+	searchTrackCmd.PersistentFlags().Int32VarP(&searchTrackCfg.Limit, "limit", "l", 20, "maximum number of tracks to list")
+	searchCmd.AddCommand(searchTrackCmd)
+	backfillCmd.AddCommand(backfillAlbumsCmd)
+	backfillCmd.AddCommand(backfillArtistsCmd)
 
 	dbCmd.AddCommand(searchCmd)
+	dbCmd.AddCommand(backfillCmd)
+	dbCmd.AddCommand(checkCmd)
+	dbCmd.AddCommand(migrateCmd)
+	dbCmd.AddCommand(getArtistCmd())
+	dbCmd.AddCommand(getStatsCmd())
+	dbCmd.AddCommand(getBenchCmd())
+	dbCmd.AddCommand(getPlaylistCmd())
+	dbCmd.AddCommand(getLyricsCmd())
+	dbCmd.AddCommand(getLibraryCmds()...)
 	return dbCmd
 }
 
@@ -65,12 +117,12 @@ func searchAlbum(cmd *cobra.Command, args []string) {
 	case artistSet && nameSet:
 		album, err = app.DB.GetAlbumByNameAndArtist(ctx,
 			db.GetAlbumByNameAndArtistParams{
-				Artist: pgtype.Text{String: searchAlbumCfg.Artist, Valid: true},
-				Name:   pgtype.Text{String: searchAlbumCfg.Name, Valid: true}})
+				Artist: searchAlbumCfg.Artist,
+				Name:   searchAlbumCfg.Name})
 	case artistSet:
-		album, err = app.DB.GetAlbumByArtist(ctx, pgtype.Text{String: searchAlbumCfg.Artist, Valid: true})
+		album, err = app.DB.GetAlbumByArtist(ctx, searchAlbumCfg.Artist)
 	case nameSet:
-		album, err = app.DB.GetAlbumByName(ctx, pgtype.Text{String: searchAlbumCfg.Name, Valid: true})
+		album, err = app.DB.GetAlbumByName(ctx, searchAlbumCfg.Name)
 	default:
 		log.Error().Msg("album artist or name must be specified for search")
 		return
@@ -79,7 +131,7 @@ func searchAlbum(cmd *cobra.Command, args []string) {
 		log.Error().Err(err).Msg("failed to get album")
 		return
 	}
-	coverArtBytes, err := app.DownloadFile(ctx, viper.GetString(internal.S3_BUCKET_NAME), album.Cover.String)
+	coverArtBytes, err := app.Store.Get(ctx, album.Cover.String)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to download cover art")
 		return
@@ -105,12 +157,12 @@ func searchAlbum(cmd *cobra.Command, args []string) {
 	spacing := "    "
 
 	fmt.Print(asciiLines[0] + "\n")
-	fmt.Print(asciiLines[1] + spacing + "Name: " + album.Name.String + "\n")
-	fmt.Print(asciiLines[2] + spacing + "Artist: " + album.Artist.String + "\n")
-	fmt.Print(asciiLines[3] + "\n")
+	fmt.Print(asciiLines[1] + spacing + "Name: " + album.Name + "\n")
+	fmt.Print(asciiLines[2] + spacing + "Artist: " + album.Artist + "\n")
+	fmt.Print(asciiLines[3] + spacing + albumDetails(album) + "\n")
 	fmt.Print(asciiLines[4] + spacing + "Tracks:\n")
 	var trackLine = 5
-	tracks, err := app.DB.GetTracksByAlbumId(ctx, pgtype.Text{String: album.ID, Valid: true})
+	tracks, err := app.DB.GetTracksByAlbumId(ctx, album.ID)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get tracks")
 		return
@@ -159,3 +211,106 @@ func searchAlbum(cmd *cobra.Command, args []string) {
 	}
 
 }
+
+func searchTrack(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	term := strings.Join(args, " ")
+	prefixQuery := internal.PrefixTSQuery(term)
+	if prefixQuery == "" {
+		log.Error().Str("query", term).Msg("query must contain at least one letter or number")
+		return
+	}
+	tracks, err := app.DB.SearchTracks(ctx, db.SearchTracksParams{PrefixQuery: prefixQuery, Term: term, ResultLimit: searchTrackCfg.Limit})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to search tracks")
+		return
+	}
+	if len(tracks) == 0 {
+		fmt.Println(color.YellowString("no tracks found"))
+		return
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.AppendHeader(table.Row{"ID", "Title", "Artist", "Album", "Length", "Rank"})
+	for _, track := range tracks {
+		var trackInfo internal.ExifInfo
+		if err := json.Unmarshal(track.Info, &trackInfo); err != nil {
+			log.Error().Err(err).Str("track_id", track.ID).Msg("failed to parse track info")
+			return
+		}
+		seconds, _ := track.TotalDuration.Float64Value()
+		t.AppendRow(table.Row{
+			track.ID,
+			trackInfo.Title,
+			trackInfo.Artist,
+			track.AlbumName,
+			fmt.Sprintf("%d:%02d", int(seconds.Float64/60), int(seconds.Float64)%60),
+			fmt.Sprintf("%.3f", track.Rank),
+		})
+	}
+	t.Render()
+}
+
+// year, genre, track count and total duration of the album in a single line
+func albumDetails(album db.Album) string {
+	var details []string
+	if album.Year.Valid {
+		details = append(details, fmt.Sprintf("%d", album.Year.Int32))
+	}
+	if album.Genre.Valid {
+		details = append(details, album.Genre.String)
+	}
+	details = append(details, fmt.Sprintf("%d tracks", album.TrackCount))
+	if album.DiscCount > 1 {
+		details = append(details, fmt.Sprintf("%d discs", album.DiscCount))
+	}
+	seconds, _ := album.TotalDuration.Float64Value()
+	details = append(details, fmt.Sprintf("%d:%02d", int(seconds.Float64/60), int(seconds.Float64)%60))
+	return strings.Join(details, " · ")
+}
+
+func backfillAlbums(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	count, err := app.DB.RefreshAllAlbumStats(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to refresh album stats")
+		return
+	}
+	fmt.Printf("refreshed %d albums\n", count)
+}
+
+func checkConstraints(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	violations, err := db.CheckConstraints(ctx, app.StdDB)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to check constraints")
+		return
+	}
+	if len(violations) == 0 {
+		fmt.Println(color.GreenString("no violations found"))
+		return
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.AppendHeader(table.Row{"Check", "Table", "Row", "Detail"})
+	for _, v := range violations {
+		t.AppendRow(table.Row{v.Check, v.Table, v.Row, v.Detail})
+	}
+	t.Render()
+	fmt.Println(color.RedString("%d rows must be fixed before migration %d can be applied", len(violations), db.SchemaHardeningVersion))
+}
+
+func migrateDatabase(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	if err := db.Migrate(app.StdDB); err != nil {
+		log.Error().Err(err).Msg("failed to migrate database")
+		return
+	}
+	fmt.Println(color.GreenString("database is up to date"))
+}
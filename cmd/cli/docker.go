@@ -23,6 +23,7 @@ import (
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/fatih/color"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -266,6 +267,63 @@ func startContainer(ctx context.Context, resp *container.CreateResponse, id *str
 	return nil
 }
 
+// runScript runs the bash script in a container of the strafe image and writes its output to out.
+// the directories are mounted at the same path, the script must only read and write files under them.
+func runScript(ctx context.Context, docker *client.Client, script string, out io.Writer, dirs ...string) error {
+	scriptFile, err := os.CreateTemp(dirs[0], "strafe-script-*.sh")
+	if err != nil {
+		return fmt.Errorf("failed to create script file: %w", err)
+	}
+	defer os.Remove(scriptFile.Name())
+	if _, err := io.WriteString(scriptFile, script); err != nil {
+		scriptFile.Close()
+		return fmt.Errorf("failed to write script file: %w", err)
+	}
+	scriptFile.Close()
+	var mounts = make([]mount.Mount, 0, len(dirs))
+	for _, dir := range dirs {
+		mounts = append(mounts, mount.Mount{Type: mount.TypeBind, Source: dir, Target: dir})
+	}
+	resp, err := docker.ContainerCreate(ctx, &container.Config{
+		Image:        getImageTag(),
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+		Cmd:          []string{"/bin/bash", "-e", scriptFile.Name()},
+	}, &container.HostConfig{Mounts: mounts}, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	defer func() {
+		// removed even if the run was cancelled
+		if err := removeContainer(context.WithoutCancel(ctx), &resp, nil, docker); err != nil {
+			log.Error().Err(err).Msg("failed to remove container")
+		}
+	}()
+	if err := startContainer(ctx, &resp, nil, docker); err != nil {
+		return err
+	}
+	logs, err := docker.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return fmt.Errorf("failed to get container logs: %w", err)
+	}
+	defer logs.Close()
+	go stdcopy.StdCopy(out, out, logs)
+	statusCh, errCh := docker.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("error waiting for container: %w", err)
+	case status := <-statusCh:
+		if status.Error != nil {
+			return fmt.Errorf("container exited with status %d: %s", status.StatusCode, status.Error.Message)
+		}
+		if status.StatusCode != 0 {
+			return fmt.Errorf("container exited with status %d", status.StatusCode)
+		}
+	}
+	return nil
+}
+
 func healthImage(cmd *cobra.Command, args []string) {
 	ctx := cmd.Context()
 	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
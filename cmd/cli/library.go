@@ -0,0 +1,1260 @@
+package cli
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	libraryConflictSkip      = "skip"
+	libraryConflictOverwrite = "overwrite"
+	libraryConflictFail      = "fail"
+	// rows read from and written to the database at once
+	libraryBatch = 1000
+	// rows are read in id order after this id
+	libraryFirstID = "00000000-0000-0000-0000-000000000000"
+)
+
+type LibraryExportConfig struct {
+	Output string
+	// segments, playlists and covers of the tracks are written to the archive
+	Objects bool
+}
+
+type LibraryImportConfig struct {
+	// what happens to records and objects that already exist, one of the libraryConflict constants
+	OnConflict string
+	// the import is checked and rolled back, objects are not written
+	DryRun bool
+}
+
+var (
+	libraryExportCmd = &cobra.Command{
+		Use:   "export -o library.tar",
+		Short: "write albums, artists, tracks, lyrics and listening history to a portable archive",
+		Long: `write albums, artists, tracks, lyrics and listening history to a portable archive.
+
+the archive is a tar file with a manifest.json and a JSON record on every line of a file for every table, read from a
+single snapshot of the database. with --objects the segments, playlists and covers of the tracks are stored under
+objects/ with their keys as paths, otherwise the archive only points to the objects of the bucket.`,
+		Run: WrapCommandWithResources(exportLibrary, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	libraryExportCfg = LibraryExportConfig{}
+	libraryImportCmd = &cobra.Command{
+		Use:   "import <library.tar>",
+		Short: "restore an archive written by strafe db export into the database and the bucket",
+		Long: `restore an archive written by strafe db export into the database and the bucket, run strafe db migrate first.
+
+albums and artists with the same name as an existing album or artist of another id are merged into the existing one.
+records with an id that already exists are kept with --on-conflict skip, replaced with overwrite and stop the import
+with fail, and the same goes for objects with the same key. listening history and play events that are already
+stored are never imported twice.
+
+everything is imported in a single transaction, which is only committed after the rows that were written are read
+back and compared with the archive. objects are written under imports/ of the bucket first and only moved to their
+keys after the commit, an import that fails leaves the objects of the bucket as they were.`,
+		Args: cobra.ExactArgs(1),
+		Run:  WrapCommandWithResources(importLibrary, ResourceConfig{Resources: []ResourceType{ResourceDatabase, ResourceStorage}}),
+	}
+	libraryImportCfg = LibraryImportConfig{}
+)
+
+func getLibraryCmds() []*cobra.Command {
+	libraryExportCmd.PersistentFlags().StringVarP(&libraryExportCfg.Output, "output", "o", "library.tar", "archive to write")
+	libraryExportCmd.PersistentFlags().BoolVar(&libraryExportCfg.Objects, "objects", false, "include segments, playlists and covers from the bucket")
+	libraryImportCmd.PersistentFlags().StringVar(&libraryImportCfg.OnConflict, "on-conflict", libraryConflictSkip, "skip keeps, overwrite replaces and fail refuses records and objects that already exist")
+	libraryImportCmd.PersistentFlags().BoolVar(&libraryImportCfg.DryRun, "dry-run", false, "check the archive and report what would be imported, nothing is written")
+	return []*cobra.Command{libraryExportCmd, libraryImportCmd}
+}
+
+// librarySpool collects the records of a table in a temporary file, the manifest is written before the tables
+// and needs their row counts and checksums
+type librarySpool struct {
+	file    *os.File
+	hash    hash.Hash
+	encoder *json.Encoder
+	rows    int64
+}
+
+func newLibrarySpool(dir string, libraryTable internal.LibraryTable) (*librarySpool, error) {
+	file, err := os.Create(filepath.Join(dir, libraryTable.FileName()))
+	if err != nil {
+		return nil, err
+	}
+	spool := &librarySpool{file: file, hash: sha256.New()}
+	spool.encoder = json.NewEncoder(io.MultiWriter(file, spool.hash))
+	return spool, nil
+}
+
+func (s *librarySpool) write(record any) error {
+	s.rows++
+	return s.encoder.Encode(record)
+}
+
+func exportLibrary(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	// the bucket is only needed for the objects
+	if libraryExportCfg.Objects {
+		if err := app.InitializeStorage(); err != nil {
+			log.Error().Err(err).Msg("failed to initialize storage")
+			return
+		}
+	}
+	dir, err := os.MkdirTemp("", "strafe-export-*")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create temporary directory")
+		return
+	}
+	defer os.RemoveAll(dir)
+	var spools = make(map[internal.LibraryTable]*librarySpool, len(internal.LibraryTables))
+	for _, libraryTable := range internal.LibraryTables {
+		spool, err := newLibrarySpool(dir, libraryTable)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to create temporary file")
+			return
+		}
+		defer spool.file.Close()
+		spools[libraryTable] = spool
+	}
+
+	// rows added while exporting are either in every table or in none
+	tx, err := app.Conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to begin transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+	keys, err := exportLibraryTables(ctx, app.DB.WithTx(tx), spools)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to export library")
+		return
+	}
+	var objects []internal.ObjectInfo
+	if libraryExportCfg.Objects {
+		if objects, err = listLibraryObjects(ctx, app.Store, keys); err != nil {
+			log.Error().Err(err).Msg("failed to list objects")
+			return
+		}
+	}
+
+	var manifest = internal.LibraryManifest{
+		Format:    internal.LibraryFormat,
+		Version:   internal.LibraryVersion,
+		CreatedAt: time.Now().UTC(),
+		Tables:    make(map[internal.LibraryTable]internal.LibraryFile, len(spools)),
+		Objects:   internal.LibraryObjects{Included: libraryExportCfg.Objects, Count: int64(len(objects))},
+	}
+	for libraryTable, spool := range spools {
+		manifest.Tables[libraryTable] = internal.LibraryFile{Name: libraryTable.FileName(), Rows: spool.rows, SHA256: hex.EncodeToString(spool.hash.Sum(nil))}
+	}
+	for _, object := range objects {
+		manifest.Objects.Bytes += object.Size
+	}
+	if err := writeLibraryArchive(ctx, app.Store, libraryExportCfg.Output, manifest, spools, objects); err != nil {
+		os.Remove(libraryExportCfg.Output)
+		log.Error().Err(err).Msg("failed to write archive")
+		return
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.AppendHeader(table.Row{"Table", "Rows"})
+	for _, libraryTable := range internal.LibraryTables {
+		t.AppendRow(table.Row{libraryTable, manifest.Tables[libraryTable].Rows})
+	}
+	if manifest.Objects.Included {
+		t.AppendFooter(table.Row{"objects", fmt.Sprintf("%d (%.1f MB)", manifest.Objects.Count, float64(manifest.Objects.Bytes)/(1<<20))})
+	}
+	t.Render()
+	fmt.Printf("library written to %s\n", libraryExportCfg.Output)
+}
+
+// exportLibraryTables writes every table to its spool and returns the covers and track folders the rows reference
+func exportLibraryTables(ctx context.Context, q *db.Queries, spools map[internal.LibraryTable]*librarySpool) ([]string, error) {
+	var keys []string
+	for after := libraryFirstID; ; {
+		albums, err := q.ExportAlbums(ctx, db.ExportAlbumsParams{AfterID: after, ResultLimit: libraryBatch})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export albums: %w", err)
+		}
+		for _, album := range albums {
+			if album.Cover.Valid {
+				keys = append(keys, album.Cover.String)
+			}
+			if err := spools[internal.LibraryTableAlbums].write(libraryAlbum(album)); err != nil {
+				return nil, err
+			}
+		}
+		if len(albums) < libraryBatch {
+			break
+		}
+		after = albums[len(albums)-1].ID
+	}
+
+	for after := libraryFirstID; ; {
+		artists, err := q.ExportArtists(ctx, db.ExportArtistsParams{AfterID: after, ResultLimit: libraryBatch})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export artists: %w", err)
+		}
+		for _, artist := range artists {
+			if err := spools[internal.LibraryTableArtists].write(libraryArtist(artist)); err != nil {
+				return nil, err
+			}
+		}
+		if len(artists) < libraryBatch {
+			break
+		}
+		after = artists[len(artists)-1].ID
+	}
+
+	// credits and lyrics are read for every page of tracks
+	for after := libraryFirstID; ; {
+		tracks, err := q.ExportTracks(ctx, db.ExportTracksParams{AfterID: after, ResultLimit: libraryBatch})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export tracks: %w", err)
+		}
+		var trackIDs = make([]string, 0, len(tracks))
+		for _, track := range tracks {
+			trackIDs = append(trackIDs, track.ID)
+			keys = append(keys, libraryFolderPrefix(track.InstrumentalFolderPath))
+			if track.VocalFolderPath.Valid {
+				keys = append(keys, libraryFolderPrefix(track.VocalFolderPath.String))
+			}
+			if err := spools[internal.LibraryTableTracks].write(libraryTrack(track)); err != nil {
+				return nil, err
+			}
+		}
+		credits, err := q.ExportTrackArtists(ctx, trackIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export track artists: %w", err)
+		}
+		for _, credit := range credits {
+			if err := spools[internal.LibraryTableTrackArtists].write(libraryTrackArtist(credit)); err != nil {
+				return nil, err
+			}
+		}
+		lyrics, err := q.ExportLyrics(ctx, trackIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export lyrics: %w", err)
+		}
+		for _, lyric := range lyrics {
+			if err := spools[internal.LibraryTableLyrics].write(libraryLyrics(lyric)); err != nil {
+				return nil, err
+			}
+		}
+		if len(tracks) < libraryBatch {
+			break
+		}
+		after = tracks[len(tracks)-1].ID
+	}
+
+	var afterListen = db.ExportListeningHistoriesParams{
+		AfterListenedAt: pgtype.Timestamptz{InfinityModifier: pgtype.NegativeInfinity, Valid: true},
+		AfterTrackID:    libraryFirstID,
+		ResultLimit:     libraryBatch,
+	}
+	for {
+		listens, err := q.ExportListeningHistories(ctx, afterListen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export listening history: %w", err)
+		}
+		for _, listen := range listens {
+			record := internal.LibraryListen{TrackID: listen.TrackID, AnonID: listen.AnonID, ListenedAt: listen.ListenedAt.Time}
+			if err := spools[internal.LibraryTableListeningHistories].write(record); err != nil {
+				return nil, err
+			}
+		}
+		if len(listens) < libraryBatch {
+			break
+		}
+		last := listens[len(listens)-1]
+		afterListen.AfterListenedAt, afterListen.AfterTrackID, afterListen.AfterAnonID = last.ListenedAt, last.TrackID, last.AnonID
+	}
+
+	for after := int64(0); ; {
+		events, err := q.ExportPlayEvents(ctx, db.ExportPlayEventsParams{AfterID: after, ResultLimit: libraryBatch})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export play events: %w", err)
+		}
+		for _, event := range events {
+			record := internal.LibraryPlayEvent{
+				TrackID:   event.TrackID,
+				AnonID:    event.AnonID,
+				Type:      string(event.EventType),
+				Position:  json.Number(event.Position),
+				Duration:  json.Number(event.Duration),
+				CreatedAt: event.CreatedAt.Time,
+			}
+			if err := spools[internal.LibraryTablePlayEvents].write(record); err != nil {
+				return nil, err
+			}
+		}
+		if len(events) < libraryBatch {
+			break
+		}
+		after = events[len(events)-1].ID
+	}
+	return keys, nil
+}
+
+// libraryAlbum and the functions below return the records of the rows, imports read back the rows they wrote and
+// compare them with the records of the archive. timestamps are written in UTC so that they compare equal regardless
+// of the time zone of the database session.
+func libraryAlbum(album db.ExportAlbumsRow) internal.LibraryAlbum {
+	record := internal.LibraryAlbum{
+		ID:                        album.ID,
+		Name:                      album.Name,
+		Artist:                    album.Artist,
+		Cover:                     textPointer(album.Cover),
+		Genre:                     textPointer(album.Genre),
+		CreatedAt:                 album.CreatedAt.Time.UTC(),
+		MusicBrainzReleaseID:      textPointer(album.MusicbrainzReleaseID),
+		MusicBrainzReleaseGroupID: textPointer(album.MusicbrainzReleaseGroupID),
+		CanonicalName:             textPointer(album.CanonicalName),
+		ReleaseDate:               textPointer(album.ReleaseDate),
+	}
+	if album.Year.Valid {
+		record.Year = &album.Year.Int32
+	}
+	return record
+}
+
+func libraryArtist(artist db.Artist) internal.LibraryArtist {
+	return internal.LibraryArtist{
+		ID:            artist.ID,
+		Name:          artist.Name,
+		SortName:      artist.SortName,
+		MatchName:     artist.MatchName,
+		Aliases:       artist.Aliases,
+		CreatedAt:     artist.CreatedAt.Time.UTC(),
+		MusicBrainzID: textPointer(artist.MusicbrainzID),
+	}
+}
+
+func libraryTrack(track db.ExportTracksRow) internal.LibraryTrack {
+	return internal.LibraryTrack{
+		ID:                     track.ID,
+		AlbumID:                track.AlbumID,
+		AlbumName:              track.AlbumName,
+		VocalFolderPath:        textPointer(track.VocalFolderPath),
+		InstrumentalFolderPath: track.InstrumentalFolderPath,
+		TotalDuration:          json.Number(track.TotalDuration),
+		Info:                   track.Info,
+		Instrumental:           track.Instrumental,
+		Tempo:                  json.Number(track.Tempo),
+		Key:                    track.Key,
+		VocalWaveform:          track.VocalWaveform,
+		InstrumentalWaveform:   track.InstrumentalWaveform,
+		MusicBrainzRecordingID: textPointer(track.MusicbrainzRecordingID),
+		CanonicalTitle:         textPointer(track.CanonicalTitle),
+		CreatedAt:              track.CreatedAt.Time.UTC(),
+	}
+}
+
+func libraryTrackArtist(credit db.TrackArtist) internal.LibraryTrackArtist {
+	return internal.LibraryTrackArtist{TrackID: credit.TrackID, ArtistID: credit.ArtistID, Role: string(credit.Role), Position: credit.Position}
+}
+
+func libraryLyrics(lyric db.Lyric) internal.LibraryLyrics {
+	return internal.LibraryLyrics{
+		TrackID:   lyric.TrackID,
+		Language:  textPointer(lyric.Language),
+		Plain:     lyric.Plain,
+		Synced:    lyric.Synced,
+		Source:    lyric.Source,
+		UpdatedAt: lyric.UpdatedAt.Time.UTC(),
+	}
+}
+
+// libraryFolderPrefix returns the prefix of the segments and the playlist of the stored folder path of a track
+func libraryFolderPrefix(folderPath string) string {
+	return path.Dir(internal.PlaylistKey(folderPath)) + "/"
+}
+
+// listLibraryObjects lists the objects under the given keys and prefixes, prefixes end with a slash
+func listLibraryObjects(ctx context.Context, store internal.ObjectStore, keys []string) ([]internal.ObjectInfo, error) {
+	var (
+		objects []internal.ObjectInfo
+		seen    = make(map[string]bool)
+		added   = make(map[string]bool)
+	)
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		listed, err := store.List(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var found bool
+		for _, object := range listed {
+			// covers are exact keys, other covers may start with the same key
+			if !strings.HasSuffix(key, "/") && object.Key != key {
+				continue
+			}
+			found = true
+			if !added[object.Key] {
+				added[object.Key] = true
+				objects = append(objects, object)
+			}
+		}
+		if !found {
+			log.Warn().Str("key", key).Msg("object is missing from the bucket, it is not in the archive")
+		}
+	}
+	return objects, nil
+}
+
+func writeLibraryArchive(ctx context.Context, store internal.ObjectStore, output string, manifest internal.LibraryManifest, spools map[internal.LibraryTable]*librarySpool, objects []internal.ObjectInfo) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive := tar.NewWriter(file)
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeLibraryEntry(archive, internal.LibraryManifestName, manifestBytes, manifest.CreatedAt); err != nil {
+		return err
+	}
+	for _, libraryTable := range internal.LibraryTables {
+		spool := spools[libraryTable]
+		size, err := spool.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err := spool.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		header := &tar.Header{Name: libraryTable.FileName(), Mode: 0o644, Size: size, ModTime: manifest.CreatedAt}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(archive, spool.file); err != nil {
+			return fmt.Errorf("failed to write %s: %w", libraryTable, err)
+		}
+	}
+	for i, object := range objects {
+		contents, err := store.Get(ctx, object.Key)
+		if err != nil {
+			return err
+		}
+		if err := writeLibraryEntry(archive, internal.LibraryObjectName(object.Key), contents, object.LastModified); err != nil {
+			return err
+		}
+		if (i+1)%libraryBatch == 0 {
+			log.Info().Int("objects", i+1).Int("total", len(objects)).Msg("writing objects")
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeLibraryEntry(archive *tar.Writer, name string, contents []byte, modified time.Time) error {
+	if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(contents)), ModTime: modified}); err != nil {
+		return err
+	}
+	_, err := archive.Write(contents)
+	return err
+}
+
+// libraryCounts is a row of the import summary
+type libraryCounts struct {
+	archive  int64
+	inserted int64
+	replaced int64
+	skipped  int64
+	// matched to an existing record of another id
+	merged int64
+}
+
+// libraryImporter imports the records of an archive in table order, ids of merged albums and artists are mapped to
+// the ids of the existing records
+type libraryImporter struct {
+	q     *db.Queries
+	store internal.ObjectStore
+	cfg   LibraryImportConfig
+	// archive id to database id
+	albumIDs  map[string]string
+	artistIDs map[string]string
+	// tracks that already existed and were kept, their credits and lyrics are not imported either
+	skippedTracks map[string]bool
+	trackIDs      []string
+	lyricsIDs     []string
+	// playlist keys of the imported tracks by track id
+	playlists map[string][]string
+	// key and size of the objects of the archive
+	objects map[string]int64
+	// objects written under the staging prefix of the import by key, see promote
+	importID string
+	staged   map[string]int64
+	// digests of the records that were written by table and key, see verifyRecords
+	written  map[internal.LibraryTable]map[string][sha256.Size]byte
+	counts   map[string]*libraryCounts
+	listens  db.ImportListeningHistoriesParams
+	events   db.ImportPlayEventsParams
+	manifest internal.LibraryManifest
+}
+
+func importLibrary(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	if !slices.Contains([]string{libraryConflictSkip, libraryConflictOverwrite, libraryConflictFail}, libraryImportCfg.OnConflict) {
+		log.Error().Str("on-conflict", libraryImportCfg.OnConflict).Msgf("on-conflict must be %s, %s or %s", libraryConflictSkip, libraryConflictOverwrite, libraryConflictFail)
+		return
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open archive")
+		return
+	}
+	defer file.Close()
+	tx, err := app.Conn.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to begin transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+	importer := &libraryImporter{
+		q:             app.DB.WithTx(tx),
+		store:         app.Store,
+		cfg:           libraryImportCfg,
+		albumIDs:      make(map[string]string),
+		artistIDs:     make(map[string]string),
+		skippedTracks: make(map[string]bool),
+		playlists:     make(map[string][]string),
+		objects:       make(map[string]int64),
+		importID:      uuid.NewString(),
+		staged:        make(map[string]int64),
+		written:       make(map[internal.LibraryTable]map[string][sha256.Size]byte),
+		counts:        make(map[string]*libraryCounts),
+	}
+	// staged objects of imports that failed are deleted, the command may have been interrupted
+	defer importer.discard(context.WithoutCancel(ctx))
+	if err := importer.read(ctx, tar.NewReader(file)); err != nil {
+		log.Error().Err(err).Msg("failed to import library")
+		return
+	}
+	if err := importer.verify(ctx); err != nil {
+		log.Error().Err(err).Msg("import could not be verified, nothing was imported")
+		return
+	}
+	importer.render()
+	if libraryImportCfg.DryRun {
+		fmt.Println("dry run, nothing was imported")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to commit transaction")
+		return
+	}
+	if err := importer.promote(ctx); err != nil {
+		log.Error().Err(err).Int("objects", len(importer.staged)).Msg("database was imported but objects are missing, import the archive again with the same --on-conflict to write them")
+		return
+	}
+	fmt.Printf("library imported from %s\n", args[0])
+}
+
+func (im *libraryImporter) count(name string) *libraryCounts {
+	if im.counts[name] == nil {
+		im.counts[name] = &libraryCounts{}
+	}
+	return im.counts[name]
+}
+
+// read imports the entries of the archive, tables are checked against the row counts and checksums of the manifest
+func (im *libraryImporter) read(ctx context.Context, archive *tar.Reader) error {
+	header, err := archive.Next()
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if header.Name != internal.LibraryManifestName {
+		return fmt.Errorf("archive does not start with %s", internal.LibraryManifestName)
+	}
+	if err := json.NewDecoder(archive).Decode(&im.manifest); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := im.manifest.Validate(); err != nil {
+		return err
+	}
+	for _, libraryTable := range internal.LibraryTables {
+		file := im.manifest.Tables[libraryTable]
+		header, err := archive.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+		if header.Name != file.Name {
+			return fmt.Errorf("expected %s in the archive, got %s", file.Name, header.Name)
+		}
+		im.count(string(libraryTable)).archive = file.Rows
+		if err := im.readTable(ctx, archive, libraryTable, file); err != nil {
+			return fmt.Errorf("failed to import %s: %w", libraryTable, err)
+		}
+		log.Info().Str("table", string(libraryTable)).Int64("rows", file.Rows).Msg("imported")
+	}
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		key, ok := internal.LibraryObjectKey(header.Name)
+		if !ok || header.Typeflag != tar.TypeReg {
+			log.Warn().Str("entry", header.Name).Msg("skipping unknown entry of the archive")
+			continue
+		}
+		if err := im.object(ctx, key, header.Size, archive); err != nil {
+			return fmt.Errorf("failed to import object %s: %w", key, err)
+		}
+	}
+	if int64(len(im.objects)) != im.manifest.Objects.Count {
+		return fmt.Errorf("manifest lists %d objects, archive has %d", im.manifest.Objects.Count, len(im.objects))
+	}
+	// albums that got tracks have new counts and durations
+	var refreshed = make(map[string]bool)
+	for _, albumID := range im.albumIDs {
+		if refreshed[albumID] {
+			continue
+		}
+		refreshed[albumID] = true
+		if err := im.q.RefreshAlbumStats(ctx, albumID); err != nil {
+			return fmt.Errorf("failed to refresh album stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// readTable imports the records of the table one line at a time while hashing the file
+func (im *libraryImporter) readTable(ctx context.Context, r io.Reader, libraryTable internal.LibraryTable, file internal.LibraryFile) error {
+	digest := sha256.New()
+	decoder := json.NewDecoder(io.TeeReader(r, digest))
+	var rows int64
+	for {
+		var err error
+		switch libraryTable {
+		case internal.LibraryTableAlbums:
+			var record internal.LibraryAlbum
+			if err = decoder.Decode(&record); err == nil {
+				err = im.album(ctx, record)
+			}
+		case internal.LibraryTableArtists:
+			var record internal.LibraryArtist
+			if err = decoder.Decode(&record); err == nil {
+				err = im.artist(ctx, record)
+			}
+		case internal.LibraryTableTracks:
+			var record internal.LibraryTrack
+			if err = decoder.Decode(&record); err == nil {
+				err = im.track(ctx, record)
+			}
+		case internal.LibraryTableTrackArtists:
+			var record internal.LibraryTrackArtist
+			if err = decoder.Decode(&record); err == nil {
+				err = im.trackArtist(ctx, record)
+			}
+		case internal.LibraryTableLyrics:
+			var record internal.LibraryLyrics
+			if err = decoder.Decode(&record); err == nil {
+				err = im.lyrics(ctx, record)
+			}
+		case internal.LibraryTableListeningHistories:
+			var record internal.LibraryListen
+			if err = decoder.Decode(&record); err == nil {
+				err = im.listen(ctx, record)
+			}
+		case internal.LibraryTablePlayEvents:
+			var record internal.LibraryPlayEvent
+			if err = decoder.Decode(&record); err == nil {
+				err = im.playEvent(ctx, record)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("row %d: %w", rows+1, err)
+		}
+		rows++
+	}
+	if err := im.flush(ctx); err != nil {
+		return err
+	}
+	// the decoder stops at the last record, the rest of the file is whitespace
+	if _, err := io.Copy(io.Discard, io.TeeReader(r, digest)); err != nil {
+		return err
+	}
+	if rows != file.Rows {
+		return fmt.Errorf("manifest lists %d rows, file has %d", file.Rows, rows)
+	}
+	if sum := hex.EncodeToString(digest.Sum(nil)); sum != file.SHA256 {
+		return fmt.Errorf("checksum mismatch, manifest lists %s, file is %s", file.SHA256, sum)
+	}
+	return nil
+}
+
+// exists decides what happens to a record whose id is already taken, true if the record is imported
+func (im *libraryImporter) exists(counts *libraryCounts, kind string, id string) (bool, error) {
+	switch im.cfg.OnConflict {
+	case libraryConflictFail:
+		return false, fmt.Errorf("%s %s already exists", kind, id)
+	case libraryConflictOverwrite:
+		counts.replaced++
+		return true, nil
+	default:
+		counts.skipped++
+		return false, nil
+	}
+}
+
+func (im *libraryImporter) album(ctx context.Context, record internal.LibraryAlbum) error {
+	counts := im.count(string(internal.LibraryTableAlbums))
+	im.albumIDs[record.ID] = record.ID
+	exists, err := im.q.AlbumExists(ctx, record.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if write, err := im.exists(counts, "album", record.ID); !write {
+			return err
+		}
+	} else {
+		existingID, err := im.q.GetAlbumIDByNameAndArtist(ctx, db.GetAlbumIDByNameAndArtistParams{Name: record.Name, Artist: record.Artist})
+		if err == nil {
+			im.albumIDs[record.ID] = existingID
+			counts.merged++
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		counts.inserted++
+	}
+	record.CreatedAt = record.CreatedAt.UTC()
+	if err := im.expect(internal.LibraryTableAlbums, record.ID, record); err != nil {
+		return err
+	}
+	var params = db.ImportAlbumParams{
+		ID:                        record.ID,
+		Name:                      record.Name,
+		Cover:                     pointerText(record.Cover),
+		Artist:                    record.Artist,
+		Genre:                     pointerText(record.Genre),
+		CreatedAt:                 pgtype.Timestamptz{Time: record.CreatedAt, Valid: true},
+		MusicbrainzReleaseID:      pointerText(record.MusicBrainzReleaseID),
+		MusicbrainzReleaseGroupID: pointerText(record.MusicBrainzReleaseGroupID),
+		CanonicalName:             pointerText(record.CanonicalName),
+		ReleaseDate:               pointerText(record.ReleaseDate),
+	}
+	if record.Year != nil {
+		params.Year = pgtype.Int4{Int32: *record.Year, Valid: true}
+	}
+	return im.q.ImportAlbum(ctx, params)
+}
+
+func (im *libraryImporter) artist(ctx context.Context, record internal.LibraryArtist) error {
+	counts := im.count(string(internal.LibraryTableArtists))
+	im.artistIDs[record.ID] = record.ID
+	exists, err := im.q.ArtistExists(ctx, record.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if write, err := im.exists(counts, "artist", record.ID); !write {
+			return err
+		}
+	} else {
+		existing, err := im.q.GetArtistByMatchNameOrAlias(ctx, record.MatchName)
+		if err == nil {
+			im.artistIDs[record.ID] = existing.ID
+			counts.merged++
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		counts.inserted++
+	}
+	if record.Aliases == nil {
+		record.Aliases = []string{}
+	}
+	record.CreatedAt = record.CreatedAt.UTC()
+	if err := im.expect(internal.LibraryTableArtists, record.ID, record); err != nil {
+		return err
+	}
+	return im.q.ImportArtist(ctx, db.ImportArtistParams{
+		ID:            record.ID,
+		Name:          record.Name,
+		SortName:      record.SortName,
+		MatchName:     record.MatchName,
+		Aliases:       record.Aliases,
+		CreatedAt:     pgtype.Timestamptz{Time: record.CreatedAt, Valid: true},
+		MusicbrainzID: pointerText(record.MusicBrainzID),
+	})
+}
+
+func (im *libraryImporter) track(ctx context.Context, record internal.LibraryTrack) error {
+	counts := im.count(string(internal.LibraryTableTracks))
+	exists, err := im.q.TrackExists(ctx, record.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		write, err := im.exists(counts, "track", record.ID)
+		if !write {
+			im.skippedTracks[record.ID] = true
+			return err
+		}
+		// credits of the archive replace the credits of the track
+		if err := im.q.DeleteTrackArtists(ctx, record.ID); err != nil {
+			return err
+		}
+	} else {
+		counts.inserted++
+	}
+	if albumID, ok := im.albumIDs[record.AlbumID]; ok {
+		record.AlbumID = albumID
+	}
+	record.CreatedAt = record.CreatedAt.UTC()
+	if err := im.expect(internal.LibraryTableTracks, record.ID, record); err != nil {
+		return err
+	}
+	im.trackIDs = append(im.trackIDs, record.ID)
+	im.playlists[record.ID] = []string{internal.PlaylistKey(record.InstrumentalFolderPath)}
+	if record.VocalFolderPath != nil {
+		im.playlists[record.ID] = append(im.playlists[record.ID], internal.PlaylistKey(*record.VocalFolderPath))
+	}
+	return im.q.ImportTrack(ctx, db.ImportTrackParams{
+		ID:                     record.ID,
+		AlbumID:                record.AlbumID,
+		AlbumName:              record.AlbumName,
+		VocalFolderPath:        pointerText(record.VocalFolderPath),
+		InstrumentalFolderPath: record.InstrumentalFolderPath,
+		TotalDuration:          record.TotalDuration.String(),
+		Info:                   record.Info,
+		Instrumental:           record.Instrumental,
+		Tempo:                  record.Tempo.String(),
+		Key:                    record.Key,
+		VocalWaveform:          record.VocalWaveform,
+		InstrumentalWaveform:   record.InstrumentalWaveform,
+		MusicbrainzRecordingID: pointerText(record.MusicBrainzRecordingID),
+		CanonicalTitle:         pointerText(record.CanonicalTitle),
+		CreatedAt:              pgtype.Timestamptz{Time: record.CreatedAt, Valid: true},
+	})
+}
+
+func (im *libraryImporter) trackArtist(ctx context.Context, record internal.LibraryTrackArtist) error {
+	counts := im.count(string(internal.LibraryTableTrackArtists))
+	if im.skippedTracks[record.TrackID] {
+		counts.skipped++
+		return nil
+	}
+	if artistID, ok := im.artistIDs[record.ArtistID]; ok {
+		record.ArtistID = artistID
+	}
+	counts.inserted++
+	if err := im.expect(internal.LibraryTableTrackArtists, libraryCreditKey(record), record); err != nil {
+		return err
+	}
+	return im.q.InsertTrackArtist(ctx, db.InsertTrackArtistParams{TrackID: record.TrackID, ArtistID: record.ArtistID, Role: db.ArtistRole(record.Role), Position: record.Position})
+}
+
+func (im *libraryImporter) lyrics(ctx context.Context, record internal.LibraryLyrics) error {
+	counts := im.count(string(internal.LibraryTableLyrics))
+	if im.skippedTracks[record.TrackID] {
+		counts.skipped++
+		return nil
+	}
+	counts.inserted++
+	im.lyricsIDs = append(im.lyricsIDs, record.TrackID)
+	if string(record.Synced) == "null" {
+		record.Synced = nil
+	}
+	record.UpdatedAt = record.UpdatedAt.UTC()
+	if err := im.expect(internal.LibraryTableLyrics, record.TrackID, record); err != nil {
+		return err
+	}
+	return im.q.ImportLyrics(ctx, db.ImportLyricsParams{
+		TrackID:   record.TrackID,
+		Language:  pointerText(record.Language),
+		Plain:     record.Plain,
+		Synced:    record.Synced,
+		Source:    record.Source,
+		UpdatedAt: pgtype.Timestamptz{Time: record.UpdatedAt, Valid: true},
+	})
+}
+
+func (im *libraryImporter) listen(ctx context.Context, record internal.LibraryListen) error {
+	im.listens.TrackIds = append(im.listens.TrackIds, record.TrackID)
+	im.listens.AnonIds = append(im.listens.AnonIds, record.AnonID)
+	im.listens.ListenedAts = append(im.listens.ListenedAts, pgtype.Timestamptz{Time: record.ListenedAt, Valid: true})
+	if len(im.listens.TrackIds) < libraryBatch {
+		return nil
+	}
+	return im.flush(ctx)
+}
+
+func (im *libraryImporter) playEvent(ctx context.Context, record internal.LibraryPlayEvent) error {
+	im.events.TrackIds = append(im.events.TrackIds, record.TrackID)
+	im.events.AnonIds = append(im.events.AnonIds, record.AnonID)
+	im.events.EventTypes = append(im.events.EventTypes, record.Type)
+	im.events.Positions = append(im.events.Positions, record.Position.String())
+	im.events.Durations = append(im.events.Durations, record.Duration.String())
+	im.events.CreatedAts = append(im.events.CreatedAts, pgtype.Timestamptz{Time: record.CreatedAt, Valid: true})
+	if len(im.events.TrackIds) < libraryBatch {
+		return nil
+	}
+	return im.flush(ctx)
+}
+
+// flush writes the batched listening history and play events, entries that are already stored count as skipped
+func (im *libraryImporter) flush(ctx context.Context) error {
+	if batch := int64(len(im.listens.TrackIds)); batch > 0 {
+		inserted, err := im.q.ImportListeningHistories(ctx, im.listens)
+		if err != nil {
+			return err
+		}
+		counts := im.count(string(internal.LibraryTableListeningHistories))
+		counts.inserted += inserted
+		counts.skipped += batch - inserted
+		im.listens = db.ImportListeningHistoriesParams{}
+	}
+	if batch := int64(len(im.events.TrackIds)); batch > 0 {
+		inserted, err := im.q.ImportPlayEvents(ctx, im.events)
+		if err != nil {
+			return err
+		}
+		counts := im.count(string(internal.LibraryTablePlayEvents))
+		counts.inserted += inserted
+		counts.skipped += batch - inserted
+		im.events = db.ImportPlayEventsParams{}
+	}
+	return nil
+}
+
+// object stages the object unless an object with the key exists, objects of the same size are taken to be the same.
+// objects are written under the staging prefix of the import and only replace the objects of the bucket once the
+// import is committed, see promote.
+func (im *libraryImporter) object(ctx context.Context, key string, size int64, r io.Reader) error {
+	counts := im.count("objects")
+	counts.archive++
+	im.objects[key] = size
+	reader, info, err := im.store.Open(ctx, key)
+	if err == nil {
+		reader.Close()
+		switch {
+		case im.cfg.OnConflict == libraryConflictFail && info.Size != size:
+			return fmt.Errorf("object already exists with %d bytes instead of %d", info.Size, size)
+		case im.cfg.OnConflict != libraryConflictOverwrite:
+			counts.skipped++
+			return nil
+		}
+		counts.replaced++
+	} else if errors.Is(err, internal.ErrObjectNotFound) {
+		counts.inserted++
+	} else {
+		return err
+	}
+	if im.cfg.DryRun {
+		return nil
+	}
+	if err := im.store.PutReader(ctx, internal.LibraryStagingKey(im.importID, key), r, size); err != nil {
+		return err
+	}
+	im.staged[key] = size
+	return nil
+}
+
+// promote moves the staged objects to their keys after the import is committed
+func (im *libraryImporter) promote(ctx context.Context) error {
+	for key := range im.staged {
+		staging := internal.LibraryStagingKey(im.importID, key)
+		reader, info, err := im.store.Open(ctx, staging)
+		if err != nil {
+			return fmt.Errorf("failed to open staged object %s: %w", key, err)
+		}
+		err = im.store.PutReader(ctx, key, reader, info.Size)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write object %s: %w", key, err)
+		}
+		if err := im.store.Delete(ctx, staging); err != nil {
+			return fmt.Errorf("failed to delete staged object %s: %w", key, err)
+		}
+		delete(im.staged, key)
+	}
+	return nil
+}
+
+// discard deletes the staged objects that were not promoted
+func (im *libraryImporter) discard(ctx context.Context) {
+	for key := range im.staged {
+		if err := im.store.Delete(ctx, internal.LibraryStagingKey(im.importID, key)); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("failed to delete staged object")
+		}
+	}
+}
+
+// expect records the digest of a record as it was written, credits are keyed by libraryCreditKey and lyrics by track
+func (im *libraryImporter) expect(libraryTable internal.LibraryTable, key string, record any) error {
+	digest, err := libraryDigest(record)
+	if err != nil {
+		return err
+	}
+	if im.written[libraryTable] == nil {
+		im.written[libraryTable] = make(map[string][sha256.Size]byte)
+	}
+	im.written[libraryTable][key] = digest
+	return nil
+}
+
+func libraryDigest(record any) ([sha256.Size]byte, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(encoded), nil
+}
+
+func libraryCreditKey(credit internal.LibraryTrackArtist) string {
+	return fmt.Sprintf("%s/%s/%d", credit.TrackID, credit.Role, credit.Position)
+}
+
+// verify checks that every imported row is in the database as it is in the archive and every object of the archive
+// is staged or in the bucket, objects the imported rows reference but the archive does not have are only reported
+func (im *libraryImporter) verify(ctx context.Context) error {
+	var (
+		albumIDs  []string
+		artistIDs []string
+	)
+	for _, id := range im.albumIDs {
+		albumIDs = append(albumIDs, id)
+	}
+	for _, id := range im.artistIDs {
+		artistIDs = append(artistIDs, id)
+	}
+	albumIDs, artistIDs = uniqueStrings(albumIDs), uniqueStrings(artistIDs)
+	trackIDs, lyricsIDs := uniqueStrings(im.trackIDs), uniqueStrings(im.lyricsIDs)
+	found, err := im.q.CountLibraryRows(ctx, db.CountLibraryRowsParams{AlbumIds: albumIDs, ArtistIds: artistIDs, TrackIds: trackIDs, LyricsTrackIds: lyricsIDs})
+	if err != nil {
+		return err
+	}
+	for _, check := range []struct {
+		table    internal.LibraryTable
+		expected int
+		found    int64
+	}{
+		{internal.LibraryTableAlbums, len(albumIDs), found.Albums},
+		{internal.LibraryTableArtists, len(artistIDs), found.Artists},
+		{internal.LibraryTableTracks, len(trackIDs), found.Tracks},
+		{internal.LibraryTableLyrics, len(lyricsIDs), found.Lyrics},
+	} {
+		if int64(check.expected) != check.found {
+			return fmt.Errorf("expected %d %s in the database, found %d", check.expected, check.table, check.found)
+		}
+	}
+	if err := im.verifyRecords(ctx); err != nil {
+		return err
+	}
+
+	if !im.cfg.DryRun {
+		for key, size := range im.objects {
+			stored := key
+			_, staged := im.staged[key]
+			if staged {
+				stored = internal.LibraryStagingKey(im.importID, key)
+			}
+			reader, info, err := im.store.Open(ctx, stored)
+			if err != nil {
+				return fmt.Errorf("object %s is not in the bucket: %w", key, err)
+			}
+			reader.Close()
+			if info.Size != size && (staged || im.cfg.OnConflict != libraryConflictSkip) {
+				return fmt.Errorf("object %s has %d bytes in the bucket, %d in the archive", key, info.Size, size)
+			}
+		}
+	}
+	var missing int
+	for _, trackID := range trackIDs {
+		for _, key := range im.playlists[trackID] {
+			if _, ok := im.objects[key]; ok {
+				continue
+			}
+			reader, _, err := im.store.Open(ctx, key)
+			if err != nil {
+				if !errors.Is(err, internal.ErrObjectNotFound) {
+					return err
+				}
+				missing++
+				log.Warn().Str("track", trackID).Str("key", key).Msg("playlist of the track is not in the bucket")
+				continue
+			}
+			reader.Close()
+		}
+	}
+	if missing > 0 {
+		log.Warn().Int("playlists", missing).Msg("tracks cannot be played until their objects are uploaded, export with --objects to include them")
+	}
+	return nil
+}
+
+// verifyRecords reads back the albums, artists, tracks, credits and lyrics that were written and compares them with
+// the records of the archive. merged and kept records are not compared, their rows are only counted by verify.
+func (im *libraryImporter) verifyRecords(ctx context.Context) error {
+	var found = make(map[internal.LibraryTable]map[string][sha256.Size]byte, len(im.written))
+	add := func(libraryTable internal.LibraryTable, key string, record any) error {
+		digest, err := libraryDigest(record)
+		if err != nil {
+			return err
+		}
+		if found[libraryTable] == nil {
+			found[libraryTable] = make(map[string][sha256.Size]byte)
+		}
+		found[libraryTable][key] = digest
+		return nil
+	}
+	written := func(libraryTable internal.LibraryTable) []string {
+		return slices.Sorted(maps.Keys(im.written[libraryTable]))
+	}
+	for ids := range slices.Chunk(written(internal.LibraryTableAlbums), libraryBatch) {
+		albums, err := im.q.ExportAlbums(ctx, db.ExportAlbumsParams{AfterID: libraryFirstID, Ids: ids, ResultLimit: int32(len(ids))})
+		if err != nil {
+			return fmt.Errorf("failed to read back albums: %w", err)
+		}
+		for _, album := range albums {
+			if err := add(internal.LibraryTableAlbums, album.ID, libraryAlbum(album)); err != nil {
+				return err
+			}
+		}
+	}
+	for ids := range slices.Chunk(written(internal.LibraryTableArtists), libraryBatch) {
+		artists, err := im.q.ExportArtists(ctx, db.ExportArtistsParams{AfterID: libraryFirstID, Ids: ids, ResultLimit: int32(len(ids))})
+		if err != nil {
+			return fmt.Errorf("failed to read back artists: %w", err)
+		}
+		for _, artist := range artists {
+			if err := add(internal.LibraryTableArtists, artist.ID, libraryArtist(artist)); err != nil {
+				return err
+			}
+		}
+	}
+	// credits of the written tracks are replaced by the credits of the archive, the database has no others
+	for ids := range slices.Chunk(written(internal.LibraryTableTracks), libraryBatch) {
+		tracks, err := im.q.ExportTracks(ctx, db.ExportTracksParams{AfterID: libraryFirstID, Ids: ids, ResultLimit: int32(len(ids))})
+		if err != nil {
+			return fmt.Errorf("failed to read back tracks: %w", err)
+		}
+		for _, track := range tracks {
+			if err := add(internal.LibraryTableTracks, track.ID, libraryTrack(track)); err != nil {
+				return err
+			}
+		}
+		credits, err := im.q.ExportTrackArtists(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("failed to read back track artists: %w", err)
+		}
+		for _, credit := range credits {
+			record := libraryTrackArtist(credit)
+			if err := add(internal.LibraryTableTrackArtists, libraryCreditKey(record), record); err != nil {
+				return err
+			}
+		}
+	}
+	for ids := range slices.Chunk(written(internal.LibraryTableLyrics), libraryBatch) {
+		lyrics, err := im.q.ExportLyrics(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("failed to read back lyrics: %w", err)
+		}
+		for _, lyric := range lyrics {
+			if err := add(internal.LibraryTableLyrics, lyric.TrackID, libraryLyrics(lyric)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, libraryTable := range internal.LibraryTables {
+		for _, key := range written(libraryTable) {
+			digest, ok := found[libraryTable][key]
+			if !ok {
+				return fmt.Errorf("%s %s of the archive is not in the database", libraryTable, key)
+			}
+			if digest != im.written[libraryTable][key] {
+				return fmt.Errorf("%s %s in the database differs from the archive", libraryTable, key)
+			}
+		}
+		if len(found[libraryTable]) != len(im.written[libraryTable]) {
+			return fmt.Errorf("expected %d %s in the database, found %d", len(im.written[libraryTable]), libraryTable, len(found[libraryTable]))
+		}
+	}
+	return nil
+}
+
+func (im *libraryImporter) render() {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.AppendHeader(table.Row{"Table", "Archive", "Inserted", "Replaced", "Skipped", "Merged"})
+	var names = make([]string, 0, len(internal.LibraryTables)+1)
+	for _, libraryTable := range internal.LibraryTables {
+		names = append(names, string(libraryTable))
+	}
+	if im.manifest.Objects.Included {
+		names = append(names, "objects")
+	}
+	for _, name := range names {
+		counts := im.count(name)
+		t.AppendRow(table.Row{name, counts.archive, counts.inserted, counts.replaced, counts.skipped, counts.merged})
+	}
+	t.Render()
+}
+
+func uniqueStrings(values []string) []string {
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+func textPointer(text pgtype.Text) *string {
+	if !text.Valid {
+		return nil
+	}
+	return &text.String
+}
+
+func pointerText(value *string) pgtype.Text {
+	if value == nil {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: *value, Valid: true}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/caner-cetin/strafe/internal"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type LyricsSetConfig struct {
+	// ISO 639-2 code
+	Language string
+}
+
+var (
+	lyricsCmd = &cobra.Command{
+		Use:   "lyrics",
+		Short: "show and set the lyrics of tracks",
+	}
+	lyricsSetCmd = &cobra.Command{
+		Use:   "set <track id> <file>",
+		Short: "replace the lyrics of the track with an LRC, enhanced LRC or text file",
+		Args:  cobra.ExactArgs(2),
+		Run:   WrapCommandWithResources(setLyrics, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	lyricsSetCfg  = LyricsSetConfig{}
+	lyricsShowCmd = &cobra.Command{
+		Use:   "show <track id>",
+		Short: "print the lyrics of the track, with line times if they are synced",
+		Args:  cobra.ExactArgs(1),
+		Run:   WrapCommandWithResources(showLyrics, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+)
+
+func getLyricsCmd() *cobra.Command {
+	lyricsSetCmd.PersistentFlags().StringVarP(&lyricsSetCfg.Language, "language", "l", "", "ISO 639-2 code of the language, such as eng")
+	lyricsCmd.AddCommand(lyricsSetCmd)
+	lyricsCmd.AddCommand(lyricsShowCmd)
+	return lyricsCmd
+}
+
+func setLyrics(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	trackID := args[0]
+	if _, err := uuid.Parse(trackID); err != nil {
+		log.Error().Err(err).Str("track", trackID).Msg("track id is not a uuid")
+		return
+	}
+	exists, err := app.DB.TrackExists(ctx, trackID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to check track")
+		return
+	}
+	if !exists {
+		log.Error().Str("track", trackID).Msg("track does not exist")
+		return
+	}
+	contents, err := os.ReadFile(args[1])
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read lyrics file")
+		return
+	}
+	lyrics := internal.ParseLyrics(string(contents))
+	if lyrics.Plain == "" {
+		log.Error().Str("file", args[1]).Msg("lyrics file is empty")
+		return
+	}
+	lyrics.Language = lyricsSetCfg.Language
+	if err := internal.SaveLyrics(ctx, app.DB, trackID, lyrics, internal.LyricsSourceCLI); err != nil {
+		log.Error().Err(err).Msg("failed to save lyrics")
+		return
+	}
+	if lyrics.Lines != nil {
+		fmt.Printf("saved %d synced lines\n", len(lyrics.Lines))
+		return
+	}
+	fmt.Println("saved plain lyrics, the file has no line times")
+}
+
+func showLyrics(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	if _, err := uuid.Parse(args[0]); err != nil {
+		log.Error().Err(err).Str("track", args[0]).Msg("track id is not a uuid")
+		return
+	}
+	lyrics, err := app.DB.GetLyrics(ctx, args[0])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error().Str("track", args[0]).Msg("track has no lyrics")
+			return
+		}
+		log.Error().Err(err).Msg("failed to get lyrics")
+		return
+	}
+	if lyrics.Synced == nil {
+		fmt.Println(lyrics.Plain)
+		return
+	}
+	var lines []internal.LyricLine
+	if err := json.Unmarshal(lyrics.Synced, &lines); err != nil {
+		log.Error().Err(err).Msg("failed to parse synced lyrics")
+		return
+	}
+	for _, line := range lines {
+		fmt.Printf("[%02d:%05.2f] %s\n", int(line.Time)/60, line.Time-float64(int(line.Time)/60*60), line.Text)
+	}
+}
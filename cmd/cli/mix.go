@@ -0,0 +1,586 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	mixOrderPlaylist = "playlist"
+	mixOrderHarmonic = "harmonic"
+	// transitions start on the first beat of a bar
+	mixBeatsPerBar = 4
+	// vocals fade in and out over a bar around the transitions
+	mixVocalFadeBeats = 4
+	mixSampleRate     = 44100
+)
+
+var trackIDPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+type MixRenderConfig struct {
+	Playlist string
+	Output   string
+	// next to the output with the .cue extension by default
+	Cue string
+	// median tempo of the tracks if zero
+	BPM float64
+	// tracks are stretched at most this much, 0.08 is 8 percent
+	MaxStretch float64
+	// length of the crossfades in beats
+	Transition int
+	Order      string
+	// vocals are dropped during transitions unless set
+	KeepVocals bool
+}
+
+var (
+	mixCmd = &cobra.Command{
+		Use:   "mix",
+		Short: "render DJ mixes of the library",
+	}
+	mixRenderCmd = &cobra.Command{
+		Use:   "render --playlist <playlist id, name or file> -o mix.flac",
+		Short: "render the tracks as a single beat matched mix with a cue sheet",
+		Long: `render the tracks as a single beat matched mix with a cue sheet.
+
+tracks are stretched toward a common tempo, transitions start on a bar of the outgoing track and the first beat of
+the incoming track lands on it. vocals are dropped during transitions, only the instrumentals are crossfaded.
+
+--playlist is a playlist id or name, or a file with a track id on every line such as an exported playlist.
+the format of the mix is taken from the extension of the output, such as .flac, .wav or .mp3.`,
+		Run: WrapCommandWithResources(renderMix, ResourceConfig{Resources: []ResourceType{ResourceDocker, ResourceDatabase, ResourceStorage}}),
+	}
+	mixRenderCfg = MixRenderConfig{}
+)
+
+// mixTrack is a track of the mix, times are seconds of the stretched track unless noted otherwise
+type mixTrack struct {
+	id                 string
+	title              string
+	artist             string
+	key                string
+	tempo              float64
+	instrumentalFolder string
+	vocalFolder        string
+	// stems joined into single files
+	instrumentalPath string
+	vocalPath        string
+	// seconds of the original track
+	duration float64
+	beats    []float64
+	// atempo factor, above 1 speeds the track up
+	stretch float64
+	// the track is trimmed to start and end
+	start float64
+	end   float64
+	// where the transition to the next track starts
+	transition float64
+	// position of start in the mix
+	offset float64
+}
+
+func getMixCmd() *cobra.Command {
+	mixRenderCmd.PersistentFlags().StringVar(&mixRenderCfg.Playlist, "playlist", "", "playlist id or name, or a file with a track id on every line")
+	mixRenderCmd.PersistentFlags().StringVarP(&mixRenderCfg.Output, "output", "o", "", "file to write the mix to, the extension selects the format")
+	mixRenderCmd.PersistentFlags().StringVar(&mixRenderCfg.Cue, "cue", "", "file to write the cue sheet to, next to the output by default")
+	mixRenderCmd.PersistentFlags().Float64Var(&mixRenderCfg.BPM, "bpm", 0, "tempo of the mix, median tempo of the tracks by default")
+	mixRenderCmd.PersistentFlags().Float64Var(&mixRenderCfg.MaxStretch, "max-stretch", 0.08, "tracks are stretched at most this much toward the tempo of the mix")
+	mixRenderCmd.PersistentFlags().IntVar(&mixRenderCfg.Transition, "transition", 32, "length of the crossfades in beats")
+	mixRenderCmd.PersistentFlags().StringVar(&mixRenderCfg.Order, "order", mixOrderPlaylist, "playlist keeps the order, harmonic orders the tracks by key and tempo starting from the first track")
+	mixRenderCmd.PersistentFlags().BoolVar(&mixRenderCfg.KeepVocals, "keep-vocals", false, "keep the vocals during transitions")
+	mixRenderCmd.MarkPersistentFlagRequired("playlist")
+	mixRenderCmd.MarkPersistentFlagRequired("output")
+	mixCmd.AddCommand(mixRenderCmd)
+	return mixCmd
+}
+
+func renderMix(cmd *cobra.Command, args []string) {
+	exitIfImage(DoesNotExist)
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var cfg = mixRenderCfg
+	if cfg.Transition <= 0 {
+		log.Error().Int("transition", cfg.Transition).Msg("transition must be at least a beat")
+		return
+	}
+	if cfg.MaxStretch < 0 || cfg.MaxStretch >= 0.5 {
+		log.Error().Float64("max_stretch", cfg.MaxStretch).Msg("max stretch must be between 0 and 0.5")
+		return
+	}
+	if cfg.Order != mixOrderPlaylist && cfg.Order != mixOrderHarmonic {
+		log.Error().Str("order", cfg.Order).Msgf("order must be %s or %s", mixOrderPlaylist, mixOrderHarmonic)
+		return
+	}
+	if filepath.Ext(cfg.Output) == "" {
+		log.Error().Str("output", cfg.Output).Msg("output needs an extension such as .flac to select the format")
+		return
+	}
+	if cfg.Cue == "" {
+		cfg.Cue = strings.TrimSuffix(cfg.Output, filepath.Ext(cfg.Output)) + ".cue"
+	}
+
+	title, trackIDs, err := resolveMixTracks(ctx, app.DB, cfg.Playlist)
+	if err != nil {
+		log.Error().Err(err).Str("playlist", cfg.Playlist).Msg("failed to get the tracks of the mix")
+		return
+	}
+	if len(trackIDs) == 0 {
+		log.Error().Str("playlist", cfg.Playlist).Msg("mix has no tracks")
+		return
+	}
+	tracks, err := loadMixTracks(ctx, app.DB, trackIDs)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get tracks")
+		return
+	}
+	if cfg.Order == mixOrderHarmonic {
+		tracks = orderHarmonic(tracks)
+	}
+	if cfg.BPM == 0 {
+		cfg.BPM = medianTempo(tracks)
+	}
+	if cfg.BPM <= 0 {
+		log.Error().Msg("tracks have no tempo, set the tempo of the mix with --bpm")
+		return
+	}
+
+	dir, err := os.MkdirTemp(os.TempDir(), "strafe-mix-*")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create temporary directory")
+		return
+	}
+	defer os.RemoveAll(dir)
+	for i := range tracks {
+		log.Info().Str("title", tracks[i].title).Msg("downloading stems")
+		if err := downloadMixStems(ctx, app.Store, dir, i, &tracks[i]); err != nil {
+			log.Error().Err(err).Str("track", tracks[i].id).Msg("failed to download stems")
+			return
+		}
+	}
+	log.Info().Int("tracks", len(tracks)).Msg("detecting beats")
+	if err := runScript(ctx, app.Docker, beatScript(dir, tracks), os.Stdout, dir); err != nil {
+		log.Error().Err(err).Msg("failed to detect beats")
+		return
+	}
+	for i := range tracks {
+		if tracks[i].beats, err = readBeats(beatsPath(dir, i)); err != nil {
+			log.Error().Err(err).Str("track", tracks[i].id).Msg("failed to read beats")
+			return
+		}
+	}
+	length, err := planMix(tracks, cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to plan the mix")
+		return
+	}
+	rendered := filepath.Join(dir, "mix"+filepath.Ext(cfg.Output))
+	filterPath := filepath.Join(dir, "filter.txt")
+	if err := os.WriteFile(filterPath, []byte(mixFilter(tracks, cfg)), 0o644); err != nil {
+		log.Error().Err(err).Msg("failed to write filter")
+		return
+	}
+	log.Info().Str("length", formatHours(length)).Float64("bpm", cfg.BPM).Msg("rendering mix")
+	if err := runScript(ctx, app.Docker, renderScript(tracks, filterPath, rendered), os.Stdout, dir); err != nil {
+		log.Error().Err(err).Msg("failed to render mix")
+		return
+	}
+	if err := copyFile(rendered, cfg.Output); err != nil {
+		log.Error().Err(err).Msg("failed to write mix")
+		return
+	}
+	if err := writeMixCue(cfg, title, tracks); err != nil {
+		log.Error().Err(err).Msg("failed to write cue sheet")
+		return
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.SetTitle(title)
+	t.AppendHeader(table.Row{"#", "Start", "Title", "Artist", "Key", "BPM", "Stretch"})
+	for i, track := range tracks {
+		t.AppendRow(table.Row{
+			i + 1,
+			formatMixTime(mixTrackStart(tracks, i, cfg)),
+			track.title,
+			track.artist,
+			track.key,
+			fmt.Sprintf("%.1f", track.tempo),
+			fmt.Sprintf("%+.1f%%", (track.stretch-1)*100),
+		})
+	}
+	t.Render()
+	log.Info().Str("file", cfg.Output).Str("cue", cfg.Cue).Msg("rendered mix")
+}
+
+// resolveMixTracks reads the track ids from the file if it exists, otherwise from the playlist with the id or name
+func resolveMixTracks(ctx context.Context, q *db.Queries, playlistOrFile string) (string, []string, error) {
+	if contents, err := os.ReadFile(playlistOrFile); err == nil {
+		var (
+			trackIDs []string
+			scanner  = bufio.NewScanner(bytes.NewReader(contents))
+		)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			// exported playlists point at /track/{id}/playlist/{stem}.m3u8
+			trackID := trackIDPattern.FindString(line)
+			if trackID == "" {
+				return "", nil, fmt.Errorf("line %q has no track id", line)
+			}
+			trackIDs = append(trackIDs, strings.ToLower(trackID))
+		}
+		if err := scanner.Err(); err != nil {
+			return "", nil, err
+		}
+		name := filepath.Base(playlistOrFile)
+		return strings.TrimSuffix(name, filepath.Ext(name)), trackIDs, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", nil, err
+	}
+	playlist, err := resolvePlaylist(ctx, q, playlistOrFile)
+	if err != nil {
+		return "", nil, err
+	}
+	items, err := q.ListPlaylistItems(ctx, playlist.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	var trackIDs = make([]string, 0, len(items))
+	for _, item := range items {
+		trackIDs = append(trackIDs, item.ID)
+	}
+	return playlist.Name, trackIDs, nil
+}
+
+func loadMixTracks(ctx context.Context, q *db.Queries, trackIDs []string) ([]mixTrack, error) {
+	var tracks = make([]mixTrack, 0, len(trackIDs))
+	for _, trackID := range trackIDs {
+		track, err := q.GetTrackByID(ctx, trackID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get track %s: %w", trackID, err)
+		}
+		tempo, _ := track.Tempo.Float64Value()
+		duration, _ := track.TotalDuration.Float64Value()
+		tracks = append(tracks, mixTrack{
+			id:                 track.ID,
+			title:              fastjson.GetString(track.Info, "Title"),
+			artist:             fastjson.GetString(track.Info, "Artist"),
+			key:                track.Key,
+			tempo:              tempo.Float64,
+			duration:           duration.Float64,
+			instrumentalFolder: track.InstrumentalFolderPath,
+			vocalFolder:        track.VocalFolderPath.String,
+		})
+	}
+	return tracks, nil
+}
+
+// orderHarmonic starts from the first track and picks the track closest in key and tempo next,
+// every 4 BPM of difference counts as much as a step on the camelot wheel
+func orderHarmonic(tracks []mixTrack) []mixTrack {
+	var (
+		ordered   = []mixTrack{tracks[0]}
+		remaining = slices.Clone(tracks[1:])
+	)
+	for len(remaining) > 0 {
+		current := ordered[len(ordered)-1]
+		best, bestScore := 0, math.Inf(1)
+		for i, candidate := range remaining {
+			steps, err := internal.CamelotDistance(current.key, candidate.key)
+			if err != nil {
+				// unknown keys are as far as a clashing key
+				steps = 3
+			}
+			score := float64(steps) + math.Abs(current.tempo-candidate.tempo)/4
+			if score < bestScore {
+				best, bestScore = i, score
+			}
+		}
+		ordered = append(ordered, remaining[best])
+		remaining = slices.Delete(remaining, best, best+1)
+	}
+	return ordered
+}
+
+func medianTempo(tracks []mixTrack) float64 {
+	var tempos []float64
+	for _, track := range tracks {
+		if track.tempo > 0 {
+			tempos = append(tempos, track.tempo)
+		}
+	}
+	if len(tempos) == 0 {
+		return 0
+	}
+	slices.Sort(tempos)
+	if len(tempos)%2 == 0 {
+		return (tempos[len(tempos)/2-1] + tempos[len(tempos)/2]) / 2
+	}
+	return tempos[len(tempos)/2]
+}
+
+// downloadMixStems joins the segments of every stem of the track into a single file
+func downloadMixStems(ctx context.Context, store internal.ObjectStore, dir string, index int, track *mixTrack) error {
+	instrumental := filepath.Join(dir, fmt.Sprintf("%03d-instrumental.ts", index))
+	if err := downloadStem(ctx, store, track.instrumentalFolder, instrumental); err != nil {
+		return err
+	}
+	track.instrumentalPath = instrumental
+	if track.vocalFolder == "" {
+		return nil
+	}
+	vocal := filepath.Join(dir, fmt.Sprintf("%03d-vocal.ts", index))
+	if err := downloadStem(ctx, store, track.vocalFolder, vocal); err != nil {
+		return err
+	}
+	track.vocalPath = vocal
+	return nil
+}
+
+// downloadStem writes the segments of the playlist one after another, MPEG-TS segments can be concatenated as they are
+func downloadStem(ctx context.Context, store internal.ObjectStore, folderPath string, target string) error {
+	playlistKey := internal.PlaylistKey(folderPath)
+	playlist, err := store.Get(ctx, playlistKey)
+	if err != nil {
+		return err
+	}
+	segments, err := internal.ReadM3U8Segments(playlist)
+	if err != nil {
+		return fmt.Errorf("invalid playlist %s: %w", playlistKey, err)
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, segment := range segments {
+		contents, err := store.Get(ctx, filepath.ToSlash(filepath.Join(filepath.Dir(playlistKey), segment.URI)))
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(contents); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	return file.Close()
+}
+
+func beatsPath(dir string, index int) string {
+	return filepath.Join(dir, fmt.Sprintf("%03d.beats", index))
+}
+
+// beatScript writes the beats of every instrumental, drums are in the instrumental stem
+func beatScript(dir string, tracks []mixTrack) string {
+	var script strings.Builder
+	for i, track := range tracks {
+		wav := filepath.Join(dir, fmt.Sprintf("%03d.wav", i))
+		fmt.Fprintf(&script, "ffmpeg -v error -y -i %q -ac 1 -ar %d %q\n", track.instrumentalPath, mixSampleRate, wav)
+		fmt.Fprintf(&script, "aubio beat -i %q > %q\n", wav, beatsPath(dir, i))
+		fmt.Fprintf(&script, "rm %q\n", wav)
+	}
+	return script.String()
+}
+
+// readBeats reads the output of aubio beat, a beat in seconds on every line
+func readBeats(path string) ([]float64, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var beats []float64
+	for _, line := range strings.Fields(string(contents)) {
+		beat, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid beat %q: %w", line, err)
+		}
+		beats = append(beats, beat)
+	}
+	return beats, nil
+}
+
+// planMix stretches the tracks toward the tempo of the mix and places them so the first beat of every track lands on
+// the first beat of a bar of the previous track, returns the length of the mix in seconds
+func planMix(tracks []mixTrack, cfg MixRenderConfig) (float64, error) {
+	var transition = float64(cfg.Transition) * 60 / cfg.BPM
+	for i := range tracks {
+		track := &tracks[i]
+		tempo := track.tempo
+		if tempo <= 0 {
+			tempo = cfg.BPM
+		}
+		// beat trackers report half or double tempo, such tracks still mix at the tempo of the mix
+		for tempo*1.5 < cfg.BPM {
+			tempo *= 2
+		}
+		for tempo > cfg.BPM*1.5 {
+			tempo /= 2
+		}
+		track.stretch = min(max(cfg.BPM/tempo, 1-cfg.MaxStretch), 1+cfg.MaxStretch)
+		length := track.duration / track.stretch
+		var beats = make([]float64, 0, len(track.beats))
+		for _, beat := range track.beats {
+			beats = append(beats, beat/track.stretch)
+		}
+		if i > 0 && len(beats) > 0 {
+			track.start = beats[0]
+		}
+		track.end = length
+		if i == len(tracks)-1 {
+			continue
+		}
+		// the last bar that leaves room for the transition
+		track.transition = -1
+		for j := 0; j < len(beats); j += mixBeatsPerBar {
+			if beats[j]+transition <= length && beats[j] >= track.start+transition {
+				track.transition = beats[j]
+			}
+		}
+		if track.transition < 0 {
+			track.transition = length - transition
+		}
+		if track.transition < track.start+transition {
+			return 0, fmt.Errorf("%s is shorter than two transitions, use a shorter --transition", track.title)
+		}
+		track.end = track.transition + transition
+	}
+	for i := 1; i < len(tracks); i++ {
+		previous := tracks[i-1]
+		tracks[i].offset = previous.offset + previous.transition - previous.start
+	}
+	last := tracks[len(tracks)-1]
+	return last.offset + last.end - last.start, nil
+}
+
+// mixFilter stretches and trims the stems of every track, fades the vocals out around the transitions unless they are
+// kept, crossfades the tracks and sums them
+func mixFilter(tracks []mixTrack, cfg MixRenderConfig) string {
+	var (
+		filter      strings.Builder
+		input       int
+		beat        = 60 / cfg.BPM
+		transition  = float64(cfg.Transition) * beat
+		vocalFade   = mixVocalFadeBeats * beat
+		stemFilters = func(track mixTrack) string {
+			return fmt.Sprintf("atempo=%.6f,atrim=start=%.6f:end=%.6f,asetpts=PTS-STARTPTS,aformat=sample_rates=%d:channel_layouts=stereo",
+				track.stretch, track.start, track.end, mixSampleRate)
+		}
+	)
+	for i, track := range tracks {
+		length := track.end - track.start
+		fmt.Fprintf(&filter, "[%d:a]%s[i%d];\n", input, stemFilters(track), i)
+		input++
+		stems := fmt.Sprintf("[i%d]", i)
+		if track.vocalPath != "" {
+			fmt.Fprintf(&filter, "[%d:a]%s", input, stemFilters(track))
+			input++
+			if !cfg.KeepVocals {
+				// silent before the fade in and after the fade out
+				if i > 0 {
+					fmt.Fprintf(&filter, ",afade=t=in:st=%.6f:d=%.6f", transition, vocalFade)
+				}
+				if i < len(tracks)-1 {
+					fmt.Fprintf(&filter, ",afade=t=out:st=%.6f:d=%.6f", max(length-transition-vocalFade, 0), vocalFade)
+				}
+			}
+			fmt.Fprintf(&filter, "[v%d];\n[i%d][v%d]amix=inputs=2:normalize=0[s%d];\n", i, i, i, i)
+			stems = fmt.Sprintf("[s%d]", i)
+		}
+		fmt.Fprintf(&filter, "%sanull", stems)
+		if i > 0 {
+			fmt.Fprintf(&filter, ",afade=t=in:st=0:d=%.6f", transition)
+		}
+		if i < len(tracks)-1 {
+			fmt.Fprintf(&filter, ",afade=t=out:st=%.6f:d=%.6f", length-transition, transition)
+		}
+		fmt.Fprintf(&filter, ",adelay=delays=%d:all=1[m%d];\n", int(math.Round(track.offset*1000)), i)
+	}
+	for i := range tracks {
+		fmt.Fprintf(&filter, "[m%d]", i)
+	}
+	if len(tracks) == 1 {
+		filter.WriteString("anull[out]\n")
+	} else {
+		fmt.Fprintf(&filter, "amix=inputs=%d:duration=longest:dropout_transition=0:normalize=0[out]\n", len(tracks))
+	}
+	return filter.String()
+}
+
+func renderScript(tracks []mixTrack, filterPath string, output string) string {
+	var command = []string{"ffmpeg", "-hide_banner", "-v", "warning", "-stats", "-y"}
+	for _, track := range tracks {
+		command = append(command, "-i", strconv.Quote(track.instrumentalPath))
+		if track.vocalPath != "" {
+			command = append(command, "-i", strconv.Quote(track.vocalPath))
+		}
+	}
+	command = append(command, "-filter_complex_script", strconv.Quote(filterPath), "-map", strconv.Quote("[out]"), strconv.Quote(output))
+	return strings.Join(command, " ") + "\n"
+}
+
+// mixTrackStart is the middle of the transition into the track, where the track takes over
+func mixTrackStart(tracks []mixTrack, index int, cfg MixRenderConfig) float64 {
+	if index == 0 {
+		return 0
+	}
+	return tracks[index].offset + float64(cfg.Transition)*60/cfg.BPM/2
+}
+
+func writeMixCue(cfg MixRenderConfig, title string, tracks []mixTrack) error {
+	var entries = make([]internal.CueEntry, 0, len(tracks))
+	for i, track := range tracks {
+		entries = append(entries, internal.CueEntry{Title: track.title, Performer: track.artist, Start: mixTrackStart(tracks, i, cfg)})
+	}
+	file, err := os.Create(cfg.Cue)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := internal.WriteCueSheet(file, title, filepath.Base(cfg.Output), entries); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func formatMixTime(seconds float64) string {
+	total := int(seconds)
+	return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+}
+
+func copyFile(source string, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fastjson"
+)
+
+// shared by the uploads of the process, concurrent uploads of a worker wait for the same rate limit
+var musicBrainz = sync.OnceValues(internal.NewMusicBrainz)
+
+// enrich looks the audio up on musicbrainz, fills the tags the audio is missing and downloads the cover of the
+// release if the album is new and no cover is given. the upload goes on with the tags it has if musicbrainz is
+// unreachable or has no matching recording.
+func (p *audioProcessor) enrich(ctx context.Context) error {
+	client, err := musicBrainz()
+	if err != nil {
+		return err
+	}
+	var query = internal.MusicBrainzQuery{
+		RecordingID: recordingIDTag(p.db_record.Info),
+		Title:       p.info.Title,
+		Artist:      p.info.Artist,
+		Album:       p.info.Album,
+	}
+	if duration, err := p.db_record.TotalDuration.Float64Value(); err == nil && duration.Valid {
+		query.Duration = duration.Float64
+	}
+	match, err := client.Lookup(ctx, query)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, internal.ErrNoMusicBrainzMatch) {
+			log.Info().Err(err).Msg("keeping the tags of the audio")
+			return nil
+		}
+		log.Warn().Err(err).Msg("failed to look up the audio on musicbrainz, keeping the tags of the audio")
+		return nil
+	}
+	p.match = &match
+	p.db_record.MusicbrainzRecordingID = pgtype.Text{String: match.RecordingID, Valid: true}
+	p.db_record.CanonicalTitle = pgtype.Text{String: match.Title, Valid: match.Title != ""}
+
+	// tags the audio has are never replaced, only the spelling of musicbrainz is stored next to them
+	var missing = make(map[string]any)
+	if p.info.Title == "" && match.Title != "" {
+		p.info.Title, missing["Title"] = match.Title, match.Title
+	}
+	if p.info.Artist == "" && match.Artist != "" {
+		p.info.Artist, missing["Artist"] = match.Artist, match.Artist
+	}
+	if p.info.Album == "" && match.ReleaseTitle != "" {
+		p.info.Album, missing["Album"] = match.ReleaseTitle, match.ReleaseTitle
+	}
+	if p.info.Year == 0 && len(match.ReleaseDate) >= 4 {
+		if year, err := strconv.Atoi(match.ReleaseDate[:4]); err == nil {
+			p.info.Year, missing["Year"] = year, year
+		}
+	}
+	if match.TrackNumber > 0 {
+		missing["Track"] = strconv.Itoa(match.TrackNumber)
+		if match.TrackCount > 0 {
+			missing["Track"] = fmt.Sprintf("%d/%d", match.TrackNumber, match.TrackCount)
+		}
+	}
+	if match.DiscNumber > 0 {
+		missing["PartOfSet"] = strconv.Itoa(match.DiscNumber)
+	}
+	if p.info.Genre == "" && match.ReleaseGroupID != "" {
+		genre, err := client.Genre(ctx, match.ReleaseGroupID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn().Err(err).Msg("failed to get the genre from musicbrainz")
+		} else if genre != "" {
+			p.info.Genre, missing["Genre"] = genre, genre
+		}
+	}
+	if p.db_record.Info, err = setMissingTags(p.db_record.Info, missing); err != nil {
+		return fmt.Errorf("failed to fill missing tags: %w", err)
+	}
+	log.Info().
+		Str("recording", match.RecordingID).
+		Str("release", match.ReleaseID).
+		Str("title", match.Title).
+		Int("score", match.Score).
+		Msg("matched audio on musicbrainz")
+
+	if p.cfg.CoverArtPath == "" && match.ReleaseID != "" && !p.cfg.DryRun {
+		if err := p.downloadCover(ctx, client); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// uploads of new albums fail later without a cover, uploads to existing albums do not need one
+			log.Warn().Err(err).Msg("failed to download cover art")
+		}
+	}
+	return nil
+}
+
+// downloadCover uses the front cover of the matched release as the cover art if the album does not exist yet
+func (p *audioProcessor) downloadCover(ctx context.Context, client *internal.MusicBrainz) error {
+	_, err := p.app.DB.GetAlbumIDByNameAndArtist(ctx, db.GetAlbumIDByNameAndArtistParams{Name: p.info.Album, Artist: p.info.Artist})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to get album: %w", err)
+	}
+	image, err := client.CoverArt(ctx, p.match.ReleaseID, p.match.ReleaseGroupID)
+	if err != nil {
+		return err
+	}
+	var extension string
+	switch contentType := http.DetectContentType(image); contentType {
+	case "image/jpeg":
+		extension = ".jpg"
+	case "image/png":
+		extension = ".png"
+	case "image/webp":
+		extension = ".webp"
+	default:
+		return fmt.Errorf("cover art archive responded with %s instead of an image", contentType)
+	}
+	if p.paths.cover, err = os.MkdirTemp(os.TempDir(), "strafe-cover-*"); err != nil {
+		return fmt.Errorf("failed to create cover directory: %w", err)
+	}
+	// the name of the file is the name of the cover object
+	path := filepath.Join(p.paths.cover, "cover"+extension)
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		return fmt.Errorf("failed to write cover: %w", err)
+	}
+	p.cfg.CoverArtPath = path
+	log.Info().Str("release", p.match.ReleaseID).Msg("downloaded cover art from the cover art archive")
+	return nil
+}
+
+// saveMatch sets the release of the album and the ids of the credited artists, ids they have already are kept
+func (p *audioProcessor) saveMatch(ctx context.Context, q *db.Queries) error {
+	if p.match.ReleaseID != "" {
+		if err := q.SetAlbumMusicBrainz(ctx, db.SetAlbumMusicBrainzParams{
+			ID:                        p.db_record.AlbumID,
+			MusicbrainzReleaseID:      pgtype.Text{String: p.match.ReleaseID, Valid: true},
+			MusicbrainzReleaseGroupID: pgtype.Text{String: p.match.ReleaseGroupID, Valid: p.match.ReleaseGroupID != ""},
+			CanonicalName:             pgtype.Text{String: p.match.ReleaseTitle, Valid: p.match.ReleaseTitle != ""},
+			ReleaseDate:               pgtype.Text{String: p.match.ReleaseDate, Valid: p.match.ReleaseDate != ""},
+		}); err != nil {
+			return fmt.Errorf("failed to set release of album: %w", err)
+		}
+	}
+	for _, artist := range p.match.Artists {
+		if artist.ID == "" {
+			continue
+		}
+		if err := q.SetArtistMusicBrainzID(ctx, db.SetArtistMusicBrainzIDParams{MusicbrainzID: artist.ID, MatchName: internal.ArtistMatchName(artist.Name)}); err != nil {
+			return fmt.Errorf("failed to set id of artist %s: %w", artist.Name, err)
+		}
+	}
+	return nil
+}
+
+// recordingIDTag returns the MusicBrainz Track Id tag taggers such as picard write, exiftool names it differently
+// for every format
+func recordingIDTag(info []byte) string {
+	object, err := fastjson.ParseBytes(info)
+	if err != nil || object.Type() != fastjson.TypeObject {
+		return ""
+	}
+	var id string
+	object.GetObject().Visit(func(key []byte, value *fastjson.Value) {
+		name := strings.ToLower(strings.NewReplacer("_", "", " ", "", "-", "").Replace(string(key)))
+		if name != "musicbrainztrackid" && name != "musicbrainzrecordingid" {
+			return
+		}
+		if candidate := string(value.GetStringBytes()); uuid.Validate(candidate) == nil {
+			id = candidate
+		}
+	})
+	return id
+}
+
+// setMissingTags sets the tags the exiftool output does not have or has empty
+func setMissingTags(info []byte, tags map[string]any) ([]byte, error) {
+	if len(tags) == 0 {
+		return info, nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(info, &object); err != nil {
+		return nil, err
+	}
+	for key, value := range tags {
+		if existing, ok := object[key]; ok && string(existing) != `""` && string(existing) != "null" {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = encoded
+	}
+	return json.Marshal(object)
+}
@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/valyala/fastjson"
+)
+
+type PlaylistCreateConfig struct {
+	Description string
+	Owner       string
+}
+
+type PlaylistAddConfig struct {
+	// appended if negative
+	Position int32
+}
+
+type PlaylistListConfig struct {
+	Owner  string
+	Limit  int32
+	Offset int32
+}
+
+type PlaylistExportConfig struct {
+	Output  string
+	BaseURL string
+	Stem    string
+}
+
+var (
+	playlistCmd = &cobra.Command{
+		Use:   "playlist",
+		Short: "create, fill and export playlists",
+	}
+	playlistCreateCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "create a playlist, playlists without an owner can only be changed with the cli",
+		Args:  cobra.ExactArgs(1),
+		Run:   WrapCommandWithResources(createPlaylist, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	playlistCreateCfg = PlaylistCreateConfig{}
+	playlistAddCmd    = &cobra.Command{
+		Use:   "add <playlist id or name> <track id>...",
+		Short: "add tracks to the playlist in the given order",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   WrapCommandWithResources(addToPlaylist, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	playlistAddCfg  = PlaylistAddConfig{}
+	playlistListCmd = &cobra.Command{
+		Use:   "list [playlist id or name]",
+		Short: "list playlists, or the tracks of the playlist",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   WrapCommandWithResources(listPlaylists, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	playlistListCfg   = PlaylistListConfig{}
+	playlistExportCmd = &cobra.Command{
+		Use:   "export <playlist id or name>",
+		Short: "export the playlist as M3U8 that points at the HLS playlist of every track",
+		Args:  cobra.ExactArgs(1),
+		Run:   WrapCommandWithResources(exportPlaylist, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	playlistExportCfg = PlaylistExportConfig{}
+)
+
+func getPlaylistCmd() *cobra.Command {
+	playlistCreateCmd.PersistentFlags().StringVarP(&playlistCreateCfg.Description, "description", "d", "", "description of the playlist")
+	playlistCreateCmd.PersistentFlags().StringVar(&playlistCreateCfg.Owner, "owner", "", "anon id of the listener that owns the playlist")
+	playlistAddCmd.PersistentFlags().Int32VarP(&playlistAddCfg.Position, "position", "p", -1, "position to insert the tracks at, starting from 0, appended by default")
+	playlistListCmd.PersistentFlags().StringVar(&playlistListCfg.Owner, "owner", "", "only list the playlists of the listener")
+	playlistListCmd.PersistentFlags().Int32VarP(&playlistListCfg.Limit, "limit", "l", 50, "number of playlists to list")
+	playlistListCmd.PersistentFlags().Int32VarP(&playlistListCfg.Offset, "offset", "o", 0, "number of playlists to skip")
+	playlistExportCmd.PersistentFlags().StringVarP(&playlistExportCfg.Output, "output", "o", "", "file to write the playlist to, stdout by default")
+	playlistExportCmd.PersistentFlags().StringVar(&playlistExportCfg.BaseURL, "base-url", "", "url of the strafe server, tracks point at its playlist endpoint unless assets.public_base_url is set")
+	playlistExportCmd.PersistentFlags().StringVar(&playlistExportCfg.Stem, "stem", "instrumental", "instrumental or vocal, instrumental tracks always use instrumental")
+	playlistCmd.AddCommand(playlistCreateCmd)
+	playlistCmd.AddCommand(playlistAddCmd)
+	playlistCmd.AddCommand(playlistListCmd)
+	playlistCmd.AddCommand(playlistExportCmd)
+	return playlistCmd
+}
+
+func createPlaylist(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var params = db.CreatePlaylistParams{Name: strings.TrimSpace(args[0])}
+	if params.Name == "" {
+		log.Error().Msg("playlist name cannot be empty")
+		return
+	}
+	if playlistCreateCfg.Description != "" {
+		params.Description = pgtype.Text{String: playlistCreateCfg.Description, Valid: true}
+	}
+	if playlistCreateCfg.Owner != "" {
+		params.AnonID = pgtype.Text{String: playlistCreateCfg.Owner, Valid: true}
+	}
+	playlist, err := app.DB.CreatePlaylist(ctx, params)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create playlist")
+		return
+	}
+	fmt.Println(playlist.ID)
+}
+
+func addToPlaylist(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	tx, err := app.Conn.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to begin transaction")
+		return
+	}
+	defer tx.Rollback(context.Background())
+	qtx := app.DB.WithTx(tx)
+	playlist, err := resolvePlaylist(ctx, qtx, args[0])
+	if err != nil {
+		log.Error().Err(err).Str("playlist", args[0]).Msg("failed to get playlist")
+		return
+	}
+	// locks the playlist until the tracks are added
+	if _, err := qtx.TouchPlaylist(ctx, playlist.ID); err != nil {
+		log.Error().Err(err).Msg("failed to lock playlist")
+		return
+	}
+	count, err := qtx.CountPlaylistItems(ctx, playlist.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to count playlist items")
+		return
+	}
+	var position = int32(count)
+	if playlistAddCfg.Position >= 0 {
+		if int64(playlistAddCfg.Position) > count {
+			log.Error().Int64("items", count).Msgf("position must be between 0 and %d", count)
+			return
+		}
+		position = playlistAddCfg.Position
+	}
+	for _, trackID := range args[1:] {
+		if _, err := uuid.Parse(trackID); err != nil {
+			log.Error().Err(err).Str("track", trackID).Msg("track id is not a uuid")
+			return
+		}
+		exists, err := qtx.TrackExists(ctx, trackID)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to check track")
+			return
+		}
+		if !exists {
+			log.Error().Str("track", trackID).Msg("track does not exist")
+			return
+		}
+		if _, err := qtx.InsertPlaylistItem(ctx, db.InsertPlaylistItemParams{PlaylistID: playlist.ID, TrackID: trackID, Position: position}); err != nil {
+			log.Error().Err(err).Str("track", trackID).Msg("failed to add track to playlist")
+			return
+		}
+		position++
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to commit transaction")
+		return
+	}
+	log.Info().Str("playlist", playlist.Name).Int("tracks", len(args)-1).Msg("added tracks")
+}
+
+func listPlaylists(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	if len(args) == 0 {
+		var params = db.ListPlaylistsParams{ResultLimit: playlistListCfg.Limit, ResultOffset: playlistListCfg.Offset}
+		if playlistListCfg.Owner != "" {
+			params.AnonID = pgtype.Text{String: playlistListCfg.Owner, Valid: true}
+		}
+		playlists, err := app.DB.ListPlaylists(ctx, params)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to list playlists")
+			return
+		}
+		t.AppendHeader(table.Row{"ID", "Name", "Owner", "Tracks", "Length", "Updated"})
+		for _, playlist := range playlists {
+			length, _ := playlist.TotalDuration.Float64Value()
+			t.AppendRow(table.Row{
+				playlist.ID,
+				playlist.Name,
+				playlist.AnonID.String,
+				playlist.TrackCount,
+				formatHours(length.Float64),
+				playlist.UpdatedAt.Time.Format("2006-01-02 15:04"),
+			})
+		}
+		t.Render()
+		return
+	}
+	playlist, err := resolvePlaylist(ctx, app.DB, args[0])
+	if err != nil {
+		log.Error().Err(err).Str("playlist", args[0]).Msg("failed to get playlist")
+		return
+	}
+	items, err := app.DB.ListPlaylistItems(ctx, playlist.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list playlist items")
+		return
+	}
+	t.SetTitle(playlist.Name)
+	t.AppendHeader(table.Row{"#", "Title", "Artist", "Album", "Length", "Track ID"})
+	for _, item := range items {
+		seconds, _ := item.TotalDuration.Float64Value()
+		t.AppendRow(table.Row{
+			item.Position,
+			fastjson.GetString(item.Info, "Title"),
+			fastjson.GetString(item.Info, "Artist"),
+			item.AlbumName,
+			fmt.Sprintf("%d:%02d", int(seconds.Float64/60), int(seconds.Float64)%60),
+			item.ID,
+		})
+	}
+	t.Render()
+}
+
+// exportPlaylist points at the playlists under assets.public_base_url if it is set, otherwise at the playlist
+// endpoint of the server which presigns the segments
+func exportPlaylist(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	if playlistExportCfg.Stem != "instrumental" && playlistExportCfg.Stem != "vocal" {
+		log.Error().Str("stem", playlistExportCfg.Stem).Msg("stem must be instrumental or vocal")
+		return
+	}
+	var baseURL = strings.TrimSuffix(playlistExportCfg.BaseURL, "/")
+	if viper.GetString(internal.ASSETS_PUBLIC_BASE_URL) != "" {
+		if err := app.InitializeAssets(); err != nil {
+			log.Error().Err(err).Msg("failed to initialize assets")
+			return
+		}
+	} else if baseURL == "" {
+		log.Error().Msgf("--base-url is required when %s is not set", internal.ASSETS_PUBLIC_BASE_URL)
+		return
+	}
+	playlist, err := resolvePlaylist(ctx, app.DB, args[0])
+	if err != nil {
+		log.Error().Err(err).Str("playlist", args[0]).Msg("failed to get playlist")
+		return
+	}
+	items, err := app.DB.ListPlaylistItems(ctx, playlist.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list playlist items")
+		return
+	}
+	var entries = make([]internal.M3U8Entry, 0, len(items))
+	for _, item := range items {
+		var stem, folderPath = "instrumental", item.InstrumentalFolderPath
+		if playlistExportCfg.Stem == "vocal" && item.VocalFolderPath.Valid {
+			stem, folderPath = "vocal", item.VocalFolderPath.String
+		}
+		var url = fmt.Sprintf("%s/track/%s/playlist/%s.m3u8", baseURL, item.ID, stem)
+		if app.Assets != nil {
+			if url, err = app.Assets.URL(ctx, internal.PlaylistKey(folderPath)); err != nil {
+				log.Error().Err(err).Msg("failed to resolve playlist url")
+				return
+			}
+		}
+		seconds, _ := item.TotalDuration.Float64Value()
+		entries = append(entries, internal.M3U8Entry{
+			Duration: seconds.Float64,
+			Title:    fmt.Sprintf("%s - %s", fastjson.GetString(item.Info, "Artist"), fastjson.GetString(item.Info, "Title")),
+			URL:      url,
+		})
+	}
+	var out io.Writer = os.Stdout
+	if playlistExportCfg.Output != "" {
+		file, err := os.Create(playlistExportCfg.Output)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to create output file")
+			return
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := internal.WriteM3U8(out, playlist.Name, entries); err != nil {
+		log.Error().Err(err).Msg("failed to export playlist")
+		return
+	}
+	if playlistExportCfg.Output != "" {
+		log.Info().Str("file", playlistExportCfg.Output).Int("tracks", len(entries)).Msg("exported playlist")
+	}
+}
+
+// resolvePlaylist gets the playlist by id, or by name if the name is unique
+func resolvePlaylist(ctx context.Context, q *db.Queries, idOrName string) (db.Playlist, error) {
+	if _, err := uuid.Parse(idOrName); err == nil {
+		return q.GetPlaylist(ctx, idOrName)
+	}
+	playlists, err := q.GetPlaylistsByName(ctx, idOrName)
+	if err != nil {
+		return db.Playlist{}, err
+	}
+	switch len(playlists) {
+	case 0:
+		return db.Playlist{}, fmt.Errorf("no playlist is named %s", idOrName)
+	case 1:
+		return playlists[0], nil
+	default:
+		var ids = make([]string, 0, len(playlists))
+		for _, playlist := range playlists {
+			ids = append(ids, playlist.ID)
+		}
+		return db.Playlist{}, errors.New("more than one playlist has this name, use one of the ids: " + strings.Join(ids, ", "))
+	}
+}
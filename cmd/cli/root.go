@@ -50,6 +50,10 @@ func init() {
 	rootCmd.AddCommand(getAudioRootCmd())
 	rootCmd.AddCommand(server.GetRunCmd())
 	rootCmd.AddCommand(getDBRootCmd())
+	rootCmd.AddCommand(getAuthRootCmd())
+	rootCmd.AddCommand(getWorkerCmd())
+	rootCmd.AddCommand(getMixCmd())
+	rootCmd.AddCommand(getWatchCmd())
 }
 
 func modifyHelp(fn func(cmd *cobra.Command, args []string)) func(cmd *cobra.Command, args []string) {
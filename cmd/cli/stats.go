@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/fatih/color"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/valyala/fastjson"
+)
+
+type StatsConfig struct {
+	Window string
+	Limit  int32
+	JSON   bool
+}
+
+var (
+	statsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "print library totals, key, tempo and genre distribution, and play trends",
+		Run:   WrapCommandWithResources(printStats, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	statsCfg = StatsConfig{}
+)
+
+type StatsBucket struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type DayTrend struct {
+	Day             time.Time `json:"day"`
+	Plays           int64     `json:"plays"`
+	Completes       int64     `json:"completes"`
+	Skips           int64     `json:"skips"`
+	ListenedSeconds float64   `json:"listened_seconds"`
+	Listeners       int64     `json:"listeners"`
+	Picks           int64     `json:"picks"`
+}
+
+type TopEntry struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Plays    int64   `json:"plays"`
+	Skips    int64   `json:"skips"`
+	SkipRate float64 `json:"skip_rate"`
+	Picks    int64   `json:"picks"`
+}
+
+// LibraryStats is printed as json with --json
+type LibraryStats struct {
+	Tracks        int64           `json:"tracks"`
+	Albums        int64           `json:"albums"`
+	Artists       int64           `json:"artists"`
+	Instrumental  int64           `json:"instrumental"`
+	TotalDuration float64         `json:"total_duration"`
+	Keys          []StatsBucket   `json:"keys"`
+	Tempo         []StatsBucket   `json:"tempo"`
+	Genres        []StatsBucket   `json:"genres"`
+	Window        internal.Window `json:"window"`
+	Trends        []DayTrend      `json:"trends"`
+	TopTracks     []TopEntry      `json:"top_tracks"`
+	TopArtists    []TopEntry      `json:"top_artists"`
+}
+
+func getStatsCmd() *cobra.Command {
+	statsCmd.PersistentFlags().StringVarP(&statsCfg.Window, "window", "w", internal.DefaultStatsWindow, "window of play trends and top tracks such as 24h, 7d, 4w or all")
+	statsCmd.PersistentFlags().Int32VarP(&statsCfg.Limit, "limit", "l", 10, "number of top tracks and artists to list")
+	statsCmd.PersistentFlags().BoolVar(&statsCfg.JSON, "json", false, "print as json")
+	return statsCmd
+}
+
+func printStats(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	window, err := internal.ParseWindow(statsCfg.Window, time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to parse window")
+		return
+	}
+	var stats = LibraryStats{Window: window}
+	if stats.Tracks, err = app.DB.GetTrackCount(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to count tracks")
+		return
+	}
+	totals, err := app.DB.GetLibraryTotals(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get library totals")
+		return
+	}
+	stats.Albums = totals.AlbumCount
+	stats.Artists = totals.ArtistCount
+	stats.Instrumental = totals.InstrumentalCount
+	duration, _ := totals.TotalDuration.Float64Value()
+	stats.TotalDuration = duration.Float64
+
+	facets, err := app.DB.TrackFacets(ctx, db.TrackFacetsParams{})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to count tracks by key, tempo and genre")
+		return
+	}
+	var camelot = make(map[string]int)
+	for _, facet := range facets {
+		switch facet.Facet {
+		case "key":
+			// enharmonic spellings share the same camelot code
+			code, err := internal.CamelotCode(facet.Value)
+			if err != nil {
+				code = facet.Value
+			}
+			if i, ok := camelot[code]; ok {
+				stats.Keys[i].Count += facet.Count
+				continue
+			}
+			camelot[code] = len(stats.Keys)
+			stats.Keys = append(stats.Keys, StatsBucket{Value: code, Count: facet.Count})
+		case "tempo":
+			stats.Tempo = append(stats.Tempo, StatsBucket{Value: facet.Value, Count: facet.Count})
+		case "genre":
+			stats.Genres = append(stats.Genres, StatsBucket{Value: facet.Value, Count: facet.Count})
+		}
+	}
+
+	since, until := window.Bounds()
+	trends, err := app.DB.PlayTrends(ctx, db.PlayTrendsParams{Since: since, Until: until})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get play trends")
+		return
+	}
+	for _, trend := range trends {
+		listened, _ := trend.ListenedSeconds.Float64Value()
+		stats.Trends = append(stats.Trends, DayTrend{
+			Day:             trend.Day.Time,
+			Plays:           trend.Plays,
+			Completes:       trend.Completes,
+			Skips:           trend.Skips,
+			ListenedSeconds: listened.Float64,
+			Listeners:       trend.Listeners,
+			Picks:           trend.Picks,
+		})
+	}
+	topTracks, err := app.DB.TopTracks(ctx, db.TopTracksParams{ResultLimit: statsCfg.Limit, Since: since, Until: until})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get top tracks")
+		return
+	}
+	for _, track := range topTracks {
+		stats.TopTracks = append(stats.TopTracks, TopEntry{
+			ID:       track.ID,
+			Name:     fmt.Sprintf("%s - %s", fastjson.GetString(track.Info, "Artist"), fastjson.GetString(track.Info, "Title")),
+			Plays:    track.Plays,
+			Skips:    track.Skips,
+			SkipRate: internal.SkipRate(track.Completes, track.Skips),
+			Picks:    track.Picks,
+		})
+	}
+	topArtists, err := app.DB.TopArtists(ctx, db.TopArtistsParams{ResultLimit: statsCfg.Limit, Since: since, Until: until})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get top artists")
+		return
+	}
+	for _, artist := range topArtists {
+		stats.TopArtists = append(stats.TopArtists, TopEntry{
+			ID:       artist.ID,
+			Name:     artist.Name,
+			Plays:    artist.Plays,
+			Skips:    artist.Skips,
+			SkipRate: internal.SkipRate(artist.Completes, artist.Skips),
+			Picks:    artist.Picks,
+		})
+	}
+
+	if statsCfg.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			log.Error().Err(err).Msg("failed to encode stats")
+		}
+		return
+	}
+	renderStats(stats)
+}
+
+func renderStats(stats LibraryStats) {
+	newTable := func(title string, header table.Row) table.Writer {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.SetStyle(table.StyleColoredBright)
+		t.SetTitle(title)
+		t.AppendHeader(header)
+		return t
+	}
+
+	library := newTable("Library", table.Row{"Tracks", "Albums", "Artists", "Instrumental", "Total Duration"})
+	library.AppendRow(table.Row{stats.Tracks, stats.Albums, stats.Artists, stats.Instrumental, formatHours(stats.TotalDuration)})
+	library.Render()
+
+	for _, distribution := range []struct {
+		title   string
+		header  string
+		buckets []StatsBucket
+	}{
+		{"Keys", "Camelot", stats.Keys},
+		{"Tempo", "BPM", stats.Tempo},
+		{"Genres", "Genre", stats.Genres},
+	} {
+		if len(distribution.buckets) == 0 {
+			continue
+		}
+		var largest int64
+		for _, bucket := range distribution.buckets {
+			largest = max(largest, bucket.Count)
+		}
+		t := newTable(distribution.title, table.Row{distribution.header, "Tracks", ""})
+		for _, bucket := range distribution.buckets {
+			t.AppendRow(table.Row{bucket.Value, bucket.Count, strings.Repeat("█", int(bucket.Count*40/largest))})
+		}
+		t.Render()
+	}
+
+	var windowTitle = "all time"
+	if stats.Window.Since != nil {
+		windowTitle = "since " + stats.Window.Since.Format(time.DateOnly)
+	}
+	if len(stats.Trends) == 0 {
+		fmt.Println(color.YellowString("nothing was played %s", windowTitle))
+		return
+	}
+	trends := newTable("Plays "+windowTitle, table.Row{"Day", "Plays", "Completes", "Skips", "Listened", "Listeners", "Picks"})
+	for _, trend := range stats.Trends {
+		trends.AppendRow(table.Row{
+			trend.Day.Format(time.DateOnly),
+			trend.Plays,
+			trend.Completes,
+			trend.Skips,
+			formatHours(trend.ListenedSeconds),
+			trend.Listeners,
+			trend.Picks,
+		})
+	}
+	trends.Render()
+	for _, top := range []struct {
+		title   string
+		entries []TopEntry
+	}{
+		{"Top Tracks " + windowTitle, stats.TopTracks},
+		{"Top Artists " + windowTitle, stats.TopArtists},
+	} {
+		t := newTable(top.title, table.Row{"Name", "Plays", "Skips", "Skip Rate", "Picks"})
+		for _, entry := range top.entries {
+			t.AppendRow(table.Row{entry.Name, entry.Plays, entry.Skips, fmt.Sprintf("%.0f%%", entry.SkipRate*100), entry.Picks})
+		}
+		t.Render()
+	}
+}
+
+// formatHours formats seconds as "12h 03m"
+func formatHours(seconds float64) string {
+	total := int(seconds)
+	return fmt.Sprintf("%dh %02dm", total/3600, total%3600/60)
+}
@@ -0,0 +1,599 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+
+	"github.com/briandowns/spinner"
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	watchStatusDone   = "done"
+	watchStatusFailed = "failed"
+	// pending files are checked this often
+	watchPollInterval = time.Second
+)
+
+var (
+	watchAudioExtensions = []string{".mp3", ".flac", ".wav", ".m4a", ".aac", ".ogg", ".opus", ".aif", ".aiff"}
+	watchImageExtensions = []string{".jpg", ".jpeg", ".png", ".webp"}
+	// cover images with these names are preferred over other images of the folder
+	watchCoverNames = []string{"cover", "folder", "front", "album"}
+)
+
+type WatchConfig struct {
+	// added files are moved here, <dir>/done by default
+	DoneDir string
+	// files that could not be added are moved here with the error next to them, <dir>/failed by default
+	FailedDir string
+	// <dir>/.strafe-watch.json by default
+	StateFile string
+	// files are processed once their size and modification time did not change for this long
+	Settle time.Duration
+	Upload UploadConfig
+}
+
+var (
+	watchCmd = &cobra.Command{
+		Use:   "watch <dir>",
+		Short: "add audio files dropped into the folder to the library",
+		Long: `add audio files dropped into the folder to the library with the same pipeline as strafe audio upload.
+
+files are processed once their size did not change for --settle, files of the same folder are processed together
+in name order as an album, with the cover image next to them. added files are moved to --done and files that failed
+to --failed, keeping their folders. the state file remembers the checksum of every added file, so files dropped
+again or left behind by a restart are not added twice. SIGINT or SIGTERM stops after the current file, a second
+signal cancels it. requires strafe docker image.`,
+		Args: cobra.ExactArgs(1),
+		Run:  WrapCommandWithResources(watchFolder, ResourceConfig{Resources: []ResourceType{ResourceDocker, ResourceDatabase, ResourceStorage}}),
+	}
+	watchCfg = WatchConfig{}
+)
+
+func getWatchCmd() *cobra.Command {
+	watchCmd.Flags().StringVar(&watchCfg.DoneDir, "done", "", "folder added files are moved to, <dir>/done by default")
+	watchCmd.Flags().StringVar(&watchCfg.FailedDir, "failed", "", "folder files that could not be added are moved to, <dir>/failed by default")
+	watchCmd.Flags().StringVar(&watchCfg.StateFile, "state", "", "file that remembers added files, <dir>/.strafe-watch.json by default")
+	watchCmd.Flags().DurationVar(&watchCfg.Settle, "settle", 10*time.Second, "wait until files did not change for this long, copies are in progress until then")
+	watchCmd.Flags().BoolVar(&watchCfg.Upload.IsInstrumental, "instrumental", false, "every dropped file is instrumental")
+	watchCmd.Flags().Int32VarP(&watchCfg.Upload.WaveformPPS, "pps", "P", 100, "waveform zoom level (pixels per second)")
+	watchCmd.Flags().StringVar(&watchCfg.Upload.ModelCheckpoint, "model", "mel_band_roformer_karaoke_aufr33_viperx_sdr_10.1956.ckpt", "model name for audio splitter, see strafe audio models for full list")
+	watchCmd.Flags().StringVar(&watchCfg.Upload.ModelDownloadDir, "model_file_directory", "/tmp/audio-separator-models/", "model download folder / file directory on the host machine")
+	watchCmd.Flags().BoolVar(&watchCfg.Upload.UseGPU, "gpu", false, "use gpu during audio separation")
+	watchCmd.Flags().BoolVar(&watchCfg.Upload.MusicBrainz, "musicbrainz", false, "fill missing tags from musicbrainz and fetch the cover of new albums from the cover art archive")
+	return watchCmd
+}
+
+// watchState is the local record of processed files by the sha256 of their contents, written after every file
+type watchState struct {
+	path  string
+	Files map[string]watchStateEntry `json:"files"`
+}
+
+type watchStateEntry struct {
+	// relative to the watched folder when it was processed
+	Path       string    `json:"path"`
+	Status     string    `json:"status"`
+	TrackID    string    `json:"track_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+func loadWatchState(path string) (*watchState, error) {
+	state := &watchState{path: path, Files: make(map[string]watchStateEntry)}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]watchStateEntry)
+	}
+	return state, nil
+}
+
+// save writes the state next to the file and renames it, a crash never leaves a partial state behind
+func (s *watchState) save() error {
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(s.path), ".strafe-watch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(contents); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), s.path)
+}
+
+// watchFile is an audio file waiting for its copy to finish
+type watchFile struct {
+	size     int64
+	modified time.Time
+	// last time the size or the modification time changed
+	changed time.Time
+}
+
+type folderWatcher struct {
+	cfg     WatchConfig
+	app     internal.AppCtx
+	root    string
+	notify  *fsnotify.Watcher
+	state   *watchState
+	pending map[string]*watchFile
+	// last event of any file of the folder, covers and lyrics are copied along with the audio
+	touched map[string]time.Time
+	// cancelled on the second signal, the file being processed is left in place
+	kill context.Context
+}
+
+func watchFolder(cmd *cobra.Command, args []string) {
+	exitIfImage(DoesNotExist)
+	// the watcher runs until it is stopped, the timeout of the command does not apply
+	ctx := context.WithoutCancel(cmd.Context())
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	root, err := filepath.Abs(args[0])
+	if err != nil {
+		log.Error().Err(err).Msg("failed to resolve folder")
+		return
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		log.Error().Err(err).Str("dir", root).Msg("folder does not exist")
+		return
+	}
+	var cfg = watchCfg
+	if cfg.DoneDir == "" {
+		cfg.DoneDir = filepath.Join(root, "done")
+	}
+	if cfg.FailedDir == "" {
+		cfg.FailedDir = filepath.Join(root, "failed")
+	}
+	if cfg.StateFile == "" {
+		cfg.StateFile = filepath.Join(root, ".strafe-watch.json")
+	}
+	for _, dir := range []*string{&cfg.DoneDir, &cfg.FailedDir, &cfg.StateFile} {
+		if *dir, err = filepath.Abs(*dir); err != nil {
+			log.Error().Err(err).Msg("failed to resolve folder")
+			return
+		}
+	}
+	state, err := loadWatchState(cfg.StateFile)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load state")
+		return
+	}
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create watcher")
+		return
+	}
+	defer notify.Close()
+
+	stop, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	kill, killFile := context.WithCancel(ctx)
+	defer killFile()
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		log.Info().Msg("stopping after the current file. send the signal again to cancel it")
+		stopWatching()
+		<-signals
+		log.Warn().Msg("cancelling the current file")
+		killFile()
+	}()
+
+	w := &folderWatcher{
+		cfg:     cfg,
+		app:     app,
+		root:    root,
+		notify:  notify,
+		state:   state,
+		pending: make(map[string]*watchFile),
+		touched: make(map[string]time.Time),
+		kill:    kill,
+	}
+	// files dropped while the watcher was not running are found by the first scan
+	if err := w.scan(root); err != nil {
+		log.Error().Err(err).Msg("failed to watch folder")
+		return
+	}
+	log.Info().Str("dir", root).Int("pending", len(w.pending)).Msg("watching for audio files")
+	w.run(stop)
+	log.Info().Msg("watcher stopped")
+}
+
+// run handles events and processes folders whose files settled until ctx is done, folders are processed one after
+// another while events of other folders keep arriving
+func (w *folderWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	var (
+		processing bool
+		finished   = make(chan struct{})
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			if processing {
+				<-finished
+			}
+			return
+		case event, ok := <-w.notify.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.notify.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Err(err).Msg("watcher error")
+			// events were dropped, files that were missed are found again
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				if err := w.scan(w.root); err != nil {
+					log.Error().Err(err).Msg("failed to rescan folder")
+				}
+			}
+		case <-finished:
+			processing = false
+		case <-ticker.C:
+			if processing {
+				continue
+			}
+			folder, files := w.settled()
+			if folder == "" {
+				continue
+			}
+			for _, file := range files {
+				delete(w.pending, file)
+			}
+			processing = true
+			go func() {
+				w.processFolder(folder, files)
+				finished <- struct{}{}
+			}()
+		}
+	}
+}
+
+// ignored reports whether the path is one the watcher writes to, or hidden
+func (w *folderWatcher) ignored(path string) bool {
+	for _, dir := range []string{w.cfg.DoneDir, w.cfg.FailedDir} {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return path == w.cfg.StateFile || (path != w.root && strings.HasPrefix(filepath.Base(path), "."))
+}
+
+// scan watches the folder and its subfolders and queues the audio files in them
+func (w *folderWatcher) scan(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// removed while walking
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if w.ignored(path) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if err := w.notify.Add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+			return nil
+		}
+		w.touch(path)
+		return nil
+	})
+}
+
+func (w *folderWatcher) handle(event fsnotify.Event) {
+	if w.ignored(event.Name) {
+		return
+	}
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		// the new name of a renamed file arrives as a create event
+		delete(w.pending, event.Name)
+		return
+	}
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			// files copied into the folder before it was watched are only found by walking it
+			if err := w.scan(event.Name); err != nil {
+				log.Error().Err(err).Str("dir", event.Name).Msg("failed to watch folder")
+			}
+			return
+		}
+	}
+	w.touch(event.Name)
+}
+
+// touch queues the file if it is audio and marks its folder as changed
+func (w *folderWatcher) touch(path string) {
+	now := time.Now()
+	w.touched[filepath.Dir(path)] = now
+	if !slices.Contains(watchAudioExtensions, strings.ToLower(filepath.Ext(path))) {
+		return
+	}
+	if _, ok := w.pending[path]; !ok {
+		w.pending[path] = &watchFile{size: -1}
+	}
+	w.pending[path].changed = now
+}
+
+// settled returns the first folder whose audio files did not change for the settle time, and the files in name order
+func (w *folderWatcher) settled() (string, []string) {
+	var (
+		now     = time.Now()
+		folders = make(map[string][]string)
+		busy    = make(map[string]bool)
+	)
+	for path, file := range w.pending {
+		folder := filepath.Dir(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path)
+			continue
+		}
+		if info.Size() != file.size || !info.ModTime().Equal(file.modified) {
+			file.size, file.modified, file.changed = info.Size(), info.ModTime(), now
+		}
+		if file.size == 0 || now.Sub(file.changed) < w.cfg.Settle || now.Sub(w.touched[folder]) < w.cfg.Settle {
+			busy[folder] = true
+		}
+		folders[folder] = append(folders[folder], path)
+	}
+	var names []string
+	for folder := range folders {
+		if !busy[folder] {
+			names = append(names, folder)
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	slices.Sort(names)
+	files := folders[names[0]]
+	slices.Sort(files)
+	return names[0], files
+}
+
+// processFolder adds the files of the folder as an album, the cover image of the folder is used for every file
+func (w *folderWatcher) processFolder(folder string, files []string) {
+	cover := findCover(folder)
+	var failed bool
+	for _, path := range files {
+		if w.kill.Err() != nil {
+			return
+		}
+		relative, _ := filepath.Rel(w.root, path)
+		logger := log.With().Str("file", relative).Logger()
+		sum, err := fileSHA256(path)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to read file")
+			continue
+		}
+		if entry, ok := w.state.Files[sum]; ok && entry.Status == watchStatusDone {
+			logger.Info().Str("track", entry.TrackID).Msg("file was added before, moving it to done")
+			w.move(path, w.cfg.DoneDir, logger)
+			continue
+		}
+		logger.Info().Msg("adding file")
+		trackID, err := w.ingest(path, cover, logger)
+		if err != nil && w.kill.Err() != nil {
+			// cancelled, the file is processed again on the next run
+			logger.Warn().Msg("cancelled, the file is left in place")
+			return
+		}
+		var entry = watchStateEntry{Path: relative, FinishedAt: time.Now()}
+		if err != nil {
+			failed = true
+			entry.Status, entry.Error = watchStatusFailed, err.Error()
+			logger.Error().Err(err).Msg("failed to add file")
+		} else {
+			entry.Status, entry.TrackID = watchStatusDone, trackID
+			logger.Info().Str("track", trackID).Msg("file added")
+		}
+		w.state.Files[sum] = entry
+		if err := w.state.save(); err != nil {
+			logger.Error().Err(err).Msg("failed to save state")
+		}
+		if err != nil {
+			if target := w.move(path, w.cfg.FailedDir, logger); target != "" {
+				if err := os.WriteFile(target+".error.txt", []byte(entry.Error+"\n"), 0o644); err != nil {
+					logger.Error().Err(err).Msg("failed to write error")
+				}
+			}
+			continue
+		}
+		w.move(path, w.cfg.DoneDir, logger)
+	}
+	w.cleanFolder(folder, cover, failed)
+}
+
+// ingest runs the upload pipeline on the file, returns the id of the inserted track
+func (w *folderWatcher) ingest(path string, cover string, logger zerolog.Logger) (string, error) {
+	dir, err := os.MkdirTemp(os.TempDir(), "strafe-watch-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	var cfg = w.cfg.Upload
+	cfg.AudioPath = path
+	cfg.CoverArtPath = cover
+	cfg.OutputDir = filepath.Join(dir, "stems")
+	cfg.NonInteractive = true
+	processor := &audioProcessor{
+		cfg:     cfg,
+		app:     w.app,
+		ctx:     w.kill,
+		spinner: spinner.New(spinner.CharSets[12], 100*time.Millisecond, spinner.WithWriter(io.Discard)),
+	}
+	processor.events = func(event internal.ProgressEvent) {
+		switch event.Type {
+		case internal.ProgressStageStarted:
+			logger.Info().Str("stage", event.Stage).Msg("stage started")
+		case internal.ProgressLog:
+			logger.Debug().Str("stage", event.Stage).Msg(event.Message)
+		}
+	}
+	processor.output = internal.NewProgressWriter(processor.emit)
+	if err := processor.run(); err != nil {
+		return "", err
+	}
+	return processor.db_record.ID, nil
+}
+
+// move moves the file and its lyrics to the same folder under target, returns the new path of the file
+func (w *folderWatcher) move(path string, target string, logger zerolog.Logger) string {
+	relative, err := filepath.Rel(w.root, path)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to move file")
+		return ""
+	}
+	destination, err := moveFile(path, filepath.Join(target, relative))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to move file")
+		return ""
+	}
+	lyrics := strings.TrimSuffix(path, filepath.Ext(path)) + ".lrc"
+	if _, err := os.Stat(lyrics); err == nil {
+		if _, err := moveFile(lyrics, strings.TrimSuffix(destination, filepath.Ext(destination))+".lrc"); err != nil {
+			logger.Error().Err(err).Msg("failed to move lyrics")
+		}
+	}
+	return destination
+}
+
+// cleanFolder moves the cover along with the files once the folder has no audio left, and removes the folder if it
+// is empty then. the cover goes to the failed files if there are any, retrying them may need it.
+func (w *folderWatcher) cleanFolder(folder string, cover string, failed bool) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if slices.Contains(watchAudioExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			return
+		}
+	}
+	if cover != "" {
+		var target = w.cfg.DoneDir
+		if failed {
+			target = w.cfg.FailedDir
+		}
+		relative, _ := filepath.Rel(w.root, cover)
+		if _, err := moveFile(cover, filepath.Join(target, relative)); err != nil {
+			log.Error().Err(err).Str("file", relative).Msg("failed to move cover")
+		}
+	}
+	if folder != w.root {
+		// fails if anything else is left in the folder
+		os.Remove(folder)
+	}
+}
+
+// findCover returns the image of the folder named like a cover, or the first image, empty if there is none
+func findCover(folder string) string {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return ""
+	}
+	var images []string
+	for _, entry := range entries {
+		if entry.IsDir() || !slices.Contains(watchImageExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if slices.Contains(watchCoverNames, name) {
+			return filepath.Join(folder, entry.Name())
+		}
+		images = append(images, entry.Name())
+	}
+	if len(images) == 0 {
+		return ""
+	}
+	return filepath.Join(folder, images[0])
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// moveFile renames the file to target, or to "name (1).ext" and so on if target exists. files are copied if
+// target is on another filesystem.
+func moveFile(source string, target string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	var (
+		extension = filepath.Ext(target)
+		base      = strings.TrimSuffix(target, extension)
+	)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(target); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		target = fmt.Sprintf("%s (%d)%s", base, i, extension)
+	}
+	if err := os.Rename(source, target); err != nil {
+		var linkErr *os.LinkError
+		if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+			return "", err
+		}
+		if err := copyFile(source, target); err != nil {
+			return "", err
+		}
+		return target, os.Remove(source)
+	}
+	return target, nil
+}
@@ -0,0 +1,442 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/briandowns/spinner"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type WorkerConfig struct {
+	// identifies the worker in locked_by of the jobs it claims, hostname and pid by default
+	Name        string
+	Concurrency int
+	// jobs are recovered by other workers if the lease is not renewed in time
+	Lease        time.Duration
+	PollInterval time.Duration
+	// first retry waits this long, every retry after waits twice as long up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	JobTimeout time.Duration
+	Upload     UploadConfig
+}
+
+type WorkerJobsConfig struct {
+	Status string
+	Limit  int32
+}
+
+var (
+	workerCmd = &cobra.Command{
+		Use:   "worker",
+		Short: "process jobs queued by POST /uploads",
+		Long: `claims queued ingest jobs and runs the same pipeline as strafe audio upload, any number of workers can run
+on different machines. SIGINT or SIGTERM stops claiming jobs and waits for the running jobs to finish, a second signal
+cancels them and queues them again. requires strafe docker image.`,
+		Run: WrapCommandWithResources(runWorker, ResourceConfig{Resources: []ResourceType{ResourceDocker, ResourceDatabase, ResourceStorage}}),
+	}
+	workerCfg     = WorkerConfig{}
+	workerJobsCmd = &cobra.Command{
+		Use:   "jobs",
+		Short: "list ingest jobs, running jobs whose lease expired are shown as stuck",
+		Run:   WrapCommandWithResources(listIngestJobs, ResourceConfig{Resources: []ResourceType{ResourceDatabase}}),
+	}
+	workerJobsCfg = WorkerJobsConfig{}
+)
+
+func getWorkerCmd() *cobra.Command {
+	hostname, _ := os.Hostname()
+	workerCmd.Flags().StringVar(&workerCfg.Name, "name", fmt.Sprintf("%s-%d", hostname, os.Getpid()), "name of the worker in the job list")
+	workerCmd.Flags().IntVarP(&workerCfg.Concurrency, "concurrency", "n", 1, "jobs processed at the same time")
+	workerCmd.Flags().DurationVar(&workerCfg.Lease, "lease", 2*time.Minute, "how long a claimed job is held without a heartbeat, renewed every third of it")
+	workerCmd.Flags().DurationVar(&workerCfg.PollInterval, "poll", 5*time.Second, "wait between checks while the queue is empty")
+	workerCmd.Flags().DurationVar(&workerCfg.Backoff, "backoff", 30*time.Second, "wait before the first retry of a failed job, doubled on every retry")
+	workerCmd.Flags().DurationVar(&workerCfg.MaxBackoff, "max_backoff", time.Hour, "longest wait before a retry")
+	workerCmd.Flags().DurationVar(&workerCfg.JobTimeout, "job_timeout", time.Hour, "jobs running longer are cancelled and retried")
+	workerCmd.Flags().Int32VarP(&workerCfg.Upload.WaveformPPS, "pps", "P", 100, "waveform zoom level (pixels per second)")
+	workerCmd.Flags().StringVar(&workerCfg.Upload.ModelCheckpoint, "model", "mel_band_roformer_karaoke_aufr33_viperx_sdr_10.1956.ckpt", "model name for audio splitter, see strafe audio models for full list")
+	workerCmd.Flags().StringVar(&workerCfg.Upload.ModelDownloadDir, "model_file_directory", "/tmp/audio-separator-models/", "model download folder / file directory on the host machine")
+	workerCmd.Flags().BoolVar(&workerCfg.Upload.UseGPU, "gpu", false, "use gpu during audio separation")
+	workerCmd.Flags().BoolVar(&workerCfg.Upload.MusicBrainz, "musicbrainz", false, "fill missing tags from musicbrainz and fetch the cover of new albums from the cover art archive")
+
+	workerJobsCmd.Flags().StringVarP(&workerJobsCfg.Status, "status", "s", "", "only list jobs with the status, one of queued, running, succeeded, failed")
+	workerJobsCmd.Flags().Int32VarP(&workerJobsCfg.Limit, "limit", "l", 50, "number of jobs to list")
+	workerCmd.AddCommand(workerJobsCmd)
+	return workerCmd
+}
+
+type worker struct {
+	cfg WorkerConfig
+	app internal.AppCtx
+	// cancelled on the second signal, running jobs are queued again
+	kill context.Context
+}
+
+func runWorker(cmd *cobra.Command, args []string) {
+	exitIfImage(DoesNotExist)
+	// the worker runs until it is stopped, the timeout of the command does not apply
+	ctx := context.WithoutCancel(cmd.Context())
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	if workerCfg.Concurrency < 1 {
+		log.Error().Int("concurrency", workerCfg.Concurrency).Msg("concurrency must be at least 1")
+		return
+	}
+	if workerCfg.Lease < 3*time.Second {
+		log.Error().Dur("lease", workerCfg.Lease).Msg("lease must be at least 3 seconds")
+		return
+	}
+	claim, stopClaiming := context.WithCancel(ctx)
+	defer stopClaiming()
+	kill, killJobs := context.WithCancel(ctx)
+	defer killJobs()
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		log.Info().Msg("draining, waiting for running jobs to finish. send the signal again to cancel them")
+		stopClaiming()
+		<-signals
+		log.Warn().Msg("cancelling running jobs")
+		killJobs()
+	}()
+
+	w := &worker{cfg: workerCfg, app: app, kill: kill}
+	log.Info().
+		Str("worker", w.cfg.Name).
+		Int("concurrency", w.cfg.Concurrency).
+		Msg("worker is starting")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.recoverExpired(claim)
+	}()
+	slots := make(chan struct{}, w.cfg.Concurrency)
+	for claim.Err() == nil {
+		select {
+		case <-claim.Done():
+			continue
+		case slots <- struct{}{}:
+		}
+		job, err := app.DB.ClaimIngestJob(claim, db.ClaimIngestJobParams{Worker: w.cfg.Name, LeaseSeconds: w.cfg.Lease.Seconds()})
+		if err != nil {
+			<-slots
+			if !errors.Is(err, sql.ErrNoRows) && claim.Err() == nil {
+				log.Error().Err(err).Msg("failed to claim job")
+			}
+			select {
+			case <-claim.Done():
+			case <-time.After(w.cfg.PollInterval):
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			w.process(job)
+		}()
+	}
+	wg.Wait()
+	log.Info().Msg("worker stopped")
+}
+
+// recoverExpired queues the jobs of workers that stopped renewing their lease again, every lease
+func (w *worker) recoverExpired(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Lease)
+	defer ticker.Stop()
+	for {
+		recovered, err := w.app.DB.RecoverExpiredIngestJobs(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to recover jobs with expired leases")
+		}
+		for _, job := range recovered {
+			log.Warn().
+				Str("job", job.ID).
+				Str("status", string(job.Status)).
+				Str("error", job.Error.String).
+				Msg("recovered stuck job")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process runs the job until it finishes, the lease is lost, it times out or the worker is killed.
+// jobs of a killed worker are queued again without counting the attempt.
+func (w *worker) process(job db.IngestJob) {
+	logger := log.With().Str("job", job.ID).Str("file", job.AudioFilename).Int32("attempt", job.Attempts).Logger()
+	logger.Info().Msg("processing job")
+	// stage updates and the final status are written even if the job is cancelled
+	ctx := context.WithoutCancel(w.kill)
+	run, cancel := context.WithTimeout(w.kill, w.cfg.JobTimeout)
+	defer cancel()
+	var lost = make(chan struct{})
+	go func() {
+		defer close(lost)
+		if !w.heartbeat(run, job.ID, logger) {
+			cancel()
+		}
+	}()
+	trackID, jobErr := w.ingest(run, job, logger)
+	cancel()
+	<-lost
+	switch {
+	case jobErr == nil:
+		rows, err := w.app.DB.CompleteIngestJob(ctx, db.CompleteIngestJobParams{ID: job.ID, Worker: w.cfg.Name, TrackID: trackID})
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to complete job")
+			return
+		}
+		if rows == 0 {
+			logger.Warn().Str("track", trackID).Msg("job was recovered by another worker before it completed, the track is kept")
+			return
+		}
+		w.deleteStaged(ctx, job, logger)
+		w.record(ctx, job.ID, internal.ProgressEvent{Type: internal.ProgressDone, TrackID: trackID}, logger)
+		logger.Info().Str("track", trackID).Msg("job succeeded")
+	case w.kill.Err() != nil:
+		if _, err := w.app.DB.ReleaseIngestJob(ctx, db.ReleaseIngestJobParams{ID: job.ID, Worker: w.cfg.Name}); err != nil {
+			logger.Error().Err(err).Msg("failed to queue cancelled job again")
+			return
+		}
+		w.record(ctx, job.ID, internal.ProgressEvent{Type: internal.ProgressRetrying, Message: "worker stopped, queued again"}, logger)
+		logger.Warn().Msg("job cancelled, queued again")
+	default:
+		backoff := w.backoff(job.Attempts)
+		status, err := w.app.DB.FailIngestJob(ctx, db.FailIngestJobParams{
+			ID:             job.ID,
+			Worker:         w.cfg.Name,
+			Error:          jobErr.Error(),
+			BackoffSeconds: backoff.Seconds(),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Warn().Msg("job failed after it was recovered by another worker")
+			return
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to record job failure")
+			return
+		}
+		if status == db.IngestJobStatusFailed {
+			w.record(ctx, job.ID, internal.ProgressEvent{Type: internal.ProgressFailed, Message: jobErr.Error()}, logger)
+			logger.Error().Err(jobErr).Msg("job failed, no attempts left")
+			return
+		}
+		w.record(ctx, job.ID, internal.ProgressEvent{Type: internal.ProgressRetrying, Message: fmt.Sprintf("%s, retrying in %s", jobErr, backoff)}, logger)
+		logger.Warn().Err(jobErr).Dur("retry_in", backoff).Msg("job failed, retrying")
+	}
+}
+
+// heartbeat renews the lease until ctx is done, returns false if the job was recovered by another worker
+func (w *worker) heartbeat(ctx context.Context, jobID string, logger zerolog.Logger) bool {
+	ticker := time.NewTicker(w.cfg.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-ticker.C:
+		}
+		rows, err := w.app.DB.RenewIngestJobLease(ctx, db.RenewIngestJobLeaseParams{ID: jobID, Worker: w.cfg.Name, LeaseSeconds: w.cfg.Lease.Seconds()})
+		if err != nil {
+			// retried on the next tick, the job is only lost once another worker recovers it
+			if ctx.Err() == nil {
+				logger.Error().Err(err).Msg("failed to renew lease")
+			}
+			continue
+		}
+		if rows == 0 {
+			logger.Warn().Msg("lease lost, cancelling job")
+			return false
+		}
+	}
+}
+
+// ingest downloads the staged files and runs the audio pipeline on them, returns the id of the inserted track
+func (w *worker) ingest(ctx context.Context, job db.IngestJob, logger zerolog.Logger) (string, error) {
+	dir, err := os.MkdirTemp(os.TempDir(), "strafe-ingest-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create job directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var cfg = w.cfg.Upload
+	cfg.IsInstrumental = job.Instrumental
+	cfg.OutputDir = filepath.Join(dir, "stems")
+	cfg.NonInteractive = true
+	processor := &audioProcessor{
+		cfg:     cfg,
+		app:     w.app,
+		ctx:     ctx,
+		spinner: spinner.New(spinner.CharSets[12], 100*time.Millisecond, spinner.WithWriter(io.Discard)),
+	}
+	processor.events = func(event internal.ProgressEvent) {
+		switch event.Type {
+		case internal.ProgressStageStarted:
+			if _, err := w.app.DB.SetIngestJobStage(context.WithoutCancel(ctx), db.SetIngestJobStageParams{ID: job.ID, Worker: w.cfg.Name, Stage: event.Stage}); err != nil {
+				logger.Error().Err(err).Str("stage", event.Stage).Msg("failed to update stage")
+			}
+			logger.Info().Str("stage", event.Stage).Msg("stage started")
+		case internal.ProgressLog:
+			logger.Debug().Str("stage", event.Stage).Msg(event.Message)
+		}
+		w.record(context.WithoutCancel(ctx), job.ID, event, logger)
+	}
+	processor.output = internal.NewProgressWriter(processor.emit)
+
+	processor.setStage(internal.IngestStageDownloading)
+	// the uploaded file name is only kept in the job, it never reaches the shell
+	if processor.cfg.AudioPath, err = w.download(ctx, job.AudioKey, dir, "audio"); err != nil {
+		return "", err
+	}
+	if job.CoverKey.Valid {
+		if processor.cfg.CoverArtPath, err = w.download(ctx, job.CoverKey.String, dir, "cover"); err != nil {
+			return "", err
+		}
+	}
+	if job.LyricsKey.Valid {
+		if processor.cfg.LyricsPath, err = w.download(ctx, job.LyricsKey.String, dir, "lyrics"); err != nil {
+			return "", err
+		}
+	}
+	if err := processor.run(); err != nil {
+		return "", err
+	}
+	return processor.db_record.ID, nil
+}
+
+// record stores the event for GET /uploads/{id}/events, failures only leave a gap in the events
+func (w *worker) record(ctx context.Context, jobID string, event internal.ProgressEvent, logger zerolog.Logger) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to encode progress event")
+		return
+	}
+	if err := w.app.DB.InsertIngestJobEvent(ctx, db.InsertIngestJobEventParams{JobID: jobID, EventType: string(event.Type), Payload: payload}); err != nil {
+		logger.Error().Err(err).Str("type", string(event.Type)).Msg("failed to record progress event")
+	}
+}
+
+// download streams the staged file into the job directory under a name chosen by the worker, the key
+// only contributes the extension
+func (w *worker) download(ctx context.Context, key string, dir string, name string) (string, error) {
+	reader, _, err := w.app.Store.Open(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to download staged file %s: %w", key, err)
+	}
+	defer reader.Close()
+	target := filepath.Join(dir, name+path.Ext(key))
+	file, err := os.Create(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to create staged file %s: %w", key, err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, reader); err != nil {
+		return "", fmt.Errorf("failed to write staged file %s: %w", key, err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write staged file %s: %w", key, err)
+	}
+	return target, nil
+}
+
+// deleteStaged deletes the uploaded files once the track is stored, failures only leave the files behind
+func (w *worker) deleteStaged(ctx context.Context, job db.IngestJob, logger zerolog.Logger) {
+	keys := []string{job.AudioKey}
+	if job.CoverKey.Valid {
+		keys = append(keys, job.CoverKey.String)
+	}
+	if job.LyricsKey.Valid {
+		keys = append(keys, job.LyricsKey.String)
+	}
+	for _, key := range keys {
+		if err := w.app.Store.Delete(ctx, key); err != nil {
+			logger.Error().Err(err).Str("key", key).Msg("failed to delete staged file")
+		}
+	}
+}
+
+func (w *worker) backoff(attempts int32) time.Duration {
+	backoff := float64(w.cfg.Backoff) * math.Pow(2, float64(max(attempts-1, 0)))
+	return time.Duration(min(backoff, float64(w.cfg.MaxBackoff)))
+}
+
+func listIngestJobs(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	app := ctx.Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var params = db.ListIngestJobsParams{ResultLimit: workerJobsCfg.Limit}
+	if workerJobsCfg.Status != "" {
+		status := db.IngestJobStatus(workerJobsCfg.Status)
+		switch status {
+		case db.IngestJobStatusQueued, db.IngestJobStatusRunning, db.IngestJobStatusSucceeded, db.IngestJobStatusFailed:
+		default:
+			log.Error().Str("status", workerJobsCfg.Status).Msg("status must be one of queued, running, succeeded, failed")
+			return
+		}
+		params.Status = db.NullIngestJobStatus{IngestJobStatus: status, Valid: true}
+	}
+	counts, err := app.DB.CountIngestJobs(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to count jobs")
+		return
+	}
+	jobs, err := app.DB.ListIngestJobs(ctx, params)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list jobs")
+		return
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	var title string
+	for _, count := range counts {
+		title += fmt.Sprintf("%s: %d  ", count.Status, count.Jobs)
+	}
+	t.SetTitle(title)
+	t.AppendHeader(table.Row{"ID", "File", "Status", "Stage", "Attempts", "Worker", "Updated", "Error"})
+	for _, job := range jobs {
+		status := string(job.Status)
+		if job.Stuck {
+			status = "stuck"
+		}
+		t.AppendRow(table.Row{
+			job.ID,
+			job.AudioFilename,
+			status,
+			job.Stage,
+			fmt.Sprintf("%d/%d", job.Attempts, job.MaxAttempts),
+			job.LockedBy.String,
+			job.UpdatedAt.Time.Format("2006-01-02 15:04"),
+			job.Error.String,
+		})
+	}
+	t.SetColumnConfigs([]table.ColumnConfig{{Name: "Error", WidthMax: 60}})
+	t.Render()
+}
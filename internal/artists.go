@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ArtistCredit is a single artist parsed from the artist or title tag of a track
+type ArtistCredit struct {
+	Name string
+	Role db.ArtistRole
+}
+
+var (
+	// "A feat. B", "A ft B", "A featuring B", "A (feat. B)"
+	featuringSplitter = regexp.MustCompile(`(?i)\s*[\(\[]?\s*\b(?:feat\.?|ft\.?|featuring)\s+`)
+	// "A & B", "A x B", "A X B", "A, B", "A vs. B", "A with B"
+	collaborationSplitter = regexp.MustCompile(`(?i)\s*(?:&|,|\s+x\s+|\s+vs\.?\s+|\s+with\s+)\s*`)
+	// "(feat. B)", "[ft. B]" in title
+	titleFeaturing = regexp.MustCompile(`(?i)[\(\[]\s*(?:feat\.?|ft\.?|featuring)\s+([^\)\]]+)[\)\]]`)
+	// "(B Remix)", "[B Edit]" in title
+	titleRemixer = regexp.MustCompile(`(?i)[\(\[]\s*([^\(\)\[\]]+?)\s+(?:remix|rework|edit|bootleg|flip)\s*[\)\]]`)
+	// "(prod. B)", "[produced by B]" in title
+	titleProducer  = regexp.MustCompile(`(?i)[\(\[]\s*(?:prod\.?|produced by)\s+([^\)\]]+)[\)\]]`)
+	leadingArticle = regexp.MustCompile(`(?i)^(the)\s+(.+)$`)
+	whitespace     = regexp.MustCompile(`\s+`)
+)
+
+// creditSegment is a part of the artist or title tag that credits one or more artists with the same role
+type creditSegment struct {
+	text string
+	role db.ArtistRole
+}
+
+func creditSegments(artist string, title string) []creditSegment {
+	var segments []creditSegment
+	parts := featuringSplitter.Split(artist, 2)
+	segments = append(segments, creditSegment{parts[0], db.ArtistRolePrimary})
+	if len(parts) == 2 {
+		segments = append(segments, creditSegment{parts[1], db.ArtistRoleFeatured})
+	}
+	for _, match := range titleFeaturing.FindAllStringSubmatch(title, -1) {
+		segments = append(segments, creditSegment{match[1], db.ArtistRoleFeatured})
+	}
+	for _, match := range titleRemixer.FindAllStringSubmatch(title, -1) {
+		segments = append(segments, creditSegment{match[1], db.ArtistRoleRemixer})
+	}
+	for _, match := range titleProducer.FindAllStringSubmatch(title, -1) {
+		segments = append(segments, creditSegment{match[1], db.ArtistRoleProducer})
+	}
+	return segments
+}
+
+// collaborationRuns returns the names of the segment split by the collaboration separators, and every run of two or
+// more adjacent names with the separators between them, "Earth, Wind & Fire" gives "Earth, Wind", "Wind & Fire" and
+// "Earth, Wind & Fire" as runs
+func collaborationRuns(segment string) (names []string, runs func(from, to int) string) {
+	separators := collaborationSplitter.FindAllStringIndex(segment, -1)
+	starts, ends := []int{0}, []int{}
+	for _, separator := range separators {
+		ends = append(ends, separator[0])
+		starts = append(starts, separator[1])
+	}
+	ends = append(ends, len(segment))
+	for i := range starts {
+		names = append(names, segment[starts[i]:ends[i]])
+	}
+	return names, func(from, to int) string { return segment[starts[from]:ends[to]] }
+}
+
+// splitCollaboration splits the segment into artists, the longest runs of names that are a known artist are kept
+// together so "Earth, Wind & Fire & B" is split into "Earth, Wind & Fire" and "B" once "Earth, Wind & Fire" exists
+func splitCollaboration(segment string, known map[string]bool) []string {
+	names, run := collaborationRuns(segment)
+	var artists []string
+	for from := 0; from < len(names); from++ {
+		to := from
+		for candidate := len(names) - 1; candidate > from; candidate-- {
+			if known[ArtistMatchName(run(from, candidate))] {
+				to = candidate
+				break
+			}
+		}
+		artists = append(artists, run(from, to))
+		from = to
+	}
+	return artists
+}
+
+// ArtistCreditCandidates returns the match names of the runs of names the artist and title tags could be credited
+// with, the ones that belong to an existing artist or alias are passed to ParseArtistCredits as known
+func ArtistCreditCandidates(artist string, title string) []string {
+	var candidates []string
+	for _, segment := range creditSegments(artist, title) {
+		names, run := collaborationRuns(segment.text)
+		for from := range names {
+			for to := from + 1; to < len(names); to++ {
+				candidates = append(candidates, ArtistMatchName(run(from, to)))
+			}
+		}
+	}
+	return candidates
+}
+
+// ParseArtistCredits splits the artist and title tags of a track into credited artists.
+//
+//	ParseArtistCredits("A & B feat. C", "Song (D Remix)", nil)
+//
+// returns A and B as primary, C as featured and D as remixer.
+// names with separators in them such as "Tyler, The Creator" are not split if their match name is known.
+// duplicate names are kept only with their first role.
+func ParseArtistCredits(artist string, title string, known map[string]bool) []ArtistCredit {
+	var credits []ArtistCredit
+	seen := make(map[string]bool)
+	add := func(name string, role db.ArtistRole) {
+		name = strings.Trim(strings.TrimSpace(name), "()[]")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return
+		}
+		key := ArtistMatchName(name)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		credits = append(credits, ArtistCredit{Name: name, Role: role})
+	}
+	for _, segment := range creditSegments(artist, title) {
+		for _, name := range splitCollaboration(segment.text, known) {
+			add(name, segment.role)
+		}
+	}
+	return credits
+}
+
+// ArtistSortName moves the leading article to the end, "The Beatles" becomes "Beatles, The"
+func ArtistSortName(name string) string {
+	name = whitespace.ReplaceAllString(strings.TrimSpace(name), " ")
+	if match := leadingArticle.FindStringSubmatch(name); match != nil {
+		return match[2] + ", " + match[1]
+	}
+	return name
+}
+
+// ArtistMatchName is the key artists are deduplicated with, "The Band", "the band" and "Band" share the same match name
+func ArtistMatchName(name string) string {
+	name = strings.ToLower(whitespace.ReplaceAllString(strings.TrimSpace(name), " "))
+	if match := leadingArticle.FindStringSubmatch(name); match != nil {
+		return match[2]
+	}
+	return name
+}
+
+// LinkTrackArtists parses the credits of the track, creates the artists that do not exist yet and links them to the track
+func LinkTrackArtists(ctx context.Context, q *db.Queries, trackID string, artist string, title string) error {
+	matchNames, err := q.GetKnownArtistMatchNames(ctx, ArtistCreditCandidates(artist, title))
+	if err != nil {
+		return fmt.Errorf("failed to get known artists: %w", err)
+	}
+	known := make(map[string]bool, len(matchNames))
+	for _, matchName := range matchNames {
+		known[matchName] = true
+	}
+	credits := ParseArtistCredits(artist, title, known)
+	// the whole tag might be a known artist with "feat." or "with" in its name
+	if whole, err := q.GetArtistByMatchNameOrAlias(ctx, ArtistMatchName(artist)); err == nil {
+		credits = append([]ArtistCredit{{Name: whole.Name, Role: db.ArtistRolePrimary}}, ParseArtistCredits("", title, known)...)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to get artist %s: %w", artist, err)
+	}
+	for i, credit := range credits {
+		artistID, err := resolveArtistID(ctx, q, credit.Name)
+		if err != nil {
+			return err
+		}
+		if err := q.InsertTrackArtist(ctx, db.InsertTrackArtistParams{
+			TrackID:  trackID,
+			ArtistID: artistID,
+			Role:     credit.Role,
+			Position: int32(i),
+		}); err != nil {
+			return fmt.Errorf("failed to link artist %s to track: %w", credit.Name, err)
+		}
+	}
+	return nil
+}
+
+func resolveArtistID(ctx context.Context, q *db.Queries, name string) (string, error) {
+	artist, err := q.GetArtistByMatchNameOrAlias(ctx, ArtistMatchName(name))
+	if err == nil {
+		return artist.ID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("failed to get artist %s: %w", name, err)
+	}
+	id, err := q.UpsertArtist(ctx, db.UpsertArtistParams{
+		ID:        uuid.NewString(),
+		Name:      name,
+		SortName:  ArtistSortName(name),
+		MatchName: ArtistMatchName(name),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to insert artist %s: %w", name, err)
+	}
+	return id, nil
+}
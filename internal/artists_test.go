@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/caner-cetin/strafe/pkg/db"
+)
+
+func TestParseArtistCredits(t *testing.T) {
+	var (
+		primary  = db.ArtistRolePrimary
+		featured = db.ArtistRoleFeatured
+		remixer  = db.ArtistRoleRemixer
+		producer = db.ArtistRoleProducer
+	)
+	tests := []struct {
+		name   string
+		artist string
+		title  string
+		known  map[string]bool
+		want   []ArtistCredit
+	}{
+		{
+			name:   "single artist",
+			artist: "Daft Punk",
+			title:  "One More Time",
+			want:   []ArtistCredit{{"Daft Punk", primary}},
+		},
+		{
+			name:   "collaboration, featuring and remix",
+			artist: "A & B feat. C",
+			title:  "Song (D Remix)",
+			want:   []ArtistCredit{{"A", primary}, {"B", primary}, {"C", featured}, {"D", remixer}},
+		},
+		{
+			name:   "separators",
+			artist: "A x B, C vs. D",
+			want:   []ArtistCredit{{"A", primary}, {"B", primary}, {"C", primary}, {"D", primary}},
+		},
+		{
+			name:   "featuring and producer in the title",
+			artist: "A",
+			title:  "Song (feat. B) [prod. C]",
+			want:   []ArtistCredit{{"A", primary}, {"B", featured}, {"C", producer}},
+		},
+		{
+			name:   "duplicates keep their first role",
+			artist: "A ft. B",
+			title:  "Song (feat. B)",
+			want:   []ArtistCredit{{"A", primary}, {"B", featured}},
+		},
+		{
+			name:   "articles are ignored when deduplicating",
+			artist: "The Band & Band",
+			want:   []ArtistCredit{{"The Band", primary}},
+		},
+		{
+			name:   "unknown names with separators are split",
+			artist: "Earth, Wind & Fire & B",
+			want:   []ArtistCredit{{"Earth", primary}, {"Wind", primary}, {"Fire", primary}, {"B", primary}},
+		},
+		{
+			name:   "known names with separators are kept together",
+			artist: "Earth, Wind & Fire & B",
+			known:  map[string]bool{"earth, wind & fire": true},
+			want:   []ArtistCredit{{"Earth, Wind & Fire", primary}, {"B", primary}},
+		},
+		{
+			name:   "x inside a name is not a separator",
+			artist: "Xander & Max",
+			want:   []ArtistCredit{{"Xander", primary}, {"Max", primary}},
+		},
+		{
+			name:   "empty tags",
+			artist: "",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseArtistCredits(tt.artist, tt.title, tt.known)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseArtistCredits(%q, %q) = %v, want %v", tt.artist, tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArtistSortName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"The Beatles", "Beatles, The"},
+		{"the  band", "band, the"},
+		{"Theatre of Tragedy", "Theatre of Tragedy"},
+		{"  Daft Punk ", "Daft Punk"},
+	}
+	for _, tt := range tests {
+		if got := ArtistSortName(tt.name); got != tt.want {
+			t.Errorf("ArtistSortName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArtistMatchName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"The Band", "band"},
+		{"the  band", "band"},
+		{"Band", "band"},
+		{"Earth, Wind & Fire", "earth, wind & fire"},
+	}
+	for _, tt := range tests {
+		if got := ArtistMatchName(tt.name); got != tt.want {
+			t.Errorf("ArtistMatchName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const DefaultPresignTTL = time.Hour
+
+// AssetResolver turns object keys of segments, playlists and covers into URLs clients can fetch.
+// keys are resolved under the public base url if it is configured, otherwise the object store
+// resolves them, S3 presigns the urls so that the bucket can stay private.
+type AssetResolver struct {
+	PublicBaseURL *url.URL
+	TTL           time.Duration
+	store         ObjectStore
+}
+
+// InitializeAssets configures the asset resolver, storage must be initialized first if no public base url is configured
+func (ctx *AppCtx) InitializeAssets() error {
+	var resolver = &AssetResolver{TTL: DefaultPresignTTL}
+	if viper.IsSet(ASSETS_PRESIGN_TTL) {
+		resolver.TTL = viper.GetDuration(ASSETS_PRESIGN_TTL)
+		if resolver.TTL <= 0 {
+			return fmt.Errorf("%s must be a positive duration such as 15m or 1h", ASSETS_PRESIGN_TTL)
+		}
+	}
+	if viper.GetString(ASSETS_PUBLIC_BASE_URL) != "" {
+		base, err := url.Parse(strings.TrimSuffix(viper.GetString(ASSETS_PUBLIC_BASE_URL), "/"))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", ASSETS_PUBLIC_BASE_URL, err)
+		}
+		resolver.PublicBaseURL = base
+	} else {
+		if ctx.Store == nil {
+			return fmt.Errorf("storage must be initialized to resolve asset urls when %s is not set", ASSETS_PUBLIC_BASE_URL)
+		}
+		resolver.store = ctx.Store
+	}
+	ctx.Assets = resolver
+	return nil
+}
+
+// Public reports whether the assets are served from the public base url, clients can then fetch
+// playlists directly as the segments are resolved relative to the playlist.
+func (r *AssetResolver) Public() bool {
+	return r.PublicBaseURL != nil
+}
+
+// URL resolves the object key, presigned urls expire after the configured TTL
+func (r *AssetResolver) URL(ctx context.Context, key string) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+	if r.Public() {
+		resolved := *r.PublicBaseURL
+		resolved.Path = resolved.Path + "/" + strings.TrimPrefix(key, "/")
+		return resolved.String(), nil
+	}
+	return r.store.URL(ctx, key, r.TTL)
+}
+
+// PlaylistKey returns the key of the playlist.m3u8 next to the stored folder path of a track.
+// folder paths are stored as the key of the last uploaded file of the folder, which is the playlist itself.
+func PlaylistKey(folderPath string) string {
+	if path.Ext(folderPath) != "" {
+		folderPath = path.Dir(folderPath)
+	}
+	return path.Join(folderPath, "playlist.m3u8")
+}
+
+// RewritePlaylist replaces the segment lines of the playlist with resolved urls, segment lines are
+// relative to the folder of the playlist. tags and absolute urls are kept as they are.
+func (r *AssetResolver) RewritePlaylist(ctx context.Context, playlistKey string, playlist []byte) ([]byte, error) {
+	var (
+		rewritten bytes.Buffer
+		folder    = path.Dir(playlistKey)
+		scanner   = bufio.NewScanner(bytes.NewReader(playlist))
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.Contains(line, "://") {
+			resolved, err := r.URL(ctx, path.Join(folder, line))
+			if err != nil {
+				return nil, err
+			}
+			line = resolved
+		}
+		rewritten.WriteString(line)
+		rewritten.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist %s: %w", playlistKey, err)
+	}
+	return rewritten.Bytes(), nil
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DefaultTokenTTL = 30 * 24 * time.Hour
+	// tokens are prefixed so that leaked tokens are easy to find in logs and commits
+	apiTokenPrefix = "strafe_"
+
+	USER_CONTEXT_KEY ContextKey = "strafe_ctx.user"
+)
+
+var ErrPasswordTooLong = errors.New("password cannot be longer than 72 bytes")
+
+// dummyPasswordHash is compared against when the user does not exist, so that unknown usernames
+// take as long as wrong passwords
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("strafe"), bcrypt.DefaultCost)
+
+// User is the authenticated user of a request
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	// token the request is authenticated with
+	TokenID string `json:"-"`
+}
+
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, USER_CONTEXT_KEY, user)
+}
+
+// UserFromContext returns the authenticated user, false for anonymous requests
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(USER_CONTEXT_KEY).(User)
+	return user, ok
+}
+
+func HashPassword(password string) (string, error) {
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword compares the password with the hash, pass an empty hash for unknown users
+func CheckPassword(hash string, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewAPIToken generates a token and the hash that is stored in place of it
+func NewAPIToken() (token string, hash []byte, err error) {
+	var secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = apiTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return token, HashAPIToken(token), nil
+}
+
+// HashAPIToken hashes the token to look it up, tokens are random so a fast hash is enough
+func HashAPIToken(token string) []byte {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return sum[:]
+}
+
+// TokenTTL is how long issued tokens are valid, 0 if they do not expire
+func TokenTTL() (time.Duration, error) {
+	if !viper.IsSet(AUTH_TOKEN_TTL) {
+		return DefaultTokenTTL, nil
+	}
+	ttl := viper.GetDuration(AUTH_TOKEN_TTL)
+	if ttl < 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 720h, or 0 for tokens that do not expire", AUTH_TOKEN_TTL)
+	}
+	return ttl, nil
+}
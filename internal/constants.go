@@ -13,6 +13,30 @@ const (
 	S3_ACCOUNT_ID             = "s3.account_id"
 	S3_ACCESS_KEY_ID          = "s3.access_key_id"
 	S3_ACCESS_KEY_SECRET      = "s3.access_key_secret"
+	S3_SESSION_TOKEN          = "s3.session_token"
+	S3_ENDPOINT               = "s3.endpoint"
+	S3_REGION                 = "s3.region"
+	S3_PATH_STYLE             = "s3.path_style"
+	S3_TLS_VERIFY             = "s3.tls_verify"
+	S3_CREATE_BUCKET          = "s3.create_bucket"
+	STORAGE_BACKEND           = "storage.backend"
+	STORAGE_LOCAL_PATH        = "storage.local.path"
+	ASSETS_PUBLIC_BASE_URL    = "assets.public_base_url"
+	ASSETS_PRESIGN_TTL        = "assets.presign_ttl"
+	EVENTS_BATCH_SIZE         = "events.batch_size"
+	EVENTS_FLUSH_INTERVAL     = "events.flush_interval"
+	AUTH_TOKEN_TTL            = "auth.token_ttl"
+	AUTH_ANONYMOUS_LISTENERS  = "auth.anonymous_listeners"
+	REMOTE_URL                = "remote.url"
+	UPLOADS_MAX_SIZE          = "uploads.max_size"
+	MUSICBRAINZ_ENABLED       = "musicbrainz.enabled"
+	MUSICBRAINZ_BASE_URL      = "musicbrainz.base_url"
+	MUSICBRAINZ_COVER_ART_URL = "musicbrainz.cover_art_url"
+	MUSICBRAINZ_USER_AGENT    = "musicbrainz.user_agent"
+	MUSICBRAINZ_RATE_LIMIT    = "musicbrainz.rate_limit"
+	MUSICBRAINZ_MIN_SCORE     = "musicbrainz.min_score"
+	MUSICBRAINZ_CACHE_DIR     = "musicbrainz.cache_dir"
+	MUSICBRAINZ_CACHE_TTL     = "musicbrainz.cache_ttl"
 )
 
 type ConfigDefault string
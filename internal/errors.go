@@ -32,6 +32,42 @@ var (
 		Code:    http.StatusBadGateway,
 		Message: "cannot encode data, http transport is broken",
 	})
+	InvalidQueryParameter = WrapErr(BaseError{
+		Code:    http.StatusBadRequest,
+		Message: "invalid query parameter",
+	})
+	Unauthorized = WrapErr(BaseError{
+		Code:    http.StatusUnauthorized,
+		Message: "missing, invalid or expired token",
+	})
+	InvalidCredentials = WrapErr(BaseError{
+		Code:    http.StatusUnauthorized,
+		Message: "invalid username or password",
+	})
+	Forbidden = WrapErr(BaseError{
+		Code:    http.StatusForbidden,
+		Message: "not allowed to change this resource",
+	})
+	MalformedUpload = WrapErr(BaseError{
+		Code:    http.StatusBadRequest,
+		Message: "cannot read the multipart upload",
+	})
+	UploadTooLarge = WrapErr(BaseError{
+		Code:    http.StatusRequestEntityTooLarge,
+		Message: "upload is larger than the server accepts",
+	})
+	ResourceNotFound = WrapErr(BaseError{
+		Code:    http.StatusNotFound,
+		Message: "resource not found",
+	})
+	ResourceConflict = WrapErr(BaseError{
+		Code:    http.StatusConflict,
+		Message: "resource already exists",
+	})
+	ServiceUnavailable = WrapErr(BaseError{
+		Code:    http.StatusServiceUnavailable,
+		Message: "server is busy, try again later",
+	})
 	ServerErrorBase = WrapErr(BaseError{
 		Code:    http.StatusInternalServerError,
 		Message: "internal server error",
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultEventsBatchSize     = 500
+	DefaultEventsFlushInterval = 5 * time.Second
+)
+
+// ErrEventBufferFull is returned when events are reported faster than they can be written,
+// clients should retry later instead of the server holding on to an unbounded amount of events.
+var ErrEventBufferFull = errors.New("play event buffer is full")
+
+// ErrEventBufferClosed is returned for events reported while the server is shutting down
+var ErrEventBufferClosed = errors.New("play event buffer is closed")
+
+// PlayEventBuffer collects play events in memory and writes them with COPY in batches, either when
+// a batch is full or when the flush interval passes. reporting playback progress every few seconds
+// from every listener would otherwise be an insert per request.
+type PlayEventBuffer struct {
+	queries       *db.Queries
+	events        chan db.InsertPlayEventsParams
+	batchSize     int
+	flushInterval time.Duration
+	done          chan struct{}
+	// guards sending on events against Close closing it
+	mu     sync.Mutex
+	closed bool
+}
+
+// InitializeEvents starts the play event buffer, database must be initialized first.
+// call Close on shutdown to write the buffered events.
+func (ctx *AppCtx) InitializeEvents() error {
+	if ctx.DB == nil {
+		return fmt.Errorf("database must be initialized to record play events")
+	}
+	var (
+		batchSize     = DefaultEventsBatchSize
+		flushInterval = DefaultEventsFlushInterval
+	)
+	if viper.IsSet(EVENTS_BATCH_SIZE) {
+		batchSize = viper.GetInt(EVENTS_BATCH_SIZE)
+		if batchSize <= 0 {
+			return fmt.Errorf("%s must be a positive number", EVENTS_BATCH_SIZE)
+		}
+	}
+	if viper.IsSet(EVENTS_FLUSH_INTERVAL) {
+		flushInterval = viper.GetDuration(EVENTS_FLUSH_INTERVAL)
+		if flushInterval <= 0 {
+			return fmt.Errorf("%s must be a positive duration such as 5s or 1m", EVENTS_FLUSH_INTERVAL)
+		}
+	}
+	ctx.Events = NewPlayEventBuffer(ctx.DB, batchSize, flushInterval)
+	return nil
+}
+
+func NewPlayEventBuffer(queries *db.Queries, batchSize int, flushInterval time.Duration) *PlayEventBuffer {
+	buffer := &PlayEventBuffer{
+		queries: queries,
+		// room for a few batches while the previous one is being written
+		events:        make(chan db.InsertPlayEventsParams, batchSize*4),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+	go buffer.run()
+	return buffer
+}
+
+// Add queues the event without waiting for it to be written, returns ErrEventBufferFull if the queue is full
+// and ErrEventBufferClosed after Close
+func (b *PlayEventBuffer) Add(event db.InsertPlayEventsParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrEventBufferClosed
+	}
+	select {
+	case b.events <- event:
+		return nil
+	default:
+		return ErrEventBufferFull
+	}
+}
+
+// Close stops accepting events and writes the buffered ones, waits until they are written or ctx is done
+func (b *PlayEventBuffer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.events)
+	}
+	b.mu.Unlock()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush play events: %w", ctx.Err())
+	}
+}
+
+func (b *PlayEventBuffer) run() {
+	defer close(b.done)
+	var (
+		batch  = make([]db.InsertPlayEventsParams, 0, b.batchSize)
+		ticker = time.NewTicker(b.flushInterval)
+	)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-b.events:
+			if !ok {
+				b.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= b.batchSize {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			b.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes the batch in a single COPY. if the batch is rejected, for example because a track was deleted
+// after its events were queued, the events are inserted one by one so that only the invalid ones are dropped.
+func (b *PlayEventBuffer) flush(batch []db.InsertPlayEventsParams) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.flushInterval+30*time.Second)
+	defer cancel()
+	_, err := b.queries.InsertPlayEvents(ctx, batch)
+	if err == nil {
+		return
+	}
+	log.Warn().Err(err).Int("events", len(batch)).Msg("failed to copy play events, inserting them one by one")
+	var dropped int
+	for _, event := range batch {
+		if err := b.queries.InsertPlayEvent(ctx, db.InsertPlayEventParams(event)); err != nil {
+			log.Error().Err(err).Str("track_id", event.TrackID).Str("anon_id", event.AnonID).Msg("failed to insert play event")
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		log.Error().Int("dropped", dropped).Int("events", len(batch)).Msg("dropped play events")
+	}
+}
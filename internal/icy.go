@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"io"
+	"strings"
+)
+
+// IcyMetaInterval is the number of audio bytes between metadata blocks, the default of SHOUTcast
+const IcyMetaInterval = 16000
+
+// the length of a metadata block is a single byte counting 16 byte units
+const icyMaxMetadata = 255 * 16
+
+// IcyWriter inserts a metadata block after every interval bytes of audio, for clients that sent Icy-MetaData: 1.
+// the title is sent in the first block after it changes, other blocks are empty.
+type IcyWriter struct {
+	w         io.Writer
+	interval  int
+	remaining int
+	title     string
+	sent      string
+}
+
+func NewIcyWriter(w io.Writer, interval int) *IcyWriter {
+	return &IcyWriter{w: w, interval: interval, remaining: interval}
+}
+
+// SetTitle sets the StreamTitle of the next metadata block
+func (w *IcyWriter) SetTitle(title string) {
+	w.title = title
+}
+
+func (w *IcyWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := min(w.remaining, len(p))
+		if _, err := w.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+		w.remaining -= n
+		if w.remaining > 0 {
+			continue
+		}
+		var block = []byte{0}
+		if w.title != w.sent {
+			block = IcyMetadata(w.title)
+			w.sent = w.title
+		}
+		if _, err := w.w.Write(block); err != nil {
+			return written, err
+		}
+		w.remaining = w.interval
+	}
+	return written, nil
+}
+
+// IcyMetadata encodes the StreamTitle as a metadata block, the title cannot contain a quote followed by a semicolon
+// so quotes are replaced. titles longer than a block can hold are cut.
+func IcyMetadata(title string) []byte {
+	metadata := "StreamTitle='" + strings.ReplaceAll(title, "'", "’") + "';"
+	if len(metadata) > icyMaxMetadata {
+		metadata = strings.ToValidUTF8(metadata[:icyMaxMetadata-2], "") + "';"
+	}
+	units := (len(metadata) + 15) / 16
+	block := make([]byte, 1+units*16)
+	block[0] = byte(units)
+	copy(block[1:], metadata)
+	return block
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestIcyMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		metadata string
+		units    int
+	}{
+		{"empty", "", "StreamTitle='';", 1},
+		{"title", "Daft Punk - One More Time", "StreamTitle='Daft Punk - One More Time';", 3},
+		{"quotes are replaced", "Guns N' Roses - Don't Cry", "StreamTitle='Guns N’ Roses - Don’t Cry';", 3},
+		{"block boundary", strings.Repeat("a", 16-len("StreamTitle='';")), "StreamTitle='a';", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := IcyMetadata(tt.title)
+			if int(block[0]) != tt.units || len(block) != 1+tt.units*16 {
+				t.Fatalf("IcyMetadata(%q) has %d units and %d bytes, want %d units", tt.title, block[0], len(block), tt.units)
+			}
+			if got := string(bytes.TrimRight(block[1:], "\x00")); got != tt.metadata {
+				t.Errorf("IcyMetadata(%q) = %q, want %q", tt.title, got, tt.metadata)
+			}
+		})
+	}
+}
+
+func TestIcyMetadataCut(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+	}{
+		{"ascii", strings.Repeat("a", 5000)},
+		{"exactly full", strings.Repeat("a", icyMaxMetadata-len("StreamTitle='';"))},
+		// the cut falls inside a two byte rune
+		{"multibyte", "a" + strings.Repeat("é", 3000)},
+		{"quotes", strings.Repeat("'", 2000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := IcyMetadata(tt.title)
+			if len(block) > 1+icyMaxMetadata || int(block[0])*16 != len(block)-1 {
+				t.Fatalf("IcyMetadata() block of %d bytes claims %d units", len(block), block[0])
+			}
+			metadata := bytes.TrimRight(block[1:], "\x00")
+			if !bytes.HasPrefix(metadata, []byte("StreamTitle='")) || !bytes.HasSuffix(metadata, []byte("';")) {
+				t.Errorf("IcyMetadata() = %q, want a terminated StreamTitle", metadata)
+			}
+			if !utf8.Valid(metadata) {
+				t.Errorf("IcyMetadata() cut a rune in half")
+			}
+		})
+	}
+	if block := IcyMetadata(strings.Repeat("a", 5000)); block[0] != 255 {
+		t.Errorf("IcyMetadata() of a long title has %d units, want 255", block[0])
+	}
+}
+
+func TestIcyWriter(t *testing.T) {
+	var (
+		out    bytes.Buffer
+		writer = NewIcyWriter(&out, 4)
+		empty  = []byte{0}
+		title  = IcyMetadata("A - B")
+	)
+	writer.SetTitle("A - B")
+	for _, chunk := range []string{"ab", "cdefgh", "ij"} {
+		n, err := writer.Write([]byte(chunk))
+		if err != nil || n != len(chunk) {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	writer.SetTitle("C - D")
+	if _, err := writer.Write([]byte("klmnop")); err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	for _, part := range [][]byte{[]byte("abcd"), title, []byte("efgh"), empty, []byte("ijkl"), IcyMetadata("C - D"), []byte("mnop"), empty} {
+		want.Write(part)
+	}
+	if !bytes.Equal(out.Bytes(), want.Bytes()) {
+		t.Errorf("IcyWriter wrote\n%q\nwant\n%q", out.Bytes(), want.Bytes())
+	}
+}
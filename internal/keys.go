@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keyfinder-cli writes keys in standard notation such as "Am" and "Db", flats are preferred.
+// every camelot code lists the spelling keyfinder-cli writes first and the enharmonic spellings after it.
+var camelotKeys = map[string][]string{
+	"1A": {"Abm", "G#m"}, "1B": {"B"},
+	"2A": {"Ebm", "D#m"}, "2B": {"Gb", "F#"},
+	"3A": {"Bbm", "A#m"}, "3B": {"Db", "C#"},
+	"4A": {"Fm"}, "4B": {"Ab", "G#"},
+	"5A": {"Cm"}, "5B": {"Eb", "D#"},
+	"6A": {"Gm"}, "6B": {"Bb", "A#"},
+	"7A": {"Dm"}, "7B": {"F"},
+	"8A": {"Am"}, "8B": {"C"},
+	"9A": {"Em"}, "9B": {"G"},
+	"10A": {"Bm"}, "10B": {"D"},
+	"11A": {"Gbm", "F#m"}, "11B": {"A"},
+	"12A": {"Dbm", "C#m"}, "12B": {"E"},
+}
+
+// CamelotCode returns the camelot wheel code of a key in camelot or standard notation, "Am" and "8a" both return "8A"
+func CamelotCode(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if _, ok := camelotKeys[strings.ToUpper(key)]; ok {
+		return strings.ToUpper(key), nil
+	}
+	normalized := normalizeKey(key)
+	for code, spellings := range camelotKeys {
+		for _, spelling := range spellings {
+			if spelling == normalized {
+				return code, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown key %q, expected a camelot code such as 8A or a key such as Am, F#m, Db", key)
+}
+
+// KeySpellings returns every spelling of the key that can be stored in the tracks table,
+// "8A", "Am" and "A minor" all return ["Am"], "2B" returns ["Gb", "F#"]
+func KeySpellings(key string) ([]string, error) {
+	code, err := CamelotCode(key)
+	if err != nil {
+		return nil, err
+	}
+	return camelotKeys[code], nil
+}
+
+// normalizeKey turns "a minor", "A min", "f#m" and "Db major" into "Am", "Am", "F#m" and "Db"
+func normalizeKey(key string) string {
+	key = strings.ToLower(strings.Join(strings.Fields(key), ""))
+	if key == "" {
+		return ""
+	}
+	var minor bool
+	for _, suffix := range []string{"minor", "min", "m"} {
+		if strings.HasSuffix(key, suffix) {
+			key, minor = strings.TrimSuffix(key, suffix), true
+			break
+		}
+	}
+	for _, suffix := range []string{"major", "maj"} {
+		key = strings.TrimSuffix(key, suffix)
+	}
+	if key == "" {
+		return ""
+	}
+	key = strings.ToUpper(key[:1]) + key[1:]
+	if minor {
+		key += "m"
+	}
+	return key
+}
+
+// CamelotDistance counts the steps between the keys on the camelot wheel, switching between minor and major is a step.
+// keys a step apart or less mix without clashing.
+func CamelotDistance(a string, b string) (int, error) {
+	codeA, err := CamelotCode(a)
+	if err != nil {
+		return 0, err
+	}
+	codeB, err := CamelotCode(b)
+	if err != nil {
+		return 0, err
+	}
+	numberA, _ := strconv.Atoi(codeA[:len(codeA)-1])
+	numberB, _ := strconv.Atoi(codeB[:len(codeB)-1])
+	steps := (numberA - numberB + 12) % 12
+	steps = min(steps, 12-steps)
+	if codeA[len(codeA)-1] != codeB[len(codeB)-1] {
+		steps++
+	}
+	return steps, nil
+}
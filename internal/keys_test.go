@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCamelotCode(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"8A", "8A", false},
+		{"8a", "8A", false},
+		{" 12b ", "12B", false},
+		{"Am", "8A", false},
+		{"A minor", "8A", false},
+		{"a min", "8A", false},
+		{"C", "8B", false},
+		{"C major", "8B", false},
+		{"Cmaj", "8B", false},
+		{"F#m", "11A", false},
+		{"Gbm", "11A", false},
+		{"Db", "3B", false},
+		{"C#", "3B", false},
+		{"Abm", "1A", false},
+		{"B", "1B", false},
+		{"13A", "", true},
+		{"H", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := CamelotCode(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CamelotCode(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CamelotCode(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCamelotKeysAreUnique(t *testing.T) {
+	var seen = make(map[string]string)
+	for code, spellings := range camelotKeys {
+		for _, spelling := range spellings {
+			if other, ok := seen[spelling]; ok {
+				t.Errorf("%s is listed under %s and %s", spelling, other, code)
+			}
+			seen[spelling] = code
+		}
+	}
+	if len(camelotKeys) != 24 {
+		t.Errorf("got %d camelot codes, want 24", len(camelotKeys))
+	}
+}
+
+func TestKeySpellings(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"8A", []string{"Am"}},
+		{"A minor", []string{"Am"}},
+		{"2B", []string{"Gb", "F#"}},
+		{"D#m", []string{"Ebm", "D#m"}},
+	}
+	for _, tt := range tests {
+		got, err := KeySpellings(tt.key)
+		if err != nil {
+			t.Fatalf("KeySpellings(%q) error = %v", tt.key, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("KeySpellings(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+	if _, err := KeySpellings("X"); err == nil {
+		t.Error("KeySpellings accepted an unknown key")
+	}
+}
+
+func TestCamelotDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"8A", "8A", 0},
+		{"Am", "8A", 0},
+		{"8A", "9A", 1},
+		{"8A", "8B", 1},
+		{"12A", "1A", 1},
+		{"1B", "12A", 2},
+		{"8A", "2A", 6},
+		{"Am", "Eb", 4},
+	}
+	for _, tt := range tests {
+		got, err := CamelotDistance(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("CamelotDistance(%q, %q) error = %v", tt.a, tt.b, err)
+		}
+		if got != tt.want {
+			t.Errorf("CamelotDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if _, err := CamelotDistance("8A", "X"); err == nil {
+		t.Error("CamelotDistance accepted an unknown key")
+	}
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	LibraryFormat = "strafe-library"
+	// bumped when records change in a way older versions cannot read, archives of newer versions are refused
+	LibraryVersion = 1
+	// first entry of the archive
+	LibraryManifestName = "manifest.json"
+	// objects are stored under this directory of the archive with their key as path
+	LibraryObjectsDir = "objects/"
+	// objects are written under this prefix of the bucket while the archive is imported, see LibraryStagingKey
+	LibraryStagingPrefix = "imports"
+)
+
+// LibraryTable is a table of the archive, stored as one JSON record per line
+type LibraryTable string
+
+const (
+	LibraryTableAlbums             LibraryTable = "albums"
+	LibraryTableArtists            LibraryTable = "artists"
+	LibraryTableTracks             LibraryTable = "tracks"
+	LibraryTableTrackArtists       LibraryTable = "track_artists"
+	LibraryTableLyrics             LibraryTable = "lyrics"
+	LibraryTableListeningHistories LibraryTable = "listening_histories"
+	LibraryTablePlayEvents         LibraryTable = "play_events"
+)
+
+// LibraryTables in the order they are written and imported, records only reference records of earlier tables
+var LibraryTables = []LibraryTable{
+	LibraryTableAlbums,
+	LibraryTableArtists,
+	LibraryTableTracks,
+	LibraryTableTrackArtists,
+	LibraryTableLyrics,
+	LibraryTableListeningHistories,
+	LibraryTablePlayEvents,
+}
+
+// FileName of the table in the archive
+func (t LibraryTable) FileName() string {
+	return string(t) + ".ndjson"
+}
+
+type LibraryManifest struct {
+	Format    string                       `json:"format"`
+	Version   int                          `json:"version"`
+	CreatedAt time.Time                    `json:"created_at"`
+	Tables    map[LibraryTable]LibraryFile `json:"tables"`
+	Objects   LibraryObjects               `json:"objects"`
+}
+
+type LibraryFile struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+	// hex encoded sha256 of the file
+	SHA256 string `json:"sha256"`
+}
+
+type LibraryObjects struct {
+	// false if the archive only has the database, the objects are expected in the bucket already
+	Included bool  `json:"included"`
+	Count    int64 `json:"count"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// Validate refuses archives of other formats and of newer versions
+func (m LibraryManifest) Validate() error {
+	if m.Format != LibraryFormat {
+		return fmt.Errorf("not a strafe library archive, format is %q", m.Format)
+	}
+	if m.Version < 1 || m.Version > LibraryVersion {
+		return fmt.Errorf("archive version %d is not supported, this strafe reads versions up to %d", m.Version, LibraryVersion)
+	}
+	for _, table := range LibraryTables {
+		if _, ok := m.Tables[table]; !ok {
+			return fmt.Errorf("archive has no %s", table)
+		}
+	}
+	return nil
+}
+
+// LibraryObjectName returns the name of the object in the archive
+func LibraryObjectName(key string) string {
+	return LibraryObjectsDir + strings.TrimPrefix(key, "/")
+}
+
+// LibraryStagingKey is the key the object is written to until the import is committed and the object is moved to key
+func LibraryStagingKey(importID string, key string) string {
+	return path.Join(LibraryStagingPrefix, importID, key)
+}
+
+// LibraryObjectKey returns the key of the object stored under the name, false for other entries of the archive
+func LibraryObjectKey(name string) (string, bool) {
+	if !strings.HasPrefix(name, LibraryObjectsDir) {
+		return "", false
+	}
+	key := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(name, LibraryObjectsDir)), "/")
+	if key == "" {
+		return "", false
+	}
+	return key, true
+}
+
+type LibraryAlbum struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Artist string  `json:"artist"`
+	Cover  *string `json:"cover"`
+	Year   *int32  `json:"year"`
+	Genre  *string `json:"genre"`
+	// musicbrainz columns are missing from archives of older strafe versions
+	MusicBrainzReleaseID      *string   `json:"musicbrainz_release_id"`
+	MusicBrainzReleaseGroupID *string   `json:"musicbrainz_release_group_id"`
+	CanonicalName             *string   `json:"canonical_name"`
+	ReleaseDate               *string   `json:"release_date"`
+	CreatedAt                 time.Time `json:"created_at"`
+}
+
+type LibraryArtist struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	SortName      string    `json:"sort_name"`
+	MatchName     string    `json:"match_name"`
+	Aliases       []string  `json:"aliases"`
+	MusicBrainzID *string   `json:"musicbrainz_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type LibraryTrack struct {
+	ID                     string  `json:"id"`
+	AlbumID                string  `json:"album_id"`
+	AlbumName              string  `json:"album_name"`
+	VocalFolderPath        *string `json:"vocal_folder_path"`
+	InstrumentalFolderPath string  `json:"instrumental_folder_path"`
+	// seconds
+	TotalDuration          json.Number     `json:"total_duration"`
+	Info                   json.RawMessage `json:"info"`
+	Instrumental           bool            `json:"instrumental"`
+	Tempo                  json.Number     `json:"tempo"`
+	Key                    string          `json:"key"`
+	VocalWaveform          []byte          `json:"vocal_waveform"`
+	InstrumentalWaveform   []byte          `json:"instrumental_waveform"`
+	MusicBrainzRecordingID *string         `json:"musicbrainz_recording_id"`
+	CanonicalTitle         *string         `json:"canonical_title"`
+	CreatedAt              time.Time       `json:"created_at"`
+}
+
+type LibraryTrackArtist struct {
+	TrackID  string `json:"track_id"`
+	ArtistID string `json:"artist_id"`
+	Role     string `json:"role"`
+	Position int32  `json:"position"`
+}
+
+type LibraryLyrics struct {
+	TrackID  string  `json:"track_id"`
+	Language *string `json:"language"`
+	Plain    string  `json:"plain"`
+	// LyricLine list, null for plain lyrics
+	Synced    json.RawMessage `json:"synced"`
+	Source    string          `json:"source"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type LibraryListen struct {
+	TrackID    string    `json:"track_id"`
+	AnonID     string    `json:"anon_id"`
+	ListenedAt time.Time `json:"listened_at"`
+}
+
+type LibraryPlayEvent struct {
+	TrackID   string      `json:"track_id"`
+	AnonID    string      `json:"anon_id"`
+	Type      string      `json:"type"`
+	Position  json.Number `json:"position"`
+	Duration  json.Number `json:"duration"`
+	CreatedAt time.Time   `json:"created_at"`
+}
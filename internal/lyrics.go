@@ -0,0 +1,412 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type LyricsSource string
+
+const (
+	// .lrc or text file next to the audio
+	LyricsSourceSidecar LyricsSource = "sidecar"
+	// synchronised lyrics frame of the ID3 tag
+	LyricsSourceSYLT LyricsSource = "sylt"
+	// unsynchronised lyrics frame of the ID3 tag, which may hold LRC
+	LyricsSourceUSLT LyricsSource = "uslt"
+	// lyrics tag of other formats such as FLAC, read by exiftool
+	LyricsSourceTag LyricsSource = "tag"
+	// set with `strafe db lyrics set`
+	LyricsSourceCLI LyricsSource = "cli"
+)
+
+// ErrNoLyrics is returned if the audio has no lyrics
+var ErrNoLyrics = errors.New("no lyrics")
+
+// LyricWord is a word of enhanced LRC, the word is sung from Time until the next word
+type LyricWord struct {
+	// seconds
+	Time float64 `json:"time"`
+	Text string  `json:"text"`
+}
+
+// LyricLine is shown from Time until the next line
+type LyricLine struct {
+	// seconds
+	Time  float64     `json:"time"`
+	Text  string      `json:"text"`
+	Words []LyricWord `json:"words,omitempty"`
+}
+
+type Lyrics struct {
+	// ISO 639-2 code such as eng, empty if unknown
+	Language string
+	Plain    string
+	// nil for lyrics without times
+	Lines []LyricLine
+}
+
+var (
+	lrcTimePattern = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	lrcTagPattern  = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]$`)
+	lrcWordPattern = regexp.MustCompile(`<(\d+):(\d{1,2})(?:[.:](\d{1,3}))?>`)
+)
+
+// ParseLyrics parses LRC and enhanced LRC, text without line times is kept as plain lyrics
+func ParseLyrics(text string) Lyrics {
+	var (
+		lyrics  Lyrics
+		plain   []string
+		offset  float64
+		scanner = bufio.NewScanner(strings.NewReader(strings.TrimPrefix(text, "\ufeff")))
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var times []float64
+		for {
+			match := lrcTimePattern.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			times = append(times, lrcSeconds(match[1], match[2], match[3]))
+			line = strings.TrimSpace(line[len(match[0]):])
+		}
+		if len(times) == 0 {
+			if tag := lrcTagPattern.FindStringSubmatch(line); tag != nil {
+				// positive offsets show the lyrics earlier
+				if strings.EqualFold(tag[1], "offset") {
+					if milliseconds, err := strconv.Atoi(strings.TrimSpace(tag[2])); err == nil {
+						offset = float64(milliseconds) / 1000
+					}
+				}
+				continue
+			}
+			plain = append(plain, line)
+			continue
+		}
+		words := lrcWords(line)
+		if words != nil {
+			line = ""
+			for _, word := range words {
+				line += word.Text
+			}
+			line = strings.TrimSpace(line)
+		}
+		for _, at := range times {
+			lyrics.Lines = append(lyrics.Lines, LyricLine{Time: at, Text: line, Words: words})
+		}
+	}
+	if len(lyrics.Lines) == 0 {
+		lyrics.Plain = strings.TrimSpace(strings.Join(plain, "\n"))
+		return lyrics
+	}
+	// lines repeated with more than one time are listed once for every time
+	slices.SortStableFunc(lyrics.Lines, func(a, b LyricLine) int {
+		return cmpFloat(a.Time, b.Time)
+	})
+	var lines = make([]string, 0, len(lyrics.Lines))
+	for i := range lyrics.Lines {
+		lyrics.Lines[i].Time = max(lyrics.Lines[i].Time-offset, 0)
+		if words := lyrics.Lines[i].Words; words != nil {
+			shifted := slices.Clone(words)
+			for j := range shifted {
+				shifted[j].Time = max(shifted[j].Time-offset, 0)
+			}
+			lyrics.Lines[i].Words = shifted
+		}
+		lines = append(lines, lyrics.Lines[i].Text)
+	}
+	lyrics.Plain = strings.TrimSpace(strings.Join(lines, "\n"))
+	return lyrics
+}
+
+// SaveLyrics replaces the lyrics of the track
+func SaveLyrics(ctx context.Context, q *db.Queries, trackID string, lyrics Lyrics, source LyricsSource) error {
+	var params = db.UpsertLyricsParams{TrackID: trackID, Plain: lyrics.Plain, Source: string(source)}
+	if lyrics.Language != "" {
+		params.Language = pgtype.Text{String: lyrics.Language, Valid: true}
+	}
+	if lyrics.Lines != nil {
+		synced, err := json.Marshal(lyrics.Lines)
+		if err != nil {
+			return fmt.Errorf("failed to encode lyrics: %w", err)
+		}
+		params.Synced = synced
+	}
+	return q.UpsertLyrics(ctx, params)
+}
+
+// lrcWords splits "<00:12.00>some <00:12.50>words" into timed words, nil if the line has no word times
+func lrcWords(line string) []LyricWord {
+	matches := lrcWordPattern.FindAllStringSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	var words []LyricWord
+	for i, match := range matches {
+		end := len(line)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		text := line[match[1]:end]
+		if strings.TrimSpace(text) == "" {
+			// a time after the last word marks where it ends
+			continue
+		}
+		var fraction string
+		if match[6] >= 0 {
+			fraction = line[match[6]:match[7]]
+		}
+		words = append(words, LyricWord{Time: lrcSeconds(line[match[2]:match[3]], line[match[4]:match[5]], fraction), Text: text})
+	}
+	return words
+}
+
+// lrcSeconds reads a time such as 01:02.5, 01:02.50 or 01:02.500
+func lrcSeconds(minutes string, seconds string, fraction string) float64 {
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	var f float64
+	if fraction != "" {
+		f, _ = strconv.ParseFloat("0."+fraction, 64)
+	}
+	return float64(m*60+s) + f
+}
+
+func cmpFloat(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ReadID3Lyrics reads the lyrics from the ID3v2.3 or ID3v2.4 tag at the start of the file, synchronised lyrics are
+// preferred. unsynchronised lyrics holding LRC are parsed as synced lyrics. returns ErrNoLyrics if the file has none.
+func ReadID3Lyrics(path string) (Lyrics, LyricsSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Lyrics{}, "", err
+	}
+	defer file.Close()
+	var header [10]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil || string(header[:3]) != "ID3" {
+		return Lyrics{}, "", ErrNoLyrics
+	}
+	version, flags := header[3], header[5]
+	if version != 3 && version != 4 {
+		return Lyrics{}, "", ErrNoLyrics
+	}
+	tag := make([]byte, syncsafe(header[6:10]))
+	if _, err := io.ReadFull(file, tag); err != nil {
+		return Lyrics{}, "", fmt.Errorf("failed to read ID3 tag of %s: %w", path, err)
+	}
+	if version == 3 && flags&0x80 != 0 {
+		tag = removeUnsynchronisation(tag)
+	}
+	if flags&0x40 != 0 && len(tag) >= 4 {
+		// extended header, its size includes itself in 2.4 only
+		size := int(binary.BigEndian.Uint32(tag[:4])) + 4
+		if version == 4 {
+			size = syncsafe(tag[:4])
+		}
+		if size > len(tag) {
+			return Lyrics{}, "", ErrNoLyrics
+		}
+		tag = tag[size:]
+	}
+	var unsynced *Lyrics
+	for len(tag) >= 10 && tag[0] != 0 {
+		id := string(tag[:4])
+		size := int(binary.BigEndian.Uint32(tag[4:8]))
+		if version == 4 {
+			size = syncsafe(tag[4:8])
+		}
+		formatFlags := tag[9]
+		if 10+size > len(tag) {
+			break
+		}
+		frame := tag[10 : 10+size]
+		tag = tag[10+size:]
+		if version == 4 {
+			// compressed and encrypted frames are skipped
+			if formatFlags&0x0c != 0 {
+				continue
+			}
+			if formatFlags&0x02 != 0 {
+				frame = removeUnsynchronisation(frame)
+			}
+			if formatFlags&0x01 != 0 && len(frame) >= 4 {
+				frame = frame[4:]
+			}
+		} else if formatFlags&0xc0 != 0 {
+			continue
+		}
+		switch id {
+		case "SYLT":
+			if lyrics, ok := parseSYLT(frame); ok {
+				return lyrics, LyricsSourceSYLT, nil
+			}
+		case "USLT":
+			if lyrics, ok := parseUSLT(frame); ok && unsynced == nil {
+				unsynced = &lyrics
+			}
+		}
+	}
+	if unsynced != nil {
+		return *unsynced, LyricsSourceUSLT, nil
+	}
+	return Lyrics{}, "", ErrNoLyrics
+}
+
+// parseUSLT reads encoding, language, descriptor and the lyrics
+func parseUSLT(frame []byte) (Lyrics, bool) {
+	if len(frame) < 4 {
+		return Lyrics{}, false
+	}
+	encoding, language := frame[0], id3Language(frame[1:4])
+	_, rest := id3String(encoding, frame[4:])
+	text, _ := id3String(encoding, rest)
+	lyrics := ParseLyrics(text)
+	lyrics.Language = language
+	return lyrics, lyrics.Plain != ""
+}
+
+// parseSYLT reads encoding, language, time format, content type, descriptor and text with a time after every entry.
+// entries are lines, unless some of them start with a line break, then entries are words of the lines.
+func parseSYLT(frame []byte) (Lyrics, bool) {
+	if len(frame) < 6 {
+		return Lyrics{}, false
+	}
+	encoding, language, format := frame[0], id3Language(frame[1:4]), frame[4]
+	// times in MPEG frames cannot be turned into seconds without the frame rate
+	if format != 2 {
+		return Lyrics{}, false
+	}
+	_, rest := id3String(encoding, frame[6:])
+	type entry struct {
+		text string
+		time float64
+	}
+	var (
+		entries []entry
+		words   bool
+	)
+	for len(rest) > 0 {
+		var text string
+		text, rest = id3String(encoding, rest)
+		if len(rest) < 4 {
+			break
+		}
+		entries = append(entries, entry{text: text, time: float64(binary.BigEndian.Uint32(rest[:4])) / 1000})
+		rest = rest[4:]
+		words = words || strings.HasPrefix(text, "\n") || strings.HasPrefix(text, "\r")
+	}
+	var lyrics = Lyrics{Language: language}
+	for i, entry := range entries {
+		text := strings.TrimLeft(entry.text, "\r\n")
+		if !words {
+			lyrics.Lines = append(lyrics.Lines, LyricLine{Time: entry.time, Text: strings.TrimSpace(text)})
+			continue
+		}
+		if i == 0 || text != entry.text || len(lyrics.Lines) == 0 {
+			lyrics.Lines = append(lyrics.Lines, LyricLine{Time: entry.time})
+		}
+		line := &lyrics.Lines[len(lyrics.Lines)-1]
+		line.Words = append(line.Words, LyricWord{Time: entry.time, Text: text})
+		line.Text = strings.TrimSpace(line.Text + text)
+	}
+	if len(lyrics.Lines) == 0 {
+		return Lyrics{}, false
+	}
+	var lines = make([]string, 0, len(lyrics.Lines))
+	for _, line := range lyrics.Lines {
+		lines = append(lines, line.Text)
+	}
+	lyrics.Plain = strings.TrimSpace(strings.Join(lines, "\n"))
+	return lyrics, true
+}
+
+// id3String decodes the text up to the terminator of the encoding and returns the bytes after it
+func id3String(encoding byte, data []byte) (string, []byte) {
+	if encoding == 1 || encoding == 2 {
+		end := len(data) - len(data)%2
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				end = i
+				break
+			}
+		}
+		rest := data[min(end+2, len(data)):]
+		units := data[:end]
+		bigEndian := encoding == 2
+		if len(units) >= 2 && encoding == 1 {
+			switch {
+			case units[0] == 0xfe && units[1] == 0xff:
+				bigEndian, units = true, units[2:]
+			case units[0] == 0xff && units[1] == 0xfe:
+				units = units[2:]
+			}
+		}
+		var decoded = make([]uint16, 0, len(units)/2)
+		for i := 0; i+1 < len(units); i += 2 {
+			if bigEndian {
+				decoded = append(decoded, binary.BigEndian.Uint16(units[i:]))
+			} else {
+				decoded = append(decoded, binary.LittleEndian.Uint16(units[i:]))
+			}
+		}
+		return string(utf16.Decode(decoded)), rest
+	}
+	end := bytes.IndexByte(data, 0)
+	var rest []byte
+	if end < 0 {
+		end = len(data)
+	} else {
+		rest = data[end+1:]
+	}
+	if encoding == 3 {
+		return string(data[:end]), rest
+	}
+	// ISO-8859-1 maps to the first 256 code points
+	var runes = make([]rune, 0, end)
+	for _, b := range data[:end] {
+		runes = append(runes, rune(b))
+	}
+	return string(runes), rest
+}
+
+func id3Language(code []byte) string {
+	language := strings.ToLower(strings.TrimRight(string(code), "\x00 "))
+	if language == "xxx" || language == "und" {
+		return ""
+	}
+	return language
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// removeUnsynchronisation turns every 0xFF 0x00 back into 0xFF
+func removeUnsynchronisation(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte{0xff, 0x00}, []byte{0xff})
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLyrics(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Lyrics
+	}{
+		{
+			name: "plain text",
+			text: "first line\nsecond line\n",
+			want: Lyrics{Plain: "first line\nsecond line"},
+		},
+		{
+			name: "lrc with tags",
+			text: "[ar:Artist]\n[ti:Title]\n[00:12.00]first line\n[00:15.5]second line\n[01:02.500]third line",
+			want: Lyrics{
+				Plain: "first line\nsecond line\nthird line",
+				Lines: []LyricLine{{Time: 12, Text: "first line"}, {Time: 15.5, Text: "second line"}, {Time: 62.5, Text: "third line"}},
+			},
+		},
+		{
+			name: "repeated lines are listed for every time",
+			text: "[00:10.00][00:30.00]chorus\n[00:20.00]verse",
+			want: Lyrics{
+				Plain: "chorus\nverse\nchorus",
+				Lines: []LyricLine{{Time: 10, Text: "chorus"}, {Time: 20, Text: "verse"}, {Time: 30, Text: "chorus"}},
+			},
+		},
+		{
+			name: "offset shows lyrics earlier",
+			text: "[offset:500]\n[00:00.20]intro\n[00:10.00]line",
+			want: Lyrics{
+				Plain: "intro\nline",
+				Lines: []LyricLine{{Time: 0, Text: "intro"}, {Time: 9.5, Text: "line"}},
+			},
+		},
+		{
+			name: "byte order mark and colon fractions",
+			text: "\ufeff[00:05:25]line",
+			want: Lyrics{Plain: "line", Lines: []LyricLine{{Time: 5.25, Text: "line"}}},
+		},
+		{
+			name: "empty lines keep their time",
+			text: "[00:01.00]line\n[00:04.00]\n[00:08.00]next",
+			want: Lyrics{
+				Plain: "line\n\nnext",
+				Lines: []LyricLine{{Time: 1, Text: "line"}, {Time: 4, Text: ""}, {Time: 8, Text: "next"}},
+			},
+		},
+		{
+			name: "enhanced lrc",
+			text: "[00:12.00]<00:12.00>some <00:12.50>words<00:13.00>\n[00:14.00]<00:14.00>next <00:14.75>line",
+			want: Lyrics{
+				Plain: "some words\nnext line",
+				Lines: []LyricLine{
+					{Time: 12, Text: "some words", Words: []LyricWord{{Time: 12, Text: "some "}, {Time: 12.5, Text: "words"}}},
+					{Time: 14, Text: "next line", Words: []LyricWord{{Time: 14, Text: "next "}, {Time: 14.75, Text: "line"}}},
+				},
+			},
+		},
+		{
+			name: "offset shifts words",
+			text: "[offset:+1000]\n[00:12.00]<00:12.00>some <00:12.50>words",
+			want: Lyrics{
+				Plain: "some words",
+				Lines: []LyricLine{{Time: 11, Text: "some words", Words: []LyricWord{{Time: 11, Text: "some "}, {Time: 11.5, Text: "words"}}}},
+			},
+		},
+		{
+			name: "empty",
+			text: "",
+			want: Lyrics{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseLyrics(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLyrics(%q) =\n%+v\nwant\n%+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLyricsSharesNoWords(t *testing.T) {
+	// a line with two times is listed twice, shifting the words of one must not shift the other
+	lyrics := ParseLyrics("[offset:1000]\n[00:10.00][00:20.00]<00:10.00>la <00:10.50>la")
+	if len(lyrics.Lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lyrics.Lines))
+	}
+	if first, second := lyrics.Lines[0].Words[0].Time, lyrics.Lines[1].Words[0].Time; first != 9 || second != 9 {
+		t.Errorf("word times are %v and %v, want 9 and 9", first, second)
+	}
+}
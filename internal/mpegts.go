@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const tsPacketSize = 188
+
+// ErrNoAudioStream is returned for segments without an AAC stream
+var ErrNoAudioStream = errors.New("segment has no audio stream")
+
+var adtsSampleRates = [...]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// ADTSFrame is an AAC frame with its ADTS header, frames can be concatenated into a playable .aac stream
+type ADTSFrame struct {
+	Data     []byte
+	Duration time.Duration
+}
+
+// DemuxADTS returns the ADTS stream of the first audio stream in the MPEG-TS segment, segments of tracks are
+// written by ffmpeg with a single AAC stream.
+func DemuxADTS(segment []byte) ([]byte, error) {
+	var (
+		audio []byte
+		pes   []byte
+		pid   = -1
+	)
+	flush := func() {
+		if payload, ok := pesPayload(pes); ok {
+			audio = append(audio, payload...)
+		}
+		pes = nil
+	}
+	for offset := 0; offset+tsPacketSize <= len(segment); offset += tsPacketSize {
+		packet := segment[offset : offset+tsPacketSize]
+		if packet[0] != 0x47 {
+			return nil, fmt.Errorf("segment lost sync at byte %d", offset)
+		}
+		var (
+			unitStart  = packet[1]&0x40 != 0
+			packetPID  = int(packet[1]&0x1f)<<8 | int(packet[2])
+			control    = packet[3] >> 4 & 0x3
+			payload    = packet[4:]
+			hasPayload = control&0x1 != 0
+		)
+		if control&0x2 != 0 {
+			length := int(payload[0])
+			if 1+length > len(payload) {
+				continue
+			}
+			payload = payload[1+length:]
+		}
+		if !hasPayload {
+			continue
+		}
+		if pid < 0 {
+			// the first packet that starts a PES packet of an audio stream picks the stream
+			if !unitStart || len(payload) < 4 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 || payload[3]&0xe0 != 0xc0 {
+				continue
+			}
+			pid = packetPID
+		}
+		if packetPID != pid {
+			continue
+		}
+		if unitStart {
+			flush()
+		}
+		pes = append(pes, payload...)
+	}
+	flush()
+	if pid < 0 {
+		return nil, ErrNoAudioStream
+	}
+	return audio, nil
+}
+
+// pesPayload strips the header of the PES packet
+func pesPayload(pes []byte) ([]byte, bool) {
+	if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		return nil, false
+	}
+	start := 9 + int(pes[8])
+	if start > len(pes) {
+		return nil, false
+	}
+	return pes[start:], true
+}
+
+// SplitADTS splits the stream into frames, bytes that are not part of a valid frame are skipped
+func SplitADTS(stream []byte) []ADTSFrame {
+	var frames []ADTSFrame
+	for offset := 0; offset+7 <= len(stream); {
+		header := stream[offset:]
+		if header[0] != 0xff || header[1]&0xf6 != 0xf0 {
+			offset++
+			continue
+		}
+		var (
+			rateIndex = int(header[2] >> 2 & 0xf)
+			length    = int(header[3]&0x3)<<11 | int(header[4])<<3 | int(header[5]>>5)
+			blocks    = int(header[6]&0x3) + 1
+		)
+		if rateIndex >= len(adtsSampleRates) || length < 7 || offset+length > len(stream) {
+			offset++
+			continue
+		}
+		frames = append(frames, ADTSFrame{
+			Data: stream[offset : offset+length],
+			// every raw data block is 1024 samples
+			Duration: time.Duration(blocks*1024) * time.Second / time.Duration(adtsSampleRates[rateIndex]),
+		})
+		offset += length
+	}
+	return frames
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// adtsFrame builds an AAC LC frame without CRC at the sample rate index with the given payload
+func adtsFrame(rateIndex int, blocks int, payload []byte) []byte {
+	length := 7 + len(payload)
+	header := []byte{
+		0xff,
+		0xf1,
+		byte(1<<6 | rateIndex<<2),
+		byte(2<<6 | length>>11&0x3),
+		byte(length >> 3),
+		byte(length&0x7<<5 | 0x1f),
+		byte(0xfc | (blocks - 1)),
+	}
+	return append(header, payload...)
+}
+
+func TestSplitADTS(t *testing.T) {
+	var (
+		first   = adtsFrame(4, 1, bytes.Repeat([]byte{1}, 100))
+		second  = adtsFrame(4, 1, bytes.Repeat([]byte{2}, 300))
+		slow    = adtsFrame(11, 2, bytes.Repeat([]byte{3}, 10))
+		invalid = adtsFrame(13, 1, bytes.Repeat([]byte{4}, 10))
+		frame   = time.Duration(1024) * time.Second / 44100
+	)
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	tests := []struct {
+		name      string
+		stream    []byte
+		frames    [][]byte
+		durations []time.Duration
+	}{
+		{"frames", join(first, second), [][]byte{first, second}, []time.Duration{frame, frame}},
+		{"garbage before and between", join([]byte{0, 0xff, 0x12}, first, []byte{0xff}, second), [][]byte{first, second}, []time.Duration{frame, frame}},
+		{"truncated frame", join(first, second[:50]), [][]byte{first}, []time.Duration{frame}},
+		{"unknown sample rate", join(invalid, first), [][]byte{first}, []time.Duration{frame}},
+		{"blocks and sample rate", slow, [][]byte{slow}, []time.Duration{2 * 1024 * time.Second / 8000}},
+		{"shorter than a header", []byte{0xff, 0xf1, 0x50}, nil, nil},
+		{"empty", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitADTS(tt.stream)
+			if len(got) != len(tt.frames) {
+				t.Fatalf("SplitADTS() returned %d frames, want %d", len(got), len(tt.frames))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i].Data, tt.frames[i]) {
+					t.Errorf("frame %d has %d bytes, want %d", i, len(got[i].Data), len(tt.frames[i]))
+				}
+				if got[i].Duration != tt.durations[i] {
+					t.Errorf("frame %d lasts %v, want %v", i, got[i].Duration, tt.durations[i])
+				}
+			}
+		})
+	}
+}
+
+// tsPackets wraps the PES packet into 188 byte transport stream packets of the pid, the last packet is padded
+// with an adaptation field
+func tsPackets(pid int, pes []byte) []byte {
+	var out []byte
+	for first := true; len(pes) > 0; first = false {
+		packet := []byte{0x47, byte(pid >> 8 & 0x1f), byte(pid), 0x10}
+		if first {
+			packet[1] |= 0x40
+		}
+		room := tsPacketSize - len(packet)
+		if len(pes) < room {
+			stuffing := room - len(pes) - 1
+			packet[3] = 0x30
+			packet = append(packet, byte(stuffing))
+			packet = append(packet, bytes.Repeat([]byte{0xff}, stuffing)...)
+			room = len(pes)
+		}
+		packet = append(packet, pes[:room]...)
+		pes = pes[room:]
+		out = append(out, packet...)
+	}
+	return out
+}
+
+func TestDemuxADTS(t *testing.T) {
+	audio := append(adtsFrame(4, 1, bytes.Repeat([]byte{1}, 250)), adtsFrame(4, 1, bytes.Repeat([]byte{2}, 120))...)
+	pes := append([]byte{0, 0, 1, 0xc0, 0, 0, 0x80, 0x80, 5, 0x21, 0, 1, 0, 1}, audio...)
+	// a PES packet of another stream comes first and is skipped
+	other := append([]byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0, 0}, bytes.Repeat([]byte{9}, 50)...)
+	segment := append(tsPackets(0x100, other), tsPackets(0x101, pes)...)
+	got, err := DemuxADTS(segment)
+	if err != nil {
+		t.Fatalf("DemuxADTS() error = %v", err)
+	}
+	if !bytes.Equal(got, audio) {
+		t.Errorf("DemuxADTS() returned %d bytes, want %d", len(got), len(audio))
+	}
+	if frames := SplitADTS(got); len(frames) != 2 {
+		t.Errorf("demuxed stream has %d frames, want 2", len(frames))
+	}
+	if _, err := DemuxADTS(tsPackets(0x100, other)); err != ErrNoAudioStream {
+		t.Errorf("DemuxADTS() of a segment without audio error = %v, want ErrNoAudioStream", err)
+	}
+	if _, err := DemuxADTS(append([]byte{0x46}, segment[1:]...)); err == nil {
+		t.Error("DemuxADTS() accepted a segment without sync")
+	}
+}
@@ -0,0 +1,501 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultMusicBrainzURL       = "https://musicbrainz.org/ws/2"
+	DefaultCoverArtArchiveURL   = "https://coverartarchive.org"
+	DefaultMusicBrainzUserAgent = "strafe/0.1 ( https://github.com/caner-cetin/strafe )"
+	// musicbrainz.org allows one request per second from every client
+	DefaultMusicBrainzRateLimit = time.Second
+	DefaultMusicBrainzMinScore  = 90
+	DefaultMusicBrainzCacheTTL  = 30 * 24 * time.Hour
+	// seconds, recordings whose length differs more from the audio are other versions of the song
+	musicBrainzDurationTolerance = 5
+	// rate limited requests are retried this many times
+	musicBrainzRetries = 3
+)
+
+var (
+	ErrNoMusicBrainzMatch = errors.New("no matching recording on musicbrainz")
+	ErrNoCoverArt         = errors.New("release has no cover art")
+	errMusicBrainzMissing = errors.New("not found")
+	// "(Deluxe Edition)", "[Remastered]" at the end of album titles
+	titleSuffix = regexp.MustCompile(`\s*[\(\[][^\(\)\[\]]*[\)\]]\s*$`)
+)
+
+// MusicBrainz looks up recordings on a musicbrainz compatible web service and their covers on a cover art archive
+// compatible one. requests of all callers share the rate limit, and responses are cached on disk.
+type MusicBrainz struct {
+	BaseURL     string
+	CoverArtURL string
+	// musicbrainz.org blocks clients without a user agent that names the application and a contact
+	UserAgent string
+	// minimum time between two requests
+	RateLimit time.Duration
+	// lowest search score of the recordings that are considered, 0 to 100
+	MinScore int
+	// responses are cached under this directory, caching is disabled if empty
+	CacheDir string
+	CacheTTL time.Duration
+	Client   *http.Client
+
+	mu sync.Mutex
+	// time the next request may be sent
+	next time.Time
+}
+
+// MusicBrainzQuery is what the tags of the audio tell about it
+type MusicBrainzQuery struct {
+	// recording id of the MusicBrainz Track Id tag, the recording is looked up by id if set
+	RecordingID string
+	Title       string
+	Artist      string
+	Album       string
+	// seconds, recordings of any length match if 0
+	Duration float64
+}
+
+type MusicBrainzMatch struct {
+	RecordingID string
+	Title       string
+	// artist credit as musicbrainz writes it, such as "A feat. B"
+	Artist  string
+	Artists []MusicBrainzArtist
+	Score   int
+	// release fields are empty if the album tag names none of the releases of the recording
+	ReleaseID      string
+	ReleaseGroupID string
+	ReleaseTitle   string
+	// YYYY, YYYY-MM or YYYY-MM-DD
+	ReleaseDate string
+	TrackNumber int
+	TrackCount  int
+	DiscNumber  int
+}
+
+type MusicBrainzArtist struct {
+	ID   string
+	Name string
+}
+
+type musicBrainzRecordings struct {
+	Recordings []musicBrainzRecording `json:"recordings"`
+}
+
+type musicBrainzRecording struct {
+	ID    string `json:"id"`
+	Score int    `json:"score"`
+	Title string `json:"title"`
+	// milliseconds, 0 if unknown
+	Length       int `json:"length"`
+	ArtistCredit []struct {
+		Name       string `json:"name"`
+		JoinPhrase string `json:"joinphrase"`
+		Artist     struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"artist"`
+	} `json:"artist-credit"`
+	Releases []musicBrainzRelease `json:"releases"`
+}
+
+type musicBrainzRelease struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	Status       string `json:"status"`
+	Date         string `json:"date"`
+	ReleaseGroup struct {
+		ID          string `json:"id"`
+		PrimaryType string `json:"primary-type"`
+	} `json:"release-group"`
+	// only the medium with the recording
+	Media []struct {
+		Position    int `json:"position"`
+		TrackCount  int `json:"track-count"`
+		TrackOffset int `json:"track-offset"`
+		Track       []struct {
+			Number string `json:"number"`
+		} `json:"track"`
+	} `json:"media"`
+}
+
+// NewMusicBrainz creates a client from the musicbrainz section of the config, musicbrainz.org is used by default
+func NewMusicBrainz() (*MusicBrainz, error) {
+	m := &MusicBrainz{
+		BaseURL:     DefaultMusicBrainzURL,
+		CoverArtURL: DefaultCoverArtArchiveURL,
+		UserAgent:   DefaultMusicBrainzUserAgent,
+		RateLimit:   DefaultMusicBrainzRateLimit,
+		MinScore:    DefaultMusicBrainzMinScore,
+		CacheTTL:    DefaultMusicBrainzCacheTTL,
+		Client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	for key, target := range map[string]*string{MUSICBRAINZ_BASE_URL: &m.BaseURL, MUSICBRAINZ_COVER_ART_URL: &m.CoverArtURL} {
+		if viper.GetString(key) == "" {
+			continue
+		}
+		*target = strings.TrimSuffix(viper.GetString(key), "/")
+		if parsed, err := url.Parse(*target); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%s must be an http or https url, got %q", key, *target)
+		}
+	}
+	if viper.GetString(MUSICBRAINZ_USER_AGENT) != "" {
+		m.UserAgent = viper.GetString(MUSICBRAINZ_USER_AGENT)
+	}
+	if viper.IsSet(MUSICBRAINZ_RATE_LIMIT) {
+		m.RateLimit = viper.GetDuration(MUSICBRAINZ_RATE_LIMIT)
+	}
+	if viper.IsSet(MUSICBRAINZ_MIN_SCORE) {
+		m.MinScore = viper.GetInt(MUSICBRAINZ_MIN_SCORE)
+	}
+	if viper.IsSet(MUSICBRAINZ_CACHE_TTL) {
+		m.CacheTTL = viper.GetDuration(MUSICBRAINZ_CACHE_TTL)
+	}
+	if viper.GetString(MUSICBRAINZ_CACHE_DIR) != "" {
+		m.CacheDir = viper.GetString(MUSICBRAINZ_CACHE_DIR)
+	} else if dir, err := os.UserCacheDir(); err == nil {
+		m.CacheDir = filepath.Join(dir, "strafe", "musicbrainz")
+	}
+	if m.CacheTTL <= 0 {
+		m.CacheDir = ""
+	}
+	return m, nil
+}
+
+// Lookup finds the recording of the audio, and the release the album tag names. returns ErrNoMusicBrainzMatch if no
+// recording of the artist with the title has a high enough score and the length of the audio.
+//
+// releases named like the album tag are preferred, then official releases of albums, then the earliest release. the
+// release is left empty if the album tag names none of the releases, the audio is from another release then.
+func (m *MusicBrainz) Lookup(ctx context.Context, q MusicBrainzQuery) (MusicBrainzMatch, error) {
+	var query string
+	if q.RecordingID != "" {
+		if _, err := uuid.Parse(q.RecordingID); err != nil {
+			return MusicBrainzMatch{}, fmt.Errorf("recording id %q is not a uuid: %w", q.RecordingID, err)
+		}
+		query = "rid:" + q.RecordingID
+	} else {
+		if strings.TrimSpace(q.Title) == "" || strings.TrimSpace(q.Artist) == "" {
+			return MusicBrainzMatch{}, fmt.Errorf("title and artist tags are required: %w", ErrNoMusicBrainzMatch)
+		}
+		query = fmt.Sprintf("recording:%s AND artist:%s", luceneQuote(q.Title), luceneQuote(q.Artist))
+	}
+	body, err := m.get(ctx, m.BaseURL+"/recording?"+url.Values{"query": {query}, "fmt": {"json"}, "limit": {"25"}}.Encode())
+	if err != nil {
+		return MusicBrainzMatch{}, fmt.Errorf("failed to search recordings: %w", err)
+	}
+	var result musicBrainzRecordings
+	if err := json.Unmarshal(body, &result); err != nil {
+		return MusicBrainzMatch{}, fmt.Errorf("invalid recording search response: %w", err)
+	}
+
+	type candidate struct {
+		recording  *musicBrainzRecording
+		release    *musicBrainzRelease
+		albumMatch bool
+	}
+	// negative if a is a better match than b
+	compare := func(a candidate, b candidate) int {
+		if a.albumMatch != b.albumMatch {
+			return boolRank(a.albumMatch)
+		}
+		if a.recording.Score != b.recording.Score {
+			return b.recording.Score - a.recording.Score
+		}
+		if (a.release == nil) != (b.release == nil) {
+			return boolRank(a.release != nil)
+		}
+		if a.release == nil {
+			return 0
+		}
+		if official := a.release.Status == "Official"; official != (b.release.Status == "Official") {
+			return boolRank(official)
+		}
+		if album := a.release.ReleaseGroup.PrimaryType == "Album"; album != (b.release.ReleaseGroup.PrimaryType == "Album") {
+			return boolRank(album)
+		}
+		if (a.release.Date == "") != (b.release.Date == "") {
+			return boolRank(a.release.Date != "")
+		}
+		return cmp.Compare(a.release.Date, b.release.Date)
+	}
+	var (
+		best  *candidate
+		album = normalizeTitle(q.Album)
+	)
+	for i := range result.Recordings {
+		recording := &result.Recordings[i]
+		if q.RecordingID == "" {
+			if recording.Score < m.MinScore {
+				continue
+			}
+			if q.Duration > 0 && recording.Length > 0 && math.Abs(float64(recording.Length)/1000-q.Duration) > musicBrainzDurationTolerance {
+				continue
+			}
+		}
+		var candidates = []candidate{{recording: recording}}
+		for j := range recording.Releases {
+			release := &recording.Releases[j]
+			candidates = append(candidates, candidate{recording: recording, release: release, albumMatch: album != "" && normalizeTitle(release.Title) == album})
+		}
+		for _, c := range candidates {
+			if best == nil || compare(c, *best) < 0 {
+				best = &c
+			}
+		}
+	}
+	if best == nil {
+		return MusicBrainzMatch{}, ErrNoMusicBrainzMatch
+	}
+
+	var match = MusicBrainzMatch{RecordingID: best.recording.ID, Title: best.recording.Title, Score: best.recording.Score}
+	for _, credit := range best.recording.ArtistCredit {
+		match.Artist += credit.Name + credit.JoinPhrase
+		match.Artists = append(match.Artists, MusicBrainzArtist{ID: credit.Artist.ID, Name: credit.Name})
+	}
+	if release := best.release; release != nil && (best.albumMatch || album == "") {
+		match.ReleaseID = release.ID
+		match.ReleaseGroupID = release.ReleaseGroup.ID
+		match.ReleaseTitle = release.Title
+		match.ReleaseDate = release.Date
+		if len(release.Media) > 0 {
+			medium := release.Media[0]
+			match.DiscNumber = medium.Position
+			match.TrackCount = medium.TrackCount
+			match.TrackNumber = medium.TrackOffset + 1
+			if len(medium.Track) > 0 {
+				if number, err := strconv.Atoi(medium.Track[0].Number); err == nil {
+					match.TrackNumber = number
+				}
+			}
+		}
+	}
+	return match, nil
+}
+
+// Genre returns the genre most users voted for on the release group, empty if it has none
+func (m *MusicBrainz) Genre(ctx context.Context, releaseGroupID string) (string, error) {
+	body, err := m.get(ctx, fmt.Sprintf("%s/release-group/%s?%s", m.BaseURL, url.PathEscape(releaseGroupID), url.Values{"inc": {"genres"}, "fmt": {"json"}}.Encode()))
+	if err != nil {
+		if errors.Is(err, errMusicBrainzMissing) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get release group: %w", err)
+	}
+	var result struct {
+		Genres []struct {
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		} `json:"genres"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("invalid release group response: %w", err)
+	}
+	var genre string
+	var votes = -1
+	for _, candidate := range result.Genres {
+		if candidate.Count > votes {
+			genre, votes = candidate.Name, candidate.Count
+		}
+	}
+	return capitalizeWords(genre), nil
+}
+
+// CoverArt returns the front cover of the release, or of the release group if the release has none.
+// returns ErrNoCoverArt if neither has one.
+func (m *MusicBrainz) CoverArt(ctx context.Context, releaseID string, releaseGroupID string) ([]byte, error) {
+	for _, target := range []string{"release/" + releaseID, "release-group/" + releaseGroupID} {
+		if strings.HasSuffix(target, "/") {
+			continue
+		}
+		image, err := m.get(ctx, fmt.Sprintf("%s/%s/front", m.CoverArtURL, target))
+		if errors.Is(err, errMusicBrainzMissing) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cover art: %w", err)
+		}
+		return image, nil
+	}
+	return nil, ErrNoCoverArt
+}
+
+// get returns the body of the response to the url, from the cache if it was cached within the TTL. rate limited
+// requests are retried after the time the service asks for. returns errMusicBrainzMissing for 404.
+func (m *MusicBrainz) get(ctx context.Context, target string) ([]byte, error) {
+	cached := m.cachePath(target)
+	if cached != "" {
+		if info, err := os.Stat(cached); err == nil && time.Since(info.ModTime()) < m.CacheTTL {
+			if body, err := os.ReadFile(cached); err == nil {
+				return body, nil
+			}
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if err := m.wait(ctx); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", m.UserAgent)
+		res, err := m.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response of %s: %w", target, err)
+		}
+		switch {
+		case res.StatusCode == http.StatusOK:
+			if cached != "" {
+				if err := writeCache(cached, body); err != nil {
+					log.Debug().Err(err).Str("url", target).Msg("failed to cache response")
+				}
+			}
+			return body, nil
+		case res.StatusCode == http.StatusNotFound:
+			return nil, errMusicBrainzMissing
+		case (res.StatusCode == http.StatusServiceUnavailable || res.StatusCode == http.StatusTooManyRequests) && attempt < musicBrainzRetries:
+			delay := time.Duration(1<<attempt) * time.Second
+			if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+			log.Debug().Str("url", target).Dur("delay", delay).Msg("rate limited by musicbrainz, retrying")
+			m.delay(delay)
+		default:
+			return nil, fmt.Errorf("%s responded with %s", target, res.Status)
+		}
+	}
+}
+
+// wait blocks until the rate limit allows the next request and reserves its slot
+func (m *MusicBrainz) wait(ctx context.Context) error {
+	m.mu.Lock()
+	start := time.Now()
+	if m.next.After(start) {
+		start = m.next
+	}
+	m.next = start.Add(m.RateLimit)
+	m.mu.Unlock()
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// delay holds back every request for the duration, when the service is rate limiting us
+func (m *MusicBrainz) delay(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if next := time.Now().Add(duration); next.After(m.next) {
+		m.next = next
+	}
+}
+
+func (m *MusicBrainz) cachePath(target string) string {
+	if m.CacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(target))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(m.CacheDir, name[:2], name)
+}
+
+// writeCache writes the file next to the target and renames it, concurrent readers never see a partial response
+func writeCache(path string, body []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(body); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// luceneQuote quotes the value as a phrase of the search query
+func luceneQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// normalizeTitle lowercases the title and drops punctuation and edition suffixes, so that album tags match the
+// release titles of musicbrainz
+func normalizeTitle(title string) string {
+	for {
+		trimmed := titleSuffix.ReplaceAllString(title, "")
+		if trimmed == title {
+			break
+		}
+		title = trimmed
+	}
+	var builder strings.Builder
+	for _, word := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(word)
+	}
+	return builder.String()
+}
+
+// capitalizeWords turns genres such as "drum and bass" into "Drum And Bass", like the genre tags of most files
+func capitalizeWords(value string) string {
+	words := strings.Fields(value)
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// boolRank is -1 if the candidate having the property is better, 1 otherwise
+func boolRank(has bool) int {
+	if has {
+		return -1
+	}
+	return 1
+}
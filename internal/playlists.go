@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// M3U8Entry is a track of an exported playlist
+type M3U8Entry struct {
+	// seconds
+	Duration float64
+	Title    string
+	// url of the HLS playlist of the track
+	URL string
+}
+
+// M3U8Segment is a segment line of an HLS playlist
+type M3U8Segment struct {
+	// seconds
+	Duration float64
+	// relative to the folder of the playlist
+	URI string
+}
+
+// ReadM3U8Segments reads the segments of the HLS playlist in order, other tags are ignored
+func ReadM3U8Segments(playlist []byte) ([]M3U8Segment, error) {
+	var (
+		segments []M3U8Segment
+		duration float64
+		scanner  = bufio.NewScanner(bytes.NewReader(playlist))
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment duration %s: %w", value, err)
+			}
+			duration = parsed
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			segments = append(segments, M3U8Segment{Duration: duration, URI: line})
+			duration = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	return segments, nil
+}
+
+// WriteM3U8 writes the entries as an extended M3U playlist, players that support HLS play the tracks one after another
+func WriteM3U8(w io.Writer, name string, entries []M3U8Entry) error {
+	var buffered = bufio.NewWriter(w)
+	fmt.Fprintln(buffered, "#EXTM3U")
+	if name != "" {
+		fmt.Fprintf(buffered, "#PLAYLIST:%s\n", m3u8Line(name))
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(buffered, "#EXTINF:%d,%s\n", int(entry.Duration+0.5), m3u8Line(entry.Title))
+		fmt.Fprintln(buffered, entry.URL)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write playlist: %w", err)
+	}
+	return nil
+}
+
+// m3u8Line keeps titles with line breaks from breaking the playlist
+func m3u8Line(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+// CueEntry is a track of a cue sheet
+type CueEntry struct {
+	Title     string
+	Performer string
+	// seconds from the start of the file
+	Start float64
+}
+
+// WriteCueSheet writes the entries as a cue sheet of a single audio file, players show the tracks of the file
+// and can skip between them
+func WriteCueSheet(w io.Writer, title string, file string, entries []CueEntry) error {
+	var buffered = bufio.NewWriter(w)
+	if title != "" {
+		fmt.Fprintf(buffered, "TITLE %s\n", cueString(title))
+	}
+	fmt.Fprintf(buffered, "FILE %s WAVE\n", cueString(file))
+	for i, entry := range entries {
+		// indexes are minutes, seconds and frames, a second is 75 frames
+		frames := int(entry.Start*75 + 0.5)
+		fmt.Fprintf(buffered, "  TRACK %02d AUDIO\n", i+1)
+		fmt.Fprintf(buffered, "    TITLE %s\n", cueString(entry.Title))
+		fmt.Fprintf(buffered, "    PERFORMER %s\n", cueString(entry.Performer))
+		fmt.Fprintf(buffered, "    INDEX 01 %02d:%02d:%02d\n", frames/75/60, frames/75%60, frames%75)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write cue sheet: %w", err)
+	}
+	return nil
+}
+
+// cueString quotes the value, cue sheets cannot escape quotes
+func cueString(value string) string {
+	return `"` + strings.ReplaceAll(m3u8Line(value), `"`, "'") + `"`
+}
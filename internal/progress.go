@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type ProgressEventType string
+
+const (
+	ProgressStageStarted  ProgressEventType = "stage_started"
+	ProgressStageFinished ProgressEventType = "stage_finished"
+	// percent of the stage, and bytes for uploads
+	ProgressUpdate ProgressEventType = "progress"
+	ProgressLog    ProgressEventType = "log"
+	// the job failed and is queued again
+	ProgressRetrying ProgressEventType = "retrying"
+	ProgressDone     ProgressEventType = "done"
+	ProgressFailed   ProgressEventType = "failed"
+)
+
+// ProgressEvent is reported by the audio pipeline, printed by `strafe audio upload --json-events`
+// and streamed by GET /uploads/{id}/events
+type ProgressEvent struct {
+	Type       ProgressEventType `json:"type"`
+	Stage      string            `json:"stage,omitempty"`
+	Percent    *float64          `json:"percent,omitempty"`
+	Bytes      int64             `json:"bytes,omitempty"`
+	TotalBytes int64             `json:"total_bytes,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	TrackID    string            `json:"track_id,omitempty"`
+	Time       time.Time         `json:"time"`
+}
+
+// Finished is true for the last event of an ingest
+func (e ProgressEvent) Finished() bool {
+	return e.Type == ProgressDone || e.Type == ProgressFailed
+}
+
+var percentPattern = regexp.MustCompile(`(\d{1,3}(?:\.\d+)?)%`)
+
+// ProgressWriter reports the lines written to it as log events, carriage returns of progress bars end lines too.
+// the first percentage in a line is reported as a progress event whenever the whole percent changes.
+type ProgressWriter struct {
+	Emit func(ProgressEvent)
+
+	mu          sync.Mutex
+	line        []byte
+	lastPercent float64
+}
+
+func NewProgressWriter(emit func(ProgressEvent)) *ProgressWriter {
+	return &ProgressWriter{Emit: emit, lastPercent: -1}
+}
+
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.line = append(w.line, p...)
+	for {
+		end := bytes.IndexAny(w.line, "\r\n")
+		if end < 0 {
+			break
+		}
+		w.report(string(bytes.TrimSpace(w.line[:end])))
+		w.line = w.line[end+1:]
+	}
+	return len(p), nil
+}
+
+func (w *ProgressWriter) report(line string) {
+	if line == "" {
+		return
+	}
+	if match := percentPattern.FindStringSubmatch(line); match != nil {
+		percent, err := strconv.ParseFloat(match[1], 64)
+		if err == nil && percent <= 100 {
+			if math.Floor(percent) != w.lastPercent {
+				w.lastPercent = math.Floor(percent)
+				w.Emit(ProgressEvent{Type: ProgressUpdate, Percent: &percent})
+			}
+			// progress bars redraw the same line, only the changes are reported
+			return
+		}
+	}
+	w.Emit(ProgressEvent{Type: ProgressLog, Message: line})
+}
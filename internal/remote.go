@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrNotLoggedIn = errors.New("not logged in, run strafe auth login first")
+
+// RemoteCredentials is the token `strafe auth login` stored for calling a remote strafe server
+type RemoteCredentials struct {
+	Server    string     `json:"server"`
+	Username  string     `json:"username"`
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// RemoteCredentialsPath is strafe/credentials.json under the user config directory, ~/.config on linux
+func RemoteCredentialsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "strafe", "credentials.json"), nil
+}
+
+func SaveRemoteCredentials(credentials RemoteCredentials) error {
+	path, err := RemoteCredentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	encoded, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, encoded, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadRemoteCredentials returns ErrNotLoggedIn if no token is stored or the stored token expired
+func LoadRemoteCredentials() (RemoteCredentials, error) {
+	var credentials RemoteCredentials
+	path, err := RemoteCredentialsPath()
+	if err != nil {
+		return credentials, err
+	}
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return credentials, ErrNotLoggedIn
+		}
+		return credentials, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(encoded, &credentials); err != nil {
+		return credentials, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if credentials.ExpiresAt != nil && credentials.ExpiresAt.Before(time.Now()) {
+		return credentials, fmt.Errorf("token expired at %s: %w", credentials.ExpiresAt.Format(time.RFC3339), ErrNotLoggedIn)
+	}
+	return credentials, nil
+}
+
+func RemoveRemoteCredentials() error {
+	path, err := RemoteCredentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// NewRequest creates a request to the path of the server, authenticated with the stored token
+func (c RemoteCredentials) NewRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.Server, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	return req, nil
+}
@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+// S3Store keeps objects in a bucket of an S3 compatible storage
+type S3Store struct {
+	Client  *s3.Client
+	Config  aws.Config
+	Manager *manager.Uploader
+	Bucket  string
+}
+
+func (a *S3Store) CreateBucketIfNotExists(ctx context.Context, bucketName string) (bool, error) {
+	_, err := a.Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	exists := true
+	if err != nil {
+		var apiError smithy.APIError
+		if errors.As(err, &apiError) {
+			switch apiError.(type) {
+			case *types.NotFound:
+				log.Printf("Bucket %v is available.\n", bucketName)
+				exists = false
+				err = nil
+			default:
+				log.Printf("Either you don't have access to bucket %v or another error occurred. "+
+					"Here's what happened: %v\n", bucketName, err)
+			}
+		}
+	}
+	if !exists {
+		if a.Config.Region == "" {
+			a.Config.Region = "auto"
+		}
+		err = a.CreateBucket(ctx, bucketName, a.Config.Region)
+		if err != nil {
+			log.Printf("Failed to create bucket %v. Here's why: %v\n", bucketName, err)
+		} else {
+			log.Printf("Bucket %v created successfully.\n", bucketName)
+		}
+	}
+
+	return exists, err
+}
+
+func (a *S3Store) CreateBucket(ctx context.Context, name string, region string) error {
+	input := &s3.CreateBucketInput{Bucket: aws.String(name)}
+	// us-east-1 is the default location and is rejected as an explicit constraint by AWS and MinIO
+	if region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(region),
+		}
+	}
+	_, err := a.Client.CreateBucket(ctx, input)
+	if err != nil {
+		var owned *types.BucketAlreadyOwnedByYou
+		var exists *types.BucketAlreadyExists
+		if errors.As(err, &owned) {
+			log.Printf("You already own bucket %s.\n", name)
+			err = owned
+		} else if errors.As(err, &exists) {
+			log.Printf("Bucket %s already exists.\n", name)
+			err = exists
+		}
+	} else {
+		err = s3.NewBucketExistsWaiter(a.Client).Wait(
+			ctx, &s3.HeadBucketInput{Bucket: aws.String(name)}, time.Duration(TimeoutMS)*time.Millisecond)
+		if err != nil {
+			log.Printf("Failed attempt to wait for bucket %s to exist.\n", name)
+		}
+	}
+	return err
+}
+
+func (a *S3Store) Put(ctx context.Context, key string, contents []byte) error {
+	return a.PutReader(ctx, key, bytes.NewReader(contents), int64(len(contents)))
+}
+
+// PutReader uploads the reader in parts of the upload manager, only the parts in flight are held in memory
+func (a *S3Store) PutReader(ctx context.Context, key string, reader io.Reader, size int64) error {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(a.Bucket),
+		Key:           aws.String(key),
+		Body:          reader,
+		ContentLength: aws.Int64(size),
+	}
+
+	_, err := a.Manager.Upload(ctx, input)
+	if err != nil {
+		var noBucket *types.NoSuchBucket
+		if errors.As(err, &noBucket) {
+			return fmt.Errorf("bucket %s does not exist: %w", a.Bucket, err)
+		}
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	return nil
+}
+
+func (a *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(a.Bucket),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	var objects []ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(a.Client, input)
+
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			var noBucket *types.NoSuchBucket
+			if errors.As(err, &noBucket) {
+				return nil, fmt.Errorf("bucket %s does not exist: %w", a.Bucket, err)
+			}
+			return nil, fmt.Errorf("failed to list objects in bucket %s: %w", a.Bucket, err)
+		}
+
+		for _, object := range output.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func (a *S3Store) Get(ctx context.Context, objectKey string) ([]byte, error) {
+	result, err := a.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(a.Bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		var noKey *types.NoSuchKey
+		if errors.As(err, &noKey) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to get object %s from bucket %s: %w", objectKey, a.Bucket, err)
+	}
+	defer result.Body.Close()
+	body, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", objectKey, err)
+	}
+	return body, nil
+}
+
+func (a *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := a.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(a.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s from bucket %s: %w", key, a.Bucket, err)
+	}
+	return nil
+}
+
+func (a *S3Store) Open(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	head, err := a.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(a.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+		}
+		return nil, ObjectInfo{}, fmt.Errorf("failed to get object %s from bucket %s: %w", key, a.Bucket, err)
+	}
+	info := ObjectInfo{Key: key, Size: aws.ToInt64(head.ContentLength), LastModified: aws.ToTime(head.LastModified)}
+	return &s3ObjectReader{ctx: ctx, store: a, key: key, size: info.Size}, info, nil
+}
+
+func (a *S3Store) URL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	request, err := s3.NewPresignClient(a.Client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(a.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %w", key, err)
+	}
+	return request.URL, nil
+}
+
+// s3ObjectReader requests the object from the current offset on the first read after every seek,
+// serving a range downloads only the range.
+type s3ObjectReader struct {
+	ctx    context.Context
+	store  *S3Store
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		result, err := r.store.Client.GetObject(r.ctx, &s3.GetObjectInput{
+			Bucket: aws.String(r.store.Bucket),
+			Key:    aws.String(r.key),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-", r.offset)),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get object %s from offset %d: %w", r.key, r.offset, err)
+		}
+		r.body = result.Body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.offset + offset
+	case io.SeekEnd:
+		target = r.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("negative offset %d", target)
+	}
+	if target != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = target
+	return target, nil
+}
+
+func (r *s3ObjectReader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package internal
+
+import (
+	"strings"
+	"unicode"
+)
+
+// PrefixTSQuery turns free text into a to_tsquery expression where every word is matched as a prefix,
+// "daft pun" becomes "daft:* & pun:*". characters with a meaning in tsquery syntax are dropped,
+// an empty string is returned if nothing is left to search.
+func PrefixTSQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
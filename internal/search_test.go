@@ -0,0 +1,26 @@
+package internal
+
+import "testing"
+
+func TestPrefixTSQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"daft pun", "daft:* & pun:*"},
+		{"  Daft   PUNK ", "daft:* & punk:*"},
+		{"a&b|c", "a:* & b:* & c:*"},
+		{"!(rock) <-> 'roll':*", "rock:* & roll:*"},
+		{"mötley crüe", "mötley:* & crüe:*"},
+		{"808s", "808s:*"},
+		{"", ""},
+		{"&|!():*", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := PrefixTSQuery(tt.text); got != tt.want {
+				t.Errorf("PrefixTSQuery(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
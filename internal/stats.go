@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const DefaultStatsWindow = "7d"
+
+// Window is the time range statistics are aggregated over, a nil Since is open ended
+type Window struct {
+	Since *time.Time `json:"since"`
+	Until time.Time  `json:"until"`
+}
+
+// ParseWindow parses windows such as "24h", "7d", "4w" ending at until, "all" has no start
+func ParseWindow(window string, until time.Time) (Window, error) {
+	var parsed = Window{Until: until}
+	window = strings.TrimSpace(strings.ToLower(window))
+	if window == "all" {
+		return parsed, nil
+	}
+	var length time.Duration
+	switch {
+	case strings.HasSuffix(window, "d"), strings.HasSuffix(window, "w"):
+		count, err := strconv.Atoi(window[:len(window)-1])
+		if err != nil {
+			return parsed, fmt.Errorf("window must be a duration such as 24h, 7d, 4w or all: %w", err)
+		}
+		length = time.Duration(count) * 24 * time.Hour
+		if strings.HasSuffix(window, "w") {
+			length *= 7
+		}
+	default:
+		var err error
+		if length, err = time.ParseDuration(window); err != nil {
+			return parsed, fmt.Errorf("window must be a duration such as 24h, 7d, 4w or all: %w", err)
+		}
+	}
+	if length <= 0 {
+		return parsed, fmt.Errorf("window must be positive, got %s", window)
+	}
+	since := until.Add(-length)
+	parsed.Since = &since
+	return parsed, nil
+}
+
+// Bounds converts the window to the since and until parameters of the statistics queries
+func (w Window) Bounds() (since pgtype.Timestamptz, until pgtype.Timestamptz) {
+	if w.Since != nil {
+		since = pgtype.Timestamptz{Time: *w.Since, Valid: true}
+	}
+	return since, pgtype.Timestamptz{Time: w.Until, Valid: true}
+}
+
+// SkipRate is the share of the finished plays that were skipped, 0 if no play was finished
+func SkipRate(completes int64, skips int64) float64 {
+	if completes+skips == 0 {
+		return 0
+	}
+	return float64(skips) / float64(completes+skips)
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	until := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		window  string
+		length  time.Duration
+		all     bool
+		wantErr bool
+	}{
+		{window: "24h", length: 24 * time.Hour},
+		{window: "90m", length: 90 * time.Minute},
+		{window: "7d", length: 7 * 24 * time.Hour},
+		{window: " 7D ", length: 7 * 24 * time.Hour},
+		{window: "4w", length: 28 * 24 * time.Hour},
+		{window: "all", all: true},
+		{window: "ALL", all: true},
+		{window: "0d", wantErr: true},
+		{window: "-1h", wantErr: true},
+		{window: "d", wantErr: true},
+		{window: "1.5d", wantErr: true},
+		{window: "week", wantErr: true},
+		{window: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			got, err := ParseWindow(tt.window, until)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWindow(%q) error = %v, wantErr %v", tt.window, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Until.Equal(until) {
+				t.Errorf("ParseWindow(%q) until = %v, want %v", tt.window, got.Until, until)
+			}
+			if tt.all {
+				if got.Since != nil {
+					t.Errorf("ParseWindow(%q) since = %v, want open ended", tt.window, *got.Since)
+				}
+				return
+			}
+			if got.Since == nil || until.Sub(*got.Since) != tt.length {
+				t.Errorf("ParseWindow(%q) since = %v, want %v before until", tt.window, got.Since, tt.length)
+			}
+		})
+	}
+}
+
+func TestWindowBounds(t *testing.T) {
+	until := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	all, _ := ParseWindow("all", until)
+	if since, end := all.Bounds(); since.Valid || !end.Valid || !end.Time.Equal(until) {
+		t.Errorf("Bounds() of all = %+v, %+v", since, end)
+	}
+	week, _ := ParseWindow("7d", until)
+	if since, _ := week.Bounds(); !since.Valid || !since.Time.Equal(until.AddDate(0, 0, -7)) {
+		t.Errorf("Bounds() of 7d since = %+v", since)
+	}
+}
+
+func TestSkipRate(t *testing.T) {
+	tests := []struct {
+		completes, skips int64
+		want             float64
+	}{
+		{0, 0, 0},
+		{3, 1, 0.25},
+		{0, 5, 1},
+		{5, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := SkipRate(tt.completes, tt.skips); got != tt.want {
+			t.Errorf("SkipRate(%d, %d) = %v, want %v", tt.completes, tt.skips, got, tt.want)
+		}
+	}
+}
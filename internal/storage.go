@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	StorageBackendS3    = "s3"
+	StorageBackendLocal = "local"
+	// path the server serves objects of the local backend under
+	ObjectsRoute = "/objects"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object, keys are slash separated such as "Artist/Album/Title/vocal/000.ts"
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ObjectStore stores segments, playlists and covers.
+// methods return an error wrapping ErrObjectNotFound if the key does not exist.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, contents []byte) error
+	// PutReader stores size bytes of the reader without holding them in memory, for files too large to read at once
+	PutReader(ctx context.Context, key string, reader io.Reader, size int64) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Open returns a reader that can seek without downloading the whole object, for serving ranges
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes the object, deleting a key that does not exist is not an error
+	Delete(ctx context.Context, key string) error
+	// URL returns a url clients can fetch the object from for at least ttl
+	URL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// InitializeStorage initializes the object store selected by storage.backend, S3 is the default
+func (ctx *AppCtx) InitializeStorage() error {
+	switch backend := viper.GetString(STORAGE_BACKEND); backend {
+	case "", StorageBackendS3:
+		return ctx.InitializeS3()
+	case StorageBackendLocal:
+		if viper.GetString(STORAGE_LOCAL_PATH) == "" {
+			return fmt.Errorf("%s is not set", STORAGE_LOCAL_PATH)
+		}
+		store, err := NewLocalStore(viper.GetString(STORAGE_LOCAL_PATH))
+		if err != nil {
+			return err
+		}
+		ctx.Store = store
+		return nil
+	default:
+		return fmt.Errorf("unknown storage backend %s, expected %s or %s", backend, StorageBackendS3, StorageBackendLocal)
+	}
+}
+
+// LocalStore keeps objects as files under a directory, object keys are paths relative to the directory.
+// the server serves the objects under ObjectsRoute, see URL.
+type LocalStore struct {
+	Root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage directory %s: %w", root, err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %w", root, err)
+	}
+	return &LocalStore{Root: root}, nil
+}
+
+// path of the object on disk, keys cannot escape the root directory
+func (s *LocalStore) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, contents []byte) error {
+	return s.PutReader(ctx, key, bytes.NewReader(contents), int64(len(contents)))
+}
+
+func (s *LocalStore) PutReader(ctx context.Context, key string, reader io.Reader, size int64) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", key, err)
+	}
+	// written next to the target and renamed, readers never see a partially written object
+	temp, err := os.CreateTemp(filepath.Dir(target), ".strafe-upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", key, err)
+	}
+	defer os.Remove(temp.Name())
+	written, err := io.Copy(temp, reader)
+	if err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if written != size {
+		temp.Close()
+		return fmt.Errorf("failed to write %s: expected %d bytes, read %d", key, size, written)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := os.Rename(temp.Name(), target); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) ([]byte, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return contents, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("failed to stat %s: %w", key, err)
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return file, ObjectInfo{Key: key, Size: stat.Size(), LastModified: stat.ModTime()}, nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.Root, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".strafe-upload-") {
+			return nil
+		}
+		relative, err := filepath.Rel(s.Root, current)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects under %s: %w", s.Root, err)
+	}
+	return objects, nil
+}
+
+// URL points to the server route that serves the object, local objects do not expire
+func (s *LocalStore) URL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return ObjectsRoute + "/" + strings.Join(segments, "/"), nil
+}
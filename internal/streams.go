@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// bytes of the latest chunks sent to listeners as they join, players start without waiting for their buffer to fill
+	DefaultStreamBurstSize = 64 << 10
+	// chunks queued for a listener, listeners that fall further behind are disconnected
+	DefaultStreamListenerBuffer = 256
+)
+
+// StreamChunk is a part of a continuous stream, Title is what is playing when the chunk is played
+type StreamChunk struct {
+	Data  []byte
+	Title string
+}
+
+// StreamProducer writes the stream with send until ctx is done, send does not block
+type StreamProducer func(ctx context.Context, send func(StreamChunk)) error
+
+// StreamHub runs a single producer for every stream no matter how many listeners it has. the producer starts with
+// the first listener and stops with the last one, listeners are disconnected if their producer fails.
+type StreamHub struct {
+	burstSize      int
+	listenerBuffer int
+
+	mu      sync.Mutex
+	streams map[string]*hubStream
+}
+
+type hubStream struct {
+	cancel     context.CancelFunc
+	listeners  map[*StreamListener]struct{}
+	burst      []StreamChunk
+	burstBytes int
+}
+
+// StreamListener receives the chunks of a stream until it is closed, call Close once the client is gone
+type StreamListener struct {
+	hub    *StreamHub
+	key    string
+	stream *hubStream
+	chunks chan StreamChunk
+}
+
+// InitializeStreams creates the hub of the continuous station streams
+func (ctx *AppCtx) InitializeStreams() {
+	ctx.Streams = NewStreamHub(DefaultStreamBurstSize, DefaultStreamListenerBuffer)
+}
+
+func NewStreamHub(burstSize int, listenerBuffer int) *StreamHub {
+	return &StreamHub{burstSize: burstSize, listenerBuffer: listenerBuffer, streams: make(map[string]*hubStream)}
+}
+
+// Listen joins the stream with the key, produce starts it if it has no listeners yet
+func (h *StreamHub) Listen(key string, produce StreamProducer) *StreamListener {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stream, ok := h.streams[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream = &hubStream{cancel: cancel, listeners: make(map[*StreamListener]struct{})}
+		h.streams[key] = stream
+		go h.run(ctx, key, stream, produce)
+	}
+	listener := &StreamListener{hub: h, key: key, stream: stream, chunks: make(chan StreamChunk, h.listenerBuffer)}
+	for _, chunk := range stream.burst {
+		select {
+		case listener.chunks <- chunk:
+		default:
+		}
+	}
+	stream.listeners[listener] = struct{}{}
+	return listener
+}
+
+func (h *StreamHub) run(ctx context.Context, key string, stream *hubStream, produce StreamProducer) {
+	err := produce(ctx, func(chunk StreamChunk) { h.broadcast(stream, chunk) })
+	if err != nil && ctx.Err() == nil {
+		log.Error().Err(err).Str("stream", key).Msg("stream stopped")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// listeners reconnect to a new producer
+	if h.streams[key] == stream {
+		delete(h.streams, key)
+	}
+	for listener := range stream.listeners {
+		close(listener.chunks)
+	}
+	stream.listeners = nil
+	stream.cancel()
+}
+
+func (h *StreamHub) broadcast(stream *hubStream, chunk StreamChunk) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stream.burst = append(stream.burst, chunk)
+	stream.burstBytes += len(chunk.Data)
+	for len(stream.burst) > 1 && stream.burstBytes-len(stream.burst[0].Data) >= h.burstSize {
+		stream.burstBytes -= len(stream.burst[0].Data)
+		stream.burst = stream.burst[1:]
+	}
+	for listener := range stream.listeners {
+		select {
+		case listener.chunks <- chunk:
+		default:
+			log.Warn().Str("stream", listener.key).Msg("disconnecting listener that fell behind")
+			delete(stream.listeners, listener)
+			close(listener.chunks)
+		}
+	}
+}
+
+// Chunks is closed when the listener fell behind or the stream stopped
+func (l *StreamListener) Chunks() <-chan StreamChunk {
+	return l.chunks
+}
+
+// Close leaves the stream, the producer is stopped if this was the last listener
+func (l *StreamListener) Close() {
+	l.hub.mu.Lock()
+	defer l.hub.mu.Unlock()
+	if _, ok := l.stream.listeners[l]; ok {
+		delete(l.stream.listeners, l)
+		close(l.chunks)
+	}
+	if len(l.stream.listeners) == 0 && l.hub.streams[l.key] == l.stream {
+		delete(l.hub.streams, l.key)
+		l.stream.cancel()
+	}
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultMaxUploadSize = 512 << 20
+	// prefix of the object keys uploads are staged under until a worker processes them
+	UploadsPrefix = "uploads"
+)
+
+// stages of ingest jobs, in order
+const (
+	IngestStageQueued      = "queued"
+	IngestStageClaimed     = "claimed"
+	IngestStageDownloading = "downloading"
+	IngestStagePreparing   = "preparing"
+	IngestStageSplitting   = "splitting"
+	IngestStageAnalyzing   = "analyzing"
+	IngestStageEnriching   = "enriching"
+	IngestStageUploading   = "uploading"
+	IngestStageSaving      = "saving"
+	IngestStageDone        = "done"
+)
+
+// MaxUploadSize is the largest request body POST /uploads accepts, audio and cover together
+func MaxUploadSize() (int64, error) {
+	if !viper.IsSet(UPLOADS_MAX_SIZE) {
+		return DefaultMaxUploadSize, nil
+	}
+	size := int64(viper.GetSizeInBytes(UPLOADS_MAX_SIZE))
+	if size <= 0 {
+		return 0, fmt.Errorf("%s must be a size such as 512MB", UPLOADS_MAX_SIZE)
+	}
+	return size, nil
+}
+
+// extensions POST /uploads accepts, the stems are written in the format of the audio file
+var (
+	UploadAudioExtensions = []string{".aiff", ".flac", ".m4a", ".mp3", ".ogg", ".opus", ".wav"}
+	UploadCoverExtensions = []string{".jpeg", ".jpg", ".png", ".webp"}
+)
+
+// UploadExtension is the lowercased extension of the uploaded filename if it is one of the allowed extensions
+func UploadExtension(filename string, allowed []string) (string, error) {
+	ext := strings.ToLower(path.Ext(strings.ReplaceAll(filename, "\\", "/")))
+	if !slices.Contains(allowed, ext) {
+		return "", fmt.Errorf("extension of %s must be one of %s", path.Base(filename), strings.Join(allowed, ", "))
+	}
+	return ext, nil
+}
+
+// UploadKey is the object key a file of the ingest job is staged under. the name is chosen by the server such as
+// audio.flac, filenames of the client are only kept in the job.
+func UploadKey(jobID string, name string) string {
+	return path.Join(UploadsPrefix, jobID, name)
+}
@@ -0,0 +1,39 @@
+package internal
+
+import "testing"
+
+func TestUploadExtension(t *testing.T) {
+	tests := []struct {
+		filename string
+		allowed  []string
+		want     string
+		wantErr  bool
+	}{
+		{"01 Track.flac", UploadAudioExtensions, ".flac", false},
+		{"SONG.MP3", UploadAudioExtensions, ".mp3", false},
+		{`C:\Music\song.wav`, UploadAudioExtensions, ".wav", false},
+		{"song", UploadAudioExtensions, "", true},
+		{"song.exe", UploadAudioExtensions, "", true},
+		{`x.mp3"; rm -rf ~; ".mp3x`, UploadAudioExtensions, "", true},
+		{"album.v1/song", UploadAudioExtensions, "", true},
+		{"cover.JPG", UploadCoverExtensions, ".jpg", false},
+		{"cover.mp3", UploadCoverExtensions, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := UploadExtension(tt.filename, tt.allowed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UploadExtension(%q) error = %v, wantErr %v", tt.filename, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("UploadExtension(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadKey(t *testing.T) {
+	if got, want := UploadKey("5f1c", "audio.flac"), "uploads/5f1c/audio.flac"; got != want {
+		t.Errorf("UploadKey() = %q, want %q", got, want)
+	}
+}
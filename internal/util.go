@@ -2,18 +2,22 @@ package internal
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 
 	"github.com/caner-cetin/strafe/pkg/db"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/docker/docker/client"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	pgstdlib "github.com/jackc/pgx/v5/stdlib"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -45,6 +49,9 @@ func InitConfig() {
 		viper.SetDefault(DOCKER_IMAGE_NAME, DOCKER_IMAGE_NAME_DEFAULT)
 		viper.SetDefault(DOCKER_IMAGE_TAG, DOCKER_IMAGE_TAG_DEFAULT)
 		viper.SetDefault(DISPLAY_ASCII_ART_ON_HELP, true)
+		viper.SetDefault(S3_PATH_STYLE, true)
+		viper.SetDefault(S3_TLS_VERIFY, true)
+		viper.SetDefault(S3_CREATE_BUCKET, true)
 
 		switch Verbosity {
 		case 1:
@@ -68,29 +75,30 @@ func (ctx *AppCtx) InitializeDB() error {
 		return fmt.Errorf("database url is not set")
 	}
 
-	conf, err := pgx.ParseConfig(viper.GetString(DB_URL))
+	// the server handles requests and flushes play events concurrently, a single connection cannot be shared
+	conf, err := pgxpool.ParseConfig(viper.GetString(DB_URL))
 	if err != nil {
 		return fmt.Errorf("failed to parse database config: %w", err)
 	}
 
-	conn, err := pgx.ConnectConfig(ctx.Context, conf)
+	pool, err := pgxpool.NewWithConfig(ctx.Context, conf)
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
-	ctx.DB = db.New(conn)
-	ctx.Conn = conn
-	ctx.StdDB = pgstdlib.OpenDB(*conf)
+	if err := pool.Ping(ctx.Context); err != nil {
+		pool.Close()
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	ctx.DB = db.New(pool)
+	ctx.Conn = pool
+	ctx.StdDB = pgstdlib.OpenDB(*conf.ConnConfig)
 	return nil
 }
 
 func (ctx *AppCtx) Cleanup() {
-	if ctx.Conn != nil && !ctx.Conn.IsClosed() {
-		err := ctx.Conn.Close(ctx.Context)
-		if err != nil {
-			log.Error().Err(err).Msg("failed to close pgx connection")
-			return
-		}
-		err = ctx.StdDB.Close()
+	if ctx.Conn != nil {
+		ctx.Conn.Close()
+		err := ctx.StdDB.Close()
 		if err != nil {
 			log.Error().Err(err).Msg("failed to close sql.DB connection")
 			return
@@ -114,40 +122,69 @@ func (ctx *AppCtx) InitializeDocker() error {
 	return nil
 }
 
+// InitializeS3 connects to any S3 compatible storage. s3.endpoint selects the storage, Cloudflare R2 is used
+// if only s3.account_id is set and AWS if neither is set. static credentials are used if the access key is set,
+// otherwise credentials are resolved by the default AWS chain (environment, shared config, instance roles).
 func (ctx *AppCtx) InitializeS3() error {
-	if !viper.IsSet(S3_ACCESS_KEY_ID) {
-		return fmt.Errorf("access key id is not set")
-	}
-	if !viper.IsSet(S3_ACCESS_KEY_SECRET) {
-		return fmt.Errorf("access key secret is not set")
-	}
-	if !viper.IsSet(S3_ACCOUNT_ID) {
-		return fmt.Errorf("account id is not set")
-	}
 	if !viper.IsSet(S3_BUCKET_NAME) {
 		return fmt.Errorf("bucket name is not set")
 	}
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(), // todo: ehhhhhh
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(viper.GetString(S3_ACCESS_KEY_ID), viper.GetString(S3_ACCESS_KEY_SECRET), "")),
-		config.WithRegion("auto"),
-	)
+	endpoint := viper.GetString(S3_ENDPOINT)
+	region := viper.GetString(S3_REGION)
+	if endpoint == "" && viper.GetString(S3_ACCOUNT_ID) != "" {
+		endpoint = fmt.Sprintf("https://%s.r2.cloudflarestorage.com", viper.GetString(S3_ACCOUNT_ID))
+		if region == "" {
+			region = "auto"
+		}
+	}
+	var options []func(*config.LoadOptions) error
+	if region != "" {
+		options = append(options, config.WithRegion(region))
+	}
+	accessKeyID, accessKeySecret := viper.GetString(S3_ACCESS_KEY_ID), viper.GetString(S3_ACCESS_KEY_SECRET)
+	if (accessKeyID == "") != (accessKeySecret == "") {
+		return fmt.Errorf("both %s and %s must be set, or neither to use the default credential chain", S3_ACCESS_KEY_ID, S3_ACCESS_KEY_SECRET)
+	}
+	if accessKeyID != "" {
+		options = append(options, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(accessKeyID, accessKeySecret, viper.GetString(S3_SESSION_TOKEN)),
+		))
+	}
+	if !viper.GetBool(S3_TLS_VERIFY) {
+		log.Warn().Str("endpoint", endpoint).Msg("tls certificate of the s3 endpoint is not verified")
+		options = append(options, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{}
+			}
+			t.TLSClientConfig.InsecureSkipVerify = true
+		})))
+	}
+	cfg, err := config.LoadDefaultConfig(context.TODO(), options...)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to load s3 config: %w", err)
+	}
+	if cfg.Region == "" {
+		return fmt.Errorf("%s is not set and no region is configured for the default AWS chain", S3_REGION)
 	}
-	ctx.S3.Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(fmt.Sprintf("https://%s.r2.cloudflarestorage.com", viper.GetString(S3_ACCOUNT_ID)))
-		o.UsePathStyle = true
+	store := &S3Store{Config: cfg, Bucket: viper.GetString(S3_BUCKET_NAME)}
+	store.Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = viper.GetBool(S3_PATH_STYLE)
 	})
-	ctx.S3.Manager = manager.NewUploader(ctx.S3.Client, func(u *manager.Uploader) {
+	store.Manager = manager.NewUploader(store.Client, func(u *manager.Uploader) {
 		u.PartSize = 5 * 1024 * 1024
 		u.Concurrency = 3
 		u.LeavePartsOnError = false
 	})
-	_, err = ctx.CreateBucketIfNotExists(context.Background(), viper.GetString(S3_BUCKET_NAME))
-	if err != nil {
-		return err
+	if viper.GetBool(S3_CREATE_BUCKET) {
+		_, err = store.CreateBucketIfNotExists(context.Background(), store.Bucket)
+		if err != nil {
+			return err
+		}
 	}
+	ctx.Store = store
 
 	return nil
 }
@@ -165,3 +202,8 @@ func NewDockerClient() (*client.Client, error) {
 	}
 	return docker, nil
 }
+
+// ShellQuote quotes the value as a single bash word, nothing inside it is expanded
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"plain", "/tmp/strafe-ingest-1/audio.mp3"},
+		{"spaces", "/tmp/my song.mp3"},
+		{"double quotes", `/tmp/a".mp3`},
+		{"single quotes", "/tmp/it's.mp3"},
+		{"substitution", "/tmp/$(touch pwned).mp3"},
+		{"backticks", "/tmp/`id`.mp3"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exec.Command(bash, "-c", "printf %s "+ShellQuote(tt.value)).Output()
+			if err != nil {
+				t.Fatalf("bash failed: %v", err)
+			}
+			if string(out) != tt.value {
+				t.Errorf("ShellQuote(%q) expanded to %q", tt.value, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// Package catalogue lists the tracks and albums of the library page by page. the order and the cursor condition
+// depend on the sort of the request, so the queries are written here instead of in query.sql.
+package catalogue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// sort columns of the listings, every column has a (column, id) index that the page is read from in order
+var (
+	trackSortColumns = map[string]string{
+		"added":    "t.created_at",
+		"title":    "COALESCE(t.info->>'Title', '')",
+		"tempo":    "t.tempo",
+		"duration": "t.total_duration",
+	}
+	albumSortColumns = map[string]string{
+		"added":    "a.created_at",
+		"title":    `a."name"`,
+		"duration": "a.total_duration",
+	}
+)
+
+// Track is the lightweight track of listings, without waveforms and folder paths
+type Track struct {
+	ID            string
+	AlbumID       string
+	AlbumName     string
+	TotalDuration pgtype.Numeric
+	Info          []byte
+	Instrumental  bool
+	Tempo         pgtype.Numeric
+	Key           string
+	CreatedAt     pgtype.Timestamptz
+}
+
+type ListTracksParams struct {
+	Filter db.TrackFacetsParams
+	// narrow the listing down to the tracks of the album, the tracks the artist is credited on or the tracks of the
+	// genre, at most one is set
+	AlbumID  pgtype.Text
+	ArtistID pgtype.Text
+	Genre    pgtype.Text
+	// one of added, title, tempo, duration
+	Sort       string
+	Descending bool
+	// the page starts after the track identified by AfterID and the After* value of the sort, NULL AfterID for the first page
+	AfterID        pgtype.Text
+	AfterTitle     pgtype.Text
+	AfterTempo     pgtype.Numeric
+	AfterDuration  pgtype.Numeric
+	AfterCreatedAt pgtype.Timestamptz
+	ResultLimit    int32
+}
+
+// ListTracks lists the tracks matching the filters page by page. the order and the cursor condition are written for
+// the sort so that the page is read from the index of the sort column instead of sorting every matching track.
+func ListTracks(ctx context.Context, conn db.DBTX, arg ListTracksParams) ([]Track, error) {
+	query, args, err := tracksQuery(arg)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Track])
+}
+
+func tracksQuery(arg ListTracksParams) (string, []any, error) {
+	column, ok := trackSortColumns[arg.Sort]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown sort %q", arg.Sort)
+	}
+	var (
+		query strings.Builder
+		args  []any
+	)
+	param := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	f := arg.Filter
+	fmt.Fprintf(&query, `SELECT t.id,
+    t.album_id,
+    t.album_name,
+    t.total_duration,
+    t.info,
+    t.instrumental,
+    t.tempo,
+    t."key",
+    t.created_at
+FROM filtered_tracks(
+        %s::numeric,
+        %s::numeric,
+        %s::text[],
+        %s::text[],
+        %s::numeric,
+        %s::numeric,
+        %s::bool,
+        %s::int,
+        %s::int,
+        %s::text[]::uuid[],
+        %s::text[]::uuid[],
+        %s::text[],
+        %s::text[]::uuid[]
+    ) t
+WHERE TRUE`,
+		param(f.MinTempo),
+		param(f.MaxTempo),
+		param(f.Keys),
+		param(f.Genres),
+		param(f.MinDuration),
+		param(f.MaxDuration),
+		param(f.InstrumentalOnly),
+		param(f.MinYear),
+		param(f.MaxYear),
+		param(f.ExcludeTrackIds),
+		param(f.ExcludeAlbumIds),
+		param(f.ExcludeGenres),
+		param(f.ExcludeArtistIds),
+	)
+	switch {
+	case arg.AlbumID.Valid:
+		fmt.Fprintf(&query, "\n    AND t.album_id = %s::uuid", param(arg.AlbumID))
+	case arg.ArtistID.Valid:
+		fmt.Fprintf(&query, "\n    AND t.id IN (\n        SELECT ta.track_id\n        FROM track_artists ta\n        WHERE ta.artist_id = %s::uuid\n    )", param(arg.ArtistID))
+	case arg.Genre.Valid:
+		fmt.Fprintf(&query, "\n    AND t.info->>'Genre' = %s::text", param(arg.Genre))
+	}
+	if arg.AfterID.Valid {
+		var after string
+		switch arg.Sort {
+		case "title":
+			after = param(arg.AfterTitle) + "::text"
+		case "tempo":
+			after = param(arg.AfterTempo) + "::numeric"
+		case "duration":
+			after = param(arg.AfterDuration) + "::numeric"
+		default:
+			after = param(arg.AfterCreatedAt) + "::timestamptz"
+		}
+		writeKeyset(&query, column, "t.id", after, param(arg.AfterID), arg.Descending)
+	}
+	writeOrder(&query, column, "t.id", arg.Descending, param(arg.ResultLimit))
+	return query.String(), args, nil
+}
+
+type ListAlbumsParams struct {
+	// one of added, title, duration
+	Sort       string
+	Descending bool
+	// see ListTracksParams
+	AfterID        pgtype.Text
+	AfterTitle     pgtype.Text
+	AfterDuration  pgtype.Numeric
+	AfterCreatedAt pgtype.Timestamptz
+	ResultLimit    int32
+}
+
+// ListAlbums lists albums page by page like ListTracks
+func ListAlbums(ctx context.Context, conn db.DBTX, arg ListAlbumsParams) ([]db.Album, error) {
+	query, args, err := albumsQuery(arg)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[db.Album])
+}
+
+func albumsQuery(arg ListAlbumsParams) (string, []any, error) {
+	column, ok := albumSortColumns[arg.Sort]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown sort %q", arg.Sort)
+	}
+	var (
+		query strings.Builder
+		args  []any
+	)
+	param := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	query.WriteString("SELECT a.*\nFROM albums a\nWHERE TRUE")
+	if arg.AfterID.Valid {
+		var after string
+		switch arg.Sort {
+		case "title":
+			after = param(arg.AfterTitle) + "::text"
+		case "duration":
+			after = param(arg.AfterDuration) + "::numeric"
+		default:
+			after = param(arg.AfterCreatedAt) + "::timestamptz"
+		}
+		writeKeyset(&query, column, "a.id", after, param(arg.AfterID), arg.Descending)
+	}
+	writeOrder(&query, column, "a.id", arg.Descending, param(arg.ResultLimit))
+	return query.String(), args, nil
+}
+
+// writeKeyset continues the listing after the last row of the previous page, the row comparison matches the
+// (column, id) index in both directions
+func writeKeyset(query *strings.Builder, column string, id string, after string, afterID string, descending bool) {
+	operator := ">"
+	if descending {
+		operator = "<"
+	}
+	fmt.Fprintf(query, "\n    AND (%s, %s) %s (%s, %s::uuid)", column, id, operator, after, afterID)
+}
+
+func writeOrder(query *strings.Builder, column string, id string, descending bool, limit string) {
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	fmt.Fprintf(query, "\nORDER BY %s %s,\n    %s %s\nLIMIT %s", column, direction, id, direction, limit)
+}
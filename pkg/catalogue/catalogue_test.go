@@ -0,0 +1,102 @@
+package catalogue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestTracksQuery(t *testing.T) {
+	after := pgtype.Text{String: "0b6b1f0e-5d43-4a0a-9d6c-8f8f2a1e7c11", Valid: true}
+	tests := []struct {
+		name     string
+		arg      ListTracksParams
+		contains []string
+		excludes []string
+		args     int
+	}{
+		{
+			name:     "first page",
+			arg:      ListTracksParams{Sort: "added", ResultLimit: 51},
+			contains: []string{"ORDER BY t.created_at ASC,\n    t.id ASC\nLIMIT $14"},
+			excludes: []string{"AND (", "AND t."},
+			args:     14,
+		},
+		{
+			name:     "next page descending",
+			arg:      ListTracksParams{Sort: "tempo", Descending: true, AfterID: after, ResultLimit: 51},
+			contains: []string{"AND (t.tempo, t.id) < ($14::numeric, $15::uuid)", "ORDER BY t.tempo DESC,\n    t.id DESC\nLIMIT $16"},
+			args:     16,
+		},
+		{
+			name:     "next page by title",
+			arg:      ListTracksParams{Sort: "title", AfterID: after, ResultLimit: 51},
+			contains: []string{"AND (COALESCE(t.info->>'Title', ''), t.id) > ($14::text, $15::uuid)"},
+			args:     16,
+		},
+		{
+			name:     "album",
+			arg:      ListTracksParams{Sort: "duration", AlbumID: after, ResultLimit: 51},
+			contains: []string{"AND t.album_id = $14::uuid", "ORDER BY t.total_duration ASC"},
+			args:     15,
+		},
+		{
+			name:     "artist",
+			arg:      ListTracksParams{Sort: "added", ArtistID: after, ResultLimit: 51},
+			contains: []string{"FROM track_artists ta\n        WHERE ta.artist_id = $14::uuid"},
+			args:     15,
+		},
+		{
+			name:     "genre",
+			arg:      ListTracksParams{Sort: "added", Genre: pgtype.Text{String: "Jazz", Valid: true}, ResultLimit: 51},
+			contains: []string{"AND t.info->>'Genre' = $14::text"},
+			args:     15,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := tracksQuery(tt.arg)
+			if err != nil {
+				t.Fatalf("tracksQuery() error = %v", err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(query, want) {
+					t.Errorf("query does not contain %q:\n%s", want, query)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(query, unwanted) {
+					t.Errorf("query contains %q:\n%s", unwanted, query)
+				}
+			}
+			if len(args) != tt.args {
+				t.Errorf("got %d args, want %d", len(args), tt.args)
+			}
+		})
+	}
+}
+
+func TestAlbumsQuery(t *testing.T) {
+	after := pgtype.Text{String: "0b6b1f0e-5d43-4a0a-9d6c-8f8f2a1e7c11", Valid: true}
+	query, args, err := albumsQuery(ListAlbumsParams{Sort: "title", Descending: true, AfterID: after, ResultLimit: 21})
+	if err != nil {
+		t.Fatalf("albumsQuery() error = %v", err)
+	}
+	want := "SELECT a.*\nFROM albums a\nWHERE TRUE\n    AND (a.\"name\", a.id) < ($1::text, $2::uuid)\nORDER BY a.\"name\" DESC,\n    a.id DESC\nLIMIT $3"
+	if query != want {
+		t.Errorf("albumsQuery() =\n%s\nwant\n%s", query, want)
+	}
+	if len(args) != 3 {
+		t.Errorf("got %d args, want 3", len(args))
+	}
+}
+
+func TestUnknownSort(t *testing.T) {
+	if _, _, err := tracksQuery(ListTracksParams{Sort: "random"}); err == nil {
+		t.Error("tracksQuery() accepted an unknown sort")
+	}
+	if _, _, err := albumsQuery(ListAlbumsParams{Sort: "tempo"}); err == nil {
+		t.Error("albumsQuery() accepted an unknown sort")
+	}
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// BenchmarkArtist is the artist of the synthetic albums and tracks inserted by SeedBenchmarkTracks
+const BenchmarkArtist = "strafe benchmark"
+
+// tracks per synthetic album, the album stats trigger aggregates the tracks of the album on every insert
+const benchmarkAlbumSize = 10
+
+// SeedBenchmarkTracks inserts count synthetic tracks with 4 KiB waveforms so that random selection can be
+// measured on a large catalogue. call it in a transaction that is rolled back, the rows are not meant to be kept.
+func SeedBenchmarkTracks(ctx context.Context, conn DBTX, count int) error {
+	albums := (count + benchmarkAlbumSize - 1) / benchmarkAlbumSize
+	_, err := conn.Exec(ctx, `
+INSERT INTO public.albums (id, "name", artist)
+SELECT gen_random_uuid(),
+	'benchmark album ' || i,
+	$1
+FROM generate_series(1, $2::int) i`, BenchmarkArtist, albums)
+	if err != nil {
+		return fmt.Errorf("failed to insert benchmark albums: %w", err)
+	}
+	_, err = conn.Exec(ctx, `
+INSERT INTO public.tracks (
+		id,
+		instrumental_folder_path,
+		album_id,
+		total_duration,
+		info,
+		instrumental,
+		tempo,
+		"key",
+		instrumental_waveform,
+		album_name
+	)
+SELECT gen_random_uuid(),
+	'benchmark/' || n,
+	a.id,
+	(120 + random() * 360)::numeric(10, 3),
+	jsonb_build_object(
+		'Title', 'benchmark track ' || n,
+		'Artist', $1::text,
+		'Genre', (ARRAY['House', 'Techno', 'Ambient', 'Jazz', 'Drum & Bass'])[1 + floor(random() * 5)::int]
+	),
+	random() < 0.3,
+	(70 + random() * 110)::numeric(6, 2),
+	(ARRAY['Am', 'C', 'Em', 'G', 'F#m', 'Bb', 'Dm', 'Eb'])[1 + floor(random() * 8)::int],
+	decode(repeat('00', 4096), 'hex'),
+	a."name"
+FROM (
+		SELECT id,
+			"name",
+			row_number() OVER (ORDER BY "name") AS position
+		FROM public.albums
+		WHERE artist = $1::text
+	) a
+	CROSS JOIN generate_series(1, $3::int) n
+WHERE (a.position - 1) * $3::int + n <= $2::int`, BenchmarkArtist, count, benchmarkAlbumSize)
+	if err != nil {
+		return fmt.Errorf("failed to insert benchmark tracks: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "ANALYZE public.albums, public.tracks"); err != nil {
+		return fmt.Errorf("failed to analyze benchmark tracks: %w", err)
+	}
+	return nil
+}
+
+// OrderByRandomUnlistenedTrack is the random selection random_key replaced, it sorts every unlistened track
+// and is only kept to compare the latency of both.
+func OrderByRandomUnlistenedTrack(ctx context.Context, conn DBTX, anonID string) (string, error) {
+	var (
+		id        string
+		info      []byte
+		waveforms [2][]byte
+	)
+	// the whole row is selected like the replaced query did, sorting carries the waveforms
+	err := conn.QueryRow(ctx, `
+SELECT t.id,
+	t.info,
+	t.vocal_waveform,
+	t.instrumental_waveform
+FROM tracks t
+	LEFT JOIN track_play_stats ps ON ps.track_id = t.id
+WHERE NOT EXISTS (
+		SELECT 1
+		FROM listening_histories lh
+		WHERE lh.track_id = t.id
+			AND lh.anon_id = $1
+	)
+ORDER BY power(RANDOM(), 1 / play_weight(ps.complete_count, ps.skip_count)) DESC
+LIMIT 1`, anonID).Scan(&id, &info, &waveforms[0], &waveforms[1])
+	return id, err
+}
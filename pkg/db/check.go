@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SchemaHardeningVersion is the migration that adds foreign keys, unique album identity, NOT NULL
+// and uuid columns. rows reported by CheckConstraints make this migration fail.
+const SchemaHardeningVersion = 20261019120000
+
+// Violation is a row that violates a constraint added by the schema hardening migration
+type Violation struct {
+	Check  string
+	Table  string
+	Row    string
+	Detail string
+}
+
+type ViolationsError struct {
+	Violations []Violation
+}
+
+func (e *ViolationsError) Error() string {
+	checks := make(map[string]int)
+	for _, v := range e.Violations {
+		checks[v.Check]++
+	}
+	var summary []string
+	for check, count := range checks {
+		summary = append(summary, fmt.Sprintf("%s: %d", check, count))
+	}
+	return fmt.Sprintf("%d rows violate the constraints of migration %d (%s), run `strafe db check` for details",
+		len(e.Violations), SchemaHardeningVersion, strings.Join(summary, ", "))
+}
+
+const uuidPattern = `'^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$'`
+
+// every query returns the identifying value of the row and a detail message.
+// columns are casted to text so that the checks work both before and after the migration.
+var constraintChecks = []struct {
+	name   string
+	table  string
+	tables []string
+	query  string
+}{
+	{
+		name:   "invalid uuid",
+		table:  "albums",
+		tables: []string{"albums"},
+		query:  `SELECT id::text, 'id is not a uuid' FROM albums WHERE id::text !~ ` + uuidPattern,
+	},
+	{
+		name:   "invalid uuid",
+		table:  "tracks",
+		tables: []string{"tracks"},
+		query: `SELECT id::text, 'id or album_id is not a uuid' FROM tracks
+			WHERE id::text !~ ` + uuidPattern + ` OR album_id::text !~ ` + uuidPattern,
+	},
+	{
+		name:   "invalid uuid",
+		table:  "listening_histories",
+		tables: []string{"listening_histories"},
+		query: `SELECT track_id::text, 'track_id is not a uuid, listened by ' || COALESCE(anon_id, 'NULL') FROM listening_histories
+			WHERE track_id::text !~ ` + uuidPattern,
+	},
+	{
+		name:   "invalid uuid",
+		table:  "artists",
+		tables: []string{"artists"},
+		query:  `SELECT id::text, 'id is not a uuid' FROM artists WHERE id::text !~ ` + uuidPattern,
+	},
+	{
+		name:   "duplicate album",
+		table:  "albums",
+		tables: []string{"albums"},
+		query: `SELECT string_agg(id::text, ', '), COALESCE("name", 'NULL') || ' by ' || COALESCE(artist, 'NULL') || ' exists ' || COUNT(*) || ' times'
+			FROM albums GROUP BY "name", artist HAVING COUNT(*) > 1`,
+	},
+	{
+		name:   "missing value",
+		table:  "albums",
+		tables: []string{"albums"},
+		query:  `SELECT id::text, 'name or artist is NULL' FROM albums WHERE "name" IS NULL OR artist IS NULL`,
+	},
+	{
+		name:   "missing value",
+		table:  "tracks",
+		tables: []string{"tracks"},
+		query: `SELECT id::text, 'one of album_id, album_name, instrumental_folder_path, total_duration, info, instrumental, tempo, key, instrumental_waveform is NULL'
+			FROM tracks
+			WHERE album_id IS NULL OR album_name IS NULL OR instrumental_folder_path IS NULL OR total_duration IS NULL OR info IS NULL
+				OR instrumental IS NULL OR tempo IS NULL OR "key" IS NULL OR instrumental_waveform IS NULL`,
+	},
+	{
+		name:   "missing value",
+		table:  "listening_histories",
+		tables: []string{"listening_histories"},
+		query: `SELECT COALESCE(track_id::text, 'NULL'), 'track_id, anon_id or listened_at is NULL' FROM listening_histories
+			WHERE track_id IS NULL OR anon_id IS NULL OR listened_at IS NULL`,
+	},
+	{
+		name:   "out of range",
+		table:  "tracks",
+		tables: []string{"tracks"},
+		query: `SELECT id::text, 'tempo ' || COALESCE(tempo::text, 'NULL') || ' or total duration ' || COALESCE(total_duration::text, 'NULL') || ' is out of range' FROM tracks
+			WHERE tempo <= 0 OR tempo >= 1000 OR total_duration < 0 OR total_duration >= 10000000`,
+	},
+	{
+		name:   "orphan",
+		table:  "tracks",
+		tables: []string{"tracks", "albums"},
+		query: `SELECT t.id::text, 'album ' || t.album_id::text || ' does not exist' FROM tracks t
+			WHERE t.album_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM albums a WHERE a.id::text = t.album_id::text)`,
+	},
+	{
+		name:   "orphan",
+		table:  "listening_histories",
+		tables: []string{"listening_histories", "tracks"},
+		query: `SELECT lh.track_id::text, 'track does not exist, listened by ' || COALESCE(lh.anon_id, 'NULL') FROM listening_histories lh
+			WHERE lh.track_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM tracks t WHERE t.id::text = lh.track_id::text)`,
+	},
+	{
+		name:   "orphan",
+		table:  "track_artists",
+		tables: []string{"track_artists", "tracks", "artists"},
+		query: `SELECT ta.track_id::text || '/' || ta.artist_id::text, 'track or artist does not exist' FROM track_artists ta
+			WHERE NOT EXISTS (SELECT 1 FROM tracks t WHERE t.id::text = ta.track_id::text)
+				OR NOT EXISTS (SELECT 1 FROM artists a WHERE a.id::text = ta.artist_id::text)`,
+	},
+}
+
+// CheckConstraints reports the rows that would make the schema hardening migration fail.
+// checks on tables that do not exist yet are skipped.
+func CheckConstraints(ctx context.Context, db *sql.DB) ([]Violation, error) {
+	var violations []Violation
+	for _, check := range constraintChecks {
+		exists, err := tablesExist(ctx, db, check.tables)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		rows, err := db.QueryContext(ctx, check.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run %s check on %s: %w", check.name, check.table, err)
+		}
+		for rows.Next() {
+			var v = Violation{Check: check.name, Table: check.table}
+			if err := rows.Scan(&v.Row, &v.Detail); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan %s check on %s: %w", check.name, check.table, err)
+			}
+			violations = append(violations, v)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read %s check on %s: %w", check.name, check.table, err)
+		}
+		rows.Close()
+	}
+	return violations, nil
+}
+
+func tablesExist(ctx context.Context, db *sql.DB, tables []string) (bool, error) {
+	for _, table := range tables {
+		var exists bool
+		if err := db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, "public."+table).Scan(&exists); err != nil {
+			return false, fmt.Errorf("failed to check if table %s exists: %w", table, err)
+		}
+		if !exists {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,16 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the SQLSTATE of inserts and updates that violate a unique constraint
+const uniqueViolation = "23505"
+
+// IsUniqueViolation reports whether the statement failed because the row already exists
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 
@@ -15,6 +16,23 @@ func Migrate(db *sql.DB) error {
 	if err := goose.SetDialect("postgres"); err != nil {
 		return err
 	}
+	current, err := goose.GetDBVersion(db)
+	if err != nil {
+		return err
+	}
+	// stop right before the schema hardening and refuse to continue if existing rows would make it fail halfway
+	if current < SchemaHardeningVersion {
+		if err := goose.UpTo(db, "migrations", SchemaHardeningVersion-1); err != nil {
+			return err
+		}
+		violations, err := CheckConstraints(context.Background(), db)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			return &ViolationsError{Violations: violations}
+		}
+	}
 	if err := goose.Up(db, "migrations"); err != nil {
 		return err
 	}
@@ -0,0 +1,78 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE public.albums
+	ADD COLUMN IF NOT EXISTS "year" int4 NULL,
+	ADD COLUMN IF NOT EXISTS genre text NULL,
+	ADD COLUMN IF NOT EXISTS disc_count int4 NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS track_count int4 NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS total_duration numeric NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+-- +goose StatementEnd
+
+-- recalculates the derived album columns from the tracks of the album.
+-- year and genre are the most common values among the tracks, existing values
+-- are kept if none of the tracks carry the tag.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.refresh_album_stats(target_album_id text) RETURNS void AS $$
+BEGIN
+	UPDATE public.albums a
+	SET track_count = s.track_count,
+		total_duration = s.total_duration,
+		disc_count = s.disc_count,
+		"year" = COALESCE(s.year, a.year),
+		genre = COALESCE(s.genre, a.genre)
+	FROM (
+		SELECT COUNT(t.id)::int4 AS track_count,
+			COALESCE(SUM(t.total_duration), 0) AS total_duration,
+			CASE
+				WHEN COUNT(t.id) = 0 THEN 0
+				ELSE COALESCE(
+					MAX(NULLIF(substring(t.info->>'PartOfSet' FROM '^\d+/(\d+)$'), '')::int4),
+					MAX(NULLIF(substring(t.info->>'PartOfSet' FROM '^(\d+)'), '')::int4),
+					1
+				)
+			END AS disc_count,
+			mode() WITHIN GROUP (ORDER BY NULLIF(substring(t.info->>'Year' FROM '^(\d{4})'), '')::int4) AS "year",
+			mode() WITHIN GROUP (ORDER BY NULLIF(t.info->>'Genre', '')) AS genre
+		FROM public.tracks t
+		WHERE t.album_id = target_album_id
+	) s
+	WHERE a.id = target_album_id;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.tracks_refresh_album_stats() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.album_id IS NOT NULL THEN
+		PERFORM public.refresh_album_stats(OLD.album_id);
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.album_id IS NOT NULL
+		AND (TG_OP = 'INSERT' OR NEW.album_id IS DISTINCT FROM OLD.album_id OR NEW.total_duration IS DISTINCT FROM OLD.total_duration OR NEW.info IS DISTINCT FROM OLD.info) THEN
+		PERFORM public.refresh_album_stats(NEW.album_id);
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER tracks_album_stats
+AFTER INSERT OR UPDATE OR DELETE ON public.tracks
+FOR EACH ROW EXECUTE FUNCTION public.tracks_refresh_album_stats();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS tracks_album_stats ON public.tracks;
+DROP FUNCTION IF EXISTS public.tracks_refresh_album_stats();
+DROP FUNCTION IF EXISTS public.refresh_album_stats(text);
+ALTER TABLE public.albums
+	DROP COLUMN IF EXISTS "year",
+	DROP COLUMN IF EXISTS genre,
+	DROP COLUMN IF EXISTS disc_count,
+	DROP COLUMN IF EXISTS track_count,
+	DROP COLUMN IF EXISTS total_duration,
+	DROP COLUMN IF EXISTS created_at;
+-- +goose StatementEnd
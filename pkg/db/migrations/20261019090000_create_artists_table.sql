@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE public.artist_role AS ENUM ('primary', 'featured', 'remixer', 'producer');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.artists (
+	id text NOT NULL,
+	"name" text NOT NULL,
+	-- "Beatles, The" for "The Beatles", used for ordering
+	sort_name text NOT NULL,
+	-- lowercased name without leading article, see internal.ArtistMatchName
+	match_name text NOT NULL,
+	-- alternative spellings, stored as match names
+	aliases text[] NOT NULL DEFAULT '{}',
+	created_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT artists_pkey PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_artists_match_name ON public.artists USING btree (match_name);
+CREATE INDEX IF NOT EXISTS idx_artists_sort_name ON public.artists USING btree (sort_name);
+CREATE INDEX IF NOT EXISTS idx_artists_aliases ON public.artists USING gin (aliases);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.track_artists (
+	track_id text NOT NULL,
+	artist_id text NOT NULL,
+	"role" public.artist_role NOT NULL,
+	-- order of the artist in the credit, "A & B feat. C" is A: 0, B: 1, C: 2
+	"position" int4 NOT NULL DEFAULT 0,
+	CONSTRAINT track_artists_pkey PRIMARY KEY (track_id, artist_id, "role")
+);
+CREATE INDEX IF NOT EXISTS idx_track_artists_artist_id ON public.track_artists USING btree (artist_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE public.track_artists;
+DROP TABLE public.artists;
+DROP TYPE public.artist_role;
+-- +goose StatementEnd
@@ -0,0 +1,162 @@
+-- run `strafe db check` before applying this migration, it reports the rows that violate the constraints below.
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE public.albums
+	ALTER COLUMN id TYPE uuid USING id::uuid,
+	ALTER COLUMN "name" SET NOT NULL,
+	ALTER COLUMN artist SET NOT NULL,
+	ALTER COLUMN total_duration TYPE numeric(12, 3);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_albums_name_artist ON public.albums USING btree ("name", artist);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE public.tracks
+	ALTER COLUMN id TYPE uuid USING id::uuid,
+	ALTER COLUMN album_id TYPE uuid USING album_id::uuid,
+	ALTER COLUMN album_id SET NOT NULL,
+	ALTER COLUMN album_name SET NOT NULL,
+	ALTER COLUMN instrumental_folder_path SET NOT NULL,
+	ALTER COLUMN total_duration TYPE numeric(10, 3),
+	ALTER COLUMN total_duration SET NOT NULL,
+	ALTER COLUMN info SET NOT NULL,
+	ALTER COLUMN instrumental SET NOT NULL,
+	ALTER COLUMN instrumental SET DEFAULT false,
+	ALTER COLUMN tempo TYPE numeric(6, 2),
+	ALTER COLUMN tempo SET NOT NULL,
+	ALTER COLUMN "key" SET NOT NULL,
+	ALTER COLUMN instrumental_waveform SET NOT NULL,
+	ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now(),
+	ADD CONSTRAINT tracks_tempo_check CHECK (tempo > 0 AND tempo < 1000),
+	ADD CONSTRAINT tracks_total_duration_check CHECK (total_duration >= 0),
+	ADD CONSTRAINT tracks_album_id_fkey FOREIGN KEY (album_id) REFERENCES public.albums(id) ON UPDATE CASCADE ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_tracks_album_id ON public.tracks USING btree (album_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE public.listening_histories
+	ALTER COLUMN track_id TYPE uuid USING track_id::uuid,
+	ALTER COLUMN track_id SET NOT NULL,
+	ALTER COLUMN anon_id SET NOT NULL,
+	ALTER COLUMN listened_at SET NOT NULL,
+	ALTER COLUMN listened_at SET DEFAULT now(),
+	ADD CONSTRAINT listening_histories_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks(id) ON UPDATE CASCADE ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_listening_histories_anon_id_track_id ON public.listening_histories USING btree (anon_id, track_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE public.artists
+	ALTER COLUMN id TYPE uuid USING id::uuid;
+ALTER TABLE public.track_artists
+	ALTER COLUMN track_id TYPE uuid USING track_id::uuid,
+	ALTER COLUMN artist_id TYPE uuid USING artist_id::uuid,
+	ADD CONSTRAINT track_artists_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks(id) ON UPDATE CASCADE ON DELETE CASCADE,
+	ADD CONSTRAINT track_artists_artist_id_fkey FOREIGN KEY (artist_id) REFERENCES public.artists(id) ON UPDATE CASCADE ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- album ids are uuid now, album stats function is recreated with the new argument type
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS public.refresh_album_stats(text);
+CREATE OR REPLACE FUNCTION public.refresh_album_stats(target_album_id uuid) RETURNS void AS $$
+BEGIN
+	UPDATE public.albums a
+	SET track_count = s.track_count,
+		total_duration = s.total_duration,
+		disc_count = s.disc_count,
+		"year" = COALESCE(s.year, a.year),
+		genre = COALESCE(s.genre, a.genre)
+	FROM (
+		SELECT COUNT(t.id)::int4 AS track_count,
+			COALESCE(SUM(t.total_duration), 0) AS total_duration,
+			CASE
+				WHEN COUNT(t.id) = 0 THEN 0
+				ELSE COALESCE(
+					MAX(NULLIF(substring(t.info->>'PartOfSet' FROM '^\d+/(\d+)$'), '')::int4),
+					MAX(NULLIF(substring(t.info->>'PartOfSet' FROM '^(\d+)'), '')::int4),
+					1
+				)
+			END AS disc_count,
+			mode() WITHIN GROUP (ORDER BY NULLIF(substring(t.info->>'Year' FROM '^(\d{4})'), '')::int4) AS "year",
+			mode() WITHIN GROUP (ORDER BY NULLIF(t.info->>'Genre', '')) AS genre
+		FROM public.tracks t
+		WHERE t.album_id = target_album_id
+	) s
+	WHERE a.id = target_album_id;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS public.refresh_album_stats(uuid);
+ALTER TABLE public.track_artists
+	DROP CONSTRAINT IF EXISTS track_artists_track_id_fkey,
+	DROP CONSTRAINT IF EXISTS track_artists_artist_id_fkey,
+	ALTER COLUMN track_id TYPE text,
+	ALTER COLUMN artist_id TYPE text;
+ALTER TABLE public.artists
+	ALTER COLUMN id TYPE text;
+DROP INDEX IF EXISTS public.idx_listening_histories_anon_id_track_id;
+ALTER TABLE public.listening_histories
+	DROP CONSTRAINT IF EXISTS listening_histories_track_id_fkey,
+	ALTER COLUMN track_id TYPE text,
+	ALTER COLUMN track_id DROP NOT NULL,
+	ALTER COLUMN anon_id DROP NOT NULL,
+	ALTER COLUMN listened_at DROP NOT NULL,
+	ALTER COLUMN listened_at DROP DEFAULT;
+DROP INDEX IF EXISTS public.idx_tracks_album_id;
+ALTER TABLE public.tracks
+	DROP CONSTRAINT IF EXISTS tracks_album_id_fkey,
+	DROP CONSTRAINT IF EXISTS tracks_tempo_check,
+	DROP CONSTRAINT IF EXISTS tracks_total_duration_check,
+	DROP COLUMN IF EXISTS created_at,
+	ALTER COLUMN id TYPE text,
+	ALTER COLUMN album_id TYPE text,
+	ALTER COLUMN album_id DROP NOT NULL,
+	ALTER COLUMN album_name DROP NOT NULL,
+	ALTER COLUMN instrumental_folder_path DROP NOT NULL,
+	ALTER COLUMN total_duration TYPE numeric,
+	ALTER COLUMN total_duration DROP NOT NULL,
+	ALTER COLUMN info DROP NOT NULL,
+	ALTER COLUMN instrumental DROP NOT NULL,
+	ALTER COLUMN instrumental DROP DEFAULT,
+	ALTER COLUMN tempo TYPE numeric,
+	ALTER COLUMN tempo DROP NOT NULL,
+	ALTER COLUMN "key" DROP NOT NULL,
+	ALTER COLUMN instrumental_waveform DROP NOT NULL;
+DROP INDEX IF EXISTS public.idx_albums_name_artist;
+ALTER TABLE public.albums
+	ALTER COLUMN id TYPE text,
+	ALTER COLUMN "name" DROP NOT NULL,
+	ALTER COLUMN artist DROP NOT NULL,
+	ALTER COLUMN total_duration TYPE numeric;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.refresh_album_stats(target_album_id text) RETURNS void AS $$
+BEGIN
+	UPDATE public.albums a
+	SET track_count = s.track_count,
+		total_duration = s.total_duration,
+		disc_count = s.disc_count,
+		"year" = COALESCE(s.year, a.year),
+		genre = COALESCE(s.genre, a.genre)
+	FROM (
+		SELECT COUNT(t.id)::int4 AS track_count,
+			COALESCE(SUM(t.total_duration), 0) AS total_duration,
+			CASE
+				WHEN COUNT(t.id) = 0 THEN 0
+				ELSE COALESCE(
+					MAX(NULLIF(substring(t.info->>'PartOfSet' FROM '^\d+/(\d+)$'), '')::int4),
+					MAX(NULLIF(substring(t.info->>'PartOfSet' FROM '^(\d+)'), '')::int4),
+					1
+				)
+			END AS disc_count,
+			mode() WITHIN GROUP (ORDER BY NULLIF(substring(t.info->>'Year' FROM '^(\d{4})'), '')::int4) AS "year",
+			mode() WITHIN GROUP (ORDER BY NULLIF(t.info->>'Genre', '')) AS genre
+		FROM public.tracks t
+		WHERE t.album_id = target_album_id
+	) s
+	WHERE a.id = target_album_id;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+-- +goose StatementEnd
+
+-- search vectors are stored in generated columns, the functions compute them when a row is written
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.track_search_vector(info jsonb, album_name text) RETURNS tsvector AS $$
+	SELECT setweight(to_tsvector('simple'::regconfig, COALESCE(info->>'Title', '')), 'A') ||
+		setweight(to_tsvector('simple'::regconfig, COALESCE(info->>'Artist', '')), 'B') ||
+		setweight(to_tsvector('simple'::regconfig, COALESCE(album_name, '')), 'C') ||
+		setweight(to_tsvector('simple'::regconfig, COALESCE(info->>'Genre', '')), 'D')
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.album_search_vector("name" text, artist text, genre text) RETURNS tsvector AS $$
+	SELECT setweight(to_tsvector('simple'::regconfig, COALESCE("name", '')), 'A') ||
+		setweight(to_tsvector('simple'::regconfig, COALESCE(artist, '')), 'B') ||
+		setweight(to_tsvector('simple'::regconfig, COALESCE(genre, '')), 'D')
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE public.tracks
+	ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (track_search_vector(info, album_name)) STORED;
+ALTER TABLE public.albums
+	ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (album_search_vector("name", artist, genre)) STORED;
+ALTER TABLE public.artists
+	ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple'::regconfig, "name")) STORED;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_tracks_search_vector ON public.tracks USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_tracks_title_trgm ON public.tracks USING gin ((info->>'Title') gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_tracks_artist_trgm ON public.tracks USING gin ((info->>'Artist') gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_albums_search_vector ON public.albums USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_albums_name_trgm ON public.albums USING gin ("name" gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_artists_search_vector ON public.artists USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_artists_name_trgm ON public.artists USING gin ("name" gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.idx_artists_name_trgm;
+DROP INDEX IF EXISTS public.idx_artists_search_vector;
+DROP INDEX IF EXISTS public.idx_albums_name_trgm;
+DROP INDEX IF EXISTS public.idx_albums_search_vector;
+DROP INDEX IF EXISTS public.idx_tracks_artist_trgm;
+DROP INDEX IF EXISTS public.idx_tracks_title_trgm;
+DROP INDEX IF EXISTS public.idx_tracks_search_vector;
+ALTER TABLE public.artists DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE public.albums DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE public.tracks DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS public.album_search_vector(text, text, text);
+DROP FUNCTION IF EXISTS public.track_search_vector(jsonb, text);
+-- +goose StatementEnd
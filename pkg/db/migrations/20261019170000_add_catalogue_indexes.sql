@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- keyset pagination of catalogue listings, id breaks ties between equal sort values
+CREATE INDEX IF NOT EXISTS idx_tracks_created_at_id ON public.tracks USING btree (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tracks_title_id ON public.tracks USING btree ((COALESCE(info->>'Title', '')), id);
+CREATE INDEX IF NOT EXISTS idx_tracks_tempo_id ON public.tracks USING btree (tempo, id);
+CREATE INDEX IF NOT EXISTS idx_tracks_total_duration_id ON public.tracks USING btree (total_duration, id);
+CREATE INDEX IF NOT EXISTS idx_albums_created_at_id ON public.albums USING btree (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_albums_name_id ON public.albums USING btree ("name", id);
+CREATE INDEX IF NOT EXISTS idx_albums_total_duration_id ON public.albums USING btree (total_duration, id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.idx_albums_total_duration_id;
+DROP INDEX IF EXISTS public.idx_albums_name_id;
+DROP INDEX IF EXISTS public.idx_albums_created_at_id;
+DROP INDEX IF EXISTS public.idx_tracks_total_duration_id;
+DROP INDEX IF EXISTS public.idx_tracks_tempo_id;
+DROP INDEX IF EXISTS public.idx_tracks_title_id;
+DROP INDEX IF EXISTS public.idx_tracks_created_at_id;
+-- +goose StatementEnd
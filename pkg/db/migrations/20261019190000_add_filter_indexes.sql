@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- tempo and duration filters use the indexes created for sorting, genre filters use idx_tracks_genre of the tracks table
+CREATE INDEX IF NOT EXISTS idx_tracks_key ON public.tracks USING btree ("key");
+CREATE INDEX IF NOT EXISTS idx_albums_year ON public.albums USING btree ("year");
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.idx_albums_year;
+DROP INDEX IF EXISTS public.idx_tracks_key;
+-- +goose StatementEnd
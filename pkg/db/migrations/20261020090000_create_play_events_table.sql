@@ -0,0 +1,89 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE public.play_event_type AS ENUM ('start', 'progress', 'complete', 'skip');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.play_events (
+	id int8 GENERATED ALWAYS AS IDENTITY,
+	track_id uuid NOT NULL,
+	anon_id text NOT NULL,
+	event_type public.play_event_type NOT NULL,
+	-- playback position in seconds when the event happened
+	"position" numeric(10, 3) NOT NULL,
+	-- seconds listened since the previous event of the same play, seeking is not counted
+	duration numeric(10, 3) NOT NULL DEFAULT 0,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT play_events_pkey PRIMARY KEY (id),
+	CONSTRAINT play_events_position_check CHECK ("position" >= 0),
+	CONSTRAINT play_events_duration_check CHECK (duration >= 0),
+	CONSTRAINT play_events_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_play_events_track_id_created_at ON public.play_events USING btree (track_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_play_events_anon_id_created_at ON public.play_events USING btree (anon_id, created_at);
+-- +goose StatementEnd
+
+-- counters derived from play events, kept up to date by a statement level trigger
+-- so that batch inserts update every track once.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.track_play_stats (
+	track_id uuid NOT NULL,
+	play_count int8 NOT NULL DEFAULT 0,
+	complete_count int8 NOT NULL DEFAULT 0,
+	skip_count int8 NOT NULL DEFAULT 0,
+	listened_seconds numeric NOT NULL DEFAULT 0,
+	last_played_at timestamptz,
+	CONSTRAINT track_play_stats_pkey PRIMARY KEY (track_id),
+	CONSTRAINT track_play_stats_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- skips in the last 10% of the track are counted as completed plays
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.play_events_update_stats() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO public.track_play_stats AS s (track_id, play_count, complete_count, skip_count, listened_seconds, last_played_at)
+	SELECT e.track_id,
+		COUNT(*) FILTER (WHERE e.event_type = 'start'),
+		COUNT(*) FILTER (WHERE e.event_type = 'complete' OR (e.event_type = 'skip' AND e."position" >= t.total_duration * 0.9)),
+		COUNT(*) FILTER (WHERE e.event_type = 'skip' AND e."position" < t.total_duration * 0.9),
+		SUM(e.duration),
+		MAX(e.created_at) FILTER (WHERE e.event_type = 'start')
+	FROM new_events e
+		JOIN public.tracks t ON t.id = e.track_id
+	GROUP BY e.track_id
+	ON CONFLICT (track_id) DO UPDATE SET
+		play_count = s.play_count + EXCLUDED.play_count,
+		complete_count = s.complete_count + EXCLUDED.complete_count,
+		skip_count = s.skip_count + EXCLUDED.skip_count,
+		listened_seconds = s.listened_seconds + EXCLUDED.listened_seconds,
+		last_played_at = GREATEST(s.last_played_at, EXCLUDED.last_played_at);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER play_events_update_stats
+	AFTER INSERT ON public.play_events
+	REFERENCING NEW TABLE AS new_events
+	FOR EACH STATEMENT EXECUTE FUNCTION public.play_events_update_stats();
+-- +goose StatementEnd
+
+-- weight of a track in random selection, completed plays make a track more likely and skips less likely.
+-- weights are between 0.25 and 4, a track nobody listened to yet weighs 1.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.play_weight(complete_count int8, skip_count int8) RETURNS float8 AS $$
+	SELECT LEAST(GREATEST((1 + COALESCE(complete_count, 0))::float8 / (1 + COALESCE(skip_count, 0)), 0.25), 4);
+$$ LANGUAGE sql IMMUTABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS public.play_weight(int8, int8);
+DROP TRIGGER IF EXISTS play_events_update_stats ON public.play_events;
+DROP FUNCTION IF EXISTS public.play_events_update_stats();
+DROP TABLE IF EXISTS public.track_play_stats;
+DROP TABLE IF EXISTS public.play_events;
+DROP TYPE IF EXISTS public.play_event_type;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- listening history used to be recorded with an infinite timestamp, the time of the listen is lost.
+-- such rows are moved to the time of the migration so that they show up in time windows at least once.
+-- +goose StatementBegin
+UPDATE public.listening_histories
+SET listened_at = now()
+WHERE listened_at = 'infinity'::timestamptz;
+-- +goose StatementEnd
+
+-- listening history used to be deleted once an anonymous user listened to every track, the history
+-- is kept for statistics now and only the history since the rotation started counts as listened.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.listener_rotations (
+	anon_id text NOT NULL,
+	started_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT listener_rotations_pkey PRIMARY KEY (anon_id)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_listening_histories_listened_at ON public.listening_histories USING btree (listened_at);
+CREATE INDEX IF NOT EXISTS idx_listening_histories_anon_id_listened_at ON public.listening_histories USING btree (anon_id, listened_at);
+CREATE INDEX IF NOT EXISTS idx_play_events_created_at ON public.play_events USING btree (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.idx_play_events_created_at;
+DROP INDEX IF EXISTS public.idx_listening_histories_anon_id_listened_at;
+DROP INDEX IF EXISTS public.idx_listening_histories_listened_at;
+DROP TABLE IF EXISTS public.listener_rotations;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- random position of the track, random selection starts at a random key and walks the index
+-- instead of sorting the whole catalogue. see GetRandomTrack in query.sql.
+-- +goose StatementBegin
+ALTER TABLE public.tracks
+	ADD COLUMN IF NOT EXISTS random_key float8 NOT NULL DEFAULT random();
+CREATE INDEX IF NOT EXISTS idx_tracks_random_key ON public.tracks USING btree (random_key);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.idx_tracks_random_key;
+ALTER TABLE public.tracks
+	DROP COLUMN IF EXISTS random_key;
+-- +goose StatementEnd
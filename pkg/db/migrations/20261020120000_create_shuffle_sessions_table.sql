@@ -0,0 +1,40 @@
+-- +goose Up
+-- shuffle sessions keep the queue of a listener on the server so that clients can go back and prefetch.
+-- the queue is materialized in batches, see AppendShuffleSessionTracks in query.sql.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.shuffle_sessions (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	anon_id text NOT NULL,
+	-- filter of the tracks in the queue, see endpoints.TrackFilter
+	filter jsonb NOT NULL DEFAULT '{}',
+	-- the queue of the same seed, filter and library is always shuffled the same way
+	seed text NOT NULL,
+	-- the queue starts over with a new shuffle once every matching track was queued
+	cycle int4 NOT NULL DEFAULT 0,
+	-- position of the current track, -1 before the first track
+	"position" int4 NOT NULL DEFAULT -1,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT shuffle_sessions_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_shuffle_sessions_anon_id ON public.shuffle_sessions USING btree (anon_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.shuffle_session_tracks (
+	session_id uuid NOT NULL,
+	"position" int4 NOT NULL,
+	track_id uuid NOT NULL,
+	cycle int4 NOT NULL,
+	CONSTRAINT shuffle_session_tracks_pkey PRIMARY KEY (session_id, "position"),
+	CONSTRAINT shuffle_session_tracks_session_id_fkey FOREIGN KEY (session_id) REFERENCES public.shuffle_sessions (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT shuffle_session_tracks_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shuffle_session_tracks_cycle_track_id ON public.shuffle_session_tracks USING btree (session_id, cycle, track_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.shuffle_session_tracks;
+DROP TABLE IF EXISTS public.shuffle_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,72 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.playlists (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	"name" text NOT NULL,
+	description text NULL,
+	-- listener that owns the playlist, playlists created with the cli have no owner
+	anon_id text NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT playlists_pkey PRIMARY KEY (id),
+	CONSTRAINT playlists_name_check CHECK (btrim("name") <> '')
+);
+CREATE INDEX IF NOT EXISTS idx_playlists_anon_id ON public.playlists USING btree (anon_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- a track can be in the playlist more than once, items are identified by their own id.
+-- positions are dense from 0, the unique constraint is deferrable so that a single statement can shift them.
+CREATE TABLE IF NOT EXISTS public.playlist_items (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	playlist_id uuid NOT NULL,
+	track_id uuid NOT NULL,
+	"position" int4 NOT NULL,
+	added_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT playlist_items_pkey PRIMARY KEY (id),
+	CONSTRAINT playlist_items_position_key UNIQUE (playlist_id, "position") DEFERRABLE INITIALLY IMMEDIATE,
+	CONSTRAINT playlist_items_playlist_id_fkey FOREIGN KEY (playlist_id) REFERENCES public.playlists (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT playlist_items_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_playlist_items_track_id ON public.playlist_items USING btree (track_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- deleting items, or tracks that are in playlists, leaves gaps. positions of the affected playlists are
+-- renumbered once per statement, shifting per deleted row would depend on the order the rows are deleted in.
+CREATE OR REPLACE FUNCTION public.renumber_playlist_items() RETURNS trigger AS $$
+BEGIN
+	UPDATE public.playlist_items pi
+	SET "position" = renumbered."position"
+	FROM (
+			SELECT id,
+				row_number() OVER (
+					PARTITION BY playlist_id
+					ORDER BY "position"
+				) - 1 AS "position"
+			FROM public.playlist_items
+			WHERE playlist_id IN (
+					SELECT DISTINCT playlist_id
+					FROM deleted_items
+				)
+		) renumbered
+	WHERE pi.id = renumbered.id
+		AND pi."position" <> renumbered."position";
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER playlist_items_renumber
+	AFTER DELETE ON public.playlist_items
+	REFERENCING OLD TABLE AS deleted_items
+	FOR EACH STATEMENT EXECUTE FUNCTION public.renumber_playlist_items();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.playlist_items;
+DROP FUNCTION IF EXISTS public.renumber_playlist_items();
+DROP TABLE IF EXISTS public.playlists;
+-- +goose StatementEnd
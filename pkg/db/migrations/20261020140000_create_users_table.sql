@@ -0,0 +1,58 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.users (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	username text NOT NULL,
+	-- bcrypt
+	password_hash text NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT users_pkey PRIMARY KEY (id),
+	CONSTRAINT users_username_check CHECK (btrim(username) <> '')
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON public.users USING btree (lower(username));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- tokens are only shown once when they are issued, the sha256 of the token is stored
+CREATE TABLE IF NOT EXISTS public.api_tokens (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	token_hash bytea NOT NULL,
+	-- what the token is used for, such as the hostname of the cli that logged in
+	"name" text NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	-- tokens without expiry are valid until they are revoked
+	expires_at timestamptz NULL,
+	last_used_at timestamptz NULL,
+	CONSTRAINT api_tokens_pkey PRIMARY KEY (id),
+	CONSTRAINT api_tokens_token_hash_key UNIQUE (token_hash),
+	CONSTRAINT api_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON public.api_tokens USING btree (user_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- playlists are owned by a listener, by a user, or by nobody if they were created with the cli
+ALTER TABLE public.playlists
+	ADD COLUMN IF NOT EXISTS user_id uuid NULL;
+ALTER TABLE public.playlists
+	ADD CONSTRAINT playlists_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users (id) ON UPDATE CASCADE ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_playlists_user_id ON public.playlists USING btree (user_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- shuffle sessions of users are only reached with their token, those of anonymous listeners by their id
+ALTER TABLE public.shuffle_sessions
+	ADD COLUMN IF NOT EXISTS user_id uuid NULL;
+ALTER TABLE public.shuffle_sessions
+	ADD CONSTRAINT shuffle_sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users (id) ON UPDATE CASCADE ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE public.shuffle_sessions DROP COLUMN IF EXISTS user_id;
+ALTER TABLE public.playlists DROP COLUMN IF EXISTS user_id;
+DROP TABLE IF EXISTS public.api_tokens;
+DROP TABLE IF EXISTS public.users;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE public.ingest_job_status AS ENUM ('queued', 'running', 'succeeded', 'failed');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- uploads waiting to be processed by a worker, the uploaded files are staged in the object store
+-- under uploads/<job id>/ until the job finishes.
+CREATE TABLE IF NOT EXISTS public.ingest_jobs (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	status public.ingest_job_status NOT NULL DEFAULT 'queued',
+	-- step of the pipeline the job is at, such as splitting or uploading
+	stage text NOT NULL DEFAULT 'queued',
+	audio_key text NOT NULL,
+	-- name of the file as it was uploaded
+	audio_filename text NOT NULL,
+	cover_key text NULL,
+	instrumental bool NOT NULL DEFAULT false,
+	user_id uuid NULL,
+	attempts int4 NOT NULL DEFAULT 0,
+	max_attempts int4 NOT NULL DEFAULT 3,
+	-- failed jobs are retried after a backoff
+	run_after timestamptz NOT NULL DEFAULT now(),
+	-- worker that claimed the job, the claim is lost if the lease is not renewed
+	locked_by text NULL,
+	lease_expires_at timestamptz NULL,
+	error text NULL,
+	-- track the job created
+	track_id uuid NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	started_at timestamptz NULL,
+	finished_at timestamptz NULL,
+	CONSTRAINT ingest_jobs_pkey PRIMARY KEY (id),
+	CONSTRAINT ingest_jobs_attempts_check CHECK (attempts >= 0 AND max_attempts > 0),
+	CONSTRAINT ingest_jobs_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users (id) ON UPDATE CASCADE ON DELETE SET NULL,
+	CONSTRAINT ingest_jobs_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+-- workers only look at queued jobs
+CREATE INDEX IF NOT EXISTS idx_ingest_jobs_queued ON public.ingest_jobs USING btree (run_after) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_ingest_jobs_user_id ON public.ingest_jobs USING btree (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.ingest_jobs;
+DROP TYPE IF EXISTS public.ingest_job_status;
+-- +goose StatementEnd
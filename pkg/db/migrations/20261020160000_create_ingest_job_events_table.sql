@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- progress of ingest jobs as reported by the pipeline, streamed by GET /uploads/{id}/events
+CREATE TABLE IF NOT EXISTS public.ingest_job_events (
+	id int8 GENERATED ALWAYS AS IDENTITY,
+	job_id uuid NOT NULL,
+	-- stage_started, stage_finished, progress, log, retrying, done or failed
+	event_type text NOT NULL,
+	-- the event as it is sent to clients
+	payload jsonb NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT ingest_job_events_pkey PRIMARY KEY (id),
+	CONSTRAINT ingest_job_events_job_id_fkey FOREIGN KEY (job_id) REFERENCES public.ingest_jobs (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_ingest_job_events_job_id_id ON public.ingest_job_events USING btree (job_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.ingest_job_events;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+-- stations play the tracks matching their filter on a shared timeline, every listener hears the same track
+-- at the same position.
+CREATE TABLE IF NOT EXISTS public.stations (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	"name" text NOT NULL,
+	-- filter of the tracks the station plays, see endpoints.TrackFilter
+	filter jsonb NOT NULL DEFAULT '{}',
+	created_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT stations_pkey PRIMARY KEY (id),
+	CONSTRAINT stations_name_key UNIQUE ("name"),
+	CONSTRAINT stations_name_check CHECK ("name" ~ '^[a-z0-9][a-z0-9_-]*$')
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- playout schedule of the stations, extended ahead of time by the server. tracks are back to back,
+-- a track starts when the previous one ends.
+CREATE TABLE IF NOT EXISTS public.station_schedule (
+	station_id uuid NOT NULL,
+	"position" int8 NOT NULL,
+	track_id uuid NOT NULL,
+	starts_at timestamptz NOT NULL,
+	ends_at timestamptz NOT NULL,
+	CONSTRAINT station_schedule_pkey PRIMARY KEY (station_id, "position"),
+	CONSTRAINT station_schedule_check CHECK (ends_at > starts_at),
+	CONSTRAINT station_schedule_station_id_fkey FOREIGN KEY (station_id) REFERENCES public.stations (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT station_schedule_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_station_schedule_station_id_ends_at ON public.station_schedule USING btree (station_id, ends_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.station_schedule;
+DROP TABLE IF EXISTS public.stations;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- lyrics of the tracks, synced lyrics keep the timed lines and plain has their text without the times.
+CREATE TABLE IF NOT EXISTS public.lyrics (
+	track_id uuid NOT NULL,
+	-- ISO 639-2 code of the USLT or SYLT frame, if the lyrics were embedded
+	"language" text NULL,
+	plain text NOT NULL,
+	-- lines with the time in seconds, and the time of every word for enhanced LRC, see internal.LyricLine
+	synced jsonb NULL,
+	-- sidecar, sylt, uslt, tag or cli
+	"source" text NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT lyrics_pkey PRIMARY KEY (track_id),
+	CONSTRAINT lyrics_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- .lrc uploaded next to the audio, stored as a sidecar of the audio for the worker
+ALTER TABLE public.ingest_jobs ADD COLUMN IF NOT EXISTS lyrics_key text NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE public.ingest_jobs DROP COLUMN IF EXISTS lyrics_key;
+DROP TABLE IF EXISTS public.lyrics;
+-- +goose StatementEnd
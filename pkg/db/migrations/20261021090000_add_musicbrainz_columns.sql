@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- identifiers and spellings of musicbrainz, set by the enrichment stage of uploads. the tags of the
+-- tracks are kept as they are, only missing tags are filled in.
+ALTER TABLE public.albums
+	ADD COLUMN IF NOT EXISTS musicbrainz_release_id uuid NULL,
+	ADD COLUMN IF NOT EXISTS musicbrainz_release_group_id uuid NULL,
+	ADD COLUMN IF NOT EXISTS canonical_name text NULL,
+	-- YYYY, YYYY-MM or YYYY-MM-DD, musicbrainz only knows the year of many releases
+	ADD COLUMN IF NOT EXISTS release_date text NULL;
+ALTER TABLE public.tracks
+	ADD COLUMN IF NOT EXISTS musicbrainz_recording_id uuid NULL,
+	ADD COLUMN IF NOT EXISTS canonical_title text NULL;
+ALTER TABLE public.artists
+	ADD COLUMN IF NOT EXISTS musicbrainz_id uuid NULL;
+CREATE INDEX IF NOT EXISTS idx_tracks_musicbrainz_recording_id ON public.tracks USING btree (musicbrainz_recording_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_tracks_musicbrainz_recording_id;
+ALTER TABLE public.artists DROP COLUMN IF EXISTS musicbrainz_id;
+ALTER TABLE public.tracks
+	DROP COLUMN IF EXISTS musicbrainz_recording_id,
+	DROP COLUMN IF EXISTS canonical_title;
+ALTER TABLE public.albums
+	DROP COLUMN IF EXISTS musicbrainz_release_id,
+	DROP COLUMN IF EXISTS musicbrainz_release_group_id,
+	DROP COLUMN IF EXISTS canonical_name,
+	DROP COLUMN IF EXISTS release_date;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- tags are escaped before ts_headline wraps the matched words with <mark>, markup in a tag reaches the client as text
+CREATE OR REPLACE FUNCTION public.html_escape(value text) RETURNS text AS $$
+	SELECT replace(replace(replace(replace(replace(value, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS public.html_escape(text);
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- tracks matching the filters of listings, random picks, shuffle sessions and stations, NULL or empty filters match
+-- every track and tempo, duration and year ranges are inclusive. the function is a single STABLE SELECT, so the planner
+-- inlines it into the calling query and the tempo, key, genre, duration and year conditions of the given filters use
+-- the indexes on these columns, idx_tracks_genre comes with the tracks table. exclusions are checked on the tracks the
+-- other conditions select.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.filtered_tracks(
+		min_tempo numeric,
+		max_tempo numeric,
+		keys text[],
+		genres text[],
+		min_duration numeric,
+		max_duration numeric,
+		instrumental_only bool,
+		min_year int,
+		max_year int,
+		exclude_track_ids uuid[],
+		exclude_album_ids uuid[],
+		exclude_genres text[],
+		exclude_artist_ids uuid[]
+	) RETURNS SETOF public.tracks AS $$
+	SELECT t.*
+	FROM public.tracks t
+		JOIN public.albums a ON a.id = t.album_id
+	WHERE (min_tempo IS NULL OR t.tempo >= min_tempo)
+		AND (max_tempo IS NULL OR t.tempo <= max_tempo)
+		AND (COALESCE(cardinality(keys), 0) = 0 OR t."key" = ANY(keys))
+		AND (COALESCE(cardinality(genres), 0) = 0 OR t.info->>'Genre' = ANY(genres))
+		AND (min_duration IS NULL OR t.total_duration >= min_duration)
+		AND (max_duration IS NULL OR t.total_duration <= max_duration)
+		AND (NOT instrumental_only OR t.instrumental)
+		AND (min_year IS NULL OR a."year" >= min_year)
+		AND (max_year IS NULL OR a."year" <= max_year)
+		AND NOT t.id = ANY(COALESCE(exclude_track_ids, '{}'))
+		AND NOT t.album_id = ANY(COALESCE(exclude_album_ids, '{}'))
+		AND NOT COALESCE(t.info->>'Genre', '') = ANY(COALESCE(exclude_genres, '{}'))
+		AND NOT EXISTS (
+			SELECT 1
+			FROM public.track_artists ta
+			WHERE ta.track_id = t.id
+				AND ta.artist_id = ANY(COALESCE(exclude_artist_ids, '{}'))
+		)
+$$ LANGUAGE sql STABLE PARALLEL SAFE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS public.filtered_tracks(numeric, numeric, text[], text[], numeric, numeric, bool, int, int, uuid[], uuid[], text[], uuid[]);
+-- +goose StatementEnd
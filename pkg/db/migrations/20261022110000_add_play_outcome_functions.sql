@@ -0,0 +1,68 @@
+-- +goose Up
+-- skips in the last 10% of the track are counted as completed plays, statistics queries and the stats trigger
+-- count completes and skips with the same functions
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.is_completed_play(event_type public.play_event_type, "position" numeric, total_duration numeric) RETURNS bool AS $$
+	SELECT event_type = 'complete' OR (event_type = 'skip' AND "position" >= total_duration * 0.9)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.is_skipped_play(event_type public.play_event_type, "position" numeric, total_duration numeric) RETURNS bool AS $$
+	SELECT event_type = 'skip' AND "position" < total_duration * 0.9
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.play_events_update_stats() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO public.track_play_stats AS s (track_id, play_count, complete_count, skip_count, listened_seconds, last_played_at)
+	SELECT e.track_id,
+		COUNT(*) FILTER (WHERE e.event_type = 'start'),
+		COUNT(*) FILTER (WHERE public.is_completed_play(e.event_type, e."position", t.total_duration)),
+		COUNT(*) FILTER (WHERE public.is_skipped_play(e.event_type, e."position", t.total_duration)),
+		SUM(e.duration),
+		MAX(e.created_at) FILTER (WHERE e.event_type = 'start')
+	FROM new_events e
+		JOIN public.tracks t ON t.id = e.track_id
+	GROUP BY e.track_id
+	ON CONFLICT (track_id) DO UPDATE SET
+		play_count = s.play_count + EXCLUDED.play_count,
+		complete_count = s.complete_count + EXCLUDED.complete_count,
+		skip_count = s.skip_count + EXCLUDED.skip_count,
+		listened_seconds = s.listened_seconds + EXCLUDED.listened_seconds,
+		last_played_at = GREATEST(s.last_played_at, EXCLUDED.last_played_at);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.play_events_update_stats() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO public.track_play_stats AS s (track_id, play_count, complete_count, skip_count, listened_seconds, last_played_at)
+	SELECT e.track_id,
+		COUNT(*) FILTER (WHERE e.event_type = 'start'),
+		COUNT(*) FILTER (WHERE e.event_type = 'complete' OR (e.event_type = 'skip' AND e."position" >= t.total_duration * 0.9)),
+		COUNT(*) FILTER (WHERE e.event_type = 'skip' AND e."position" < t.total_duration * 0.9),
+		SUM(e.duration),
+		MAX(e.created_at) FILTER (WHERE e.event_type = 'start')
+	FROM new_events e
+		JOIN public.tracks t ON t.id = e.track_id
+	GROUP BY e.track_id
+	ON CONFLICT (track_id) DO UPDATE SET
+		play_count = s.play_count + EXCLUDED.play_count,
+		complete_count = s.complete_count + EXCLUDED.complete_count,
+		skip_count = s.skip_count + EXCLUDED.skip_count,
+		listened_seconds = s.listened_seconds + EXCLUDED.listened_seconds,
+		last_played_at = GREATEST(s.last_played_at, EXCLUDED.last_played_at);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS public.is_skipped_play(public.play_event_type, numeric, numeric);
+DROP FUNCTION IF EXISTS public.is_completed_play(public.play_event_type, numeric, numeric);
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- the shuffle of the current cycle of a session, sorted once when the cycle starts. batches are moved from here
+-- to the queue in rank order, see AppendShuffleSessionTracks in query.sql. sessions created before this table
+-- existed start a new cycle with their next batch.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS public.shuffle_session_order (
+	session_id uuid NOT NULL,
+	"rank" int4 NOT NULL,
+	track_id uuid NOT NULL,
+	CONSTRAINT shuffle_session_order_pkey PRIMARY KEY (session_id, "rank"),
+	CONSTRAINT shuffle_session_order_session_id_fkey FOREIGN KEY (session_id) REFERENCES public.shuffle_sessions (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT shuffle_session_order_track_id_fkey FOREIGN KEY (track_id) REFERENCES public.tracks (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_shuffle_session_order_track_id ON public.shuffle_session_order USING btree (track_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.shuffle_session_order;
+-- +goose StatementEnd
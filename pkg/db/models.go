@@ -5,33 +5,342 @@
 package db
 
 import (
+	"database/sql/driver"
+	"fmt"
+
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ArtistRole string
+
+const (
+	ArtistRolePrimary  ArtistRole = "primary"
+	ArtistRoleFeatured ArtistRole = "featured"
+	ArtistRoleRemixer  ArtistRole = "remixer"
+	ArtistRoleProducer ArtistRole = "producer"
+)
+
+func (e *ArtistRole) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = ArtistRole(s)
+	case string:
+		*e = ArtistRole(s)
+	default:
+		return fmt.Errorf("unsupported scan type for ArtistRole: %T", src)
+	}
+	return nil
+}
+
+type NullArtistRole struct {
+	ArtistRole ArtistRole
+	Valid      bool // Valid is true if ArtistRole is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullArtistRole) Scan(value interface{}) error {
+	if value == nil {
+		ns.ArtistRole, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.ArtistRole.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullArtistRole) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.ArtistRole), nil
+}
+
+type IngestJobStatus string
+
+const (
+	IngestJobStatusQueued    IngestJobStatus = "queued"
+	IngestJobStatusRunning   IngestJobStatus = "running"
+	IngestJobStatusSucceeded IngestJobStatus = "succeeded"
+	IngestJobStatusFailed    IngestJobStatus = "failed"
+)
+
+func (e *IngestJobStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = IngestJobStatus(s)
+	case string:
+		*e = IngestJobStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for IngestJobStatus: %T", src)
+	}
+	return nil
+}
+
+type NullIngestJobStatus struct {
+	IngestJobStatus IngestJobStatus
+	Valid           bool // Valid is true if IngestJobStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullIngestJobStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.IngestJobStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.IngestJobStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullIngestJobStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.IngestJobStatus), nil
+}
+
+type PlayEventType string
+
+const (
+	PlayEventTypeStart    PlayEventType = "start"
+	PlayEventTypeProgress PlayEventType = "progress"
+	PlayEventTypeComplete PlayEventType = "complete"
+	PlayEventTypeSkip     PlayEventType = "skip"
+)
+
+func (e *PlayEventType) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = PlayEventType(s)
+	case string:
+		*e = PlayEventType(s)
+	default:
+		return fmt.Errorf("unsupported scan type for PlayEventType: %T", src)
+	}
+	return nil
+}
+
+type NullPlayEventType struct {
+	PlayEventType PlayEventType
+	Valid         bool // Valid is true if PlayEventType is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullPlayEventType) Scan(value interface{}) error {
+	if value == nil {
+		ns.PlayEventType, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.PlayEventType.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullPlayEventType) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.PlayEventType), nil
+}
+
 type Album struct {
-	ID     string
-	Name   pgtype.Text
-	Cover  pgtype.Text
-	Artist pgtype.Text
+	ID                        string
+	Name                      string
+	Cover                     pgtype.Text
+	Artist                    string
+	Year                      pgtype.Int4
+	Genre                     pgtype.Text
+	DiscCount                 int32
+	TrackCount                int32
+	TotalDuration             pgtype.Numeric
+	CreatedAt                 pgtype.Timestamptz
+	SearchVector              interface{}
+	MusicbrainzReleaseID      pgtype.Text
+	MusicbrainzReleaseGroupID pgtype.Text
+	CanonicalName             pgtype.Text
+	ReleaseDate               pgtype.Text
+}
+
+type ApiToken struct {
+	ID         string
+	UserID     string
+	TokenHash  []byte
+	Name       pgtype.Text
+	CreatedAt  pgtype.Timestamptz
+	ExpiresAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+}
+
+type Artist struct {
+	ID            string
+	Name          string
+	SortName      string
+	MatchName     string
+	Aliases       []string
+	CreatedAt     pgtype.Timestamptz
+	SearchVector  interface{}
+	MusicbrainzID pgtype.Text
+}
+
+type IngestJob struct {
+	ID             string
+	Status         IngestJobStatus
+	Stage          string
+	AudioKey       string
+	AudioFilename  string
+	CoverKey       pgtype.Text
+	Instrumental   bool
+	UserID         pgtype.Text
+	Attempts       int32
+	MaxAttempts    int32
+	RunAfter       pgtype.Timestamptz
+	LockedBy       pgtype.Text
+	LeaseExpiresAt pgtype.Timestamptz
+	Error          pgtype.Text
+	TrackID        pgtype.Text
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	StartedAt      pgtype.Timestamptz
+	FinishedAt     pgtype.Timestamptz
+	LyricsKey      pgtype.Text
+}
+
+type IngestJobEvent struct {
+	ID        int64
+	JobID     string
+	EventType string
+	Payload   []byte
+	CreatedAt pgtype.Timestamptz
+}
+
+type ListenerRotation struct {
+	AnonID    string
+	StartedAt pgtype.Timestamptz
 }
 
 type ListeningHistory struct {
-	TrackID    pgtype.Text
-	AnonID     pgtype.Text
+	TrackID    string
+	AnonID     string
 	ListenedAt pgtype.Timestamptz
 }
 
+type Lyric struct {
+	TrackID   string
+	Language  pgtype.Text
+	Plain     string
+	Synced    []byte
+	Source    string
+	UpdatedAt pgtype.Timestamptz
+}
+
+type PlayEvent struct {
+	ID        int64
+	TrackID   string
+	AnonID    string
+	EventType PlayEventType
+	Position  pgtype.Numeric
+	Duration  pgtype.Numeric
+	CreatedAt pgtype.Timestamptz
+}
+
+type Playlist struct {
+	ID          string
+	Name        string
+	Description pgtype.Text
+	AnonID      pgtype.Text
+	CreatedAt   pgtype.Timestamptz
+	UpdatedAt   pgtype.Timestamptz
+	UserID      pgtype.Text
+}
+
+type PlaylistItem struct {
+	ID         string
+	PlaylistID string
+	TrackID    string
+	Position   int32
+	AddedAt    pgtype.Timestamptz
+}
+
+type ShuffleSession struct {
+	ID        string
+	AnonID    string
+	Filter    []byte
+	Seed      string
+	Cycle     int32
+	Position  int32
+	CreatedAt pgtype.Timestamptz
+	UpdatedAt pgtype.Timestamptz
+	UserID    pgtype.Text
+}
+
+type ShuffleSessionOrder struct {
+	SessionID string
+	Rank      int32
+	TrackID   string
+}
+
+type ShuffleSessionTrack struct {
+	SessionID string
+	Position  int32
+	TrackID   string
+	Cycle     int32
+}
+
+type Station struct {
+	ID        string
+	Name      string
+	Filter    []byte
+	CreatedAt pgtype.Timestamptz
+}
+
+type StationSchedule struct {
+	StationID string
+	Position  int64
+	TrackID   string
+	StartsAt  pgtype.Timestamptz
+	EndsAt    pgtype.Timestamptz
+}
+
 type Track struct {
 	ID                     string
 	VocalFolderPath        pgtype.Text
-	InstrumentalFolderPath pgtype.Text
-	AlbumID                pgtype.Text
+	InstrumentalFolderPath string
+	AlbumID                string
 	TotalDuration          pgtype.Numeric
 	Info                   []byte
-	Instrumental           pgtype.Bool
+	Instrumental           bool
 	Tempo                  pgtype.Numeric
-	Key                    pgtype.Text
+	Key                    string
 	VocalWaveform          []byte
 	InstrumentalWaveform   []byte
-	AlbumName              pgtype.Text
+	AlbumName              string
+	CreatedAt              pgtype.Timestamptz
+	SearchVector           interface{}
+	RandomKey              float64
+	MusicbrainzRecordingID pgtype.Text
+	CanonicalTitle         pgtype.Text
+}
+
+type TrackArtist struct {
+	TrackID  string
+	ArtistID string
+	Role     ArtistRole
+	Position int32
+}
+
+type TrackPlayStat struct {
+	TrackID         string
+	PlayCount       int64
+	CompleteCount   int64
+	SkipCount       int64
+	ListenedSeconds pgtype.Numeric
+	LastPlayedAt    pgtype.Timestamptz
+}
+
+type User struct {
+	ID           string
+	Username     string
+	PasswordHash string
+	CreatedAt    pgtype.Timestamptz
+	UpdatedAt    pgtype.Timestamptz
 }
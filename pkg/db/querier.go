@@ -11,36 +11,235 @@ import (
 )
 
 type Querier interface {
-	// Delete all listening history for a given anonymous user
-	DeleteListeningHistoryByAnonID(ctx context.Context, anonID pgtype.Text) error
-	GetAlbumByArtist(ctx context.Context, artist pgtype.Text) (Album, error)
+	AddArtistAlias(ctx context.Context, arg AddArtistAliasParams) error
+	AlbumExists(ctx context.Context, id string) (bool, error)
+	// Moves the next batch of the order of the current cycle to the queue of the session, see OrderShuffleSessionCycle.
+	// the batch is read from the primary key of the order, no rows are appended once the order is used up.
+	AppendShuffleSessionTracks(ctx context.Context, arg AppendShuffleSessionTracksParams) (int64, error)
+	// Schedules the next batch of tracks matching the filters after the last scheduled track, or from now on if the
+	// schedule ran out, see filtered_tracks for the filters. every slot of the batch is picked like GetRandomTrack
+	// among the candidates following its own random start in random_key order, wrapping around to the start of the
+	// key range, so that the index is walked instead of sorting the catalogue. a track picked for two slots is
+	// scheduled once, the batch can be shorter than batch_size.
+	// tracks among the last recent_tracks scheduled tracks of the station are not scheduled again.
+	AppendStationSchedule(ctx context.Context, arg AppendStationScheduleParams) (int64, error)
+	ArtistExists(ctx context.Context, id string) (bool, error)
+	// Suggests track titles, album names and artist names starting with the typed words, see SearchTracks for the arguments
+	AutocompleteSearch(ctx context.Context, arg AutocompleteSearchParams) ([]AutocompleteSearchRow, error)
+	// Claims the oldest queued job that is due, concurrent workers skip the jobs other workers are claiming.
+	ClaimIngestJob(ctx context.Context, arg ClaimIngestJobParams) (IngestJob, error)
+	CompleteIngestJob(ctx context.Context, arg CompleteIngestJobParams) (int64, error)
+	CountIngestJobs(ctx context.Context) ([]CountIngestJobsRow, error)
+	// Counts the rows of the given ids, used to verify an import.
+	CountLibraryRows(ctx context.Context, arg CountLibraryRowsParams) (CountLibraryRowsRow, error)
+	CountPlaylistItems(ctx context.Context, playlistID string) (int64, error)
+	CountShuffleSessionTracks(ctx context.Context, sessionID string) (int64, error)
+	CreateAPIToken(ctx context.Context, arg CreateAPITokenParams) (ApiToken, error)
+	CreateIngestJob(ctx context.Context, arg CreateIngestJobParams) (IngestJob, error)
+	CreatePlaylist(ctx context.Context, arg CreatePlaylistParams) (Playlist, error)
+	CreateShuffleSession(ctx context.Context, arg CreateShuffleSessionParams) (ShuffleSession, error)
+	CreateStation(ctx context.Context, arg CreateStationParams) (Station, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	DeleteAPIToken(ctx context.Context, id string) error
+	DeletePlaylist(ctx context.Context, id string) error
+	// Deletes the item, the items after it are renumbered by a trigger.
+	DeletePlaylistItem(ctx context.Context, arg DeletePlaylistItemParams) (int64, error)
+	DeleteShuffleSession(ctx context.Context, id string) error
+	DeleteStation(ctx context.Context, name string) (int64, error)
+	DeleteTrackArtists(ctx context.Context, trackID string) error
+	// Revokes every token of the user, passwords changes log out every client.
+	DeleteUserAPITokens(ctx context.Context, userID string) (int64, error)
+	// Lists albums in id order after the given id, derived columns are recalculated on import.
+	// only the albums of the given ids if ids is not NULL, imports read back what they wrote.
+	ExportAlbums(ctx context.Context, arg ExportAlbumsParams) ([]ExportAlbumsRow, error)
+	// Lists artists like ExportAlbums.
+	ExportArtists(ctx context.Context, arg ExportArtistsParams) ([]Artist, error)
+	// Lists listening history oldest first after the given entry, identical entries are exported once.
+	ExportListeningHistories(ctx context.Context, arg ExportListeningHistoriesParams) ([]ListeningHistory, error)
+	ExportLyrics(ctx context.Context, trackIds []string) ([]Lyric, error)
+	ExportPlayEvents(ctx context.Context, arg ExportPlayEventsParams) ([]ExportPlayEventsRow, error)
+	ExportTrackArtists(ctx context.Context, trackIds []string) ([]TrackArtist, error)
+	// Lists tracks like ExportAlbums, numeric columns as text to keep their precision.
+	ExportTracks(ctx context.Context, arg ExportTracksParams) ([]ExportTracksRow, error)
+	// Queues the job again after the backoff, or fails it for good once it ran out of attempts.
+	// The stage the job failed at is kept.
+	FailIngestJob(ctx context.Context, arg FailIngestJobParams) (IngestJobStatus, error)
+	GetAlbumByArtist(ctx context.Context, artist string) (Album, error)
 	GetAlbumById(ctx context.Context, id string) (Album, error)
-	GetAlbumByName(ctx context.Context, name pgtype.Text) (Album, error)
+	GetAlbumByName(ctx context.Context, name string) (Album, error)
 	GetAlbumByNameAndArtist(ctx context.Context, arg GetAlbumByNameAndArtistParams) (Album, error)
 	// Get album cover by the album ID
 	GetAlbumCoverByID(ctx context.Context, id string) (pgtype.Text, error)
-	GetAlbumIDByName(ctx context.Context, name pgtype.Text) (string, error)
+	GetAlbumIDByName(ctx context.Context, name string) (string, error)
 	GetAlbumIDByNameAndArtist(ctx context.Context, arg GetAlbumIDByNameAndArtistParams) (string, error)
-	// Get a completely random track
-	GetRandomTrack(ctx context.Context) (Track, error)
-	// Get a random track that hasn't been listened to by the given anonymous user
-	GetRandomUnlistenedTrack(ctx context.Context, anonID pgtype.Text) (Track, error)
+	GetArtistByID(ctx context.Context, id string) (Artist, error)
+	GetArtistByMatchNameOrAlias(ctx context.Context, matchName string) (Artist, error)
+	// Gets the roles the artist is credited with on the given tracks
+	GetArtistRolesByTrackIDs(ctx context.Context, arg GetArtistRolesByTrackIDsParams) ([]GetArtistRolesByTrackIDsRow, error)
+	// Gets credited artists of the track in credit order
+	GetArtistsByTrackID(ctx context.Context, trackID string) ([]GetArtistsByTrackIDRow, error)
+	GetIngestJob(ctx context.Context, id string) (IngestJob, error)
+	// Gets the given match names that belong to an artist or are an alias of one
+	GetKnownArtistMatchNames(ctx context.Context, matchNames []string) ([]string, error)
+	// Sums the library, the number of tracks is counted by GetTrackCount.
+	GetLibraryTotals(ctx context.Context) (GetLibraryTotalsRow, error)
+	// Sums the play events and random picks of the anonymous listener between since and until.
+	GetListenerPlayTotals(ctx context.Context, arg GetListenerPlayTotalsParams) (GetListenerPlayTotalsRow, error)
+	// Lists the tracks handed out to the anonymous listener newest first, between since and until.
+	// after_listened_at and after_track_id point to the last entry of the previous page.
+	GetListeningHistory(ctx context.Context, arg GetListeningHistoryParams) ([]GetListeningHistoryRow, error)
+	GetLyrics(ctx context.Context, trackID string) (Lyric, error)
+	GetPlaylist(ctx context.Context, id string) (Playlist, error)
+	GetPlaylistItem(ctx context.Context, arg GetPlaylistItemParams) (PlaylistItem, error)
+	GetPlaylistsByName(ctx context.Context, name string) ([]Playlist, error)
+	// Get a completely random track matching the filters, see filtered_tracks for the filters.
+	// candidates are picked like GetRandomUnlistenedTrack.
+	// weighted random sampling, tracks that are often completed come up more and tracks that are often skipped less
+	GetRandomTrack(ctx context.Context, arg GetRandomTrackParams) (Track, error)
+	// Get a random track matching the filters that hasn't been listened to by the given anonymous user
+	// since their current rotation started, see StartListenerRotation. see filtered_tracks for the filters.
+	// the candidates are the tracks following the random start in random_key order, the pick is weighted among them
+	// so that the index is walked instead of sorting the catalogue. no rows if no track follows start, see PickRandomTrack in random.go.
+	// weighted random sampling, tracks that are often completed come up more and tracks that are often skipped less
+	GetRandomUnlistenedTrack(ctx context.Context, arg GetRandomUnlistenedTrackParams) (Track, error)
+	GetShuffleSession(ctx context.Context, id string) (ShuffleSession, error)
+	// Gets the queued track before the position, positions of deleted tracks are skipped.
+	GetShuffleSessionTrackBefore(ctx context.Context, arg GetShuffleSessionTrackBeforeParams) (GetShuffleSessionTrackBeforeRow, error)
+	GetStationByName(ctx context.Context, name string) (Station, error)
+	// Gets the end of the last scheduled track, null if nothing is scheduled.
+	GetStationScheduleEnd(ctx context.Context, stationID string) (pgtype.Timestamptz, error)
 	// Get track by ID (all columns, use GetTrackBasicByID if waveforms are not needed)
 	GetTrackByID(ctx context.Context, id string) (Track, error)
 	// Gets total number of tracks
 	GetTrackCount(ctx context.Context) (int64, error)
-	// Gets basic track information filtered by album ID, sorted by track list
-	GetTracksByAlbumId(ctx context.Context, albumID pgtype.Text) ([]GetTracksByAlbumIdRow, error)
-	// Gets basic track information filtered by artist
-	GetTracksByArtist(ctx context.Context, info []byte) ([]GetTracksByArtistRow, error)
+	GetTrackPlayStats(ctx context.Context, trackID string) (TrackPlayStat, error)
+	// Gets basic track information filtered by album ID, sorted by disc and track number
+	GetTracksByAlbumId(ctx context.Context, albumID string) ([]GetTracksByAlbumIdRow, error)
+	// Gets basic track information of the tracks the artist is credited on
+	GetTracksByArtist(ctx context.Context, artistID string) ([]GetTracksByArtistRow, error)
+	// Gets basic track information of every track the artist is credited on, with the credit role
+	GetTracksByArtistID(ctx context.Context, artistID string) ([]GetTracksByArtistIDRow, error)
 	// Gets basic track information filtered by genre
 	GetTracksByGenre(ctx context.Context, info []byte) ([]GetTracksByGenreRow, error)
+	// Gets tracks that have no artist credits yet, used for backfilling credits of tracks ingested before artists existed
+	GetTracksWithoutArtists(ctx context.Context) ([]GetTracksWithoutArtistsRow, error)
+	// Gets the user of the token unless the token expired.
+	GetUserByAPIToken(ctx context.Context, tokenHash []byte) (GetUserByAPITokenRow, error)
+	// Usernames are case insensitive.
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	// Inserts the album of an archive, or replaces the album with the same id. track count, total duration and disc
+	// count are left for refresh_album_stats.
+	ImportAlbum(ctx context.Context, arg ImportAlbumParams) error
+	// Inserts the artist of an archive, or replaces the artist with the same id.
+	ImportArtist(ctx context.Context, arg ImportArtistParams) error
+	// Inserts the entries that are not in the listening history yet, returns the number of entries inserted.
+	ImportListeningHistories(ctx context.Context, arg ImportListeningHistoriesParams) (int64, error)
+	// Sets the lyrics of the track from an archive, keeping the time they were last changed.
+	ImportLyrics(ctx context.Context, arg ImportLyricsParams) error
+	// Inserts the events that are not stored yet, events are the same if track, listener, type, position and time
+	// are. returns the number of events inserted.
+	ImportPlayEvents(ctx context.Context, arg ImportPlayEventsParams) (int64, error)
+	// Inserts the track of an archive, or replaces the track with the same id. random_key is kept for existing tracks.
+	ImportTrack(ctx context.Context, arg ImportTrackParams) error
 	// returns id
 	InsertAlbum(ctx context.Context, arg InsertAlbumParams) (string, error)
+	InsertIngestJobEvent(ctx context.Context, arg InsertIngestJobEventParams) error
+	// Inserts a single event, used when a batch is rejected to keep the valid events of the batch
+	InsertPlayEvent(ctx context.Context, arg InsertPlayEventParams) error
+	InsertPlayEvents(ctx context.Context, arg []InsertPlayEventsParams) (int64, error)
+	// Inserts the track at the position, items at and after the position move one position down.
+	// the position must be between 0 and the number of items, lock the playlist with TouchPlaylist first.
+	InsertPlaylistItem(ctx context.Context, arg InsertPlaylistItemParams) (PlaylistItem, error)
 	InsertTrack(ctx context.Context, arg InsertTrackParams) error
+	InsertTrackArtist(ctx context.Context, arg InsertTrackArtistParams) error
+	// Lists artists ordered by sort name with the number of tracks they are credited on
+	ListArtists(ctx context.Context, arg ListArtistsParams) ([]ListArtistsRow, error)
+	// Events of the job after the given event id, oldest first.
+	ListIngestJobEvents(ctx context.Context, arg ListIngestJobEventsParams) ([]ListIngestJobEventsRow, error)
+	// Running jobs whose lease expired are reported as stuck until a worker recovers them.
+	ListIngestJobs(ctx context.Context, arg ListIngestJobsParams) ([]ListIngestJobsRow, error)
+	// Lists the tracks of the playlist in order.
+	ListPlaylistItems(ctx context.Context, playlistID string) ([]ListPlaylistItemsRow, error)
+	// Lists playlists newest first with the number and the total duration of their tracks, optionally only the playlists of the listener or of the user.
+	ListPlaylists(ctx context.Context, arg ListPlaylistsParams) ([]ListPlaylistsRow, error)
+	// Lists the queued tracks after the position, positions of deleted tracks are skipped.
+	ListShuffleSessionTracksAfter(ctx context.Context, arg ListShuffleSessionTracksAfterParams) ([]ListShuffleSessionTracksAfterRow, error)
+	// Lists the scheduled tracks that did not end at the given time, the first one is playing unless it starts later.
+	ListStationSchedule(ctx context.Context, arg ListStationScheduleParams) ([]StationSchedule, error)
+	ListStations(ctx context.Context) ([]Station, error)
+	ListUsers(ctx context.Context) ([]ListUsersRow, error)
+	// Locks the session until the end of the transaction, concurrent next and prev requests of the session are serialized.
+	LockShuffleSession(ctx context.Context, id string) (ShuffleSession, error)
+	// Locks the station until the end of the transaction, servers extending the schedule at the same time are serialized.
+	LockStation(ctx context.Context, id string) (Station, error)
+	// Moves the item from its current position to the new one, items in between move by one position.
+	// the new position must be less than the number of items, lock the playlist with TouchPlaylist first.
+	MovePlaylistItem(ctx context.Context, arg MovePlaylistItemParams) error
+	// Shuffles the tracks matching the filters for the current cycle of the session, see filtered_tracks for the filters.
+	// tracks the listener has not heard since their rotation started come first, see GetRandomUnlistenedTrack.
+	// the order is derived from the seed and the cycle so that the same seed shuffles the library the same way.
+	// the library is sorted once per cycle, AppendShuffleSessionTracks moves batches of the order to the queue.
+	// tracks added to the library during the cycle are shuffled into the next one.
+	OrderShuffleSessionCycle(ctx context.Context, arg OrderShuffleSessionCycleParams) (int64, error)
+	// Counts plays, skips, listeners and picks per day between since and until, days without any activity are omitted.
+	PlayTrends(ctx context.Context, arg PlayTrendsParams) ([]PlayTrendsRow, error)
+	// Deletes the tracks that ended before the given time.
+	PruneStationSchedule(ctx context.Context, arg PruneStationScheduleParams) (int64, error)
 	RecordListeningHistory(ctx context.Context, arg RecordListeningHistoryParams) error
-	// Searches tracks by title, artist, or genre
+	// Jobs of workers that stopped renewing their lease are queued again, or failed if they ran out of attempts.
+	RecoverExpiredIngestJobs(ctx context.Context) ([]RecoverExpiredIngestJobsRow, error)
+	// Recalculates track count, total duration, disc count, year and genre of the album from its tracks
+	RefreshAlbumStats(ctx context.Context, albumID string) error
+	// Recalculates derived columns of every album, returns the number of albums processed
+	RefreshAllAlbumStats(ctx context.Context) (int64, error)
+	// Queues the job again without counting the attempt, for workers that are shut down while processing.
+	ReleaseIngestJob(ctx context.Context, arg ReleaseIngestJobParams) (int64, error)
+	// Extends the lease of a running job, no rows are updated if the worker lost the job.
+	RenewIngestJobLease(ctx context.Context, arg RenewIngestJobLeaseParams) (int64, error)
+	// Searches albums by name, artist and genre, see SearchTracks for the arguments
+	SearchAlbums(ctx context.Context, arg SearchAlbumsParams) ([]SearchAlbumsRow, error)
+	// Searches artists by name, see SearchTracks for the arguments
+	SearchArtists(ctx context.Context, arg SearchArtistsParams) ([]SearchArtistsRow, error)
+	// Searches tracks by title, artist, album and genre, ranked by full-text match and title/artist similarity.
+	// prefix_query is a to_tsquery expression where every term is a prefix ("lov:* & son:*"), term is the raw
+	// search text used for typo tolerant trigram matching.
 	SearchTracks(ctx context.Context, arg SearchTracksParams) ([]SearchTracksRow, error)
+	// Sets the musicbrainz release of the album, values the album already has are kept
+	SetAlbumMusicBrainz(ctx context.Context, arg SetAlbumMusicBrainzParams) error
+	// Sets the musicbrainz id of the artist with the match name or alias if it has none
+	SetArtistMusicBrainzID(ctx context.Context, arg SetArtistMusicBrainzIDParams) error
+	SetArtistSortName(ctx context.Context, arg SetArtistSortNameParams) error
+	SetIngestJobStage(ctx context.Context, arg SetIngestJobStageParams) (int64, error)
+	SetShuffleSessionPosition(ctx context.Context, arg SetShuffleSessionPositionParams) error
+	SetUserPassword(ctx context.Context, arg SetUserPasswordParams) (int64, error)
+	// Starts over the rotation of the anonymous user once they listened to every track, every track is unlistened again.
+	// the listening history is kept for statistics.
+	StartListenerRotation(ctx context.Context, anonID string) error
+	// Starts over the queue with a new shuffle, tracks of the previous cycles can be queued again.
+	StartShuffleSessionCycle(ctx context.Context, id string) error
+	// Ranks artists by plays of the tracks they are credited on between since and until, NULL bounds are open.
+	// an artist credited with several roles on a track counts the plays of the track once.
+	TopArtists(ctx context.Context, arg TopArtistsParams) ([]TopArtistsRow, error)
+	// Ranks tracks by plays between since and until, NULL bounds are open.
+	// picks count the times the track was handed out by random selection, plays count the started playbacks.
+	TopTracks(ctx context.Context, arg TopTracksParams) ([]TopTracksRow, error)
+	TouchAPIToken(ctx context.Context, id string) error
+	// Locks the playlist while its items are changed and bumps updated_at.
+	TouchPlaylist(ctx context.Context, id string) (Playlist, error)
+	TrackExists(ctx context.Context, id string) (bool, error)
+	// Counts the tracks matching the filters by genre, key, instrumental flag, tempo (in 10 BPM buckets) and album year.
+	// the filters are the arguments of the filtered_tracks function, NULL or empty filters match every track.
+	// tracks with an excluded id, album, genre or credited artist never match.
+	TrackFacets(ctx context.Context, arg TrackFacetsParams) ([]TrackFacetsRow, error)
+	// Updates the name and the description of the playlist, NULL keeps the current value.
+	UpdatePlaylist(ctx context.Context, arg UpdatePlaylistParams) (Playlist, error)
+	// Inserts the album if no album with the same name and artist exists, returns id of the new or existing album
+	// and whether the album is inserted by this call
+	UpsertAlbum(ctx context.Context, arg UpsertAlbumParams) (UpsertAlbumRow, error)
+	// Inserts the artist if no artist with the same match name exists, returns id of the new or existing artist
+	UpsertArtist(ctx context.Context, arg UpsertArtistParams) (string, error)
+	// Sets the lyrics of the track, replacing the lyrics it had.
+	UpsertLyrics(ctx context.Context, arg UpsertLyricsParams) error
 }
 
 var _ Querier = (*Queries)(nil)
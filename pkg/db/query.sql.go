@@ -11,289 +11,4589 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const deleteListeningHistoryByAnonID = `-- name: DeleteListeningHistoryByAnonID :exec
-DELETE FROM listening_histories
-WHERE anon_id = $1
+const addArtistAlias = `-- name: AddArtistAlias :exec
+UPDATE artists
+SET aliases = array_append(aliases, $1::text)
+WHERE id = $2
+    AND NOT ($1::text = ANY(aliases))
 `
 
-// Delete all listening history for a given anonymous user
-func (q *Queries) DeleteListeningHistoryByAnonID(ctx context.Context, anonID pgtype.Text) error {
-	_, err := q.db.Exec(ctx, deleteListeningHistoryByAnonID, anonID)
+type AddArtistAliasParams struct {
+	Alias string
+	ID    string
+}
+
+func (q *Queries) AddArtistAlias(ctx context.Context, arg AddArtistAliasParams) error {
+	_, err := q.db.Exec(ctx, addArtistAlias, arg.Alias, arg.ID)
 	return err
 }
 
-const getAlbumByArtist = `-- name: GetAlbumByArtist :one
-SELECT a.id, a.name, a.cover, a.artist
-FROM albums a
-WHERE a.artist = $1
+const albumExists = `-- name: AlbumExists :one
+SELECT EXISTS (
+        SELECT 1
+        FROM albums
+        WHERE id = $1
+    )
 `
 
-func (q *Queries) GetAlbumByArtist(ctx context.Context, artist pgtype.Text) (Album, error) {
-	row := q.db.QueryRow(ctx, getAlbumByArtist, artist)
-	var i Album
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Cover,
-		&i.Artist,
+func (q *Queries) AlbumExists(ctx context.Context, id string) (bool, error) {
+	row := q.db.QueryRow(ctx, albumExists, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const appendShuffleSessionTracks = `-- name: AppendShuffleSessionTracks :execrows
+WITH batch AS (
+    DELETE FROM shuffle_session_order o
+    WHERE o.session_id = $1::uuid
+        AND o."rank" IN (
+            SELECT so."rank"
+            FROM shuffle_session_order so
+            WHERE so.session_id = $1::uuid
+            ORDER BY so."rank"
+            LIMIT $3::int
+        )
+    RETURNING o."rank",
+        o.track_id
+)
+INSERT INTO shuffle_session_tracks (session_id, "position", track_id, cycle)
+SELECT $1::uuid,
+    COALESCE(
+        (
+            SELECT MAX(st."position")
+            FROM shuffle_session_tracks st
+            WHERE st.session_id = $1::uuid
+        ),
+        -1
+    ) + row_number() OVER (
+        ORDER BY batch."rank"
+    ),
+    batch.track_id,
+    $2::int4
+FROM batch
+`
+
+type AppendShuffleSessionTracksParams struct {
+	SessionID string
+	Cycle     int32
+	BatchSize int32
+}
+
+// Moves the next batch of the order of the current cycle to the queue of the session, see OrderShuffleSessionCycle.
+// the batch is read from the primary key of the order, no rows are appended once the order is used up.
+func (q *Queries) AppendShuffleSessionTracks(ctx context.Context, arg AppendShuffleSessionTracksParams) (int64, error) {
+	result, err := q.db.Exec(ctx, appendShuffleSessionTracks, arg.SessionID, arg.Cycle, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const appendStationSchedule = `-- name: AppendStationSchedule :execrows
+WITH last AS (
+    SELECT COALESCE(MAX("position"), -1)::int8 AS "position",
+        GREATEST(COALESCE(MAX(ends_at), now()), now()) AS ends_at
+    FROM station_schedule
+    WHERE station_id = $1::uuid
+),
+schedulable AS NOT MATERIALIZED (
+    SELECT t.id,
+        t.random_key,
+        t.total_duration::float8 AS duration,
+        ps.complete_count,
+        ps.skip_count
+    FROM filtered_tracks(
+            $2::numeric,
+            $3::numeric,
+            $4::text[],
+            $5::text[],
+            $6::numeric,
+            $7::numeric,
+            $8::bool,
+            $9::int,
+            $10::int,
+            $11::text[]::uuid[],
+            $12::text[]::uuid[],
+            $13::text[],
+            $14::text[]::uuid[]
+        ) t
+        LEFT JOIN track_play_stats ps ON ps.track_id = t.id
+    WHERE t.total_duration > 0
+        AND NOT EXISTS (
+            SELECT 1
+            FROM station_schedule ss
+            WHERE ss.station_id = $1::uuid
+                AND ss."position" > (
+                    SELECT "position"
+                    FROM last
+                ) - $15::int8
+                AND ss.track_id = t.id
+        )
+),
+slots AS (
+    SELECT s.slot,
+        RANDOM() AS "start"
+    FROM generate_series(1, $16::int) AS s(slot)
+),
+picks AS (
+    SELECT DISTINCT ON (p.id) s.slot,
+        p.id,
+        p.duration
+    FROM slots s
+        CROSS JOIN LATERAL (
+            SELECT c.id,
+                c.duration
+            FROM (
+                    (
+                        SELECT id, random_key, duration, complete_count, skip_count
+                        FROM schedulable
+                        WHERE random_key >= s."start"
+                        ORDER BY random_key
+                        LIMIT $17::int
+                    )
+                    UNION ALL
+                    (
+                        SELECT id, random_key, duration, complete_count, skip_count
+                        FROM schedulable
+                        WHERE random_key < s."start"
+                        ORDER BY random_key
+                        LIMIT $17::int
+                    )
+                    LIMIT $17::int
+                ) c
+            -- weighted random sampling, see GetRandomTrack
+            ORDER BY power(
+                    RANDOM(),
+                    1 / play_weight(c.complete_count, c.skip_count)
+                ) DESC
+            LIMIT 1
+        ) p
+    ORDER BY p.id,
+        s.slot
+),
+picked AS (
+    SELECT id,
+        duration,
+        row_number() OVER (
+            ORDER BY slot
+        ) AS n
+    FROM picks
+)
+INSERT INTO station_schedule (station_id, "position", track_id, starts_at, ends_at)
+SELECT $1::uuid,
+    last."position" + p.n,
+    p.id,
+    last.ends_at + make_interval(secs => SUM(p.duration) OVER (ORDER BY p.n) - p.duration),
+    last.ends_at + make_interval(secs => SUM(p.duration) OVER (ORDER BY p.n))
+FROM picked p
+    CROSS JOIN last
+`
+
+type AppendStationScheduleParams struct {
+	StationID        string
+	MinTempo         pgtype.Numeric
+	MaxTempo         pgtype.Numeric
+	Keys             []string
+	Genres           []string
+	MinDuration      pgtype.Numeric
+	MaxDuration      pgtype.Numeric
+	InstrumentalOnly bool
+	MinYear          pgtype.Int4
+	MaxYear          pgtype.Int4
+	ExcludeTrackIds  []string
+	ExcludeAlbumIds  []string
+	ExcludeGenres    []string
+	ExcludeArtistIds []string
+	RecentTracks     int64
+	BatchSize        int32
+	Candidates       int32
+}
+
+// Schedules the next batch of tracks matching the filters after the last scheduled track, or from now on if the
+// schedule ran out, see filtered_tracks for the filters. every slot of the batch is picked like GetRandomTrack
+// among the candidates following its own random start in random_key order, wrapping around to the start of the
+// key range, so that the index is walked instead of sorting the catalogue. a track picked for two slots is
+// scheduled once, the batch can be shorter than batch_size.
+// tracks among the last recent_tracks scheduled tracks of the station are not scheduled again.
+func (q *Queries) AppendStationSchedule(ctx context.Context, arg AppendStationScheduleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, appendStationSchedule,
+		arg.StationID,
+		arg.MinTempo,
+		arg.MaxTempo,
+		arg.Keys,
+		arg.Genres,
+		arg.MinDuration,
+		arg.MaxDuration,
+		arg.InstrumentalOnly,
+		arg.MinYear,
+		arg.MaxYear,
+		arg.ExcludeTrackIds,
+		arg.ExcludeAlbumIds,
+		arg.ExcludeGenres,
+		arg.ExcludeArtistIds,
+		arg.RecentTracks,
+		arg.BatchSize,
+		arg.Candidates,
 	)
-	return i, err
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-const getAlbumById = `-- name: GetAlbumById :one
-SELECT a.id, a.name, a.cover, a.artist
-FROM albums a
-WHERE a.id = $1
+const artistExists = `-- name: ArtistExists :one
+SELECT EXISTS (
+        SELECT 1
+        FROM artists
+        WHERE id = $1
+    )
 `
 
-func (q *Queries) GetAlbumById(ctx context.Context, id string) (Album, error) {
-	row := q.db.QueryRow(ctx, getAlbumById, id)
-	var i Album
+func (q *Queries) ArtistExists(ctx context.Context, id string) (bool, error) {
+	row := q.db.QueryRow(ctx, artistExists, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const autocompleteSearch = `-- name: AutocompleteSearch :many
+SELECT s.kind::text AS kind,
+    s.id::uuid AS id,
+    s.label::text AS label
+FROM (
+        (
+            SELECT 'track' AS kind,
+                t.id,
+                t.info->>'Title' AS label,
+                ts_rank(
+                    t.search_vector,
+                    to_tsquery('simple', $1)
+                ) AS rank
+            FROM tracks t
+            WHERE t.search_vector @@ to_tsquery('simple', $1)
+            ORDER BY rank DESC
+            LIMIT $2
+        )
+        UNION ALL
+        (
+            SELECT 'album' AS kind,
+                a.id,
+                a."name" AS label,
+                ts_rank(
+                    a.search_vector,
+                    to_tsquery('simple', $1)
+                ) AS rank
+            FROM albums a
+            WHERE a.search_vector @@ to_tsquery('simple', $1)
+            ORDER BY rank DESC
+            LIMIT $2
+        )
+        UNION ALL
+        (
+            SELECT 'artist' AS kind,
+                ar.id,
+                ar."name" AS label,
+                ts_rank(
+                    ar.search_vector,
+                    to_tsquery('simple', $1)
+                ) AS rank
+            FROM artists ar
+            WHERE ar.search_vector @@ to_tsquery('simple', $1)
+            ORDER BY rank DESC
+            LIMIT $2
+        )
+    ) s
+ORDER BY s.rank DESC
+LIMIT $2
+`
+
+type AutocompleteSearchParams struct {
+	PrefixQuery string
+	ResultLimit int32
+}
+
+type AutocompleteSearchRow struct {
+	Kind  string
+	ID    string
+	Label string
+}
+
+// Suggests track titles, album names and artist names starting with the typed words, see SearchTracks for the arguments
+func (q *Queries) AutocompleteSearch(ctx context.Context, arg AutocompleteSearchParams) ([]AutocompleteSearchRow, error) {
+	rows, err := q.db.Query(ctx, autocompleteSearch, arg.PrefixQuery, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AutocompleteSearchRow
+	for rows.Next() {
+		var i AutocompleteSearchRow
+		if err := rows.Scan(&i.Kind, &i.ID, &i.Label); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimIngestJob = `-- name: ClaimIngestJob :one
+UPDATE ingest_jobs j
+SET status = 'running',
+    stage = 'claimed',
+    attempts = j.attempts + 1,
+    locked_by = $1::text,
+    lease_expires_at = now() + make_interval(secs => $2::float8),
+    started_at = now(),
+    finished_at = NULL,
+    updated_at = now()
+FROM (
+        SELECT id
+        FROM ingest_jobs
+        WHERE status = 'queued'
+            AND run_after <= now()
+        ORDER BY run_after,
+            created_at
+        LIMIT 1 FOR
+        UPDATE SKIP LOCKED
+    ) next
+WHERE j.id = next.id
+RETURNING j.id, j.status, j.stage, j.audio_key, j.audio_filename, j.cover_key, j.instrumental, j.user_id, j.attempts, j.max_attempts, j.run_after, j.locked_by, j.lease_expires_at, j.error, j.track_id, j.created_at, j.updated_at, j.started_at, j.finished_at, j.lyrics_key
+`
+
+type ClaimIngestJobParams struct {
+	Worker       string
+	LeaseSeconds float64
+}
+
+// Claims the oldest queued job that is due, concurrent workers skip the jobs other workers are claiming.
+func (q *Queries) ClaimIngestJob(ctx context.Context, arg ClaimIngestJobParams) (IngestJob, error) {
+	row := q.db.QueryRow(ctx, claimIngestJob, arg.Worker, arg.LeaseSeconds)
+	var i IngestJob
 	err := row.Scan(
 		&i.ID,
-		&i.Name,
-		&i.Cover,
-		&i.Artist,
+		&i.Status,
+		&i.Stage,
+		&i.AudioKey,
+		&i.AudioFilename,
+		&i.CoverKey,
+		&i.Instrumental,
+		&i.UserID,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAfter,
+		&i.LockedBy,
+		&i.LeaseExpiresAt,
+		&i.Error,
+		&i.TrackID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.LyricsKey,
 	)
 	return i, err
 }
 
-const getAlbumByName = `-- name: GetAlbumByName :one
-SELECT a.id, a.name, a.cover, a.artist
-FROM albums a
-WHERE a.name = $1
+const completeIngestJob = `-- name: CompleteIngestJob :execrows
+UPDATE ingest_jobs
+SET status = 'succeeded',
+    stage = 'done',
+    track_id = $1::uuid,
+    error = NULL,
+    locked_by = NULL,
+    lease_expires_at = NULL,
+    finished_at = now(),
+    updated_at = now()
+WHERE id = $2
+    AND locked_by = $3::text
+    AND status = 'running'
 `
 
-func (q *Queries) GetAlbumByName(ctx context.Context, name pgtype.Text) (Album, error) {
-	row := q.db.QueryRow(ctx, getAlbumByName, name)
-	var i Album
+type CompleteIngestJobParams struct {
+	TrackID string
+	ID      string
+	Worker  string
+}
+
+func (q *Queries) CompleteIngestJob(ctx context.Context, arg CompleteIngestJobParams) (int64, error) {
+	result, err := q.db.Exec(ctx, completeIngestJob, arg.TrackID, arg.ID, arg.Worker)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countIngestJobs = `-- name: CountIngestJobs :many
+SELECT status,
+    COUNT(*) AS jobs
+FROM ingest_jobs
+GROUP BY status
+ORDER BY status
+`
+
+type CountIngestJobsRow struct {
+	Status IngestJobStatus
+	Jobs   int64
+}
+
+func (q *Queries) CountIngestJobs(ctx context.Context) ([]CountIngestJobsRow, error) {
+	rows, err := q.db.Query(ctx, countIngestJobs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountIngestJobsRow
+	for rows.Next() {
+		var i CountIngestJobsRow
+		if err := rows.Scan(&i.Status, &i.Jobs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countLibraryRows = `-- name: CountLibraryRows :one
+SELECT (
+        SELECT COUNT(*)
+        FROM albums
+        WHERE id = ANY($1::text[]::uuid[])
+    ) AS albums,
+    (
+        SELECT COUNT(*)
+        FROM artists
+        WHERE id = ANY($2::text[]::uuid[])
+    ) AS artists,
+    (
+        SELECT COUNT(*)
+        FROM tracks
+        WHERE id = ANY($3::text[]::uuid[])
+    ) AS tracks,
+    (
+        SELECT COUNT(*)
+        FROM lyrics
+        WHERE track_id = ANY($4::text[]::uuid[])
+    ) AS lyrics
+`
+
+type CountLibraryRowsParams struct {
+	AlbumIds       []string
+	ArtistIds      []string
+	TrackIds       []string
+	LyricsTrackIds []string
+}
+
+type CountLibraryRowsRow struct {
+	Albums  int64
+	Artists int64
+	Tracks  int64
+	Lyrics  int64
+}
+
+// Counts the rows of the given ids, used to verify an import.
+func (q *Queries) CountLibraryRows(ctx context.Context, arg CountLibraryRowsParams) (CountLibraryRowsRow, error) {
+	row := q.db.QueryRow(ctx, countLibraryRows,
+		arg.AlbumIds,
+		arg.ArtistIds,
+		arg.TrackIds,
+		arg.LyricsTrackIds,
+	)
+	var i CountLibraryRowsRow
 	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Cover,
-		&i.Artist,
+		&i.Albums,
+		&i.Artists,
+		&i.Tracks,
+		&i.Lyrics,
 	)
 	return i, err
 }
 
-const getAlbumByNameAndArtist = `-- name: GetAlbumByNameAndArtist :one
-SELECT a.id, a.name, a.cover, a.artist
-FROM albums a
-WHERE a.name = $1
-    AND a.artist = $2
+const countPlaylistItems = `-- name: CountPlaylistItems :one
+SELECT COUNT(*)
+FROM playlist_items
+WHERE playlist_id = $1
 `
 
-type GetAlbumByNameAndArtistParams struct {
-	Name   pgtype.Text
-	Artist pgtype.Text
+func (q *Queries) CountPlaylistItems(ctx context.Context, playlistID string) (int64, error) {
+	row := q.db.QueryRow(ctx, countPlaylistItems, playlistID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
 }
 
-func (q *Queries) GetAlbumByNameAndArtist(ctx context.Context, arg GetAlbumByNameAndArtistParams) (Album, error) {
-	row := q.db.QueryRow(ctx, getAlbumByNameAndArtist, arg.Name, arg.Artist)
-	var i Album
+const countShuffleSessionTracks = `-- name: CountShuffleSessionTracks :one
+SELECT COUNT(*)
+FROM shuffle_session_tracks
+WHERE session_id = $1
+`
+
+func (q *Queries) CountShuffleSessionTracks(ctx context.Context, sessionID string) (int64, error) {
+	row := q.db.QueryRow(ctx, countShuffleSessionTracks, sessionID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAPIToken = `-- name: CreateAPIToken :one
+INSERT INTO public.api_tokens (user_id, token_hash, "name", expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, token_hash, name, created_at, expires_at, last_used_at
+`
+
+type CreateAPITokenParams struct {
+	UserID    string
+	TokenHash []byte
+	Name      pgtype.Text
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateAPIToken(ctx context.Context, arg CreateAPITokenParams) (ApiToken, error) {
+	row := q.db.QueryRow(ctx, createAPIToken,
+		arg.UserID,
+		arg.TokenHash,
+		arg.Name,
+		arg.ExpiresAt,
+	)
+	var i ApiToken
 	err := row.Scan(
 		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
 		&i.Name,
-		&i.Cover,
-		&i.Artist,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
-const getAlbumCoverByID = `-- name: GetAlbumCoverByID :one
-SELECT a.cover
-FROM albums a
-WHERE a.id = $1
+const createIngestJob = `-- name: CreateIngestJob :one
+INSERT INTO public.ingest_jobs (
+        id,
+        audio_key,
+        audio_filename,
+        cover_key,
+        instrumental,
+        user_id,
+        lyrics_key
+    )
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, status, stage, audio_key, audio_filename, cover_key, instrumental, user_id, attempts, max_attempts, run_after, locked_by, lease_expires_at, error, track_id, created_at, updated_at, started_at, finished_at, lyrics_key
 `
 
-// Get album cover by the album ID
-func (q *Queries) GetAlbumCoverByID(ctx context.Context, id string) (pgtype.Text, error) {
-	row := q.db.QueryRow(ctx, getAlbumCoverByID, id)
-	var cover pgtype.Text
-	err := row.Scan(&cover)
-	return cover, err
+type CreateIngestJobParams struct {
+	ID            string
+	AudioKey      string
+	AudioFilename string
+	CoverKey      pgtype.Text
+	Instrumental  bool
+	UserID        pgtype.Text
+	LyricsKey     pgtype.Text
 }
 
-const getAlbumIDByName = `-- name: GetAlbumIDByName :one
-SELECT a.id
-FROM albums a
-WHERE a.name = $1
-`
-
-func (q *Queries) GetAlbumIDByName(ctx context.Context, name pgtype.Text) (string, error) {
-	row := q.db.QueryRow(ctx, getAlbumIDByName, name)
-	var id string
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) CreateIngestJob(ctx context.Context, arg CreateIngestJobParams) (IngestJob, error) {
+	row := q.db.QueryRow(ctx, createIngestJob,
+		arg.ID,
+		arg.AudioKey,
+		arg.AudioFilename,
+		arg.CoverKey,
+		arg.Instrumental,
+		arg.UserID,
+		arg.LyricsKey,
+	)
+	var i IngestJob
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.Stage,
+		&i.AudioKey,
+		&i.AudioFilename,
+		&i.CoverKey,
+		&i.Instrumental,
+		&i.UserID,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAfter,
+		&i.LockedBy,
+		&i.LeaseExpiresAt,
+		&i.Error,
+		&i.TrackID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.LyricsKey,
+	)
+	return i, err
 }
 
-const getAlbumIDByNameAndArtist = `-- name: GetAlbumIDByNameAndArtist :one
-SELECT a.id
-FROM albums a
-WHERE a.name = $1
-    AND a.artist = $2
+const createPlaylist = `-- name: CreatePlaylist :one
+INSERT INTO public.playlists ("name", description, anon_id, user_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, name, description, anon_id, created_at, updated_at, user_id
 `
 
-type GetAlbumIDByNameAndArtistParams struct {
-	Name   pgtype.Text
-	Artist pgtype.Text
+type CreatePlaylistParams struct {
+	Name        string
+	Description pgtype.Text
+	AnonID      pgtype.Text
+	UserID      pgtype.Text
 }
 
-func (q *Queries) GetAlbumIDByNameAndArtist(ctx context.Context, arg GetAlbumIDByNameAndArtistParams) (string, error) {
-	row := q.db.QueryRow(ctx, getAlbumIDByNameAndArtist, arg.Name, arg.Artist)
-	var id string
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) CreatePlaylist(ctx context.Context, arg CreatePlaylistParams) (Playlist, error) {
+	row := q.db.QueryRow(ctx, createPlaylist,
+		arg.Name,
+		arg.Description,
+		arg.AnonID,
+		arg.UserID,
+	)
+	var i Playlist
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.AnonID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+	)
+	return i, err
 }
 
-const getRandomTrack = `-- name: GetRandomTrack :one
-SELECT t.id, t.vocal_folder_path, t.instrumental_folder_path, t.album_id, t.total_duration, t.info, t.instrumental, t.tempo, t.key, t.vocal_waveform, t.instrumental_waveform, t.album_name
-FROM tracks t
-    LEFT JOIN albums a ON a.id = t.album_id
-ORDER BY RANDOM()
-LIMIT 1
+const createShuffleSession = `-- name: CreateShuffleSession :one
+INSERT INTO shuffle_sessions (anon_id, filter, seed, user_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, anon_id, filter, seed, cycle, position, created_at, updated_at, user_id
 `
 
-// Get a completely random track
-func (q *Queries) GetRandomTrack(ctx context.Context) (Track, error) {
-	row := q.db.QueryRow(ctx, getRandomTrack)
-	var i Track
+type CreateShuffleSessionParams struct {
+	AnonID string
+	Filter []byte
+	Seed   string
+	UserID pgtype.Text
+}
+
+func (q *Queries) CreateShuffleSession(ctx context.Context, arg CreateShuffleSessionParams) (ShuffleSession, error) {
+	row := q.db.QueryRow(ctx, createShuffleSession,
+		arg.AnonID,
+		arg.Filter,
+		arg.Seed,
+		arg.UserID,
+	)
+	var i ShuffleSession
 	err := row.Scan(
 		&i.ID,
-		&i.VocalFolderPath,
-		&i.InstrumentalFolderPath,
-		&i.AlbumID,
-		&i.TotalDuration,
-		&i.Info,
-		&i.Instrumental,
-		&i.Tempo,
-		&i.Key,
-		&i.VocalWaveform,
-		&i.InstrumentalWaveform,
-		&i.AlbumName,
+		&i.AnonID,
+		&i.Filter,
+		&i.Seed,
+		&i.Cycle,
+		&i.Position,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
 	)
 	return i, err
 }
 
-const getRandomUnlistenedTrack = `-- name: GetRandomUnlistenedTrack :one
-SELECT t.id, t.vocal_folder_path, t.instrumental_folder_path, t.album_id, t.total_duration, t.info, t.instrumental, t.tempo, t.key, t.vocal_waveform, t.instrumental_waveform, t.album_name
-FROM tracks t
-    LEFT JOIN albums a ON a.id = t.album_id
-    LEFT JOIN listening_histories lh ON t.id = lh.track_id
-    AND lh.anon_id = $1
-WHERE lh.track_id IS NULL
-ORDER BY RANDOM()
-LIMIT 1
+const createStation = `-- name: CreateStation :one
+INSERT INTO public.stations ("name", filter)
+VALUES ($1, $2)
+RETURNING id, name, filter, created_at
 `
 
-// Get a random track that hasn't been listened to by the given anonymous user
-func (q *Queries) GetRandomUnlistenedTrack(ctx context.Context, anonID pgtype.Text) (Track, error) {
-	row := q.db.QueryRow(ctx, getRandomUnlistenedTrack, anonID)
-	var i Track
+type CreateStationParams struct {
+	Name   string
+	Filter []byte
+}
+
+func (q *Queries) CreateStation(ctx context.Context, arg CreateStationParams) (Station, error) {
+	row := q.db.QueryRow(ctx, createStation, arg.Name, arg.Filter)
+	var i Station
 	err := row.Scan(
 		&i.ID,
-		&i.VocalFolderPath,
-		&i.InstrumentalFolderPath,
-		&i.AlbumID,
-		&i.TotalDuration,
-		&i.Info,
-		&i.Instrumental,
-		&i.Tempo,
-		&i.Key,
-		&i.VocalWaveform,
-		&i.InstrumentalWaveform,
-		&i.AlbumName,
+		&i.Name,
+		&i.Filter,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
-const getTrackByID = `-- name: GetTrackByID :one
-SELECT t.id, t.vocal_folder_path, t.instrumental_folder_path, t.album_id, t.total_duration, t.info, t.instrumental, t.tempo, t.key, t.vocal_waveform, t.instrumental_waveform, t.album_name
-FROM tracks t
-WHERE t.id = $1
+const createUser = `-- name: CreateUser :one
+INSERT INTO public.users (username, password_hash)
+VALUES ($1, $2)
+RETURNING id, username, password_hash, created_at, updated_at
 `
 
-// Get track by ID (all columns, use GetTrackBasicByID if waveforms are not needed)
-func (q *Queries) GetTrackByID(ctx context.Context, id string) (Track, error) {
-	row := q.db.QueryRow(ctx, getTrackByID, id)
-	var i Track
+type CreateUserParams struct {
+	Username     string
+	PasswordHash string
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, createUser, arg.Username, arg.PasswordHash)
+	var i User
 	err := row.Scan(
 		&i.ID,
-		&i.VocalFolderPath,
-		&i.InstrumentalFolderPath,
-		&i.AlbumID,
-		&i.TotalDuration,
-		&i.Info,
-		&i.Instrumental,
-		&i.Tempo,
-		&i.Key,
-		&i.VocalWaveform,
-		&i.InstrumentalWaveform,
-		&i.AlbumName,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
-const getTrackCount = `-- name: GetTrackCount :one
-SELECT COUNT(*)
-FROM tracks
+const deleteAPIToken = `-- name: DeleteAPIToken :exec
+DELETE FROM api_tokens
+WHERE id = $1
 `
 
-// Gets total number of tracks
-func (q *Queries) GetTrackCount(ctx context.Context) (int64, error) {
-	row := q.db.QueryRow(ctx, getTrackCount)
-	var count int64
-	err := row.Scan(&count)
-	return count, err
+func (q *Queries) DeleteAPIToken(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, deleteAPIToken, id)
+	return err
+}
+
+const deletePlaylist = `-- name: DeletePlaylist :exec
+DELETE FROM playlists
+WHERE id = $1
+`
+
+func (q *Queries) DeletePlaylist(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, deletePlaylist, id)
+	return err
+}
+
+const deletePlaylistItem = `-- name: DeletePlaylistItem :execrows
+DELETE FROM playlist_items
+WHERE id = $1
+    AND playlist_id = $2
+`
+
+type DeletePlaylistItemParams struct {
+	ID         string
+	PlaylistID string
+}
+
+// Deletes the item, the items after it are renumbered by a trigger.
+func (q *Queries) DeletePlaylistItem(ctx context.Context, arg DeletePlaylistItemParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deletePlaylistItem, arg.ID, arg.PlaylistID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteShuffleSession = `-- name: DeleteShuffleSession :exec
+DELETE FROM shuffle_sessions
+WHERE id = $1
+`
+
+func (q *Queries) DeleteShuffleSession(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, deleteShuffleSession, id)
+	return err
+}
+
+const deleteStation = `-- name: DeleteStation :execrows
+DELETE FROM stations
+WHERE "name" = $1
+`
+
+func (q *Queries) DeleteStation(ctx context.Context, name string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteStation, name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteTrackArtists = `-- name: DeleteTrackArtists :exec
+DELETE FROM track_artists
+WHERE track_id = $1
+`
+
+func (q *Queries) DeleteTrackArtists(ctx context.Context, trackID string) error {
+	_, err := q.db.Exec(ctx, deleteTrackArtists, trackID)
+	return err
+}
+
+const deleteUserAPITokens = `-- name: DeleteUserAPITokens :execrows
+DELETE FROM api_tokens
+WHERE user_id = $1
+`
+
+// Revokes every token of the user, passwords changes log out every client.
+func (q *Queries) DeleteUserAPITokens(ctx context.Context, userID string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserAPITokens, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const exportAlbums = `-- name: ExportAlbums :many
+SELECT id,
+    "name",
+    cover,
+    artist,
+    "year",
+    genre,
+    musicbrainz_release_id,
+    musicbrainz_release_group_id,
+    canonical_name,
+    release_date,
+    created_at
+FROM albums
+WHERE id > $1::uuid
+    AND (
+        $2::text[] IS NULL
+        OR id = ANY($2::text[]::uuid[])
+    )
+ORDER BY id
+LIMIT $3
+`
+
+type ExportAlbumsParams struct {
+	AfterID     string
+	Ids         []string
+	ResultLimit int32
+}
+
+type ExportAlbumsRow struct {
+	ID                        string
+	Name                      string
+	Cover                     pgtype.Text
+	Artist                    string
+	Year                      pgtype.Int4
+	Genre                     pgtype.Text
+	MusicbrainzReleaseID      pgtype.Text
+	MusicbrainzReleaseGroupID pgtype.Text
+	CanonicalName             pgtype.Text
+	ReleaseDate               pgtype.Text
+	CreatedAt                 pgtype.Timestamptz
+}
+
+// Lists albums in id order after the given id, derived columns are recalculated on import.
+// only the albums of the given ids if ids is not NULL, imports read back what they wrote.
+func (q *Queries) ExportAlbums(ctx context.Context, arg ExportAlbumsParams) ([]ExportAlbumsRow, error) {
+	rows, err := q.db.Query(ctx, exportAlbums, arg.AfterID, arg.Ids, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExportAlbumsRow
+	for rows.Next() {
+		var i ExportAlbumsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Cover,
+			&i.Artist,
+			&i.Year,
+			&i.Genre,
+			&i.MusicbrainzReleaseID,
+			&i.MusicbrainzReleaseGroupID,
+			&i.CanonicalName,
+			&i.ReleaseDate,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportArtists = `-- name: ExportArtists :many
+SELECT id, name, sort_name, match_name, aliases, created_at, search_vector, musicbrainz_id
+FROM artists
+WHERE id > $1::uuid
+    AND (
+        $2::text[] IS NULL
+        OR id = ANY($2::text[]::uuid[])
+    )
+ORDER BY id
+LIMIT $3
+`
+
+type ExportArtistsParams struct {
+	AfterID     string
+	Ids         []string
+	ResultLimit int32
+}
+
+// Lists artists like ExportAlbums.
+func (q *Queries) ExportArtists(ctx context.Context, arg ExportArtistsParams) ([]Artist, error) {
+	rows, err := q.db.Query(ctx, exportArtists, arg.AfterID, arg.Ids, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Artist
+	for rows.Next() {
+		var i Artist
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.SortName,
+			&i.MatchName,
+			&i.Aliases,
+			&i.CreatedAt,
+			&i.SearchVector,
+			&i.MusicbrainzID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportListeningHistories = `-- name: ExportListeningHistories :many
+SELECT DISTINCT track_id,
+    anon_id,
+    listened_at
+FROM listening_histories
+WHERE (listened_at, track_id, anon_id) > (
+        $1::timestamptz,
+        $2::uuid,
+        $3::text
+    )
+ORDER BY listened_at,
+    track_id,
+    anon_id
+LIMIT $4
+`
+
+type ExportListeningHistoriesParams struct {
+	AfterListenedAt pgtype.Timestamptz
+	AfterTrackID    string
+	AfterAnonID     string
+	ResultLimit     int32
+}
+
+// Lists listening history oldest first after the given entry, identical entries are exported once.
+func (q *Queries) ExportListeningHistories(ctx context.Context, arg ExportListeningHistoriesParams) ([]ListeningHistory, error) {
+	rows, err := q.db.Query(ctx, exportListeningHistories,
+		arg.AfterListenedAt,
+		arg.AfterTrackID,
+		arg.AfterAnonID,
+		arg.ResultLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListeningHistory
+	for rows.Next() {
+		var i ListeningHistory
+		if err := rows.Scan(&i.TrackID, &i.AnonID, &i.ListenedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportLyrics = `-- name: ExportLyrics :many
+SELECT track_id, language, plain, synced, source, updated_at
+FROM lyrics
+WHERE track_id = ANY($1::text[]::uuid[])
+ORDER BY track_id
+`
+
+func (q *Queries) ExportLyrics(ctx context.Context, trackIds []string) ([]Lyric, error) {
+	rows, err := q.db.Query(ctx, exportLyrics, trackIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Lyric
+	for rows.Next() {
+		var i Lyric
+		if err := rows.Scan(
+			&i.TrackID,
+			&i.Language,
+			&i.Plain,
+			&i.Synced,
+			&i.Source,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportPlayEvents = `-- name: ExportPlayEvents :many
+SELECT id,
+    track_id,
+    anon_id,
+    event_type,
+    "position"::text AS "position",
+    duration::text AS duration,
+    created_at
+FROM play_events
+WHERE id > $1::int8
+ORDER BY id
+LIMIT $2
+`
+
+type ExportPlayEventsParams struct {
+	AfterID     int64
+	ResultLimit int32
+}
+
+type ExportPlayEventsRow struct {
+	ID        int64
+	TrackID   string
+	AnonID    string
+	EventType PlayEventType
+	Position  string
+	Duration  string
+	CreatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) ExportPlayEvents(ctx context.Context, arg ExportPlayEventsParams) ([]ExportPlayEventsRow, error) {
+	rows, err := q.db.Query(ctx, exportPlayEvents, arg.AfterID, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExportPlayEventsRow
+	for rows.Next() {
+		var i ExportPlayEventsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TrackID,
+			&i.AnonID,
+			&i.EventType,
+			&i.Position,
+			&i.Duration,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportTrackArtists = `-- name: ExportTrackArtists :many
+SELECT track_id, artist_id, role, position
+FROM track_artists
+WHERE track_id = ANY($1::text[]::uuid[])
+ORDER BY track_id,
+    "position",
+    "role"
+`
+
+func (q *Queries) ExportTrackArtists(ctx context.Context, trackIds []string) ([]TrackArtist, error) {
+	rows, err := q.db.Query(ctx, exportTrackArtists, trackIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TrackArtist
+	for rows.Next() {
+		var i TrackArtist
+		if err := rows.Scan(
+			&i.TrackID,
+			&i.ArtistID,
+			&i.Role,
+			&i.Position,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportTracks = `-- name: ExportTracks :many
+SELECT id,
+    album_id,
+    album_name,
+    vocal_folder_path,
+    instrumental_folder_path,
+    total_duration::text AS total_duration,
+    info,
+    instrumental,
+    tempo::text AS tempo,
+    "key",
+    vocal_waveform,
+    instrumental_waveform,
+    musicbrainz_recording_id,
+    canonical_title,
+    created_at
+FROM tracks
+WHERE id > $1::uuid
+    AND (
+        $2::text[] IS NULL
+        OR id = ANY($2::text[]::uuid[])
+    )
+ORDER BY id
+LIMIT $3
+`
+
+type ExportTracksParams struct {
+	AfterID     string
+	Ids         []string
+	ResultLimit int32
+}
+
+type ExportTracksRow struct {
+	ID                     string
+	AlbumID                string
+	AlbumName              string
+	VocalFolderPath        pgtype.Text
+	InstrumentalFolderPath string
+	TotalDuration          string
+	Info                   []byte
+	Instrumental           bool
+	Tempo                  string
+	Key                    string
+	VocalWaveform          []byte
+	InstrumentalWaveform   []byte
+	MusicbrainzRecordingID pgtype.Text
+	CanonicalTitle         pgtype.Text
+	CreatedAt              pgtype.Timestamptz
+}
+
+// Lists tracks like ExportAlbums, numeric columns as text to keep their precision.
+func (q *Queries) ExportTracks(ctx context.Context, arg ExportTracksParams) ([]ExportTracksRow, error) {
+	rows, err := q.db.Query(ctx, exportTracks, arg.AfterID, arg.Ids, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExportTracksRow
+	for rows.Next() {
+		var i ExportTracksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AlbumID,
+			&i.AlbumName,
+			&i.VocalFolderPath,
+			&i.InstrumentalFolderPath,
+			&i.TotalDuration,
+			&i.Info,
+			&i.Instrumental,
+			&i.Tempo,
+			&i.Key,
+			&i.VocalWaveform,
+			&i.InstrumentalWaveform,
+			&i.MusicbrainzRecordingID,
+			&i.CanonicalTitle,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const failIngestJob = `-- name: FailIngestJob :one
+UPDATE ingest_jobs
+SET status = CASE
+        WHEN attempts >= max_attempts THEN 'failed'::ingest_job_status
+        ELSE 'queued'::ingest_job_status
+    END,
+    run_after = now() + make_interval(secs => $1::float8),
+    error = $2::text,
+    locked_by = NULL,
+    lease_expires_at = NULL,
+    finished_at = CASE
+        WHEN attempts >= max_attempts THEN now()
+    END,
+    updated_at = now()
+WHERE id = $3
+    AND locked_by = $4::text
+    AND status = 'running'
+RETURNING status
+`
+
+type FailIngestJobParams struct {
+	BackoffSeconds float64
+	Error          string
+	ID             string
+	Worker         string
+}
+
+// Queues the job again after the backoff, or fails it for good once it ran out of attempts.
+// The stage the job failed at is kept.
+func (q *Queries) FailIngestJob(ctx context.Context, arg FailIngestJobParams) (IngestJobStatus, error) {
+	row := q.db.QueryRow(ctx, failIngestJob,
+		arg.BackoffSeconds,
+		arg.Error,
+		arg.ID,
+		arg.Worker,
+	)
+	var status IngestJobStatus
+	err := row.Scan(&status)
+	return status, err
+}
+
+const getAlbumByArtist = `-- name: GetAlbumByArtist :one
+SELECT a.id, a.name, a.cover, a.artist, a.year, a.genre, a.disc_count, a.track_count, a.total_duration, a.created_at, a.search_vector, a.musicbrainz_release_id, a.musicbrainz_release_group_id, a.canonical_name, a.release_date
+FROM albums a
+WHERE a.artist = $1
+`
+
+func (q *Queries) GetAlbumByArtist(ctx context.Context, artist string) (Album, error) {
+	row := q.db.QueryRow(ctx, getAlbumByArtist, artist)
+	var i Album
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Cover,
+		&i.Artist,
+		&i.Year,
+		&i.Genre,
+		&i.DiscCount,
+		&i.TrackCount,
+		&i.TotalDuration,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.MusicbrainzReleaseID,
+		&i.MusicbrainzReleaseGroupID,
+		&i.CanonicalName,
+		&i.ReleaseDate,
+	)
+	return i, err
+}
+
+const getAlbumById = `-- name: GetAlbumById :one
+SELECT a.id, a.name, a.cover, a.artist, a.year, a.genre, a.disc_count, a.track_count, a.total_duration, a.created_at, a.search_vector, a.musicbrainz_release_id, a.musicbrainz_release_group_id, a.canonical_name, a.release_date
+FROM albums a
+WHERE a.id = $1
+`
+
+func (q *Queries) GetAlbumById(ctx context.Context, id string) (Album, error) {
+	row := q.db.QueryRow(ctx, getAlbumById, id)
+	var i Album
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Cover,
+		&i.Artist,
+		&i.Year,
+		&i.Genre,
+		&i.DiscCount,
+		&i.TrackCount,
+		&i.TotalDuration,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.MusicbrainzReleaseID,
+		&i.MusicbrainzReleaseGroupID,
+		&i.CanonicalName,
+		&i.ReleaseDate,
+	)
+	return i, err
+}
+
+const getAlbumByName = `-- name: GetAlbumByName :one
+SELECT a.id, a.name, a.cover, a.artist, a.year, a.genre, a.disc_count, a.track_count, a.total_duration, a.created_at, a.search_vector, a.musicbrainz_release_id, a.musicbrainz_release_group_id, a.canonical_name, a.release_date
+FROM albums a
+WHERE a.name = $1
+`
+
+func (q *Queries) GetAlbumByName(ctx context.Context, name string) (Album, error) {
+	row := q.db.QueryRow(ctx, getAlbumByName, name)
+	var i Album
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Cover,
+		&i.Artist,
+		&i.Year,
+		&i.Genre,
+		&i.DiscCount,
+		&i.TrackCount,
+		&i.TotalDuration,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.MusicbrainzReleaseID,
+		&i.MusicbrainzReleaseGroupID,
+		&i.CanonicalName,
+		&i.ReleaseDate,
+	)
+	return i, err
+}
+
+const getAlbumByNameAndArtist = `-- name: GetAlbumByNameAndArtist :one
+SELECT a.id, a.name, a.cover, a.artist, a.year, a.genre, a.disc_count, a.track_count, a.total_duration, a.created_at, a.search_vector, a.musicbrainz_release_id, a.musicbrainz_release_group_id, a.canonical_name, a.release_date
+FROM albums a
+WHERE a.name = $1
+    AND a.artist = $2
+`
+
+type GetAlbumByNameAndArtistParams struct {
+	Name   string
+	Artist string
+}
+
+func (q *Queries) GetAlbumByNameAndArtist(ctx context.Context, arg GetAlbumByNameAndArtistParams) (Album, error) {
+	row := q.db.QueryRow(ctx, getAlbumByNameAndArtist, arg.Name, arg.Artist)
+	var i Album
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Cover,
+		&i.Artist,
+		&i.Year,
+		&i.Genre,
+		&i.DiscCount,
+		&i.TrackCount,
+		&i.TotalDuration,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.MusicbrainzReleaseID,
+		&i.MusicbrainzReleaseGroupID,
+		&i.CanonicalName,
+		&i.ReleaseDate,
+	)
+	return i, err
+}
+
+const getAlbumCoverByID = `-- name: GetAlbumCoverByID :one
+SELECT a.cover
+FROM albums a
+WHERE a.id = $1
+`
+
+// Get album cover by the album ID
+func (q *Queries) GetAlbumCoverByID(ctx context.Context, id string) (pgtype.Text, error) {
+	row := q.db.QueryRow(ctx, getAlbumCoverByID, id)
+	var cover pgtype.Text
+	err := row.Scan(&cover)
+	return cover, err
+}
+
+const getAlbumIDByName = `-- name: GetAlbumIDByName :one
+SELECT a.id
+FROM albums a
+WHERE a.name = $1
+`
+
+func (q *Queries) GetAlbumIDByName(ctx context.Context, name string) (string, error) {
+	row := q.db.QueryRow(ctx, getAlbumIDByName, name)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getAlbumIDByNameAndArtist = `-- name: GetAlbumIDByNameAndArtist :one
+SELECT a.id
+FROM albums a
+WHERE a.name = $1
+    AND a.artist = $2
+`
+
+type GetAlbumIDByNameAndArtistParams struct {
+	Name   string
+	Artist string
+}
+
+func (q *Queries) GetAlbumIDByNameAndArtist(ctx context.Context, arg GetAlbumIDByNameAndArtistParams) (string, error) {
+	row := q.db.QueryRow(ctx, getAlbumIDByNameAndArtist, arg.Name, arg.Artist)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getArtistByID = `-- name: GetArtistByID :one
+SELECT a.id, a.name, a.sort_name, a.match_name, a.aliases, a.created_at, a.search_vector, a.musicbrainz_id
+FROM artists a
+WHERE a.id = $1
+`
+
+func (q *Queries) GetArtistByID(ctx context.Context, id string) (Artist, error) {
+	row := q.db.QueryRow(ctx, getArtistByID, id)
+	var i Artist
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.SortName,
+		&i.MatchName,
+		&i.Aliases,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.MusicbrainzID,
+	)
+	return i, err
+}
+
+const getArtistByMatchNameOrAlias = `-- name: GetArtistByMatchNameOrAlias :one
+SELECT a.id, a.name, a.sort_name, a.match_name, a.aliases, a.created_at, a.search_vector, a.musicbrainz_id
+FROM artists a
+WHERE a.match_name = $1
+    OR $1::text = ANY(a.aliases)
+LIMIT 1
+`
+
+func (q *Queries) GetArtistByMatchNameOrAlias(ctx context.Context, matchName string) (Artist, error) {
+	row := q.db.QueryRow(ctx, getArtistByMatchNameOrAlias, matchName)
+	var i Artist
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.SortName,
+		&i.MatchName,
+		&i.Aliases,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.MusicbrainzID,
+	)
+	return i, err
+}
+
+const getArtistRolesByTrackIDs = `-- name: GetArtistRolesByTrackIDs :many
+SELECT ta.track_id,
+    ta."role"
+FROM track_artists ta
+WHERE ta.artist_id = $1
+    AND ta.track_id = ANY($2::text[]::uuid[])
+ORDER BY ta.track_id,
+    ta.position
+`
+
+type GetArtistRolesByTrackIDsParams struct {
+	ArtistID string
+	TrackIds []string
+}
+
+type GetArtistRolesByTrackIDsRow struct {
+	TrackID string
+	Role    ArtistRole
+}
+
+// Gets the roles the artist is credited with on the given tracks
+func (q *Queries) GetArtistRolesByTrackIDs(ctx context.Context, arg GetArtistRolesByTrackIDsParams) ([]GetArtistRolesByTrackIDsRow, error) {
+	rows, err := q.db.Query(ctx, getArtistRolesByTrackIDs, arg.ArtistID, arg.TrackIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetArtistRolesByTrackIDsRow
+	for rows.Next() {
+		var i GetArtistRolesByTrackIDsRow
+		if err := rows.Scan(&i.TrackID, &i.Role); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getArtistsByTrackID = `-- name: GetArtistsByTrackID :many
+SELECT a.id,
+    a."name",
+    ta."role"
+FROM track_artists ta
+    JOIN artists a ON a.id = ta.artist_id
+WHERE ta.track_id = $1
+ORDER BY ta."position",
+    ta."role"
+`
+
+type GetArtistsByTrackIDRow struct {
+	ID   string
+	Name string
+	Role ArtistRole
+}
+
+// Gets credited artists of the track in credit order
+func (q *Queries) GetArtistsByTrackID(ctx context.Context, trackID string) ([]GetArtistsByTrackIDRow, error) {
+	rows, err := q.db.Query(ctx, getArtistsByTrackID, trackID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetArtistsByTrackIDRow
+	for rows.Next() {
+		var i GetArtistsByTrackIDRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.Role); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getIngestJob = `-- name: GetIngestJob :one
+SELECT id, status, stage, audio_key, audio_filename, cover_key, instrumental, user_id, attempts, max_attempts, run_after, locked_by, lease_expires_at, error, track_id, created_at, updated_at, started_at, finished_at, lyrics_key
+FROM ingest_jobs
+WHERE id = $1
+`
+
+func (q *Queries) GetIngestJob(ctx context.Context, id string) (IngestJob, error) {
+	row := q.db.QueryRow(ctx, getIngestJob, id)
+	var i IngestJob
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.Stage,
+		&i.AudioKey,
+		&i.AudioFilename,
+		&i.CoverKey,
+		&i.Instrumental,
+		&i.UserID,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAfter,
+		&i.LockedBy,
+		&i.LeaseExpiresAt,
+		&i.Error,
+		&i.TrackID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.LyricsKey,
+	)
+	return i, err
+}
+
+const getKnownArtistMatchNames = `-- name: GetKnownArtistMatchNames :many
+SELECT m.match_name::text
+FROM unnest($1::text[]) AS m(match_name)
+WHERE EXISTS (
+        SELECT 1
+        FROM artists a
+        WHERE a.match_name = m.match_name
+            OR m.match_name = ANY(a.aliases)
+    )
+`
+
+// Gets the given match names that belong to an artist or are an alias of one
+func (q *Queries) GetKnownArtistMatchNames(ctx context.Context, matchNames []string) ([]string, error) {
+	rows, err := q.db.Query(ctx, getKnownArtistMatchNames, matchNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var m_match_name string
+		if err := rows.Scan(&m_match_name); err != nil {
+			return nil, err
+		}
+		items = append(items, m_match_name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLibraryTotals = `-- name: GetLibraryTotals :one
+SELECT COALESCE(SUM(t.total_duration), 0)::numeric AS total_duration,
+    COUNT(*) FILTER (
+        WHERE t.instrumental
+    ) AS instrumental_count,
+    (
+        SELECT COUNT(*)
+        FROM albums
+    ) AS album_count,
+    (
+        SELECT COUNT(*)
+        FROM artists
+    ) AS artist_count
+FROM tracks t
+`
+
+type GetLibraryTotalsRow struct {
+	TotalDuration     pgtype.Numeric
+	InstrumentalCount int64
+	AlbumCount        int64
+	ArtistCount       int64
+}
+
+// Sums the library, the number of tracks is counted by GetTrackCount.
+func (q *Queries) GetLibraryTotals(ctx context.Context) (GetLibraryTotalsRow, error) {
+	row := q.db.QueryRow(ctx, getLibraryTotals)
+	var i GetLibraryTotalsRow
+	err := row.Scan(
+		&i.TotalDuration,
+		&i.InstrumentalCount,
+		&i.AlbumCount,
+		&i.ArtistCount,
+	)
+	return i, err
+}
+
+const getListenerPlayTotals = `-- name: GetListenerPlayTotals :one
+SELECT COUNT(*) FILTER (
+        WHERE e.event_type = 'start'
+    ) AS plays,
+    COUNT(*) FILTER (
+        WHERE is_completed_play(e.event_type, e."position", t.total_duration)
+    ) AS completes,
+    COUNT(*) FILTER (
+        WHERE is_skipped_play(e.event_type, e."position", t.total_duration)
+    ) AS skips,
+    COALESCE(SUM(e.duration), 0)::numeric AS listened_seconds,
+    COUNT(DISTINCT e.track_id) AS track_count,
+    (
+        SELECT COUNT(*)
+        FROM listening_histories lh
+        WHERE lh.anon_id = $1
+            AND (
+                $2::timestamptz IS NULL
+                OR lh.listened_at >= $2::timestamptz
+            )
+            AND (
+                $3::timestamptz IS NULL
+                OR lh.listened_at < $3::timestamptz
+            )
+    ) AS picks
+FROM play_events e
+    JOIN tracks t ON t.id = e.track_id
+WHERE e.anon_id = $1
+    AND (
+        $2::timestamptz IS NULL
+        OR e.created_at >= $2::timestamptz
+    )
+    AND (
+        $3::timestamptz IS NULL
+        OR e.created_at < $3::timestamptz
+    )
+`
+
+type GetListenerPlayTotalsParams struct {
+	AnonID string
+	Since  pgtype.Timestamptz
+	Until  pgtype.Timestamptz
+}
+
+type GetListenerPlayTotalsRow struct {
+	Plays           int64
+	Completes       int64
+	Skips           int64
+	ListenedSeconds pgtype.Numeric
+	TrackCount      int64
+	Picks           int64
+}
+
+// Sums the play events and random picks of the anonymous listener between since and until.
+func (q *Queries) GetListenerPlayTotals(ctx context.Context, arg GetListenerPlayTotalsParams) (GetListenerPlayTotalsRow, error) {
+	row := q.db.QueryRow(ctx, getListenerPlayTotals, arg.AnonID, arg.Since, arg.Until)
+	var i GetListenerPlayTotalsRow
+	err := row.Scan(
+		&i.Plays,
+		&i.Completes,
+		&i.Skips,
+		&i.ListenedSeconds,
+		&i.TrackCount,
+		&i.Picks,
+	)
+	return i, err
+}
+
+const getListeningHistory = `-- name: GetListeningHistory :many
+SELECT lh.track_id,
+    lh.listened_at,
+    t.info,
+    a.name AS album_name,
+    t.total_duration
+FROM listening_histories lh
+    JOIN tracks t ON t.id = lh.track_id
+    JOIN albums a ON a.id = t.album_id
+WHERE lh.anon_id = $1
+    AND (
+        $2::timestamptz IS NULL
+        OR lh.listened_at >= $2::timestamptz
+    )
+    AND (
+        $3::timestamptz IS NULL
+        OR lh.listened_at < $3::timestamptz
+    )
+    AND (
+        $4::timestamptz IS NULL
+        OR (lh.listened_at, lh.track_id) < (
+            $4::timestamptz,
+            $5::uuid
+        )
+    )
+ORDER BY lh.listened_at DESC,
+    lh.track_id DESC
+LIMIT $6
+`
+
+type GetListeningHistoryParams struct {
+	AnonID          string
+	Since           pgtype.Timestamptz
+	Until           pgtype.Timestamptz
+	AfterListenedAt pgtype.Timestamptz
+	AfterTrackID    pgtype.Text
+	ResultLimit     int32
+}
+
+type GetListeningHistoryRow struct {
+	TrackID       string
+	ListenedAt    pgtype.Timestamptz
+	Info          []byte
+	AlbumName     string
+	TotalDuration pgtype.Numeric
+}
+
+// Lists the tracks handed out to the anonymous listener newest first, between since and until.
+// after_listened_at and after_track_id point to the last entry of the previous page.
+func (q *Queries) GetListeningHistory(ctx context.Context, arg GetListeningHistoryParams) ([]GetListeningHistoryRow, error) {
+	rows, err := q.db.Query(ctx, getListeningHistory,
+		arg.AnonID,
+		arg.Since,
+		arg.Until,
+		arg.AfterListenedAt,
+		arg.AfterTrackID,
+		arg.ResultLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetListeningHistoryRow
+	for rows.Next() {
+		var i GetListeningHistoryRow
+		if err := rows.Scan(
+			&i.TrackID,
+			&i.ListenedAt,
+			&i.Info,
+			&i.AlbumName,
+			&i.TotalDuration,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLyrics = `-- name: GetLyrics :one
+SELECT track_id, language, plain, synced, source, updated_at
+FROM lyrics
+WHERE track_id = $1
+`
+
+func (q *Queries) GetLyrics(ctx context.Context, trackID string) (Lyric, error) {
+	row := q.db.QueryRow(ctx, getLyrics, trackID)
+	var i Lyric
+	err := row.Scan(
+		&i.TrackID,
+		&i.Language,
+		&i.Plain,
+		&i.Synced,
+		&i.Source,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getPlaylist = `-- name: GetPlaylist :one
+SELECT id, name, description, anon_id, created_at, updated_at, user_id
+FROM playlists
+WHERE id = $1
+`
+
+func (q *Queries) GetPlaylist(ctx context.Context, id string) (Playlist, error) {
+	row := q.db.QueryRow(ctx, getPlaylist, id)
+	var i Playlist
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.AnonID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const getPlaylistItem = `-- name: GetPlaylistItem :one
+SELECT id, playlist_id, track_id, position, added_at
+FROM playlist_items
+WHERE id = $1
+    AND playlist_id = $2
+`
+
+type GetPlaylistItemParams struct {
+	ID         string
+	PlaylistID string
+}
+
+func (q *Queries) GetPlaylistItem(ctx context.Context, arg GetPlaylistItemParams) (PlaylistItem, error) {
+	row := q.db.QueryRow(ctx, getPlaylistItem, arg.ID, arg.PlaylistID)
+	var i PlaylistItem
+	err := row.Scan(
+		&i.ID,
+		&i.PlaylistID,
+		&i.TrackID,
+		&i.Position,
+		&i.AddedAt,
+	)
+	return i, err
+}
+
+const getPlaylistsByName = `-- name: GetPlaylistsByName :many
+SELECT id, name, description, anon_id, created_at, updated_at, user_id
+FROM playlists
+WHERE "name" = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetPlaylistsByName(ctx context.Context, name string) ([]Playlist, error) {
+	rows, err := q.db.Query(ctx, getPlaylistsByName, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Playlist
+	for rows.Next() {
+		var i Playlist
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.AnonID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRandomTrack = `-- name: GetRandomTrack :one
+WITH candidates AS (
+    SELECT t.id,
+        ps.complete_count,
+        ps.skip_count
+    FROM filtered_tracks(
+            $1::numeric,
+            $2::numeric,
+            $3::text[],
+            $4::text[],
+            $5::numeric,
+            $6::numeric,
+            $7::bool,
+            $8::int,
+            $9::int,
+            $10::text[]::uuid[],
+            $11::text[]::uuid[],
+            $12::text[],
+            $13::text[]::uuid[]
+        ) t
+        LEFT JOIN track_play_stats ps ON ps.track_id = t.id
+    WHERE t.random_key >= $14::float8
+    ORDER BY t.random_key
+    LIMIT $15::int
+)
+SELECT t.id, t.vocal_folder_path, t.instrumental_folder_path, t.album_id, t.total_duration, t.info, t.instrumental, t.tempo, t.key, t.vocal_waveform, t.instrumental_waveform, t.album_name, t.created_at, t.search_vector, t.random_key, t.musicbrainz_recording_id, t.canonical_title
+FROM candidates c
+    JOIN tracks t ON t.id = c.id
+ORDER BY power(
+        RANDOM(),
+        1 / play_weight(c.complete_count, c.skip_count)
+    ) DESC
+LIMIT 1
+`
+
+type GetRandomTrackParams struct {
+	MinTempo         pgtype.Numeric
+	MaxTempo         pgtype.Numeric
+	Keys             []string
+	Genres           []string
+	MinDuration      pgtype.Numeric
+	MaxDuration      pgtype.Numeric
+	InstrumentalOnly bool
+	MinYear          pgtype.Int4
+	MaxYear          pgtype.Int4
+	ExcludeTrackIds  []string
+	ExcludeAlbumIds  []string
+	ExcludeGenres    []string
+	ExcludeArtistIds []string
+	Start            float64
+	Candidates       int32
+}
+
+// Get a completely random track matching the filters, see filtered_tracks for the filters.
+// candidates are picked like GetRandomUnlistenedTrack.
+// weighted random sampling, tracks that are often completed come up more and tracks that are often skipped less
+func (q *Queries) GetRandomTrack(ctx context.Context, arg GetRandomTrackParams) (Track, error) {
+	row := q.db.QueryRow(ctx, getRandomTrack,
+		arg.MinTempo,
+		arg.MaxTempo,
+		arg.Keys,
+		arg.Genres,
+		arg.MinDuration,
+		arg.MaxDuration,
+		arg.InstrumentalOnly,
+		arg.MinYear,
+		arg.MaxYear,
+		arg.ExcludeTrackIds,
+		arg.ExcludeAlbumIds,
+		arg.ExcludeGenres,
+		arg.ExcludeArtistIds,
+		arg.Start,
+		arg.Candidates,
+	)
+	var i Track
+	err := row.Scan(
+		&i.ID,
+		&i.VocalFolderPath,
+		&i.InstrumentalFolderPath,
+		&i.AlbumID,
+		&i.TotalDuration,
+		&i.Info,
+		&i.Instrumental,
+		&i.Tempo,
+		&i.Key,
+		&i.VocalWaveform,
+		&i.InstrumentalWaveform,
+		&i.AlbumName,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.RandomKey,
+		&i.MusicbrainzRecordingID,
+		&i.CanonicalTitle,
+	)
+	return i, err
+}
+
+const getRandomUnlistenedTrack = `-- name: GetRandomUnlistenedTrack :one
+WITH candidates AS (
+    SELECT t.id,
+        ps.complete_count,
+        ps.skip_count
+    FROM filtered_tracks(
+            $1::numeric,
+            $2::numeric,
+            $3::text[],
+            $4::text[],
+            $5::numeric,
+            $6::numeric,
+            $7::bool,
+            $8::int,
+            $9::int,
+            $10::text[]::uuid[],
+            $11::text[]::uuid[],
+            $12::text[],
+            $13::text[]::uuid[]
+        ) t
+        LEFT JOIN track_play_stats ps ON ps.track_id = t.id
+    WHERE t.random_key >= $14::float8
+        AND NOT EXISTS (
+            SELECT 1
+            FROM listening_histories lh
+            WHERE lh.track_id = t.id
+                AND lh.anon_id = $15
+                AND lh.listened_at >= COALESCE(
+                    (
+                        SELECT lr.started_at
+                        FROM listener_rotations lr
+                        WHERE lr.anon_id = $15
+                    ),
+                    '-infinity'
+                )
+        )
+    ORDER BY t.random_key
+    LIMIT $16::int
+)
+SELECT t.id, t.vocal_folder_path, t.instrumental_folder_path, t.album_id, t.total_duration, t.info, t.instrumental, t.tempo, t.key, t.vocal_waveform, t.instrumental_waveform, t.album_name, t.created_at, t.search_vector, t.random_key, t.musicbrainz_recording_id, t.canonical_title
+FROM candidates c
+    JOIN tracks t ON t.id = c.id
+ORDER BY power(
+        RANDOM(),
+        1 / play_weight(c.complete_count, c.skip_count)
+    ) DESC
+LIMIT 1
+`
+
+type GetRandomUnlistenedTrackParams struct {
+	MinTempo         pgtype.Numeric
+	MaxTempo         pgtype.Numeric
+	Keys             []string
+	Genres           []string
+	MinDuration      pgtype.Numeric
+	MaxDuration      pgtype.Numeric
+	InstrumentalOnly bool
+	MinYear          pgtype.Int4
+	MaxYear          pgtype.Int4
+	ExcludeTrackIds  []string
+	ExcludeAlbumIds  []string
+	ExcludeGenres    []string
+	ExcludeArtistIds []string
+	Start            float64
+	AnonID           string
+	Candidates       int32
+}
+
+// Get a random track matching the filters that hasn't been listened to by the given anonymous user
+// since their current rotation started, see StartListenerRotation. see filtered_tracks for the filters.
+// the candidates are the tracks following the random start in random_key order, the pick is weighted among them
+// so that the index is walked instead of sorting the catalogue. no rows if no track follows start, see PickRandomTrack in random.go.
+// weighted random sampling, tracks that are often completed come up more and tracks that are often skipped less
+func (q *Queries) GetRandomUnlistenedTrack(ctx context.Context, arg GetRandomUnlistenedTrackParams) (Track, error) {
+	row := q.db.QueryRow(ctx, getRandomUnlistenedTrack,
+		arg.MinTempo,
+		arg.MaxTempo,
+		arg.Keys,
+		arg.Genres,
+		arg.MinDuration,
+		arg.MaxDuration,
+		arg.InstrumentalOnly,
+		arg.MinYear,
+		arg.MaxYear,
+		arg.ExcludeTrackIds,
+		arg.ExcludeAlbumIds,
+		arg.ExcludeGenres,
+		arg.ExcludeArtistIds,
+		arg.Start,
+		arg.AnonID,
+		arg.Candidates,
+	)
+	var i Track
+	err := row.Scan(
+		&i.ID,
+		&i.VocalFolderPath,
+		&i.InstrumentalFolderPath,
+		&i.AlbumID,
+		&i.TotalDuration,
+		&i.Info,
+		&i.Instrumental,
+		&i.Tempo,
+		&i.Key,
+		&i.VocalWaveform,
+		&i.InstrumentalWaveform,
+		&i.AlbumName,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.RandomKey,
+		&i.MusicbrainzRecordingID,
+		&i.CanonicalTitle,
+	)
+	return i, err
+}
+
+const getShuffleSession = `-- name: GetShuffleSession :one
+SELECT id, anon_id, filter, seed, cycle, position, created_at, updated_at, user_id
+FROM shuffle_sessions
+WHERE id = $1
+`
+
+func (q *Queries) GetShuffleSession(ctx context.Context, id string) (ShuffleSession, error) {
+	row := q.db.QueryRow(ctx, getShuffleSession, id)
+	var i ShuffleSession
+	err := row.Scan(
+		&i.ID,
+		&i.AnonID,
+		&i.Filter,
+		&i.Seed,
+		&i.Cycle,
+		&i.Position,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const getShuffleSessionTrackBefore = `-- name: GetShuffleSessionTrackBefore :one
+SELECT "position",
+    track_id
+FROM shuffle_session_tracks
+WHERE session_id = $1
+    AND "position" < $2
+ORDER BY "position" DESC
+LIMIT 1
+`
+
+type GetShuffleSessionTrackBeforeParams struct {
+	SessionID      string
+	BeforePosition int32
+}
+
+type GetShuffleSessionTrackBeforeRow struct {
+	Position int32
+	TrackID  string
+}
+
+// Gets the queued track before the position, positions of deleted tracks are skipped.
+func (q *Queries) GetShuffleSessionTrackBefore(ctx context.Context, arg GetShuffleSessionTrackBeforeParams) (GetShuffleSessionTrackBeforeRow, error) {
+	row := q.db.QueryRow(ctx, getShuffleSessionTrackBefore, arg.SessionID, arg.BeforePosition)
+	var i GetShuffleSessionTrackBeforeRow
+	err := row.Scan(&i.Position, &i.TrackID)
+	return i, err
+}
+
+const getStationByName = `-- name: GetStationByName :one
+SELECT id, name, filter, created_at
+FROM stations
+WHERE "name" = $1
+`
+
+func (q *Queries) GetStationByName(ctx context.Context, name string) (Station, error) {
+	row := q.db.QueryRow(ctx, getStationByName, name)
+	var i Station
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Filter,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getStationScheduleEnd = `-- name: GetStationScheduleEnd :one
+SELECT MAX(ends_at)::timestamptz AS ends_at
+FROM station_schedule
+WHERE station_id = $1
+`
+
+// Gets the end of the last scheduled track, null if nothing is scheduled.
+func (q *Queries) GetStationScheduleEnd(ctx context.Context, stationID string) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, getStationScheduleEnd, stationID)
+	var ends_at pgtype.Timestamptz
+	err := row.Scan(&ends_at)
+	return ends_at, err
+}
+
+const getTrackByID = `-- name: GetTrackByID :one
+SELECT t.id, t.vocal_folder_path, t.instrumental_folder_path, t.album_id, t.total_duration, t.info, t.instrumental, t.tempo, t.key, t.vocal_waveform, t.instrumental_waveform, t.album_name, t.created_at, t.search_vector, t.random_key, t.musicbrainz_recording_id, t.canonical_title
+FROM tracks t
+WHERE t.id = $1
+`
+
+// Get track by ID (all columns, use GetTrackBasicByID if waveforms are not needed)
+func (q *Queries) GetTrackByID(ctx context.Context, id string) (Track, error) {
+	row := q.db.QueryRow(ctx, getTrackByID, id)
+	var i Track
+	err := row.Scan(
+		&i.ID,
+		&i.VocalFolderPath,
+		&i.InstrumentalFolderPath,
+		&i.AlbumID,
+		&i.TotalDuration,
+		&i.Info,
+		&i.Instrumental,
+		&i.Tempo,
+		&i.Key,
+		&i.VocalWaveform,
+		&i.InstrumentalWaveform,
+		&i.AlbumName,
+		&i.CreatedAt,
+		&i.SearchVector,
+		&i.RandomKey,
+		&i.MusicbrainzRecordingID,
+		&i.CanonicalTitle,
+	)
+	return i, err
+}
+
+const getTrackCount = `-- name: GetTrackCount :one
+SELECT COUNT(*)
+FROM tracks
+`
+
+// Gets total number of tracks
+func (q *Queries) GetTrackCount(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, getTrackCount)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getTrackPlayStats = `-- name: GetTrackPlayStats :one
+SELECT ps.track_id, ps.play_count, ps.complete_count, ps.skip_count, ps.listened_seconds, ps.last_played_at
+FROM track_play_stats ps
+WHERE ps.track_id = $1
+`
+
+func (q *Queries) GetTrackPlayStats(ctx context.Context, trackID string) (TrackPlayStat, error) {
+	row := q.db.QueryRow(ctx, getTrackPlayStats, trackID)
+	var i TrackPlayStat
+	err := row.Scan(
+		&i.TrackID,
+		&i.PlayCount,
+		&i.CompleteCount,
+		&i.SkipCount,
+		&i.ListenedSeconds,
+		&i.LastPlayedAt,
+	)
+	return i, err
+}
+
+const getTracksByAlbumId = `-- name: GetTracksByAlbumId :many
+SELECT id,
+    album_id,
+    album_name,
+    total_duration,
+    info,
+    instrumental,
+    tempo,
+    "key",
+    created_at
+FROM tracks
+WHERE album_id = $1
+ORDER BY substring(info->>'PartOfSet' FROM '^\d+')::int NULLS FIRST,
+    substring(info->>'Track' FROM '^\d+')::int NULLS LAST,
+    info->>'Title'
+`
+
+type GetTracksByAlbumIdRow struct {
+	ID            string
+	AlbumID       string
+	AlbumName     string
+	TotalDuration pgtype.Numeric
+	Info          []byte
+	Instrumental  bool
+	Tempo         pgtype.Numeric
+	Key           string
+	CreatedAt     pgtype.Timestamptz
+}
+
+// Gets basic track information filtered by album ID, sorted by disc and track number
+func (q *Queries) GetTracksByAlbumId(ctx context.Context, albumID string) ([]GetTracksByAlbumIdRow, error) {
+	rows, err := q.db.Query(ctx, getTracksByAlbumId, albumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTracksByAlbumIdRow
+	for rows.Next() {
+		var i GetTracksByAlbumIdRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AlbumID,
+			&i.AlbumName,
+			&i.TotalDuration,
+			&i.Info,
+			&i.Instrumental,
+			&i.Tempo,
+			&i.Key,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTracksByArtist = `-- name: GetTracksByArtist :many
+SELECT id,
+    album_id,
+    album_name,
+    total_duration,
+    info,
+    instrumental,
+    tempo,
+    "key",
+    created_at
+FROM tracks
+WHERE id IN (
+        SELECT track_id
+        FROM track_artists
+        WHERE artist_id = $1
+    )
+`
+
+type GetTracksByArtistRow struct {
+	ID            string
+	AlbumID       string
+	AlbumName     string
+	TotalDuration pgtype.Numeric
+	Info          []byte
+	Instrumental  bool
+	Tempo         pgtype.Numeric
+	Key           string
+	CreatedAt     pgtype.Timestamptz
+}
+
+// Gets basic track information of the tracks the artist is credited on
+func (q *Queries) GetTracksByArtist(ctx context.Context, artistID string) ([]GetTracksByArtistRow, error) {
+	rows, err := q.db.Query(ctx, getTracksByArtist, artistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTracksByArtistRow
+	for rows.Next() {
+		var i GetTracksByArtistRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AlbumID,
+			&i.AlbumName,
+			&i.TotalDuration,
+			&i.Info,
+			&i.Instrumental,
+			&i.Tempo,
+			&i.Key,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTracksByArtistID = `-- name: GetTracksByArtistID :many
+SELECT t.id,
+    t.album_id,
+    t.album_name,
+    t.total_duration,
+    t.info,
+    t.instrumental,
+    t.tempo,
+    t."key",
+    ta."role"
+FROM track_artists ta
+    JOIN tracks t ON t.id = ta.track_id
+WHERE ta.artist_id = $1
+ORDER BY t.album_name,
+    substring(t.info->>'PartOfSet' FROM '^\d+')::int NULLS FIRST,
+    substring(t.info->>'Track' FROM '^\d+')::int NULLS LAST,
+    t.info->>'Title'
+`
+
+type GetTracksByArtistIDRow struct {
+	ID            string
+	AlbumID       string
+	AlbumName     string
+	TotalDuration pgtype.Numeric
+	Info          []byte
+	Instrumental  bool
+	Tempo         pgtype.Numeric
+	Key           string
+	Role          ArtistRole
+}
+
+// Gets basic track information of every track the artist is credited on, with the credit role
+func (q *Queries) GetTracksByArtistID(ctx context.Context, artistID string) ([]GetTracksByArtistIDRow, error) {
+	rows, err := q.db.Query(ctx, getTracksByArtistID, artistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTracksByArtistIDRow
+	for rows.Next() {
+		var i GetTracksByArtistIDRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AlbumID,
+			&i.AlbumName,
+			&i.TotalDuration,
+			&i.Info,
+			&i.Instrumental,
+			&i.Tempo,
+			&i.Key,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTracksByGenre = `-- name: GetTracksByGenre :many
+SELECT id,
+    album_id,
+    album_name,
+    total_duration,
+    info,
+    instrumental,
+    tempo,
+    "key",
+    created_at
+FROM tracks
+WHERE info->>'Genre' = $1
+`
+
+type GetTracksByGenreRow struct {
+	ID            string
+	AlbumID       string
+	AlbumName     string
+	TotalDuration pgtype.Numeric
+	Info          []byte
+	Instrumental  bool
+	Tempo         pgtype.Numeric
+	Key           string
+	CreatedAt     pgtype.Timestamptz
+}
+
+// Gets basic track information filtered by genre
+func (q *Queries) GetTracksByGenre(ctx context.Context, info []byte) ([]GetTracksByGenreRow, error) {
+	rows, err := q.db.Query(ctx, getTracksByGenre, info)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTracksByGenreRow
+	for rows.Next() {
+		var i GetTracksByGenreRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AlbumID,
+			&i.AlbumName,
+			&i.TotalDuration,
+			&i.Info,
+			&i.Instrumental,
+			&i.Tempo,
+			&i.Key,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTracksWithoutArtists = `-- name: GetTracksWithoutArtists :many
+SELECT t.id,
+    t.info
+FROM tracks t
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM track_artists ta
+        WHERE ta.track_id = t.id
+    )
+`
+
+type GetTracksWithoutArtistsRow struct {
+	ID   string
+	Info []byte
+}
+
+// Gets tracks that have no artist credits yet, used for backfilling credits of tracks ingested before artists existed
+func (q *Queries) GetTracksWithoutArtists(ctx context.Context) ([]GetTracksWithoutArtistsRow, error) {
+	rows, err := q.db.Query(ctx, getTracksWithoutArtists)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTracksWithoutArtistsRow
+	for rows.Next() {
+		var i GetTracksWithoutArtistsRow
+		if err := rows.Scan(&i.ID, &i.Info); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserByAPIToken = `-- name: GetUserByAPIToken :one
+SELECT u.id,
+    u.username,
+    t.id AS token_id,
+    t.expires_at,
+    t.last_used_at
+FROM api_tokens t
+    JOIN users u ON u.id = t.user_id
+WHERE t.token_hash = $1
+    AND (
+        t.expires_at IS NULL
+        OR t.expires_at > now()
+    )
+`
+
+type GetUserByAPITokenRow struct {
+	ID         string
+	Username   string
+	TokenID    string
+	ExpiresAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+}
+
+// Gets the user of the token unless the token expired.
+func (q *Queries) GetUserByAPIToken(ctx context.Context, tokenHash []byte) (GetUserByAPITokenRow, error) {
+	row := q.db.QueryRow(ctx, getUserByAPIToken, tokenHash)
+	var i GetUserByAPITokenRow
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.TokenID,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, username, password_hash, created_at, updated_at
+FROM users
+WHERE lower(username) = lower($1)
+`
+
+// Usernames are case insensitive.
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const importAlbum = `-- name: ImportAlbum :exec
+INSERT INTO public.albums (
+        id,
+        "name",
+        cover,
+        artist,
+        "year",
+        genre,
+        musicbrainz_release_id,
+        musicbrainz_release_group_id,
+        canonical_name,
+        release_date,
+        created_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ON CONFLICT (id) DO
+UPDATE
+SET "name" = EXCLUDED."name",
+    cover = EXCLUDED.cover,
+    artist = EXCLUDED.artist,
+    "year" = EXCLUDED."year",
+    genre = EXCLUDED.genre,
+    musicbrainz_release_id = EXCLUDED.musicbrainz_release_id,
+    musicbrainz_release_group_id = EXCLUDED.musicbrainz_release_group_id,
+    canonical_name = EXCLUDED.canonical_name,
+    release_date = EXCLUDED.release_date,
+    created_at = EXCLUDED.created_at
+`
+
+type ImportAlbumParams struct {
+	ID                        string
+	Name                      string
+	Cover                     pgtype.Text
+	Artist                    string
+	Year                      pgtype.Int4
+	Genre                     pgtype.Text
+	MusicbrainzReleaseID      pgtype.Text
+	MusicbrainzReleaseGroupID pgtype.Text
+	CanonicalName             pgtype.Text
+	ReleaseDate               pgtype.Text
+	CreatedAt                 pgtype.Timestamptz
+}
+
+// Inserts the album of an archive, or replaces the album with the same id. track count, total duration and disc
+// count are left for refresh_album_stats.
+func (q *Queries) ImportAlbum(ctx context.Context, arg ImportAlbumParams) error {
+	_, err := q.db.Exec(ctx, importAlbum,
+		arg.ID,
+		arg.Name,
+		arg.Cover,
+		arg.Artist,
+		arg.Year,
+		arg.Genre,
+		arg.MusicbrainzReleaseID,
+		arg.MusicbrainzReleaseGroupID,
+		arg.CanonicalName,
+		arg.ReleaseDate,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const importArtist = `-- name: ImportArtist :exec
+INSERT INTO public.artists (
+        id,
+        "name",
+        sort_name,
+        match_name,
+        aliases,
+        musicbrainz_id,
+        created_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO
+UPDATE
+SET "name" = EXCLUDED."name",
+    sort_name = EXCLUDED.sort_name,
+    match_name = EXCLUDED.match_name,
+    aliases = EXCLUDED.aliases,
+    musicbrainz_id = EXCLUDED.musicbrainz_id,
+    created_at = EXCLUDED.created_at
+`
+
+type ImportArtistParams struct {
+	ID            string
+	Name          string
+	SortName      string
+	MatchName     string
+	Aliases       []string
+	MusicbrainzID pgtype.Text
+	CreatedAt     pgtype.Timestamptz
+}
+
+// Inserts the artist of an archive, or replaces the artist with the same id.
+func (q *Queries) ImportArtist(ctx context.Context, arg ImportArtistParams) error {
+	_, err := q.db.Exec(ctx, importArtist,
+		arg.ID,
+		arg.Name,
+		arg.SortName,
+		arg.MatchName,
+		arg.Aliases,
+		arg.MusicbrainzID,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const importListeningHistories = `-- name: ImportListeningHistories :execrows
+INSERT INTO listening_histories (track_id, anon_id, listened_at)
+SELECT h.track_id,
+    h.anon_id,
+    h.listened_at
+FROM (
+        -- set returning functions of the same select are read in step
+        SELECT unnest($1::text[])::uuid AS track_id,
+            unnest($2::text[]) AS anon_id,
+            unnest($3::timestamptz[]) AS listened_at
+    ) h
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM listening_histories lh
+        WHERE lh.track_id = h.track_id
+            AND lh.anon_id = h.anon_id
+            AND lh.listened_at = h.listened_at
+    )
+`
+
+type ImportListeningHistoriesParams struct {
+	TrackIds    []string
+	AnonIds     []string
+	ListenedAts []pgtype.Timestamptz
+}
+
+// Inserts the entries that are not in the listening history yet, returns the number of entries inserted.
+func (q *Queries) ImportListeningHistories(ctx context.Context, arg ImportListeningHistoriesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, importListeningHistories, arg.TrackIds, arg.AnonIds, arg.ListenedAts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const importLyrics = `-- name: ImportLyrics :exec
+INSERT INTO public.lyrics (
+        track_id,
+        "language",
+        plain,
+        synced,
+        "source",
+        updated_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (track_id) DO
+UPDATE
+SET "language" = EXCLUDED."language",
+    plain = EXCLUDED.plain,
+    synced = EXCLUDED.synced,
+    "source" = EXCLUDED."source",
+    updated_at = EXCLUDED.updated_at
+`
+
+type ImportLyricsParams struct {
+	TrackID   string
+	Language  pgtype.Text
+	Plain     string
+	Synced    []byte
+	Source    string
+	UpdatedAt pgtype.Timestamptz
+}
+
+// Sets the lyrics of the track from an archive, keeping the time they were last changed.
+func (q *Queries) ImportLyrics(ctx context.Context, arg ImportLyricsParams) error {
+	_, err := q.db.Exec(ctx, importLyrics,
+		arg.TrackID,
+		arg.Language,
+		arg.Plain,
+		arg.Synced,
+		arg.Source,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const importPlayEvents = `-- name: ImportPlayEvents :execrows
+INSERT INTO play_events (
+        track_id,
+        anon_id,
+        event_type,
+        "position",
+        duration,
+        created_at
+    )
+SELECT e.track_id,
+    e.anon_id,
+    e.event_type,
+    e.position,
+    e.duration,
+    e.created_at
+FROM (
+        SELECT unnest($1::text[])::uuid AS track_id,
+            unnest($2::text[]) AS anon_id,
+            unnest($3::text[])::play_event_type AS event_type,
+            unnest($4::text[])::numeric AS "position",
+            unnest($5::text[])::numeric AS duration,
+            unnest($6::timestamptz[]) AS created_at
+    ) e
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM play_events pe
+        WHERE pe.track_id = e.track_id
+            AND pe.anon_id = e.anon_id
+            AND pe.event_type = e.event_type
+            AND pe.position = e.position
+            AND pe.created_at = e.created_at
+    )
+`
+
+type ImportPlayEventsParams struct {
+	TrackIds   []string
+	AnonIds    []string
+	EventTypes []string
+	Positions  []string
+	Durations  []string
+	CreatedAts []pgtype.Timestamptz
+}
+
+// Inserts the events that are not stored yet, events are the same if track, listener, type, position and time
+// are. returns the number of events inserted.
+func (q *Queries) ImportPlayEvents(ctx context.Context, arg ImportPlayEventsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, importPlayEvents,
+		arg.TrackIds,
+		arg.AnonIds,
+		arg.EventTypes,
+		arg.Positions,
+		arg.Durations,
+		arg.CreatedAts,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const importTrack = `-- name: ImportTrack :exec
+INSERT INTO public.tracks (
+        id,
+        album_id,
+        album_name,
+        vocal_folder_path,
+        instrumental_folder_path,
+        total_duration,
+        info,
+        instrumental,
+        tempo,
+        "key",
+        vocal_waveform,
+        instrumental_waveform,
+        musicbrainz_recording_id,
+        canonical_title,
+        created_at
+    )
+VALUES (
+        $1,
+        $2,
+        $3,
+        $4,
+        $5,
+        $14::text::numeric,
+        $6,
+        $7,
+        $15::text::numeric,
+        $8,
+        $9,
+        $10,
+        $11,
+        $12,
+        $13
+    ) ON CONFLICT (id) DO
+UPDATE
+SET album_id = EXCLUDED.album_id,
+    album_name = EXCLUDED.album_name,
+    vocal_folder_path = EXCLUDED.vocal_folder_path,
+    instrumental_folder_path = EXCLUDED.instrumental_folder_path,
+    total_duration = EXCLUDED.total_duration,
+    info = EXCLUDED.info,
+    instrumental = EXCLUDED.instrumental,
+    tempo = EXCLUDED.tempo,
+    "key" = EXCLUDED."key",
+    vocal_waveform = EXCLUDED.vocal_waveform,
+    instrumental_waveform = EXCLUDED.instrumental_waveform,
+    musicbrainz_recording_id = EXCLUDED.musicbrainz_recording_id,
+    canonical_title = EXCLUDED.canonical_title,
+    created_at = EXCLUDED.created_at
+`
+
+type ImportTrackParams struct {
+	ID                     string
+	AlbumID                string
+	AlbumName              string
+	VocalFolderPath        pgtype.Text
+	InstrumentalFolderPath string
+	Info                   []byte
+	Instrumental           bool
+	Key                    string
+	VocalWaveform          []byte
+	InstrumentalWaveform   []byte
+	MusicbrainzRecordingID pgtype.Text
+	CanonicalTitle         pgtype.Text
+	CreatedAt              pgtype.Timestamptz
+	TotalDuration          string
+	Tempo                  string
+}
+
+// Inserts the track of an archive, or replaces the track with the same id. random_key is kept for existing tracks.
+func (q *Queries) ImportTrack(ctx context.Context, arg ImportTrackParams) error {
+	_, err := q.db.Exec(ctx, importTrack,
+		arg.ID,
+		arg.AlbumID,
+		arg.AlbumName,
+		arg.VocalFolderPath,
+		arg.InstrumentalFolderPath,
+		arg.Info,
+		arg.Instrumental,
+		arg.Key,
+		arg.VocalWaveform,
+		arg.InstrumentalWaveform,
+		arg.MusicbrainzRecordingID,
+		arg.CanonicalTitle,
+		arg.CreatedAt,
+		arg.TotalDuration,
+		arg.Tempo,
+	)
+	return err
+}
+
+const insertAlbum = `-- name: InsertAlbum :one
+INSERT INTO public.albums (id, "name", cover, artist, "year", genre)
+VALUES($1, $2, $3, $4, $5, $6)
+RETURNING id
+`
+
+type InsertAlbumParams struct {
+	ID     string
+	Name   string
+	Cover  pgtype.Text
+	Artist string
+	Year   pgtype.Int4
+	Genre  pgtype.Text
+}
+
+// returns id
+func (q *Queries) InsertAlbum(ctx context.Context, arg InsertAlbumParams) (string, error) {
+	row := q.db.QueryRow(ctx, insertAlbum,
+		arg.ID,
+		arg.Name,
+		arg.Cover,
+		arg.Artist,
+		arg.Year,
+		arg.Genre,
+	)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertIngestJobEvent = `-- name: InsertIngestJobEvent :exec
+INSERT INTO public.ingest_job_events (job_id, event_type, payload)
+VALUES ($1, $2, $3)
+`
+
+type InsertIngestJobEventParams struct {
+	JobID     string
+	EventType string
+	Payload   []byte
+}
+
+func (q *Queries) InsertIngestJobEvent(ctx context.Context, arg InsertIngestJobEventParams) error {
+	_, err := q.db.Exec(ctx, insertIngestJobEvent, arg.JobID, arg.EventType, arg.Payload)
+	return err
+}
+
+const insertPlayEvent = `-- name: InsertPlayEvent :exec
+INSERT INTO play_events (
+        track_id,
+        anon_id,
+        event_type,
+        "position",
+        duration,
+        created_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type InsertPlayEventParams struct {
+	TrackID   string
+	AnonID    string
+	EventType PlayEventType
+	Position  pgtype.Numeric
+	Duration  pgtype.Numeric
+	CreatedAt pgtype.Timestamptz
+}
+
+// Inserts a single event, used when a batch is rejected to keep the valid events of the batch
+func (q *Queries) InsertPlayEvent(ctx context.Context, arg InsertPlayEventParams) error {
+	_, err := q.db.Exec(ctx, insertPlayEvent,
+		arg.TrackID,
+		arg.AnonID,
+		arg.EventType,
+		arg.Position,
+		arg.Duration,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+type InsertPlayEventsParams struct {
+	TrackID   string
+	AnonID    string
+	EventType PlayEventType
+	Position  pgtype.Numeric
+	Duration  pgtype.Numeric
+	CreatedAt pgtype.Timestamptz
+}
+
+const insertPlaylistItem = `-- name: InsertPlaylistItem :one
+WITH shifted AS (
+    UPDATE playlist_items
+    SET "position" = "position" + 1
+    WHERE playlist_id = $1
+        AND "position" >= $3
+)
+INSERT INTO playlist_items (playlist_id, track_id, "position")
+VALUES (
+        $1,
+        $2,
+        $3
+    )
+RETURNING id, playlist_id, track_id, position, added_at
+`
+
+type InsertPlaylistItemParams struct {
+	PlaylistID string
+	TrackID    string
+	Position   int32
+}
+
+// Inserts the track at the position, items at and after the position move one position down.
+// the position must be between 0 and the number of items, lock the playlist with TouchPlaylist first.
+func (q *Queries) InsertPlaylistItem(ctx context.Context, arg InsertPlaylistItemParams) (PlaylistItem, error) {
+	row := q.db.QueryRow(ctx, insertPlaylistItem, arg.PlaylistID, arg.TrackID, arg.Position)
+	var i PlaylistItem
+	err := row.Scan(
+		&i.ID,
+		&i.PlaylistID,
+		&i.TrackID,
+		&i.Position,
+		&i.AddedAt,
+	)
+	return i, err
+}
+
+const insertTrack = `-- name: InsertTrack :exec
+INSERT INTO public.tracks (
+        id,
+        vocal_folder_path,
+        instrumental_folder_path,
+        album_id,
+        total_duration,
+        info,
+        instrumental,
+        tempo,
+        "key",
+        vocal_waveform,
+        instrumental_waveform,
+        album_name,
+        musicbrainz_recording_id,
+        canonical_title
+    )
+VALUES(
+        $1,
+        $2,
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        $8,
+        $9,
+        $10,
+        $11,
+        $12,
+        $13,
+        $14
+    )
+`
+
+type InsertTrackParams struct {
+	ID                     string
+	VocalFolderPath        pgtype.Text
+	InstrumentalFolderPath string
+	AlbumID                string
+	TotalDuration          pgtype.Numeric
+	Info                   []byte
+	Instrumental           bool
+	Tempo                  pgtype.Numeric
+	Key                    string
+	VocalWaveform          []byte
+	InstrumentalWaveform   []byte
+	AlbumName              string
+	MusicbrainzRecordingID pgtype.Text
+	CanonicalTitle         pgtype.Text
+}
+
+func (q *Queries) InsertTrack(ctx context.Context, arg InsertTrackParams) error {
+	_, err := q.db.Exec(ctx, insertTrack,
+		arg.ID,
+		arg.VocalFolderPath,
+		arg.InstrumentalFolderPath,
+		arg.AlbumID,
+		arg.TotalDuration,
+		arg.Info,
+		arg.Instrumental,
+		arg.Tempo,
+		arg.Key,
+		arg.VocalWaveform,
+		arg.InstrumentalWaveform,
+		arg.AlbumName,
+		arg.MusicbrainzRecordingID,
+		arg.CanonicalTitle,
+	)
+	return err
+}
+
+const insertTrackArtist = `-- name: InsertTrackArtist :exec
+INSERT INTO public.track_artists (track_id, artist_id, "role", "position")
+VALUES($1, $2, $3, $4) ON CONFLICT DO NOTHING
+`
+
+type InsertTrackArtistParams struct {
+	TrackID  string
+	ArtistID string
+	Role     ArtistRole
+	Position int32
+}
+
+func (q *Queries) InsertTrackArtist(ctx context.Context, arg InsertTrackArtistParams) error {
+	_, err := q.db.Exec(ctx, insertTrackArtist,
+		arg.TrackID,
+		arg.ArtistID,
+		arg.Role,
+		arg.Position,
+	)
+	return err
+}
+
+const listArtists = `-- name: ListArtists :many
+SELECT a.id,
+    a."name",
+    a.sort_name,
+    a.aliases,
+    COUNT(DISTINCT ta.track_id) AS track_count
+FROM artists a
+    LEFT JOIN track_artists ta ON ta.artist_id = a.id
+GROUP BY a.id
+ORDER BY a.sort_name
+LIMIT $1 OFFSET $2
+`
+
+type ListArtistsParams struct {
+	Limit  int32
+	Offset int32
+}
+
+type ListArtistsRow struct {
+	ID         string
+	Name       string
+	SortName   string
+	Aliases    []string
+	TrackCount int64
+}
+
+// Lists artists ordered by sort name with the number of tracks they are credited on
+func (q *Queries) ListArtists(ctx context.Context, arg ListArtistsParams) ([]ListArtistsRow, error) {
+	rows, err := q.db.Query(ctx, listArtists, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListArtistsRow
+	for rows.Next() {
+		var i ListArtistsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.SortName,
+			&i.Aliases,
+			&i.TrackCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listIngestJobEvents = `-- name: ListIngestJobEvents :many
+SELECT id,
+    event_type,
+    payload
+FROM ingest_job_events
+WHERE job_id = $1
+    AND id > $2::int8
+ORDER BY id
+LIMIT $3
+`
+
+type ListIngestJobEventsParams struct {
+	JobID       string
+	AfterID     int64
+	ResultLimit int32
+}
+
+type ListIngestJobEventsRow struct {
+	ID        int64
+	EventType string
+	Payload   []byte
+}
+
+// Events of the job after the given event id, oldest first.
+func (q *Queries) ListIngestJobEvents(ctx context.Context, arg ListIngestJobEventsParams) ([]ListIngestJobEventsRow, error) {
+	rows, err := q.db.Query(ctx, listIngestJobEvents, arg.JobID, arg.AfterID, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListIngestJobEventsRow
+	for rows.Next() {
+		var i ListIngestJobEventsRow
+		if err := rows.Scan(&i.ID, &i.EventType, &i.Payload); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listIngestJobs = `-- name: ListIngestJobs :many
+SELECT id, status, stage, audio_key, audio_filename, cover_key, instrumental, user_id, attempts, max_attempts, run_after, locked_by, lease_expires_at, error, track_id, created_at, updated_at, started_at, finished_at, lyrics_key,
+    (
+        status = 'running'
+        AND lease_expires_at < now()
+    )::bool AS stuck
+FROM ingest_jobs
+WHERE $1::ingest_job_status IS NULL
+    OR status = $1::ingest_job_status
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type ListIngestJobsParams struct {
+	Status      NullIngestJobStatus
+	ResultLimit int32
+}
+
+type ListIngestJobsRow struct {
+	ID             string
+	Status         IngestJobStatus
+	Stage          string
+	AudioKey       string
+	AudioFilename  string
+	CoverKey       pgtype.Text
+	Instrumental   bool
+	UserID         pgtype.Text
+	Attempts       int32
+	MaxAttempts    int32
+	RunAfter       pgtype.Timestamptz
+	LockedBy       pgtype.Text
+	LeaseExpiresAt pgtype.Timestamptz
+	Error          pgtype.Text
+	TrackID        pgtype.Text
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	StartedAt      pgtype.Timestamptz
+	FinishedAt     pgtype.Timestamptz
+	LyricsKey      pgtype.Text
+	Stuck          bool
+}
+
+// Running jobs whose lease expired are reported as stuck until a worker recovers them.
+func (q *Queries) ListIngestJobs(ctx context.Context, arg ListIngestJobsParams) ([]ListIngestJobsRow, error) {
+	rows, err := q.db.Query(ctx, listIngestJobs, arg.Status, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListIngestJobsRow
+	for rows.Next() {
+		var i ListIngestJobsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Status,
+			&i.Stage,
+			&i.AudioKey,
+			&i.AudioFilename,
+			&i.CoverKey,
+			&i.Instrumental,
+			&i.UserID,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.RunAfter,
+			&i.LockedBy,
+			&i.LeaseExpiresAt,
+			&i.Error,
+			&i.TrackID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.LyricsKey,
+			&i.Stuck,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPlaylistItems = `-- name: ListPlaylistItems :many
+SELECT pi.id AS item_id,
+    pi."position",
+    pi.added_at,
+    t.id,
+    t.album_id,
+    t.album_name,
+    t.total_duration,
+    t.info,
+    t.instrumental,
+    t.tempo,
+    t."key",
+    t.created_at,
+    t.instrumental_folder_path,
+    t.vocal_folder_path
+FROM playlist_items pi
+    JOIN tracks t ON t.id = pi.track_id
+WHERE pi.playlist_id = $1
+ORDER BY pi."position"
+`
+
+type ListPlaylistItemsRow struct {
+	ItemID                 string
+	Position               int32
+	AddedAt                pgtype.Timestamptz
+	ID                     string
+	AlbumID                string
+	AlbumName              string
+	TotalDuration          pgtype.Numeric
+	Info                   []byte
+	Instrumental           bool
+	Tempo                  pgtype.Numeric
+	Key                    string
+	CreatedAt              pgtype.Timestamptz
+	InstrumentalFolderPath string
+	VocalFolderPath        pgtype.Text
+}
+
+// Lists the tracks of the playlist in order.
+func (q *Queries) ListPlaylistItems(ctx context.Context, playlistID string) ([]ListPlaylistItemsRow, error) {
+	rows, err := q.db.Query(ctx, listPlaylistItems, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPlaylistItemsRow
+	for rows.Next() {
+		var i ListPlaylistItemsRow
+		if err := rows.Scan(
+			&i.ItemID,
+			&i.Position,
+			&i.AddedAt,
+			&i.ID,
+			&i.AlbumID,
+			&i.AlbumName,
+			&i.TotalDuration,
+			&i.Info,
+			&i.Instrumental,
+			&i.Tempo,
+			&i.Key,
+			&i.CreatedAt,
+			&i.InstrumentalFolderPath,
+			&i.VocalFolderPath,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPlaylists = `-- name: ListPlaylists :many
+SELECT p.id, p.name, p.description, p.anon_id, p.created_at, p.updated_at, p.user_id,
+    COUNT(t.id) AS track_count,
+    COALESCE(SUM(t.total_duration), 0)::numeric AS total_duration
+FROM playlists p
+    LEFT JOIN playlist_items pi ON pi.playlist_id = p.id
+    LEFT JOIN tracks t ON t.id = pi.track_id
+WHERE (
+        $1::text IS NULL
+        OR p.anon_id = $1::text
+    )
+    AND (
+        $2::text IS NULL
+        OR p.user_id = $2::text::uuid
+    )
+GROUP BY p.id
+ORDER BY p.created_at DESC
+LIMIT $4 OFFSET $3
+`
+
+type ListPlaylistsParams struct {
+	AnonID       pgtype.Text
+	UserID       pgtype.Text
+	ResultOffset int32
+	ResultLimit  int32
+}
+
+type ListPlaylistsRow struct {
+	ID            string
+	Name          string
+	Description   pgtype.Text
+	AnonID        pgtype.Text
+	CreatedAt     pgtype.Timestamptz
+	UpdatedAt     pgtype.Timestamptz
+	UserID        pgtype.Text
+	TrackCount    int64
+	TotalDuration pgtype.Numeric
+}
+
+// Lists playlists newest first with the number and the total duration of their tracks, optionally only the playlists of the listener or of the user.
+func (q *Queries) ListPlaylists(ctx context.Context, arg ListPlaylistsParams) ([]ListPlaylistsRow, error) {
+	rows, err := q.db.Query(ctx, listPlaylists,
+		arg.AnonID,
+		arg.UserID,
+		arg.ResultOffset,
+		arg.ResultLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPlaylistsRow
+	for rows.Next() {
+		var i ListPlaylistsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.AnonID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.TrackCount,
+			&i.TotalDuration,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listShuffleSessionTracksAfter = `-- name: ListShuffleSessionTracksAfter :many
+SELECT "position",
+    track_id
+FROM shuffle_session_tracks
+WHERE session_id = $1
+    AND "position" > $2
+ORDER BY "position"
+LIMIT $3
+`
+
+type ListShuffleSessionTracksAfterParams struct {
+	SessionID     string
+	AfterPosition int32
+	ResultLimit   int32
+}
+
+type ListShuffleSessionTracksAfterRow struct {
+	Position int32
+	TrackID  string
+}
+
+// Lists the queued tracks after the position, positions of deleted tracks are skipped.
+func (q *Queries) ListShuffleSessionTracksAfter(ctx context.Context, arg ListShuffleSessionTracksAfterParams) ([]ListShuffleSessionTracksAfterRow, error) {
+	rows, err := q.db.Query(ctx, listShuffleSessionTracksAfter, arg.SessionID, arg.AfterPosition, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListShuffleSessionTracksAfterRow
+	for rows.Next() {
+		var i ListShuffleSessionTracksAfterRow
+		if err := rows.Scan(&i.Position, &i.TrackID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStationSchedule = `-- name: ListStationSchedule :many
+SELECT station_id, position, track_id, starts_at, ends_at
+FROM station_schedule
+WHERE station_id = $1
+    AND ends_at > $2::timestamptz
+ORDER BY "position"
+LIMIT $3
+`
+
+type ListStationScheduleParams struct {
+	StationID   string
+	At          pgtype.Timestamptz
+	ResultLimit int32
+}
+
+// Lists the scheduled tracks that did not end at the given time, the first one is playing unless it starts later.
+func (q *Queries) ListStationSchedule(ctx context.Context, arg ListStationScheduleParams) ([]StationSchedule, error) {
+	rows, err := q.db.Query(ctx, listStationSchedule, arg.StationID, arg.At, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StationSchedule
+	for rows.Next() {
+		var i StationSchedule
+		if err := rows.Scan(
+			&i.StationID,
+			&i.Position,
+			&i.TrackID,
+			&i.StartsAt,
+			&i.EndsAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStations = `-- name: ListStations :many
+SELECT id, name, filter, created_at
+FROM stations
+ORDER BY "name"
+`
+
+func (q *Queries) ListStations(ctx context.Context) ([]Station, error) {
+	rows, err := q.db.Query(ctx, listStations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Station
+	for rows.Next() {
+		var i Station
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Filter,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT u.id,
+    u.username,
+    u.created_at,
+    COUNT(t.id) FILTER (
+        WHERE t.expires_at IS NULL
+            OR t.expires_at > now()
+    ) AS active_tokens,
+    MAX(t.last_used_at)::timestamptz AS last_used_at
+FROM users u
+    LEFT JOIN api_tokens t ON t.user_id = u.id
+GROUP BY u.id
+ORDER BY u.username
+`
+
+type ListUsersRow struct {
+	ID           string
+	Username     string
+	CreatedAt    pgtype.Timestamptz
+	ActiveTokens int64
+	LastUsedAt   pgtype.Timestamptz
+}
+
+func (q *Queries) ListUsers(ctx context.Context) ([]ListUsersRow, error) {
+	rows, err := q.db.Query(ctx, listUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUsersRow
+	for rows.Next() {
+		var i ListUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.CreatedAt,
+			&i.ActiveTokens,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockShuffleSession = `-- name: LockShuffleSession :one
+SELECT id, anon_id, filter, seed, cycle, position, created_at, updated_at, user_id
+FROM shuffle_sessions
+WHERE id = $1 FOR
+UPDATE
+`
+
+// Locks the session until the end of the transaction, concurrent next and prev requests of the session are serialized.
+func (q *Queries) LockShuffleSession(ctx context.Context, id string) (ShuffleSession, error) {
+	row := q.db.QueryRow(ctx, lockShuffleSession, id)
+	var i ShuffleSession
+	err := row.Scan(
+		&i.ID,
+		&i.AnonID,
+		&i.Filter,
+		&i.Seed,
+		&i.Cycle,
+		&i.Position,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const lockStation = `-- name: LockStation :one
+SELECT id, name, filter, created_at
+FROM stations
+WHERE id = $1 FOR
+UPDATE
+`
+
+// Locks the station until the end of the transaction, servers extending the schedule at the same time are serialized.
+func (q *Queries) LockStation(ctx context.Context, id string) (Station, error) {
+	row := q.db.QueryRow(ctx, lockStation, id)
+	var i Station
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Filter,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const movePlaylistItem = `-- name: MovePlaylistItem :exec
+UPDATE playlist_items
+SET "position" = CASE
+        WHEN id = $1 THEN $2::int4
+        WHEN $3::int4 < $2::int4 THEN "position" - 1
+        ELSE "position" + 1
+    END
+WHERE playlist_id = $4
+    AND "position" BETWEEN LEAST($3::int4, $2::int4)
+    AND GREATEST($3::int4, $2::int4)
+`
+
+type MovePlaylistItemParams struct {
+	ID          string
+	NewPosition int32
+	OldPosition int32
+	PlaylistID  string
+}
+
+// Moves the item from its current position to the new one, items in between move by one position.
+// the new position must be less than the number of items, lock the playlist with TouchPlaylist first.
+func (q *Queries) MovePlaylistItem(ctx context.Context, arg MovePlaylistItemParams) error {
+	_, err := q.db.Exec(ctx, movePlaylistItem,
+		arg.ID,
+		arg.NewPosition,
+		arg.OldPosition,
+		arg.PlaylistID,
+	)
+	return err
+}
+
+const orderShuffleSessionCycle = `-- name: OrderShuffleSessionCycle :execrows
+INSERT INTO shuffle_session_order (session_id, "rank", track_id)
+SELECT $1::uuid,
+    row_number() OVER (
+        ORDER BY shuffled.listened,
+            shuffled.shuffle_key
+    ),
+    shuffled.id
+FROM (
+        SELECT t.id,
+            EXISTS (
+                SELECT 1
+                FROM listening_histories lh
+                WHERE lh.track_id = t.id
+                    AND lh.anon_id = $2
+                    AND lh.listened_at >= COALESCE(
+                        (
+                            SELECT lr.started_at
+                            FROM listener_rotations lr
+                            WHERE lr.anon_id = $2
+                        ),
+                        '-infinity'
+                    )
+            ) AS listened,
+            md5($3::text || ':' || $4::int4::text || ':' || t.id::text) AS shuffle_key
+        FROM filtered_tracks(
+                $5::numeric,
+                $6::numeric,
+                $7::text[],
+                $8::text[],
+                $9::numeric,
+                $10::numeric,
+                $11::bool,
+                $12::int,
+                $13::int,
+                $14::text[]::uuid[],
+                $15::text[]::uuid[],
+                $16::text[],
+                $17::text[]::uuid[]
+            ) t
+    ) shuffled
+`
+
+type OrderShuffleSessionCycleParams struct {
+	SessionID        string
+	AnonID           string
+	Seed             string
+	Cycle            int32
+	MinTempo         pgtype.Numeric
+	MaxTempo         pgtype.Numeric
+	Keys             []string
+	Genres           []string
+	MinDuration      pgtype.Numeric
+	MaxDuration      pgtype.Numeric
+	InstrumentalOnly bool
+	MinYear          pgtype.Int4
+	MaxYear          pgtype.Int4
+	ExcludeTrackIds  []string
+	ExcludeAlbumIds  []string
+	ExcludeGenres    []string
+	ExcludeArtistIds []string
+}
+
+// Shuffles the tracks matching the filters for the current cycle of the session, see filtered_tracks for the filters.
+// tracks the listener has not heard since their rotation started come first, see GetRandomUnlistenedTrack.
+// the order is derived from the seed and the cycle so that the same seed shuffles the library the same way.
+// the library is sorted once per cycle, AppendShuffleSessionTracks moves batches of the order to the queue.
+// tracks added to the library during the cycle are shuffled into the next one.
+func (q *Queries) OrderShuffleSessionCycle(ctx context.Context, arg OrderShuffleSessionCycleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, orderShuffleSessionCycle,
+		arg.SessionID,
+		arg.AnonID,
+		arg.Seed,
+		arg.Cycle,
+		arg.MinTempo,
+		arg.MaxTempo,
+		arg.Keys,
+		arg.Genres,
+		arg.MinDuration,
+		arg.MaxDuration,
+		arg.InstrumentalOnly,
+		arg.MinYear,
+		arg.MaxYear,
+		arg.ExcludeTrackIds,
+		arg.ExcludeAlbumIds,
+		arg.ExcludeGenres,
+		arg.ExcludeArtistIds,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const playTrends = `-- name: PlayTrends :many
+WITH plays AS (
+    SELECT date_trunc('day', e.created_at) AS day,
+        COUNT(*) FILTER (
+            WHERE e.event_type = 'start'
+        ) AS plays,
+        COUNT(*) FILTER (
+            WHERE is_completed_play(e.event_type, e."position", t.total_duration)
+        ) AS completes,
+        COUNT(*) FILTER (
+            WHERE is_skipped_play(e.event_type, e."position", t.total_duration)
+        ) AS skips,
+        SUM(e.duration) AS listened_seconds,
+        COUNT(DISTINCT e.anon_id) AS listeners
+    FROM play_events e
+        JOIN tracks t ON t.id = e.track_id
+    WHERE (
+            $1::timestamptz IS NULL
+            OR e.created_at >= $1::timestamptz
+        )
+        AND (
+            $2::timestamptz IS NULL
+            OR e.created_at < $2::timestamptz
+        )
+    GROUP BY 1
+),
+picks AS (
+    SELECT date_trunc('day', lh.listened_at) AS day,
+        COUNT(*) AS picks
+    FROM listening_histories lh
+    WHERE (
+            $1::timestamptz IS NULL
+            OR lh.listened_at >= $1::timestamptz
+        )
+        AND (
+            $2::timestamptz IS NULL
+            OR lh.listened_at < $2::timestamptz
+        )
+    GROUP BY 1
+)
+SELECT COALESCE(p.day, k.day)::timestamptz AS day,
+    COALESCE(p.plays, 0)::int8 AS plays,
+    COALESCE(p.completes, 0)::int8 AS completes,
+    COALESCE(p.skips, 0)::int8 AS skips,
+    COALESCE(p.listened_seconds, 0)::numeric AS listened_seconds,
+    COALESCE(p.listeners, 0)::int8 AS listeners,
+    COALESCE(k.picks, 0)::int8 AS picks
+FROM plays p
+    FULL JOIN picks k ON k.day = p.day
+ORDER BY 1
+`
+
+type PlayTrendsParams struct {
+	Since pgtype.Timestamptz
+	Until pgtype.Timestamptz
+}
+
+type PlayTrendsRow struct {
+	Day             pgtype.Timestamptz
+	Plays           int64
+	Completes       int64
+	Skips           int64
+	ListenedSeconds pgtype.Numeric
+	Listeners       int64
+	Picks           int64
+}
+
+// Counts plays, skips, listeners and picks per day between since and until, days without any activity are omitted.
+func (q *Queries) PlayTrends(ctx context.Context, arg PlayTrendsParams) ([]PlayTrendsRow, error) {
+	rows, err := q.db.Query(ctx, playTrends, arg.Since, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PlayTrendsRow
+	for rows.Next() {
+		var i PlayTrendsRow
+		if err := rows.Scan(
+			&i.Day,
+			&i.Plays,
+			&i.Completes,
+			&i.Skips,
+			&i.ListenedSeconds,
+			&i.Listeners,
+			&i.Picks,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pruneStationSchedule = `-- name: PruneStationSchedule :execrows
+DELETE FROM station_schedule
+WHERE station_id = $1
+    AND ends_at < $2
+`
+
+type PruneStationScheduleParams struct {
+	StationID string
+	EndsAt    pgtype.Timestamptz
+}
+
+// Deletes the tracks that ended before the given time.
+func (q *Queries) PruneStationSchedule(ctx context.Context, arg PruneStationScheduleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, pruneStationSchedule, arg.StationID, arg.EndsAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recordListeningHistory = `-- name: RecordListeningHistory :exec
+INSERT INTO listening_histories (track_id, anon_id, listened_at)
+VALUES ($1, $2, $3)
+`
+
+type RecordListeningHistoryParams struct {
+	TrackID    string
+	AnonID     string
+	ListenedAt pgtype.Timestamptz
+}
+
+func (q *Queries) RecordListeningHistory(ctx context.Context, arg RecordListeningHistoryParams) error {
+	_, err := q.db.Exec(ctx, recordListeningHistory, arg.TrackID, arg.AnonID, arg.ListenedAt)
+	return err
+}
+
+const recoverExpiredIngestJobs = `-- name: RecoverExpiredIngestJobs :many
+UPDATE ingest_jobs
+SET status = CASE
+        WHEN attempts >= max_attempts THEN 'failed'::ingest_job_status
+        ELSE 'queued'::ingest_job_status
+    END,
+    run_after = now(),
+    error = 'lease of worker ' || locked_by || ' expired at stage ' || stage,
+    locked_by = NULL,
+    lease_expires_at = NULL,
+    finished_at = CASE
+        WHEN attempts >= max_attempts THEN now()
+    END,
+    updated_at = now()
+WHERE status = 'running'
+    AND lease_expires_at < now()
+RETURNING id,
+    status,
+    error
+`
+
+type RecoverExpiredIngestJobsRow struct {
+	ID     string
+	Status IngestJobStatus
+	Error  pgtype.Text
+}
+
+// Jobs of workers that stopped renewing their lease are queued again, or failed if they ran out of attempts.
+func (q *Queries) RecoverExpiredIngestJobs(ctx context.Context) ([]RecoverExpiredIngestJobsRow, error) {
+	rows, err := q.db.Query(ctx, recoverExpiredIngestJobs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RecoverExpiredIngestJobsRow
+	for rows.Next() {
+		var i RecoverExpiredIngestJobsRow
+		if err := rows.Scan(&i.ID, &i.Status, &i.Error); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const refreshAlbumStats = `-- name: RefreshAlbumStats :exec
+SELECT refresh_album_stats($1::uuid)
+`
+
+// Recalculates track count, total duration, disc count, year and genre of the album from its tracks
+func (q *Queries) RefreshAlbumStats(ctx context.Context, albumID string) error {
+	_, err := q.db.Exec(ctx, refreshAlbumStats, albumID)
+	return err
+}
+
+const refreshAllAlbumStats = `-- name: RefreshAllAlbumStats :execrows
+SELECT refresh_album_stats(a.id)
+FROM albums a
+`
+
+// Recalculates derived columns of every album, returns the number of albums processed
+func (q *Queries) RefreshAllAlbumStats(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, refreshAllAlbumStats)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const releaseIngestJob = `-- name: ReleaseIngestJob :execrows
+UPDATE ingest_jobs
+SET status = 'queued',
+    stage = 'queued',
+    attempts = GREATEST(attempts - 1, 0),
+    run_after = now(),
+    locked_by = NULL,
+    lease_expires_at = NULL,
+    updated_at = now()
+WHERE id = $1
+    AND locked_by = $2::text
+    AND status = 'running'
+`
+
+type ReleaseIngestJobParams struct {
+	ID     string
+	Worker string
+}
+
+// Queues the job again without counting the attempt, for workers that are shut down while processing.
+func (q *Queries) ReleaseIngestJob(ctx context.Context, arg ReleaseIngestJobParams) (int64, error) {
+	result, err := q.db.Exec(ctx, releaseIngestJob, arg.ID, arg.Worker)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const renewIngestJobLease = `-- name: RenewIngestJobLease :execrows
+UPDATE ingest_jobs
+SET lease_expires_at = now() + make_interval(secs => $1::float8),
+    updated_at = now()
+WHERE id = $2
+    AND locked_by = $3::text
+    AND status = 'running'
+`
+
+type RenewIngestJobLeaseParams struct {
+	LeaseSeconds float64
+	ID           string
+	Worker       string
+}
+
+// Extends the lease of a running job, no rows are updated if the worker lost the job.
+func (q *Queries) RenewIngestJobLease(ctx context.Context, arg RenewIngestJobLeaseParams) (int64, error) {
+	result, err := q.db.Exec(ctx, renewIngestJobLease, arg.LeaseSeconds, arg.ID, arg.Worker)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const searchAlbums = `-- name: SearchAlbums :many
+SELECT a.id, a.name, a.cover, a.artist, a.year, a.genre, a.disc_count, a.track_count, a.total_duration, a.created_at, a.search_vector, a.musicbrainz_release_id, a.musicbrainz_release_group_id, a.canonical_name, a.release_date,
+    (
+        ts_rank(
+            a.search_vector,
+            to_tsquery('simple', $1)
+        ) + word_similarity($2, a."name")
+    )::float8 AS rank,
+    ts_headline(
+        'simple',
+        html_escape(a."name"),
+        to_tsquery('simple', $1),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS name_highlight,
+    ts_headline(
+        'simple',
+        html_escape(a.artist),
+        to_tsquery('simple', $1),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS artist_highlight
+FROM albums a
+WHERE a.search_vector @@ to_tsquery('simple', $1)
+    OR a."name" %> $2
+ORDER BY rank DESC,
+    a.id
+LIMIT $3
+`
+
+type SearchAlbumsParams struct {
+	PrefixQuery string
+	Term        string
+	ResultLimit int32
+}
+
+type SearchAlbumsRow struct {
+	ID                        string
+	Name                      string
+	Cover                     pgtype.Text
+	Artist                    string
+	Year                      pgtype.Int4
+	Genre                     pgtype.Text
+	DiscCount                 int32
+	TrackCount                int32
+	TotalDuration             pgtype.Numeric
+	CreatedAt                 pgtype.Timestamptz
+	SearchVector              interface{}
+	MusicbrainzReleaseID      pgtype.Text
+	MusicbrainzReleaseGroupID pgtype.Text
+	CanonicalName             pgtype.Text
+	ReleaseDate               pgtype.Text
+	Rank                      float64
+	NameHighlight             string
+	ArtistHighlight           string
+}
+
+// Searches albums by name, artist and genre, see SearchTracks for the arguments
+func (q *Queries) SearchAlbums(ctx context.Context, arg SearchAlbumsParams) ([]SearchAlbumsRow, error) {
+	rows, err := q.db.Query(ctx, searchAlbums, arg.PrefixQuery, arg.Term, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchAlbumsRow
+	for rows.Next() {
+		var i SearchAlbumsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Cover,
+			&i.Artist,
+			&i.Year,
+			&i.Genre,
+			&i.DiscCount,
+			&i.TrackCount,
+			&i.TotalDuration,
+			&i.CreatedAt,
+			&i.SearchVector,
+			&i.MusicbrainzReleaseID,
+			&i.MusicbrainzReleaseGroupID,
+			&i.CanonicalName,
+			&i.ReleaseDate,
+			&i.Rank,
+			&i.NameHighlight,
+			&i.ArtistHighlight,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchArtists = `-- name: SearchArtists :many
+SELECT a.id,
+    a."name",
+    a.sort_name,
+    a.aliases,
+    (
+        ts_rank(
+            a.search_vector,
+            to_tsquery('simple', $1)
+        ) + word_similarity($2, a."name")
+    )::float8 AS rank,
+    ts_headline(
+        'simple',
+        html_escape(a."name"),
+        to_tsquery('simple', $1),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS name_highlight
+FROM artists a
+WHERE a.search_vector @@ to_tsquery('simple', $1)
+    OR a."name" %> $2
+ORDER BY rank DESC,
+    a.id
+LIMIT $3
+`
+
+type SearchArtistsParams struct {
+	PrefixQuery string
+	Term        string
+	ResultLimit int32
+}
+
+type SearchArtistsRow struct {
+	ID            string
+	Name          string
+	SortName      string
+	Aliases       []string
+	Rank          float64
+	NameHighlight string
+}
+
+// Searches artists by name, see SearchTracks for the arguments
+func (q *Queries) SearchArtists(ctx context.Context, arg SearchArtistsParams) ([]SearchArtistsRow, error) {
+	rows, err := q.db.Query(ctx, searchArtists, arg.PrefixQuery, arg.Term, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchArtistsRow
+	for rows.Next() {
+		var i SearchArtistsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.SortName,
+			&i.Aliases,
+			&i.Rank,
+			&i.NameHighlight,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchTracks = `-- name: SearchTracks :many
+SELECT t.id,
+    t.album_id,
+    t.album_name,
+    t.total_duration,
+    t.info,
+    t.instrumental,
+    t.tempo,
+    t."key",
+    (
+        ts_rank(
+            t.search_vector,
+            to_tsquery('simple', $1)
+        ) + word_similarity($2, t.info->>'Title') + word_similarity($2, t.info->>'Artist') / 2
+    )::float8 AS rank,
+    ts_headline(
+        'simple',
+        html_escape(COALESCE(t.info->>'Title', '')),
+        to_tsquery('simple', $1),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS title_highlight,
+    ts_headline(
+        'simple',
+        html_escape(COALESCE(t.info->>'Artist', '')),
+        to_tsquery('simple', $1),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS artist_highlight,
+    ts_headline(
+        'simple',
+        html_escape(t.album_name),
+        to_tsquery('simple', $1),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS album_highlight
+FROM tracks t
+WHERE t.search_vector @@ to_tsquery('simple', $1)
+    OR (t.info->>'Title') %> $2
+    OR (t.info->>'Artist') %> $2
+ORDER BY rank DESC,
+    t.id
+LIMIT $3
+`
+
+type SearchTracksParams struct {
+	PrefixQuery string
+	Term        string
+	ResultLimit int32
+}
+
+type SearchTracksRow struct {
+	ID              string
+	AlbumID         string
+	AlbumName       string
+	TotalDuration   pgtype.Numeric
+	Info            []byte
+	Instrumental    bool
+	Tempo           pgtype.Numeric
+	Key             string
+	Rank            float64
+	TitleHighlight  string
+	ArtistHighlight string
+	AlbumHighlight  string
+}
+
+// Searches tracks by title, artist, album and genre, ranked by full-text match and title/artist similarity.
+// prefix_query is a to_tsquery expression where every term is a prefix ("lov:* & son:*"), term is the raw
+// search text used for typo tolerant trigram matching.
+func (q *Queries) SearchTracks(ctx context.Context, arg SearchTracksParams) ([]SearchTracksRow, error) {
+	rows, err := q.db.Query(ctx, searchTracks, arg.PrefixQuery, arg.Term, arg.ResultLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchTracksRow
+	for rows.Next() {
+		var i SearchTracksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AlbumID,
+			&i.AlbumName,
+			&i.TotalDuration,
+			&i.Info,
+			&i.Instrumental,
+			&i.Tempo,
+			&i.Key,
+			&i.Rank,
+			&i.TitleHighlight,
+			&i.ArtistHighlight,
+			&i.AlbumHighlight,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setAlbumMusicBrainz = `-- name: SetAlbumMusicBrainz :exec
+UPDATE albums
+SET musicbrainz_release_id = COALESCE(musicbrainz_release_id, $1::uuid),
+    musicbrainz_release_group_id = COALESCE(
+        musicbrainz_release_group_id,
+        $2::uuid
+    ),
+    canonical_name = COALESCE(canonical_name, $3),
+    release_date = COALESCE(release_date, $4)
+WHERE id = $5
+`
+
+type SetAlbumMusicBrainzParams struct {
+	MusicbrainzReleaseID      pgtype.Text
+	MusicbrainzReleaseGroupID pgtype.Text
+	CanonicalName             pgtype.Text
+	ReleaseDate               pgtype.Text
+	ID                        string
+}
+
+// Sets the musicbrainz release of the album, values the album already has are kept
+func (q *Queries) SetAlbumMusicBrainz(ctx context.Context, arg SetAlbumMusicBrainzParams) error {
+	_, err := q.db.Exec(ctx, setAlbumMusicBrainz,
+		arg.MusicbrainzReleaseID,
+		arg.MusicbrainzReleaseGroupID,
+		arg.CanonicalName,
+		arg.ReleaseDate,
+		arg.ID,
+	)
+	return err
+}
+
+const setArtistMusicBrainzID = `-- name: SetArtistMusicBrainzID :exec
+UPDATE artists
+SET musicbrainz_id = $1::uuid
+WHERE musicbrainz_id IS NULL
+    AND (
+        match_name = $2
+        OR $2::text = ANY(aliases)
+    )
+`
+
+type SetArtistMusicBrainzIDParams struct {
+	MusicbrainzID string
+	MatchName     string
+}
+
+// Sets the musicbrainz id of the artist with the match name or alias if it has none
+func (q *Queries) SetArtistMusicBrainzID(ctx context.Context, arg SetArtistMusicBrainzIDParams) error {
+	_, err := q.db.Exec(ctx, setArtistMusicBrainzID, arg.MusicbrainzID, arg.MatchName)
+	return err
+}
+
+const setArtistSortName = `-- name: SetArtistSortName :exec
+UPDATE artists
+SET sort_name = $2
+WHERE id = $1
+`
+
+type SetArtistSortNameParams struct {
+	ID       string
+	SortName string
+}
+
+func (q *Queries) SetArtistSortName(ctx context.Context, arg SetArtistSortNameParams) error {
+	_, err := q.db.Exec(ctx, setArtistSortName, arg.ID, arg.SortName)
+	return err
+}
+
+const setIngestJobStage = `-- name: SetIngestJobStage :execrows
+UPDATE ingest_jobs
+SET stage = $1,
+    updated_at = now()
+WHERE id = $2
+    AND locked_by = $3::text
+    AND status = 'running'
+`
+
+type SetIngestJobStageParams struct {
+	Stage  string
+	ID     string
+	Worker string
+}
+
+func (q *Queries) SetIngestJobStage(ctx context.Context, arg SetIngestJobStageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setIngestJobStage, arg.Stage, arg.ID, arg.Worker)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setShuffleSessionPosition = `-- name: SetShuffleSessionPosition :exec
+UPDATE shuffle_sessions
+SET "position" = $2,
+    updated_at = now()
+WHERE id = $1
+`
+
+type SetShuffleSessionPositionParams struct {
+	ID       string
+	Position int32
+}
+
+func (q *Queries) SetShuffleSessionPosition(ctx context.Context, arg SetShuffleSessionPositionParams) error {
+	_, err := q.db.Exec(ctx, setShuffleSessionPosition, arg.ID, arg.Position)
+	return err
+}
+
+const setUserPassword = `-- name: SetUserPassword :execrows
+UPDATE users
+SET password_hash = $2,
+    updated_at = now()
+WHERE id = $1
+`
+
+type SetUserPasswordParams struct {
+	ID           string
+	PasswordHash string
+}
+
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setUserPassword, arg.ID, arg.PasswordHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const startListenerRotation = `-- name: StartListenerRotation :exec
+INSERT INTO listener_rotations (anon_id, started_at)
+VALUES ($1, now()) ON CONFLICT (anon_id) DO
+UPDATE
+SET started_at = EXCLUDED.started_at
+`
+
+// Starts over the rotation of the anonymous user once they listened to every track, every track is unlistened again.
+// the listening history is kept for statistics.
+func (q *Queries) StartListenerRotation(ctx context.Context, anonID string) error {
+	_, err := q.db.Exec(ctx, startListenerRotation, anonID)
+	return err
+}
+
+const startShuffleSessionCycle = `-- name: StartShuffleSessionCycle :exec
+UPDATE shuffle_sessions
+SET cycle = cycle + 1,
+    updated_at = now()
+WHERE id = $1
+`
+
+// Starts over the queue with a new shuffle, tracks of the previous cycles can be queued again.
+func (q *Queries) StartShuffleSessionCycle(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, startShuffleSessionCycle, id)
+	return err
 }
 
-const getTracksByAlbumId = `-- name: GetTracksByAlbumId :many
-SELECT id,
-    vocal_folder_path,
-    instrumental_folder_path,
-    album_id,
-    total_duration,
-    info,
-    instrumental,
-    tempo,
-    "key"
-FROM tracks
-WHERE album_id = $1
-ORDER BY info->>'Track'
+const topArtists = `-- name: TopArtists :many
+WITH plays AS (
+    SELECT e.track_id,
+        COUNT(*) FILTER (
+            WHERE e.event_type = 'start'
+        ) AS plays,
+        COUNT(*) FILTER (
+            WHERE is_completed_play(e.event_type, e."position", t.total_duration)
+        ) AS completes,
+        COUNT(*) FILTER (
+            WHERE is_skipped_play(e.event_type, e."position", t.total_duration)
+        ) AS skips,
+        SUM(e.duration) AS listened_seconds
+    FROM play_events e
+        JOIN tracks t ON t.id = e.track_id
+    WHERE (
+            $2::timestamptz IS NULL
+            OR e.created_at >= $2::timestamptz
+        )
+        AND (
+            $3::timestamptz IS NULL
+            OR e.created_at < $3::timestamptz
+        )
+    GROUP BY e.track_id
+),
+picks AS (
+    SELECT lh.track_id,
+        COUNT(*) AS picks
+    FROM listening_histories lh
+    WHERE (
+            $2::timestamptz IS NULL
+            OR lh.listened_at >= $2::timestamptz
+        )
+        AND (
+            $3::timestamptz IS NULL
+            OR lh.listened_at < $3::timestamptz
+        )
+    GROUP BY lh.track_id
+),
+credits AS (
+    SELECT DISTINCT ta.track_id,
+        ta.artist_id
+    FROM track_artists ta
+)
+SELECT ar.id,
+    ar.name,
+    COUNT(DISTINCT c.track_id) AS track_count,
+    COALESCE(SUM(p.plays), 0)::int8 AS plays,
+    COALESCE(SUM(p.completes), 0)::int8 AS completes,
+    COALESCE(SUM(p.skips), 0)::int8 AS skips,
+    COALESCE(SUM(p.listened_seconds), 0)::numeric AS listened_seconds,
+    COALESCE(SUM(k.picks), 0)::int8 AS picks
+FROM plays p
+    FULL JOIN picks k ON k.track_id = p.track_id
+    JOIN credits c ON c.track_id = COALESCE(p.track_id, k.track_id)
+    JOIN artists ar ON ar.id = c.artist_id
+GROUP BY ar.id
+ORDER BY plays DESC,
+    picks DESC,
+    listened_seconds DESC,
+    ar.id
+LIMIT $1
 `
 
-type GetTracksByAlbumIdRow struct {
-	ID                     string
-	VocalFolderPath        pgtype.Text
-	InstrumentalFolderPath pgtype.Text
-	AlbumID                pgtype.Text
-	TotalDuration          pgtype.Numeric
-	Info                   []byte
-	Instrumental           pgtype.Bool
-	Tempo                  pgtype.Numeric
-	Key                    pgtype.Text
+type TopArtistsParams struct {
+	ResultLimit int32
+	Since       pgtype.Timestamptz
+	Until       pgtype.Timestamptz
 }
 
-// Gets basic track information filtered by album ID, sorted by track list
-func (q *Queries) GetTracksByAlbumId(ctx context.Context, albumID pgtype.Text) ([]GetTracksByAlbumIdRow, error) {
-	rows, err := q.db.Query(ctx, getTracksByAlbumId, albumID)
+type TopArtistsRow struct {
+	ID              string
+	Name            string
+	TrackCount      int64
+	Plays           int64
+	Completes       int64
+	Skips           int64
+	ListenedSeconds pgtype.Numeric
+	Picks           int64
+}
+
+// Ranks artists by plays of the tracks they are credited on between since and until, NULL bounds are open.
+// an artist credited with several roles on a track counts the plays of the track once.
+func (q *Queries) TopArtists(ctx context.Context, arg TopArtistsParams) ([]TopArtistsRow, error) {
+	rows, err := q.db.Query(ctx, topArtists, arg.ResultLimit, arg.Since, arg.Until)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetTracksByAlbumIdRow
+	var items []TopArtistsRow
 	for rows.Next() {
-		var i GetTracksByAlbumIdRow
+		var i TopArtistsRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.VocalFolderPath,
-			&i.InstrumentalFolderPath,
-			&i.AlbumID,
-			&i.TotalDuration,
-			&i.Info,
-			&i.Instrumental,
-			&i.Tempo,
-			&i.Key,
+			&i.Name,
+			&i.TrackCount,
+			&i.Plays,
+			&i.Completes,
+			&i.Skips,
+			&i.ListenedSeconds,
+			&i.Picks,
 		); err != nil {
 			return nil, err
 		}
@@ -305,52 +4605,108 @@ func (q *Queries) GetTracksByAlbumId(ctx context.Context, albumID pgtype.Text) (
 	return items, nil
 }
 
-const getTracksByArtist = `-- name: GetTracksByArtist :many
-SELECT id,
-    vocal_folder_path,
-    instrumental_folder_path,
-    album_id,
-    total_duration,
-    info,
-    instrumental,
-    tempo,
-    "key"
-FROM tracks
-WHERE info->>'Artist' = $1
+const topTracks = `-- name: TopTracks :many
+WITH plays AS (
+    SELECT e.track_id,
+        COUNT(*) FILTER (
+            WHERE e.event_type = 'start'
+        ) AS plays,
+        COUNT(*) FILTER (
+            WHERE is_completed_play(e.event_type, e."position", t.total_duration)
+        ) AS completes,
+        COUNT(*) FILTER (
+            WHERE is_skipped_play(e.event_type, e."position", t.total_duration)
+        ) AS skips,
+        SUM(e.duration) AS listened_seconds,
+        COUNT(DISTINCT e.anon_id) AS listeners
+    FROM play_events e
+        JOIN tracks t ON t.id = e.track_id
+    WHERE (
+            $2::timestamptz IS NULL
+            OR e.created_at >= $2::timestamptz
+        )
+        AND (
+            $3::timestamptz IS NULL
+            OR e.created_at < $3::timestamptz
+        )
+    GROUP BY e.track_id
+),
+picks AS (
+    SELECT lh.track_id,
+        COUNT(*) AS picks
+    FROM listening_histories lh
+    WHERE (
+            $2::timestamptz IS NULL
+            OR lh.listened_at >= $2::timestamptz
+        )
+        AND (
+            $3::timestamptz IS NULL
+            OR lh.listened_at < $3::timestamptz
+        )
+    GROUP BY lh.track_id
+)
+SELECT t.id,
+    t.info,
+    a.name AS album_name,
+    t.total_duration,
+    COALESCE(p.plays, 0)::int8 AS plays,
+    COALESCE(p.completes, 0)::int8 AS completes,
+    COALESCE(p.skips, 0)::int8 AS skips,
+    COALESCE(p.listened_seconds, 0)::numeric AS listened_seconds,
+    COALESCE(p.listeners, 0)::int8 AS listeners,
+    COALESCE(k.picks, 0)::int8 AS picks
+FROM plays p
+    FULL JOIN picks k ON k.track_id = p.track_id
+    JOIN tracks t ON t.id = COALESCE(p.track_id, k.track_id)
+    JOIN albums a ON a.id = t.album_id
+ORDER BY plays DESC,
+    picks DESC,
+    listened_seconds DESC,
+    t.id
+LIMIT $1
 `
 
-type GetTracksByArtistRow struct {
-	ID                     string
-	VocalFolderPath        pgtype.Text
-	InstrumentalFolderPath pgtype.Text
-	AlbumID                pgtype.Text
-	TotalDuration          pgtype.Numeric
-	Info                   []byte
-	Instrumental           pgtype.Bool
-	Tempo                  pgtype.Numeric
-	Key                    pgtype.Text
+type TopTracksParams struct {
+	ResultLimit int32
+	Since       pgtype.Timestamptz
+	Until       pgtype.Timestamptz
+}
+
+type TopTracksRow struct {
+	ID              string
+	Info            []byte
+	AlbumName       string
+	TotalDuration   pgtype.Numeric
+	Plays           int64
+	Completes       int64
+	Skips           int64
+	ListenedSeconds pgtype.Numeric
+	Listeners       int64
+	Picks           int64
 }
 
-// Gets basic track information filtered by artist
-func (q *Queries) GetTracksByArtist(ctx context.Context, info []byte) ([]GetTracksByArtistRow, error) {
-	rows, err := q.db.Query(ctx, getTracksByArtist, info)
+// Ranks tracks by plays between since and until, NULL bounds are open.
+// picks count the times the track was handed out by random selection, plays count the started playbacks.
+func (q *Queries) TopTracks(ctx context.Context, arg TopTracksParams) ([]TopTracksRow, error) {
+	rows, err := q.db.Query(ctx, topTracks, arg.ResultLimit, arg.Since, arg.Until)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetTracksByArtistRow
+	var items []TopTracksRow
 	for rows.Next() {
-		var i GetTracksByArtistRow
+		var i TopTracksRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.VocalFolderPath,
-			&i.InstrumentalFolderPath,
-			&i.AlbumID,
-			&i.TotalDuration,
 			&i.Info,
-			&i.Instrumental,
-			&i.Tempo,
-			&i.Key,
+			&i.AlbumName,
+			&i.TotalDuration,
+			&i.Plays,
+			&i.Completes,
+			&i.Skips,
+			&i.ListenedSeconds,
+			&i.Listeners,
+			&i.Picks,
 		); err != nil {
 			return nil, err
 		}
@@ -362,53 +4718,164 @@ func (q *Queries) GetTracksByArtist(ctx context.Context, info []byte) ([]GetTrac
 	return items, nil
 }
 
-const getTracksByGenre = `-- name: GetTracksByGenre :many
-SELECT id,
-    vocal_folder_path,
-    instrumental_folder_path,
-    album_id,
-    total_duration,
-    info,
-    instrumental,
-    tempo,
-    "key"
-FROM tracks
-WHERE info->>'Genre' = $1
+const touchAPIToken = `-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET last_used_at = now()
+WHERE id = $1
 `
 
-type GetTracksByGenreRow struct {
-	ID                     string
-	VocalFolderPath        pgtype.Text
-	InstrumentalFolderPath pgtype.Text
-	AlbumID                pgtype.Text
-	TotalDuration          pgtype.Numeric
-	Info                   []byte
-	Instrumental           pgtype.Bool
-	Tempo                  pgtype.Numeric
-	Key                    pgtype.Text
+func (q *Queries) TouchAPIToken(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, touchAPIToken, id)
+	return err
 }
 
-// Gets basic track information filtered by genre
-func (q *Queries) GetTracksByGenre(ctx context.Context, info []byte) ([]GetTracksByGenreRow, error) {
-	rows, err := q.db.Query(ctx, getTracksByGenre, info)
+const touchPlaylist = `-- name: TouchPlaylist :one
+UPDATE playlists
+SET updated_at = now()
+WHERE id = $1
+RETURNING id, name, description, anon_id, created_at, updated_at, user_id
+`
+
+// Locks the playlist while its items are changed and bumps updated_at.
+func (q *Queries) TouchPlaylist(ctx context.Context, id string) (Playlist, error) {
+	row := q.db.QueryRow(ctx, touchPlaylist, id)
+	var i Playlist
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.AnonID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const trackExists = `-- name: TrackExists :one
+SELECT EXISTS (
+        SELECT 1
+        FROM tracks
+        WHERE id = $1
+    )
+`
+
+func (q *Queries) TrackExists(ctx context.Context, id string) (bool, error) {
+	row := q.db.QueryRow(ctx, trackExists, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const trackFacets = `-- name: TrackFacets :many
+WITH filtered AS (
+    SELECT t.info->>'Genre' AS genre,
+        t."key",
+        t.instrumental,
+        (floor(t.tempo / 10) * 10)::int AS tempo,
+        a."year"
+    FROM filtered_tracks(
+            $1::numeric,
+            $2::numeric,
+            $3::text[],
+            $4::text[],
+            $5::numeric,
+            $6::numeric,
+            $7::bool,
+            $8::int,
+            $9::int,
+            $10::text[]::uuid[],
+            $11::text[]::uuid[],
+            $12::text[],
+            $13::text[]::uuid[]
+        ) t
+        JOIN albums a ON a.id = t.album_id
+)
+SELECT 'genre'::text AS facet,
+    genre::text AS value,
+    COUNT(*) AS count
+FROM filtered
+WHERE genre IS NOT NULL
+GROUP BY genre
+UNION ALL
+SELECT 'key',
+    "key",
+    COUNT(*)
+FROM filtered
+GROUP BY "key"
+UNION ALL
+SELECT 'instrumental',
+    instrumental::text,
+    COUNT(*)
+FROM filtered
+GROUP BY instrumental
+UNION ALL
+SELECT 'tempo',
+    tempo::text,
+    COUNT(*)
+FROM filtered
+GROUP BY tempo
+UNION ALL
+SELECT 'year',
+    "year"::text,
+    COUNT(*)
+FROM filtered
+WHERE "year" IS NOT NULL
+GROUP BY "year"
+ORDER BY facet,
+    count DESC,
+    value
+`
+
+type TrackFacetsParams struct {
+	MinTempo         pgtype.Numeric
+	MaxTempo         pgtype.Numeric
+	Keys             []string
+	Genres           []string
+	MinDuration      pgtype.Numeric
+	MaxDuration      pgtype.Numeric
+	InstrumentalOnly bool
+	MinYear          pgtype.Int4
+	MaxYear          pgtype.Int4
+	ExcludeTrackIds  []string
+	ExcludeAlbumIds  []string
+	ExcludeGenres    []string
+	ExcludeArtistIds []string
+}
+
+type TrackFacetsRow struct {
+	Facet string
+	Value string
+	Count int64
+}
+
+// Counts the tracks matching the filters by genre, key, instrumental flag, tempo (in 10 BPM buckets) and album year.
+// the filters are the arguments of the filtered_tracks function, NULL or empty filters match every track.
+// tracks with an excluded id, album, genre or credited artist never match.
+func (q *Queries) TrackFacets(ctx context.Context, arg TrackFacetsParams) ([]TrackFacetsRow, error) {
+	rows, err := q.db.Query(ctx, trackFacets,
+		arg.MinTempo,
+		arg.MaxTempo,
+		arg.Keys,
+		arg.Genres,
+		arg.MinDuration,
+		arg.MaxDuration,
+		arg.InstrumentalOnly,
+		arg.MinYear,
+		arg.MaxYear,
+		arg.ExcludeTrackIds,
+		arg.ExcludeAlbumIds,
+		arg.ExcludeGenres,
+		arg.ExcludeArtistIds,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetTracksByGenreRow
+	var items []TrackFacetsRow
 	for rows.Next() {
-		var i GetTracksByGenreRow
-		if err := rows.Scan(
-			&i.ID,
-			&i.VocalFolderPath,
-			&i.InstrumentalFolderPath,
-			&i.AlbumID,
-			&i.TotalDuration,
-			&i.Info,
-			&i.Instrumental,
-			&i.Tempo,
-			&i.Key,
-		); err != nil {
+		var i TrackFacetsRow
+		if err := rows.Scan(&i.Facet, &i.Value, &i.Count); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -419,174 +4886,137 @@ func (q *Queries) GetTracksByGenre(ctx context.Context, info []byte) ([]GetTrack
 	return items, nil
 }
 
-const insertAlbum = `-- name: InsertAlbum :one
-INSERT INTO public.albums (id, "name", cover, artist)
-VALUES($1, $2, $3, $4)
-RETURNING id
+const updatePlaylist = `-- name: UpdatePlaylist :one
+UPDATE playlists
+SET "name" = COALESCE($1, "name"),
+    description = COALESCE($2, description),
+    updated_at = now()
+WHERE id = $3
+RETURNING id, name, description, anon_id, created_at, updated_at, user_id
 `
 
-type InsertAlbumParams struct {
+type UpdatePlaylistParams struct {
+	Name        pgtype.Text
+	Description pgtype.Text
+	ID          string
+}
+
+// Updates the name and the description of the playlist, NULL keeps the current value.
+func (q *Queries) UpdatePlaylist(ctx context.Context, arg UpdatePlaylistParams) (Playlist, error) {
+	row := q.db.QueryRow(ctx, updatePlaylist, arg.Name, arg.Description, arg.ID)
+	var i Playlist
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.AnonID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const upsertAlbum = `-- name: UpsertAlbum :one
+INSERT INTO public.albums (id, "name", cover, artist, "year", genre)
+VALUES($1, $2, $3, $4, $5, $6) ON CONFLICT ("name", artist) DO
+UPDATE
+SET "name" = EXCLUDED."name"
+RETURNING id,
+    (xmax = 0)::bool AS inserted
+`
+
+type UpsertAlbumParams struct {
 	ID     string
-	Name   pgtype.Text
+	Name   string
 	Cover  pgtype.Text
-	Artist pgtype.Text
+	Artist string
+	Year   pgtype.Int4
+	Genre  pgtype.Text
 }
 
-// returns id
-func (q *Queries) InsertAlbum(ctx context.Context, arg InsertAlbumParams) (string, error) {
-	row := q.db.QueryRow(ctx, insertAlbum,
+type UpsertAlbumRow struct {
+	ID       string
+	Inserted bool
+}
+
+// Inserts the album if no album with the same name and artist exists, returns id of the new or existing album
+// and whether the album is inserted by this call
+func (q *Queries) UpsertAlbum(ctx context.Context, arg UpsertAlbumParams) (UpsertAlbumRow, error) {
+	row := q.db.QueryRow(ctx, upsertAlbum,
 		arg.ID,
 		arg.Name,
 		arg.Cover,
 		arg.Artist,
+		arg.Year,
+		arg.Genre,
 	)
-	var id string
-	err := row.Scan(&id)
-	return id, err
+	var i UpsertAlbumRow
+	err := row.Scan(&i.ID, &i.Inserted)
+	return i, err
 }
 
-const insertTrack = `-- name: InsertTrack :exec
-INSERT INTO public.tracks (
-        id,
-        vocal_folder_path,
-        instrumental_folder_path,
-        album_id,
-        total_duration,
-        info,
-        instrumental,
-        tempo,
-        "key",
-        vocal_waveform,
-        instrumental_waveform,
-        album_name
-    )
-VALUES(
-        $1,
-        $2,
-        $3,
-        $4,
-        $5,
-        $6,
-        $7,
-        $8,
-        $9,
-        $10,
-        $11,
-        $12
-    )
+const upsertArtist = `-- name: UpsertArtist :one
+INSERT INTO public.artists (id, "name", sort_name, match_name)
+VALUES($1, $2, $3, $4) ON CONFLICT (match_name) DO
+UPDATE
+SET match_name = EXCLUDED.match_name
+RETURNING id
 `
 
-type InsertTrackParams struct {
-	ID                     string
-	VocalFolderPath        pgtype.Text
-	InstrumentalFolderPath pgtype.Text
-	AlbumID                pgtype.Text
-	TotalDuration          pgtype.Numeric
-	Info                   []byte
-	Instrumental           pgtype.Bool
-	Tempo                  pgtype.Numeric
-	Key                    pgtype.Text
-	VocalWaveform          []byte
-	InstrumentalWaveform   []byte
-	AlbumName              pgtype.Text
+type UpsertArtistParams struct {
+	ID        string
+	Name      string
+	SortName  string
+	MatchName string
 }
 
-func (q *Queries) InsertTrack(ctx context.Context, arg InsertTrackParams) error {
-	_, err := q.db.Exec(ctx, insertTrack,
+// Inserts the artist if no artist with the same match name exists, returns id of the new or existing artist
+func (q *Queries) UpsertArtist(ctx context.Context, arg UpsertArtistParams) (string, error) {
+	row := q.db.QueryRow(ctx, upsertArtist,
 		arg.ID,
-		arg.VocalFolderPath,
-		arg.InstrumentalFolderPath,
-		arg.AlbumID,
-		arg.TotalDuration,
-		arg.Info,
-		arg.Instrumental,
-		arg.Tempo,
-		arg.Key,
-		arg.VocalWaveform,
-		arg.InstrumentalWaveform,
-		arg.AlbumName,
+		arg.Name,
+		arg.SortName,
+		arg.MatchName,
 	)
-	return err
+	var id string
+	err := row.Scan(&id)
+	return id, err
 }
 
-const recordListeningHistory = `-- name: RecordListeningHistory :exec
-INSERT INTO listening_histories (track_id, anon_id, listened_at)
-VALUES ($1, $2, $3)
+const upsertLyrics = `-- name: UpsertLyrics :exec
+INSERT INTO public.lyrics (
+        track_id,
+        "language",
+        plain,
+        synced,
+        "source"
+    )
+VALUES ($1, $2, $3, $4, $5) ON CONFLICT (track_id) DO
+UPDATE
+SET "language" = EXCLUDED."language",
+    plain = EXCLUDED.plain,
+    synced = EXCLUDED.synced,
+    "source" = EXCLUDED."source",
+    updated_at = now()
 `
 
-type RecordListeningHistoryParams struct {
-	TrackID    pgtype.Text
-	AnonID     pgtype.Text
-	ListenedAt pgtype.Timestamptz
+type UpsertLyricsParams struct {
+	TrackID  string
+	Language pgtype.Text
+	Plain    string
+	Synced   []byte
+	Source   string
 }
 
-func (q *Queries) RecordListeningHistory(ctx context.Context, arg RecordListeningHistoryParams) error {
-	_, err := q.db.Exec(ctx, recordListeningHistory, arg.TrackID, arg.AnonID, arg.ListenedAt)
+// Sets the lyrics of the track, replacing the lyrics it had.
+func (q *Queries) UpsertLyrics(ctx context.Context, arg UpsertLyricsParams) error {
+	_, err := q.db.Exec(ctx, upsertLyrics,
+		arg.TrackID,
+		arg.Language,
+		arg.Plain,
+		arg.Synced,
+		arg.Source,
+	)
 	return err
 }
-
-const searchTracks = `-- name: SearchTracks :many
-SELECT id,
-    vocal_folder_path,
-    instrumental_folder_path,
-    album_id,
-    total_duration,
-    info,
-    instrumental,
-    tempo,
-    "key"
-FROM tracks
-WHERE info->>'Title' ILIKE '%' || $1 || '%'
-    OR info->>'Artist' ILIKE '%' || $1 || '%'
-    OR info->>'Genre' ILIKE '%' || $1 || '%'
-LIMIT $2 OFFSET $3
-`
-
-type SearchTracksParams struct {
-	Column1 pgtype.Text
-	Limit   int32
-	Offset  int32
-}
-
-type SearchTracksRow struct {
-	ID                     string
-	VocalFolderPath        pgtype.Text
-	InstrumentalFolderPath pgtype.Text
-	AlbumID                pgtype.Text
-	TotalDuration          pgtype.Numeric
-	Info                   []byte
-	Instrumental           pgtype.Bool
-	Tempo                  pgtype.Numeric
-	Key                    pgtype.Text
-}
-
-// Searches tracks by title, artist, or genre
-func (q *Queries) SearchTracks(ctx context.Context, arg SearchTracksParams) ([]SearchTracksRow, error) {
-	rows, err := q.db.Query(ctx, searchTracks, arg.Column1, arg.Limit, arg.Offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []SearchTracksRow
-	for rows.Next() {
-		var i SearchTracksRow
-		if err := rows.Scan(
-			&i.ID,
-			&i.VocalFolderPath,
-			&i.InstrumentalFolderPath,
-			&i.AlbumID,
-			&i.TotalDuration,
-			&i.Info,
-			&i.Instrumental,
-			&i.Tempo,
-			&i.Key,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RandomCandidates is the number of tracks following the random start that a pick is weighted among.
+// tracks are not equally spaced in random_key order, weighting among neighbours evens out the
+// chance of a track that follows a large gap.
+const RandomCandidates = 32
+
+// PickRandomUnlistenedTrack picks a random unlistened track starting at a random key, wrapping around to the
+// start of the key range if no track follows it. returns pgx.ErrNoRows if every matching track is listened to.
+func (q *Queries) PickRandomUnlistenedTrack(ctx context.Context, arg GetRandomUnlistenedTrackParams) (Track, error) {
+	arg.Start, arg.Candidates = rand.Float64(), RandomCandidates
+	track, err := q.GetRandomUnlistenedTrack(ctx, arg)
+	if errors.Is(err, pgx.ErrNoRows) && arg.Start > 0 {
+		arg.Start = 0
+		return q.GetRandomUnlistenedTrack(ctx, arg)
+	}
+	return track, err
+}
+
+// PickRandomTrack picks a random track like PickRandomUnlistenedTrack, returns pgx.ErrNoRows if no track matches the filters
+func (q *Queries) PickRandomTrack(ctx context.Context, arg GetRandomTrackParams) (Track, error) {
+	arg.Start, arg.Candidates = rand.Float64(), RandomCandidates
+	track, err := q.GetRandomTrack(ctx, arg)
+	if errors.Is(err, pgx.ErrNoRows) && arg.Start > 0 {
+		arg.Start = 0
+		return q.GetRandomTrack(ctx, arg)
+	}
+	return track, err
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+
+	"github.com/rs/zerolog/log"
+)
+
+// last_used_at of tokens is updated at most once per interval instead of on every request
+const tokenTouchInterval = time.Minute
+
+// Authenticate resolves the bearer token of the request to its user, requests without a token are anonymous.
+// invalid and expired tokens are rejected instead of being treated as anonymous so that clients notice they have to log in again.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			unauthorized(w, errors.New("authorization header is not a bearer token"))
+			return
+		}
+		app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+		row, err := app.DB.GetUserByAPIToken(r.Context(), internal.HashAPIToken(token))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				unauthorized(w, errors.New("token does not exist or expired"))
+				return
+			}
+			internal.ServerError(w, err)
+			return
+		}
+		if !row.LastUsedAt.Valid || time.Since(row.LastUsedAt.Time) > tokenTouchInterval {
+			if err := app.DB.TouchAPIToken(r.Context(), row.TokenID); err != nil {
+				log.Warn().Err(err).Str("token", row.TokenID).Msg("failed to update last use of token")
+			}
+		}
+		user := internal.User{ID: row.ID, Username: row.Username, TokenID: row.TokenID}
+		next.ServeHTTP(w, r.WithContext(internal.WithUser(r.Context(), user)))
+	})
+}
+
+// RequireUser rejects anonymous requests, mount it after Authenticate
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := internal.UserFromContext(r.Context()); !ok {
+			unauthorized(w, errors.New("route requires a token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListenerWrites protects the routes anonymous listeners record their listening through, random picks, play
+// events and shuffle sessions. they stay open unless anonymous listeners are disabled, playlists always require a user.
+func ListenerWrites(anonymous bool) func(next http.Handler) http.Handler {
+	if anonymous {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+	return RequireUser
+}
+
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="strafe"`)
+	internal.WriteError(w, internal.Unauthorized(err))
+}
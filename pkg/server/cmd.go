@@ -2,9 +2,14 @@ package server
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/caner-cetin/strafe/internal"
 	"github.com/caner-cetin/strafe/pkg/db"
@@ -16,6 +21,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -34,6 +40,8 @@ func GetRunCmd() *cobra.Command {
 }
 
 func runServer(command *cobra.Command, args []string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
@@ -50,20 +58,117 @@ func runServer(command *cobra.Command, args []string) {
 		log.Error().Err(err).Msg("failed to migrate database")
 		return
 	}
+	if err := app.InitializeStorage(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize storage")
+		return
+	}
+	if err := app.InitializeAssets(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize asset resolver")
+		return
+	}
+	if err := app.InitializeEvents(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize play events")
+		return
+	}
+	app.InitializeStreams()
+	shutdown, endStreams := context.WithCancel(context.Background())
+	defer endStreams()
+	app.Shutdown = shutdown
 	r.Use(WithAppContext(app))
+	go endpoints.RunStationScheduler(ctx, app)
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://cansu.dev", "http://localhost:5173", "https://dj.cansu.dev"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"Link", "Location"},
 		AllowCredentials: false,
 	}))
+	r.Use(Authenticate)
+	// listening of anonymous listeners is recorded unless disabled, everything else they could change requires a token
+	listenerWrites := ListenerWrites(!viper.IsSet(internal.AUTH_ANONYMOUS_LISTENERS) || viper.GetBool(internal.AUTH_ANONYMOUS_LISTENERS))
 
 	r.Get("/health", endpoints.Health)
+	r.Route("/auth", func(auth chi.Router) {
+		auth.Post("/token", endpoints.IssueToken)
+		auth.With(RequireUser).Delete("/token", endpoints.RevokeToken)
+		auth.With(RequireUser).Get("/me", endpoints.CurrentUser)
+	})
+	r.Route("/tracks", func(tracks chi.Router) {
+		tracks.Get("/", endpoints.ListTracks)
+		tracks.Get("/facets", endpoints.GetTrackFacets)
+	})
+	r.Route("/albums", func(albums chi.Router) {
+		albums.Get("/", endpoints.ListAlbums)
+		albums.Get("/{albumId}", endpoints.GetAlbum)
+	})
 	r.Route("/track", func(track chi.Router) {
-		track.Post("/random", endpoints.GetRandomTrack)
+		track.With(listenerWrites).Post("/random", endpoints.GetRandomTrack)
 		track.Get("/{trackId}", endpoints.GetTrack)
+		track.Get("/{trackId}/playlist/{stem}.m3u8", endpoints.GetTrackPlaylist)
+		track.Get("/{trackId}/lyrics", endpoints.GetTrackLyrics)
+		track.With(listenerWrites).Post("/{trackId}/events", endpoints.RecordPlayEvent)
+	})
+	r.Route("/playlists", func(playlists chi.Router) {
+		playlists.Get("/", endpoints.ListPlaylists)
+		playlists.Get("/{playlistId}", endpoints.GetPlaylist)
+		playlists.Get("/{playlistId}/export.m3u8", endpoints.ExportPlaylist)
+		playlists.Group(func(writes chi.Router) {
+			writes.Use(RequireUser)
+			writes.Post("/", endpoints.CreatePlaylist)
+			writes.Patch("/{playlistId}", endpoints.UpdatePlaylist)
+			writes.Delete("/{playlistId}", endpoints.DeletePlaylist)
+			writes.Post("/{playlistId}/items", endpoints.AddPlaylistItem)
+			writes.Patch("/{playlistId}/items/{itemId}", endpoints.MovePlaylistItem)
+			writes.Delete("/{playlistId}/items/{itemId}", endpoints.DeletePlaylistItem)
+		})
+	})
+	r.Route("/sessions", func(sessions chi.Router) {
+		// sessions belong to the user who created them, see endpoints.sessionOwned
+		sessions.Use(listenerWrites)
+		sessions.Post("/", endpoints.CreateSession)
+		sessions.Get("/{sessionId}", endpoints.GetSession)
+		sessions.Delete("/{sessionId}", endpoints.DeleteSession)
+		sessions.Get("/{sessionId}/next", endpoints.NextSessionTrack)
+		sessions.Get("/{sessionId}/prev", endpoints.PrevSessionTrack)
+		sessions.Get("/{sessionId}/peek", endpoints.PeekSessionTracks)
+	})
+	r.Route("/uploads", func(uploads chi.Router) {
+		uploads.Use(RequireUser)
+		uploads.Post("/", endpoints.CreateUpload)
+		uploads.Get("/{uploadId}", endpoints.GetUpload)
+		uploads.Get("/{uploadId}/events", endpoints.StreamUploadEvents)
+	})
+	r.Route("/stations", func(stations chi.Router) {
+		stations.Get("/", endpoints.ListStations)
+		stations.With(RequireUser).Post("/", endpoints.CreateStation)
+		stations.With(RequireUser).Delete("/{name}", endpoints.DeleteStation)
+	})
+	r.Route("/station/{name}", func(station chi.Router) {
+		station.Get("/now", endpoints.GetNowPlaying)
+		station.Get("/events", endpoints.StreamStation)
+	})
+	r.Route("/stream", func(stream chi.Router) {
+		stream.Get("/{name}.aac", endpoints.StreamStationAAC)
+		stream.Get("/{name}.mp3", endpoints.StreamStationMP3)
+	})
+	r.Route("/artists", func(artists chi.Router) {
+		artists.Get("/", endpoints.ListArtists)
+		artists.Get("/{name}", endpoints.GetArtist)
+	})
+	r.Get("/genres/{genre}", endpoints.ListGenreTracks)
+	// local storage has no other way to reach clients, objects are served with range support
+	if _, ok := app.Store.(*internal.LocalStore); ok {
+		r.Get(internal.ObjectsRoute+"/*", endpoints.GetObject)
+	}
+	r.Route("/stats", func(stats chi.Router) {
+		stats.Get("/top-tracks", endpoints.TopTracks)
+		stats.Get("/top-artists", endpoints.TopArtists)
+		stats.Get("/anon/{anonId}/history", endpoints.GetListeningHistory)
+	})
+	r.Route("/search", func(search chi.Router) {
+		search.Get("/", endpoints.Search)
+		search.Get("/suggest", endpoints.Suggest)
 	})
 	if port == 0 {
 		addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
@@ -90,7 +195,27 @@ func runServer(command *cobra.Command, args []string) {
 		Str("host", host).
 		Int("port", port).
 		Msg("server is starting")
-	http.ListenAndServe(net.JoinHostPort(host, strconv.Itoa(port)), r)
+	server := &http.Server{Addr: net.JoinHostPort(host, strconv.Itoa(port)), Handler: r}
+	// Shutdown waits for every response, long lived ones never finish on their own
+	server.RegisterOnShutdown(endStreams)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("server stopped")
+			stop()
+		}
+	}()
+	<-ctx.Done()
+	stop()
+	log.Info().Msg("server is shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("failed to shut down server gracefully")
+	}
+	// buffered play events are written after the last request is handled
+	if err := app.Events.Close(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("failed to write buffered play events")
+	}
 }
 
 func WithAppContext(app internal.AppCtx) func(next http.Handler) http.Handler {
@@ -0,0 +1,136 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type Artist struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	SortName   string   `json:"sort_name"`
+	Aliases    []string `json:"aliases"`
+	TrackCount int64    `json:"track_count,omitempty"`
+}
+
+type ArtistCredit struct {
+	ID   string        `json:"id"`
+	Name string        `json:"name"`
+	Role db.ArtistRole `json:"role"`
+}
+
+type ArtistTrack struct {
+	TrackSummary
+	Roles []db.ArtistRole `json:"roles"`
+}
+
+type ArtistResponse struct {
+	Artist
+	Tracks Page[ArtistTrack] `json:"tracks"`
+}
+
+func ListArtists(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var params = db.ListArtistsParams{Limit: 50, Offset: 0}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			internal.WriteError(w, internal.InvalidQueryParameter(err))
+			return
+		}
+		params.Limit = int32(parsed)
+	}
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		parsed, err := strconv.ParseInt(offset, 10, 32)
+		if err != nil || parsed < 0 {
+			internal.WriteError(w, internal.InvalidQueryParameter(err))
+			return
+		}
+		params.Offset = int32(parsed)
+	}
+	rows, err := app.DB.ListArtists(r.Context(), params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = make([]Artist, 0, len(rows))
+	for _, row := range rows {
+		response = append(response, Artist{
+			ID:         row.ID,
+			Name:       row.Name,
+			SortName:   row.SortName,
+			Aliases:    row.Aliases,
+			TrackCount: row.TrackCount,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetArtist resolves the artist by name or alias, "the band", "The Band" and "Band" are the same artist.
+// tracks the artist is credited on are paginated like ListTracks.
+func GetArtist(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	page, err := parsePageRequest(r, trackSorts)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	params, err := listTracksParams(page)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	artist, err := app.DB.GetArtistByMatchNameOrAlias(r.Context(), internal.ArtistMatchName(chi.URLParam(r, "name")))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	params.ArtistID.String, params.ArtistID.Valid = artist.ID, true
+	tracks, err := listTrackPage(r, app, page, params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var trackIDs = make([]string, 0, len(tracks.Items))
+	for _, track := range tracks.Items {
+		trackIDs = append(trackIDs, track.ID)
+	}
+	credits, err := app.DB.GetArtistRolesByTrackIDs(r.Context(), db.GetArtistRolesByTrackIDsParams{ArtistID: artist.ID, TrackIds: trackIDs})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var roles = make(map[string][]db.ArtistRole)
+	for _, credit := range credits {
+		roles[credit.TrackID] = append(roles[credit.TrackID], credit.Role)
+	}
+	var response = ArtistResponse{
+		Artist: Artist{
+			ID:       artist.ID,
+			Name:     artist.Name,
+			SortName: artist.SortName,
+			Aliases:  artist.Aliases,
+		},
+		Tracks: Page[ArtistTrack]{Items: make([]ArtistTrack, 0, len(tracks.Items)), NextCursor: tracks.NextCursor},
+	}
+	for _, track := range tracks.Items {
+		response.Tracks.Items = append(response.Tracks.Items, ArtistTrack{TrackSummary: track, Roles: roles[track.ID]})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
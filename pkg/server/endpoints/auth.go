@@ -0,0 +1,106 @@
+package endpoints
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type IssueTokenRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// what the token is used for, such as the hostname of the cli that logged in
+	Name string `json:"name"`
+}
+
+type TokenResponse struct {
+	// only shown once, send it as "Authorization: Bearer <token>"
+	Token     string        `json:"token"`
+	ExpiresAt *time.Time    `json:"expires_at"`
+	User      internal.User `json:"user"`
+}
+
+// IssueToken exchanges the username and password for an API token that expires after auth.token_ttl
+func IssueToken(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var body IssueTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err.Error() == "EOF" {
+			internal.WriteError(w, internal.MissingJSONBody(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	if body.Username == "" || body.Password == "" {
+		internal.WriteError(w, internal.MalformedJSONBody(errors.New("username and password are required")))
+		return
+	}
+	user, err := app.DB.GetUserByUsername(r.Context(), body.Username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		internal.ServerError(w, err)
+		return
+	}
+	// unknown users are compared against a dummy hash so that they take as long as wrong passwords
+	if !internal.CheckPassword(user.PasswordHash, body.Password) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="strafe"`)
+		internal.WriteError(w, internal.InvalidCredentials(errors.New("invalid username or password for "+body.Username)))
+		return
+	}
+	ttl, err := internal.TokenTTL()
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	token, hash, err := internal.NewAPIToken()
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var params = db.CreateAPITokenParams{UserID: user.ID, TokenHash: hash}
+	if body.Name != "" {
+		params.Name = pgtype.Text{String: body.Name, Valid: true}
+	}
+	if ttl > 0 {
+		params.ExpiresAt = pgtype.Timestamptz{Time: time.Now().Add(ttl), Valid: true}
+	}
+	created, err := app.DB.CreateAPIToken(r.Context(), params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = TokenResponse{Token: token, User: internal.User{ID: user.ID, Username: user.Username}}
+	if created.ExpiresAt.Valid {
+		response.ExpiresAt = &created.ExpiresAt.Time
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeToken revokes the token the request is authenticated with
+func RevokeToken(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	user, _ := internal.UserFromContext(r.Context())
+	if err := app.DB.DeleteAPIToken(r.Context(), user.TokenID); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CurrentUser returns the user the request is authenticated as
+func CurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, _ := internal.UserFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,395 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/catalogue"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/valyala/fastjson"
+)
+
+var (
+	trackSorts = []string{"added", "title", "tempo", "duration"}
+	albumSorts = []string{"added", "title", "duration"}
+	// leading number of "3", "3/12" and "03"
+	leadingNumber = regexp.MustCompile(`^\d+`)
+)
+
+// TrackSummary is the lightweight representation of a track used in listings, without waveforms and folder paths
+type TrackSummary struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Artist       string    `json:"artist"`
+	AlbumID      string    `json:"album_id"`
+	AlbumName    string    `json:"album_name"`
+	Genre        string    `json:"genre"`
+	Disc         int       `json:"disc,omitempty"`
+	Number       int       `json:"number,omitempty"`
+	Length       float64   `json:"length"`
+	Tempo        float64   `json:"tempo"`
+	Key          string    `json:"key"`
+	Instrumental bool      `json:"instrumental"`
+	AddedAt      time.Time `json:"added_at"`
+}
+
+type Album struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Artist     string    `json:"artist"`
+	Cover      *string   `json:"cover"`
+	CoverURL   *string   `json:"cover_url"`
+	Year       *int32    `json:"year"`
+	Genre      *string   `json:"genre"`
+	DiscCount  int32     `json:"disc_count"`
+	TrackCount int32     `json:"track_count"`
+	Length     float64   `json:"length"`
+	AddedAt    time.Time `json:"added_at"`
+	// set if the album was matched on musicbrainz during upload
+	MusicBrainzReleaseID      *string `json:"musicbrainz_release_id"`
+	MusicBrainzReleaseGroupID *string `json:"musicbrainz_release_group_id"`
+	CanonicalName             *string `json:"canonical_name"`
+	ReleaseDate               *string `json:"release_date"`
+}
+
+type AlbumResponse struct {
+	Album
+	Tracks []TrackSummary `json:"tracks"`
+}
+
+// ListTracks lists the library with cursor pagination.
+// album_id and the filters of parseTrackFilter narrow down the listing, see parsePageRequest for sorting and paging.
+func ListTracks(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	page, err := parsePageRequest(r, trackSorts)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	params, err := listTracksParams(page)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	filter, err := parseTrackFilter(r.URL.Query())
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	filterParams, err := filter.params()
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	params.Filter = filterParams
+	if albumID := r.URL.Query().Get("album_id"); albumID != "" {
+		if _, err := uuid.Parse(albumID); err != nil {
+			internal.WriteError(w, internal.InvalidQueryParameter(err))
+			return
+		}
+		params.AlbumID.String, params.AlbumID.Valid = albumID, true
+	}
+	response, err := listTrackPage(r, app, page, params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListGenreTracks lists the tracks of the genre like ListTracks, the filters of parseTrackFilter narrow it down further
+func ListGenreTracks(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	page, err := parsePageRequest(r, trackSorts)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	params, err := listTracksParams(page)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	filter, err := parseTrackFilter(r.URL.Query())
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	if params.Filter, err = filter.params(); err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	params.Genre = pgtype.Text{String: chi.URLParam(r, "genre"), Valid: true}
+	response, err := listTrackPage(r, app, page, params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetTrackFacets counts the tracks matching the filters of parseTrackFilter by genre, key, instrumental flag, tempo and year
+func GetTrackFacets(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	filter, err := parseTrackFilter(r.URL.Query())
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	params, err := filter.params()
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	rows, err := app.DB.TrackFacets(r.Context(), params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = FacetsResponse{
+		Genres:       []Facet{},
+		Keys:         []Facet{},
+		Instrumental: []Facet{},
+		Tempo:        []Facet{},
+		Years:        []Facet{},
+	}
+	var camelot = make(map[string]int)
+	for _, row := range rows {
+		switch row.Facet {
+		case "genre":
+			response.Genres = append(response.Genres, Facet{Value: row.Value, Count: row.Count})
+		case "key":
+			// enharmonic spellings share the same camelot code
+			code, err := internal.CamelotCode(row.Value)
+			if err != nil {
+				code = row.Value
+			}
+			if i, ok := camelot[code]; ok {
+				response.Keys[i].Count += row.Count
+				continue
+			}
+			camelot[code] = len(response.Keys)
+			response.Keys = append(response.Keys, Facet{Value: code, Count: row.Count})
+		case "instrumental":
+			response.Total += row.Count
+			response.Instrumental = append(response.Instrumental, Facet{Value: row.Value, Count: row.Count})
+		case "tempo":
+			response.Tempo = append(response.Tempo, Facet{Value: row.Value, Count: row.Count})
+		case "year":
+			response.Years = append(response.Years, Facet{Value: row.Value, Count: row.Count})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func ListAlbums(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	page, err := parsePageRequest(r, albumSorts)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	var params = catalogue.ListAlbumsParams{Sort: page.Sort, Descending: page.Descending, ResultLimit: page.Limit + 1}
+	params.AfterID, params.AfterTitle, params.AfterDuration, params.AfterCreatedAt, err = page.After.afterValues()
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	rows, err := catalogue.ListAlbums(r.Context(), app.Conn, params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = Page[Album]{Items: make([]Album, 0, len(rows))}
+	for i, row := range rows {
+		if i == int(page.Limit) {
+			last := rows[i-1]
+			next := cursor{
+				Sort:       page.Sort,
+				Descending: page.Descending,
+				ID:         last.ID,
+				Value:      cursorValue(page.Sort, last.Name, last.TotalDuration, last.TotalDuration, last.CreatedAt),
+			}.encode()
+			response.NextCursor = &next
+			break
+		}
+		album, err := albumResponse(r.Context(), app.Assets, row)
+		if err != nil {
+			internal.ServerError(w, err)
+			return
+		}
+		response.Items = append(response.Items, album)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetAlbum returns the album with its tracklist ordered by disc and track number
+func GetAlbum(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var albumID = chi.URLParam(r, "albumId")
+	if _, err := uuid.Parse(albumID); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return
+	}
+	album, err := app.DB.GetAlbumById(r.Context(), albumID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	tracks, err := app.DB.GetTracksByAlbumId(r.Context(), album.ID)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	albumSummary, err := albumResponse(r.Context(), app.Assets, album)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = AlbumResponse{Album: albumSummary, Tracks: make([]TrackSummary, 0, len(tracks))}
+	for _, track := range tracks {
+		response.Tracks = append(response.Tracks, trackSummary(catalogue.Track(track)))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func listTracksParams(page pageRequest) (catalogue.ListTracksParams, error) {
+	var params = catalogue.ListTracksParams{Sort: page.Sort, Descending: page.Descending, ResultLimit: page.Limit + 1}
+	var (
+		numeric pgtype.Numeric
+		err     error
+	)
+	params.AfterID, params.AfterTitle, numeric, params.AfterCreatedAt, err = page.After.afterValues()
+	if page.Sort == "tempo" {
+		params.AfterTempo = numeric
+	} else {
+		params.AfterDuration = numeric
+	}
+	return params, err
+}
+
+// listTrackPage fetches one more track than the limit to know whether there is a next page
+func listTrackPage(r *http.Request, app internal.AppCtx, page pageRequest, params catalogue.ListTracksParams) (Page[TrackSummary], error) {
+	rows, err := catalogue.ListTracks(r.Context(), app.Conn, params)
+	if err != nil {
+		return Page[TrackSummary]{}, err
+	}
+	var response = Page[TrackSummary]{Items: make([]TrackSummary, 0, len(rows))}
+	for i, row := range rows {
+		if i == int(page.Limit) {
+			last := rows[i-1]
+			next := cursor{
+				Sort:       page.Sort,
+				Descending: page.Descending,
+				ID:         last.ID,
+				Value:      cursorValue(page.Sort, fastjson.GetString(last.Info, "Title"), last.TotalDuration, last.Tempo, last.CreatedAt),
+			}.encode()
+			response.NextCursor = &next
+			break
+		}
+		response.Items = append(response.Items, trackSummary(row))
+	}
+	return response, nil
+}
+
+func trackSummary(track catalogue.Track) TrackSummary {
+	length, _ := track.TotalDuration.Float64Value()
+	tempo, _ := track.Tempo.Float64Value()
+	return TrackSummary{
+		ID:           track.ID,
+		Title:        fastjson.GetString(track.Info, "Title"),
+		Artist:       fastjson.GetString(track.Info, "Artist"),
+		AlbumID:      track.AlbumID,
+		AlbumName:    track.AlbumName,
+		Genre:        fastjson.GetString(track.Info, "Genre"),
+		Disc:         tagNumber(track.Info, "PartOfSet"),
+		Number:       tagNumber(track.Info, "Track"),
+		Length:       length.Float64,
+		Tempo:        tempo.Float64,
+		Key:          track.Key,
+		Instrumental: track.Instrumental,
+		AddedAt:      track.CreatedAt.Time,
+	}
+}
+
+// tagNumber reads tags such as "Track" that exiftool writes either as a number or as "3/12"
+func tagNumber(info []byte, key string) int {
+	parsed, err := fastjson.ParseBytes(info)
+	if err != nil {
+		return 0
+	}
+	value := parsed.Get(key)
+	if value == nil {
+		return 0
+	}
+	if value.Type() == fastjson.TypeNumber {
+		return value.GetInt()
+	}
+	number, _ := strconv.Atoi(leadingNumber.FindString(string(value.GetStringBytes())))
+	return number
+}
+
+func albumResponse(ctx context.Context, assets *internal.AssetResolver, album db.Album) (Album, error) {
+	length, _ := album.TotalDuration.Float64Value()
+	var response = Album{
+		ID:         album.ID,
+		Name:       album.Name,
+		Artist:     album.Artist,
+		DiscCount:  album.DiscCount,
+		TrackCount: album.TrackCount,
+		Length:     length.Float64,
+		AddedAt:    album.CreatedAt.Time,
+	}
+	if album.Cover.Valid {
+		coverURL, err := assets.URL(ctx, album.Cover.String)
+		if err != nil {
+			return response, err
+		}
+		response.Cover = &album.Cover.String
+		response.CoverURL = &coverURL
+	}
+	if album.Year.Valid {
+		response.Year = &album.Year.Int32
+	}
+	if album.Genre.Valid {
+		response.Genre = &album.Genre.String
+	}
+	if album.MusicbrainzReleaseID.Valid {
+		response.MusicBrainzReleaseID = &album.MusicbrainzReleaseID.String
+	}
+	if album.MusicbrainzReleaseGroupID.Valid {
+		response.MusicBrainzReleaseGroupID = &album.MusicbrainzReleaseGroupID.String
+	}
+	if album.CanonicalName.Valid {
+		response.CanonicalName = &album.CanonicalName.String
+	}
+	if album.ReleaseDate.Valid {
+		response.ReleaseDate = &album.ReleaseDate.String
+	}
+	return response, nil
+}
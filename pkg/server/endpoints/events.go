@@ -0,0 +1,103 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// PlayEventRequest reports the playback of a track. players send "start" when playback begins,
+// "progress" periodically while playing, and "complete" or "skip" when playback ends.
+// position is the playback position in seconds, duration is the seconds listened since the previous event.
+type PlayEventRequest struct {
+	AnonID   string           `json:"anonId"`
+	Type     db.PlayEventType `json:"type"`
+	Position float64          `json:"position"`
+	Duration float64          `json:"duration"`
+}
+
+// RecordPlayEvent queues the play event and responds with 202, events are written in batches.
+// play counts and skip rates derived from the events weight random track selection.
+func RecordPlayEvent(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var trackId = chi.URLParam(r, "trackId")
+	var body PlayEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err.Error() == "EOF" {
+			internal.WriteError(w, internal.MissingJSONBody(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	if err := body.validate(); err != nil {
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	if _, err := uuid.Parse(trackId); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return
+	}
+	exists, err := app.DB.TrackExists(r.Context(), trackId)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if !exists {
+		internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("track %s does not exist", trackId)))
+		return
+	}
+	event := db.InsertPlayEventsParams{
+		TrackID:   trackId,
+		AnonID:    body.AnonID,
+		EventType: body.Type,
+		CreatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	if err := event.Position.Scan(strconv.FormatFloat(body.Position, 'f', 3, 64)); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := event.Duration.Scan(strconv.FormatFloat(body.Duration, 'f', 3, 64)); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := app.Events.Add(event); err != nil {
+		if errors.Is(err, internal.ErrEventBufferFull) || errors.Is(err, internal.ErrEventBufferClosed) {
+			w.Header().Set("Retry-After", "5")
+			internal.WriteError(w, internal.ServiceUnavailable(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (e PlayEventRequest) validate() error {
+	switch e.Type {
+	case db.PlayEventTypeStart, db.PlayEventTypeProgress, db.PlayEventTypeComplete, db.PlayEventTypeSkip:
+	default:
+		return fmt.Errorf("type must be one of start, progress, complete or skip, got %q", e.Type)
+	}
+	if e.AnonID == "" {
+		return errors.New("anonId is required")
+	}
+	// numeric(10, 3) columns
+	if e.Position < 0 || e.Position >= 1e7 {
+		return errors.New("position must be a non-negative number of seconds")
+	}
+	if e.Duration < 0 || e.Duration >= 1e7 {
+		return errors.New("duration must be a non-negative number of seconds")
+	}
+	return nil
+}
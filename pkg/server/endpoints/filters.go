@@ -0,0 +1,254 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TrackFilter narrows down track listings and random picks, zero values match every track.
+// keys accept camelot codes ("8A") and standard notation ("Am", "F# minor"), ranges are inclusive.
+type TrackFilter struct {
+	MinTempo         *float64 `json:"min_tempo"`
+	MaxTempo         *float64 `json:"max_tempo"`
+	Keys             []string `json:"keys"`
+	Genres           []string `json:"genres"`
+	MinDuration      *float64 `json:"min_duration"`
+	MaxDuration      *float64 `json:"max_duration"`
+	InstrumentalOnly bool     `json:"instrumental_only"`
+	MinYear          *int32   `json:"min_year"`
+	MaxYear          *int32   `json:"max_year"`
+	ExcludeTracks    []string `json:"exclude_tracks"`
+	ExcludeAlbums    []string `json:"exclude_albums"`
+	ExcludeGenres    []string `json:"exclude_genres"`
+	ExcludeArtists   []string `json:"exclude_artists"`
+}
+
+type Facet struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// FacetsResponse counts the tracks matching the filters by every filterable value.
+// keys are counted by camelot code and tempo in 10 BPM buckets, "120" counts the tracks between 120 and 130 BPM.
+type FacetsResponse struct {
+	Total        int64   `json:"total"`
+	Genres       []Facet `json:"genres"`
+	Keys         []Facet `json:"keys"`
+	Instrumental []Facet `json:"instrumental"`
+	Tempo        []Facet `json:"tempo"`
+	Years        []Facet `json:"years"`
+}
+
+// parseTrackFilter reads the filter from query parameters, lists can be given by repeating the parameter
+// (genre=House&genre=Techno), keys and ids can also be separated with commas (key=8A,9A).
+func parseTrackFilter(query url.Values) (TrackFilter, error) {
+	var (
+		filter TrackFilter
+		err    error
+	)
+	parseFloat := func(name string) *float64 {
+		raw := query.Get(name)
+		if raw == "" || err != nil {
+			return nil
+		}
+		parsed, parseErr := strconv.ParseFloat(raw, 64)
+		if parseErr != nil {
+			err = fmt.Errorf("%s must be a number: %w", name, parseErr)
+			return nil
+		}
+		return &parsed
+	}
+	parseYear := func(name string) *int32 {
+		raw := query.Get(name)
+		if raw == "" || err != nil {
+			return nil
+		}
+		parsed, parseErr := strconv.ParseInt(raw, 10, 32)
+		if parseErr != nil {
+			err = fmt.Errorf("%s must be a year: %w", name, parseErr)
+			return nil
+		}
+		year := int32(parsed)
+		return &year
+	}
+	splitList := func(name string) []string {
+		var values []string
+		for _, value := range query[name] {
+			for _, part := range strings.Split(value, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					values = append(values, part)
+				}
+			}
+		}
+		return values
+	}
+	filter.MinTempo = parseFloat("min_tempo")
+	filter.MaxTempo = parseFloat("max_tempo")
+	filter.MinDuration = parseFloat("min_duration")
+	filter.MaxDuration = parseFloat("max_duration")
+	filter.MinYear = parseYear("min_year")
+	filter.MaxYear = parseYear("max_year")
+	if err != nil {
+		return filter, err
+	}
+	if instrumental := query.Get("instrumental"); instrumental != "" {
+		if filter.InstrumentalOnly, err = strconv.ParseBool(instrumental); err != nil {
+			return filter, fmt.Errorf("instrumental must be true or false: %w", err)
+		}
+	}
+	filter.Keys = splitList("key")
+	filter.Genres = query["genre"]
+	filter.ExcludeTracks = splitList("exclude_track")
+	filter.ExcludeAlbums = splitList("exclude_album")
+	filter.ExcludeGenres = query["exclude_genre"]
+	filter.ExcludeArtists = splitList("exclude_artist")
+	return filter, nil
+}
+
+// params validates the filter and converts it to the filter parameters shared by the track queries
+func (f TrackFilter) params() (db.TrackFacetsParams, error) {
+	var params = db.TrackFacetsParams{
+		Genres:           f.Genres,
+		InstrumentalOnly: f.InstrumentalOnly,
+		ExcludeGenres:    f.ExcludeGenres,
+	}
+	if f.MinTempo != nil && f.MaxTempo != nil && *f.MinTempo > *f.MaxTempo {
+		return params, errors.New("min_tempo is greater than max_tempo")
+	}
+	if f.MinDuration != nil && f.MaxDuration != nil && *f.MinDuration > *f.MaxDuration {
+		return params, errors.New("min_duration is greater than max_duration")
+	}
+	if f.MinYear != nil && f.MaxYear != nil && *f.MinYear > *f.MaxYear {
+		return params, errors.New("min_year is greater than max_year")
+	}
+	for _, bound := range []struct {
+		value *float64
+		param *pgtype.Numeric
+	}{
+		{f.MinTempo, &params.MinTempo},
+		{f.MaxTempo, &params.MaxTempo},
+		{f.MinDuration, &params.MinDuration},
+		{f.MaxDuration, &params.MaxDuration},
+	} {
+		if bound.value == nil {
+			continue
+		}
+		if err := bound.param.Scan(strconv.FormatFloat(*bound.value, 'f', -1, 64)); err != nil {
+			return params, err
+		}
+	}
+	if f.MinYear != nil {
+		params.MinYear = pgtype.Int4{Int32: *f.MinYear, Valid: true}
+	}
+	if f.MaxYear != nil {
+		params.MaxYear = pgtype.Int4{Int32: *f.MaxYear, Valid: true}
+	}
+	for _, key := range f.Keys {
+		spellings, err := internal.KeySpellings(key)
+		if err != nil {
+			return params, err
+		}
+		params.Keys = append(params.Keys, spellings...)
+	}
+	for _, ids := range [][]string{f.ExcludeTracks, f.ExcludeAlbums, f.ExcludeArtists} {
+		for _, id := range ids {
+			if _, err := uuid.Parse(id); err != nil {
+				return params, fmt.Errorf("excluded id %q is not a uuid: %w", id, err)
+			}
+		}
+	}
+	params.ExcludeTrackIds = f.ExcludeTracks
+	params.ExcludeAlbumIds = f.ExcludeAlbums
+	params.ExcludeArtistIds = f.ExcludeArtists
+	return params, nil
+}
+
+func unlistenedTrackParams(filter db.TrackFacetsParams, anonID string) db.GetRandomUnlistenedTrackParams {
+	return db.GetRandomUnlistenedTrackParams{
+		MinTempo:         filter.MinTempo,
+		MaxTempo:         filter.MaxTempo,
+		Keys:             filter.Keys,
+		Genres:           filter.Genres,
+		MinDuration:      filter.MinDuration,
+		MaxDuration:      filter.MaxDuration,
+		InstrumentalOnly: filter.InstrumentalOnly,
+		MinYear:          filter.MinYear,
+		MaxYear:          filter.MaxYear,
+		ExcludeTrackIds:  filter.ExcludeTrackIds,
+		ExcludeAlbumIds:  filter.ExcludeAlbumIds,
+		ExcludeGenres:    filter.ExcludeGenres,
+		ExcludeArtistIds: filter.ExcludeArtistIds,
+		AnonID:           anonID,
+	}
+}
+
+func randomTrackParams(filter db.TrackFacetsParams) db.GetRandomTrackParams {
+	return db.GetRandomTrackParams{
+		MinTempo:         filter.MinTempo,
+		MaxTempo:         filter.MaxTempo,
+		Keys:             filter.Keys,
+		Genres:           filter.Genres,
+		MinDuration:      filter.MinDuration,
+		MaxDuration:      filter.MaxDuration,
+		InstrumentalOnly: filter.InstrumentalOnly,
+		MinYear:          filter.MinYear,
+		MaxYear:          filter.MaxYear,
+		ExcludeTrackIds:  filter.ExcludeTrackIds,
+		ExcludeAlbumIds:  filter.ExcludeAlbumIds,
+		ExcludeGenres:    filter.ExcludeGenres,
+		ExcludeArtistIds: filter.ExcludeArtistIds,
+	}
+}
+
+func shuffleSessionParams(filter db.TrackFacetsParams, session db.ShuffleSession) db.OrderShuffleSessionCycleParams {
+	return db.OrderShuffleSessionCycleParams{
+		SessionID:        session.ID,
+		Cycle:            session.Cycle,
+		AnonID:           session.AnonID,
+		Seed:             session.Seed,
+		MinTempo:         filter.MinTempo,
+		MaxTempo:         filter.MaxTempo,
+		Keys:             filter.Keys,
+		Genres:           filter.Genres,
+		MinDuration:      filter.MinDuration,
+		MaxDuration:      filter.MaxDuration,
+		InstrumentalOnly: filter.InstrumentalOnly,
+		MinYear:          filter.MinYear,
+		MaxYear:          filter.MaxYear,
+		ExcludeTrackIds:  filter.ExcludeTrackIds,
+		ExcludeAlbumIds:  filter.ExcludeAlbumIds,
+		ExcludeGenres:    filter.ExcludeGenres,
+		ExcludeArtistIds: filter.ExcludeArtistIds,
+	}
+}
+
+func stationScheduleParams(filter db.TrackFacetsParams, stationID string, recentTracks int64) db.AppendStationScheduleParams {
+	return db.AppendStationScheduleParams{
+		StationID:        stationID,
+		RecentTracks:     recentTracks,
+		MinTempo:         filter.MinTempo,
+		MaxTempo:         filter.MaxTempo,
+		Keys:             filter.Keys,
+		Genres:           filter.Genres,
+		MinDuration:      filter.MinDuration,
+		MaxDuration:      filter.MaxDuration,
+		InstrumentalOnly: filter.InstrumentalOnly,
+		MinYear:          filter.MinYear,
+		MaxYear:          filter.MaxYear,
+		ExcludeTrackIds:  filter.ExcludeTrackIds,
+		ExcludeAlbumIds:  filter.ExcludeAlbumIds,
+		ExcludeGenres:    filter.ExcludeGenres,
+		ExcludeArtistIds: filter.ExcludeArtistIds,
+		BatchSize:        stationBatchSize,
+		Candidates:       db.RandomCandidates,
+	}
+}
@@ -0,0 +1,66 @@
+package endpoints
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type TrackLyrics struct {
+	TrackID  string  `json:"track_id"`
+	Language *string `json:"language"`
+	Source   string  `json:"source"`
+	// false if the lyrics have no line times, lines is empty then
+	Synced    bool                 `json:"synced"`
+	Plain     string               `json:"plain"`
+	Lines     []internal.LyricLine `json:"lines"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// GetTrackLyrics responds with the lyrics of the track. synced lyrics have a start time in seconds for every line,
+// and for every word if they were imported from enhanced LRC, a line is shown until the next one starts.
+func GetTrackLyrics(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var trackId = chi.URLParam(r, "trackId")
+	if _, err := uuid.Parse(trackId); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return
+	}
+	lyrics, err := app.DB.GetLyrics(r.Context(), trackId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("track %s has no lyrics: %w", trackId, err)))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	var response = TrackLyrics{
+		TrackID:   lyrics.TrackID,
+		Source:    lyrics.Source,
+		Synced:    lyrics.Synced != nil,
+		Plain:     lyrics.Plain,
+		Lines:     []internal.LyricLine{},
+		UpdatedAt: lyrics.UpdatedAt.Time,
+	}
+	if lyrics.Language.Valid {
+		response.Language = &lyrics.Language.String
+	}
+	if lyrics.Synced != nil {
+		if err := json.Unmarshal(lyrics.Synced, &response.Lines); err != nil {
+			internal.ServerError(w, fmt.Errorf("invalid synced lyrics of track %s: %w", trackId, err))
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,33 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/caner-cetin/strafe/internal"
+)
+
+// GetObject serves an object of the local storage, Range, If-Modified-Since and HEAD requests are handled by http.ServeContent
+func GetObject(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var key = strings.TrimPrefix(r.URL.Path, internal.ObjectsRoute+"/")
+	object, info, err := app.Store.Open(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, internal.ErrObjectNotFound) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	defer object.Close()
+	switch path.Ext(key) {
+	case ".m3u8":
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	case ".ts":
+		w.Header().Set("Content-Type", "video/mp2t")
+	}
+	http.ServeContent(w, r, path.Base(key), info.LastModified, object)
+}
@@ -0,0 +1,139 @@
+package endpoints
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Page is a single page of a listing, next_cursor is null on the last page
+type Page[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// cursor points to the last item of the previous page. it is handed to the clients as an opaque
+// base64 string, sort and direction are kept so that a cursor cannot be reused with another sort.
+type cursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	ID         string `json:"id"`
+	// value of the sort column of the last item, see cursorValue
+	Value string `json:"v"`
+}
+
+func (c cursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(encoded string) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+	return &c, nil
+}
+
+type pageRequest struct {
+	Sort       string
+	Descending bool
+	Limit      int32
+	After      *cursor
+}
+
+// parsePageRequest reads sort, order, limit and cursor query parameters.
+// the first of the sorts is the default, added is sorted newest first by default and every other sort ascending.
+func parsePageRequest(r *http.Request, sorts []string) (pageRequest, error) {
+	var query = r.URL.Query()
+	var page = pageRequest{Sort: sorts[0], Limit: 50}
+	if sort := query.Get("sort"); sort != "" {
+		if !slices.Contains(sorts, sort) {
+			return page, fmt.Errorf("sort must be one of %v", sorts)
+		}
+		page.Sort = sort
+	}
+	switch query.Get("order") {
+	case "":
+		page.Descending = page.Sort == "added"
+	case "asc":
+		page.Descending = false
+	case "desc":
+		page.Descending = true
+	default:
+		return page, errors.New("order must be asc or desc")
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil || parsed <= 0 || parsed > 200 {
+			return page, errors.New("limit must be between 1 and 200")
+		}
+		page.Limit = int32(parsed)
+	}
+	if encoded := query.Get("cursor"); encoded != "" {
+		after, err := decodeCursor(encoded)
+		if err != nil {
+			return page, err
+		}
+		if after.Sort != page.Sort || after.Descending != page.Descending {
+			return page, errors.New("cursor belongs to a listing with another sort or order")
+		}
+		page.After = after
+	}
+	return page, nil
+}
+
+// cursorValue formats the value of the sort column for the cursor
+func cursorValue(sort string, title string, duration pgtype.Numeric, tempo pgtype.Numeric, createdAt pgtype.Timestamptz) string {
+	switch sort {
+	case "title":
+		return title
+	case "duration":
+		value, _ := duration.Value()
+		return fmt.Sprint(value)
+	case "tempo":
+		value, _ := tempo.Value()
+		return fmt.Sprint(value)
+	default:
+		return createdAt.Time.Format(time.RFC3339Nano)
+	}
+}
+
+// afterValues parses the cursor value into the typed parameters of the listing queries
+func (c *cursor) afterValues() (id pgtype.Text, title pgtype.Text, numeric pgtype.Numeric, createdAt pgtype.Timestamptz, err error) {
+	if c == nil {
+		return
+	}
+	id = pgtype.Text{String: c.ID, Valid: true}
+	switch c.Sort {
+	case "title":
+		title = pgtype.Text{String: c.Value, Valid: true}
+	case "duration", "tempo":
+		if err = numeric.Scan(c.Value); err != nil {
+			err = fmt.Errorf("malformed cursor: %w", err)
+		}
+	default:
+		var parsed time.Time
+		if parsed, err = time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			err = fmt.Errorf("malformed cursor: %w", err)
+			return
+		}
+		createdAt = pgtype.Timestamptz{Time: parsed, Valid: true}
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package endpoints
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const testCursorID = "0b6b1f0e-5d43-4a0a-9d6c-8f8f2a1e7c11"
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []cursor{
+		{Sort: "added", Descending: true, ID: testCursorID, Value: "2026-10-19T12:00:00.123456Z"},
+		{Sort: "title", ID: testCursorID, Value: "Ünïcode & spaces / slashes"},
+		{Sort: "tempo", Descending: true, ID: testCursorID, Value: "128.5"},
+		{Sort: "title", ID: testCursorID, Value: ""},
+	}
+	for _, want := range tests {
+		t.Run(want.Sort, func(t *testing.T) {
+			encoded := want.encode()
+			if url.QueryEscape(encoded) != encoded {
+				t.Errorf("cursor %q is not url safe", encoded)
+			}
+			got, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if *got != want {
+				t.Errorf("decodeCursor() = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformedCursor(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"not base64", "not a cursor!"},
+		{"truncated", cursor{Sort: "added", ID: testCursorID}.encode()[:20]},
+		{"not json", encode("added:" + testCursorID)},
+		{"wrong types", encode(`{"s":1,"d":"yes","id":"` + testCursorID + `"}`)},
+		{"missing id", encode(`{"s":"added","v":"2026-10-19T12:00:00Z"}`)},
+		{"id not a uuid", encode(`{"s":"added","id":"1 OR 1=1"}`)},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodeCursor(tt.encoded); err == nil {
+				t.Errorf("decodeCursor(%q) = %+v, want an error", tt.encoded, got)
+			}
+		})
+	}
+}
+
+func TestCursorAfterValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  cursor
+		wantErr bool
+	}{
+		{"added", cursor{Sort: "added", ID: testCursorID, Value: "2026-10-19T12:00:00.5Z"}, false},
+		{"title", cursor{Sort: "title", ID: testCursorID, Value: "anything goes"}, false},
+		{"duration", cursor{Sort: "duration", ID: testCursorID, Value: "215.04"}, false},
+		{"malformed time", cursor{Sort: "added", ID: testCursorID, Value: "yesterday"}, true},
+		{"malformed number", cursor{Sort: "tempo", ID: testCursorID, Value: "fast"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _, _, _, err := tt.cursor.afterValues()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("afterValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!id.Valid || id.String != testCursorID) {
+				t.Errorf("afterValues() id = %+v", id)
+			}
+		})
+	}
+	var first *cursor
+	if id, _, _, _, err := first.afterValues(); err != nil || id.Valid {
+		t.Errorf("afterValues() of the first page = %+v, %v", id, err)
+	}
+}
+
+func TestCursorValueRoundTrip(t *testing.T) {
+	createdAt := pgtype.Timestamptz{Time: time.Date(2026, 10, 19, 12, 0, 0, 123456000, time.UTC), Valid: true}
+	var tempo pgtype.Numeric
+	if err := tempo.Scan("128.5"); err != nil {
+		t.Fatal(err)
+	}
+	added := cursor{Sort: "added", ID: testCursorID, Value: cursorValue("added", "", pgtype.Numeric{}, pgtype.Numeric{}, createdAt)}
+	_, _, _, after, err := added.afterValues()
+	if err != nil || !after.Time.Equal(createdAt.Time) {
+		t.Errorf("added cursor value %q parsed to %v, %v", added.Value, after.Time, err)
+	}
+	byTempo := cursor{Sort: "tempo", ID: testCursorID, Value: cursorValue("tempo", "", pgtype.Numeric{}, tempo, createdAt)}
+	_, _, numeric, _, err := byTempo.afterValues()
+	if err != nil {
+		t.Fatalf("tempo cursor value %q: %v", byTempo.Value, err)
+	}
+	if value, _ := numeric.Float64Value(); value.Float64 != 128.5 {
+		t.Errorf("tempo cursor value %q parsed to %v", byTempo.Value, value.Float64)
+	}
+}
+
+func TestParsePageRequest(t *testing.T) {
+	sorts := []string{"added", "title", "tempo"}
+	titleCursor := cursor{Sort: "title", ID: testCursorID, Value: "b"}.encode()
+	tests := []struct {
+		name    string
+		query   string
+		want    pageRequest
+		wantErr bool
+	}{
+		{name: "defaults", query: "", want: pageRequest{Sort: "added", Descending: true, Limit: 50}},
+		{name: "title ascending", query: "sort=title&limit=10", want: pageRequest{Sort: "title", Limit: 10}},
+		{name: "explicit order", query: "sort=added&order=asc", want: pageRequest{Sort: "added", Limit: 50}},
+		{name: "unknown sort", query: "sort=random", wantErr: true},
+		{name: "unknown order", query: "order=up", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "large limit", query: "limit=201", wantErr: true},
+		{name: "malformed limit", query: "limit=ten", wantErr: true},
+		{name: "malformed cursor", query: "cursor=abc", wantErr: true},
+		{name: "cursor of another sort", query: "sort=tempo&cursor=" + titleCursor, wantErr: true},
+		{name: "cursor of another order", query: "sort=title&order=desc&cursor=" + titleCursor, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePageRequest(httptest.NewRequest("GET", "/tracks?"+tt.query, nil), sorts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePageRequest(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parsePageRequest(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+	got, err := parsePageRequest(httptest.NewRequest("GET", "/tracks?sort=title&cursor="+titleCursor, nil), sorts)
+	if err != nil || got.After == nil || got.After.Value != "b" {
+		t.Errorf("parsePageRequest() with a cursor = %+v, %v", got, err)
+	}
+}
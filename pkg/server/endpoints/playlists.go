@@ -0,0 +1,645 @@
+package endpoints
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/catalogue"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/valyala/fastjson"
+)
+
+type Playlist struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	AnonID      *string   `json:"anon_id"`
+	UserID      *string   `json:"user_id"`
+	TrackCount  int64     `json:"track_count"`
+	Length      float64   `json:"length"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type PlaylistItem struct {
+	ID       string       `json:"id"`
+	Position int32        `json:"position"`
+	AddedAt  time.Time    `json:"added_at"`
+	Track    TrackSummary `json:"track"`
+}
+
+type PlaylistResponse struct {
+	Playlist
+	Items []PlaylistItem `json:"items"`
+}
+
+type CreatePlaylistRequest struct {
+	Name        string   `json:"name"`
+	Description *string  `json:"description"`
+	TrackIDs    []string `json:"trackIds"`
+}
+
+// UpdatePlaylistRequest keeps the fields that are not set
+type UpdatePlaylistRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+type AddPlaylistItemRequest struct {
+	TrackID string `json:"trackId"`
+	// appended if not set
+	Position *int32 `json:"position"`
+}
+
+type MovePlaylistItemRequest struct {
+	Position int32 `json:"position"`
+}
+
+// ListPlaylists lists playlists newest first, only the playlists of the user of the token if mine is true
+func ListPlaylists(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var params = db.ListPlaylistsParams{ResultLimit: 50, ResultOffset: 0}
+	if mine := r.URL.Query().Get("mine"); mine != "" {
+		parsed, err := strconv.ParseBool(mine)
+		if err != nil {
+			internal.WriteError(w, internal.InvalidQueryParameter(errors.New("mine must be true or false")))
+			return
+		}
+		if parsed {
+			user, ok := internal.UserFromContext(r.Context())
+			if !ok {
+				internal.WriteError(w, internal.Unauthorized(errors.New("mine requires a token")))
+				return
+			}
+			params.UserID = pgtype.Text{String: user.ID, Valid: true}
+		}
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			internal.WriteError(w, internal.InvalidQueryParameter(errors.New("limit must be between 1 and 500")))
+			return
+		}
+		params.ResultLimit = int32(parsed)
+	}
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		parsed, err := strconv.ParseInt(offset, 10, 32)
+		if err != nil || parsed < 0 {
+			internal.WriteError(w, internal.InvalidQueryParameter(errors.New("offset must not be negative")))
+			return
+		}
+		params.ResultOffset = int32(parsed)
+	}
+	rows, err := app.DB.ListPlaylists(r.Context(), params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = make([]Playlist, 0, len(rows))
+	for _, row := range rows {
+		length, _ := row.TotalDuration.Float64Value()
+		playlist := playlistSummary(db.Playlist{
+			ID:          row.ID,
+			Name:        row.Name,
+			Description: row.Description,
+			AnonID:      row.AnonID,
+			UserID:      row.UserID,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+		})
+		playlist.TrackCount, playlist.Length = row.TrackCount, length.Float64
+		response = append(response, playlist)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreatePlaylist creates a playlist owned by the user of the token, optionally with tracks in the given order
+func CreatePlaylist(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var body CreatePlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err.Error() == "EOF" {
+			internal.WriteError(w, internal.MissingJSONBody(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	user, authenticated := internal.UserFromContext(r.Context())
+	if !authenticated {
+		internal.WriteError(w, internal.Unauthorized(errors.New("creating a playlist requires a token")))
+		return
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		internal.WriteError(w, internal.MalformedJSONBody(errors.New("name is required")))
+		return
+	}
+	for _, trackID := range body.TrackIDs {
+		if _, err := uuid.Parse(trackID); err != nil {
+			internal.WriteError(w, internal.MalformedJSONBody(fmt.Errorf("track id %s is not a uuid: %w", trackID, err)))
+			return
+		}
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	var description pgtype.Text
+	if body.Description != nil {
+		description = pgtype.Text{String: *body.Description, Valid: true}
+	}
+	playlist, err := qtx.CreatePlaylist(r.Context(), db.CreatePlaylistParams{
+		Name:        strings.TrimSpace(body.Name),
+		Description: description,
+		UserID:      pgtype.Text{String: user.ID, Valid: true},
+	})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	for i, trackID := range body.TrackIDs {
+		exists, err := qtx.TrackExists(r.Context(), trackID)
+		if err != nil {
+			internal.ServerError(w, err)
+			return
+		}
+		if !exists {
+			internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("track %s does not exist", trackID)))
+			return
+		}
+		if _, err := qtx.InsertPlaylistItem(r.Context(), db.InsertPlaylistItemParams{PlaylistID: playlist.ID, TrackID: trackID, Position: int32(i)}); err != nil {
+			internal.ServerError(w, err)
+			return
+		}
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := playlistResponse(r.Context(), app, playlist)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetPlaylist returns the playlist with its tracks in order
+func GetPlaylist(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	playlistID, ok := playlistIDParam(w, r)
+	if !ok {
+		return
+	}
+	playlist, err := app.DB.GetPlaylist(r.Context(), playlistID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := playlistResponse(r.Context(), app, playlist)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExportPlaylist serves the playlist as M3U8 that points at the HLS playlist of every track, stem is instrumental
+// by default and instrumental tracks fall back to it for vocal. the urls are relative to this server unless
+// assets are served from the public base url, see playlistURL.
+func ExportPlaylist(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var stem = r.URL.Query().Get("stem")
+	if stem == "" {
+		stem = "instrumental"
+	}
+	if stem != "instrumental" && stem != "vocal" {
+		internal.WriteError(w, internal.InvalidQueryParameter(fmt.Errorf("stem must be instrumental or vocal, got %s", stem)))
+		return
+	}
+	playlistID, ok := playlistIDParam(w, r)
+	if !ok {
+		return
+	}
+	playlist, err := app.DB.GetPlaylist(r.Context(), playlistID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	items, err := app.DB.ListPlaylistItems(r.Context(), playlist.ID)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var entries = make([]internal.M3U8Entry, 0, len(items))
+	for _, item := range items {
+		length, _ := item.TotalDuration.Float64Value()
+		var url string
+		if stem == "vocal" && item.VocalFolderPath.Valid {
+			url, err = playlistURL(app, item.ID, "vocal", item.VocalFolderPath.String)
+		} else {
+			url, err = playlistURL(app, item.ID, "instrumental", item.InstrumentalFolderPath)
+		}
+		if err != nil {
+			internal.ServerError(w, err)
+			return
+		}
+		entries = append(entries, internal.M3U8Entry{
+			Duration: length.Float64,
+			Title:    fmt.Sprintf("%s - %s", fastjson.GetString(item.Info, "Artist"), fastjson.GetString(item.Info, "Title")),
+			URL:      url,
+		})
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.WriteHeader(http.StatusOK)
+	internal.WriteM3U8(w, playlist.Name, entries)
+}
+
+// UpdatePlaylist renames the playlist or changes its description, see lockOwnedPlaylist for who can change it
+func UpdatePlaylist(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var body UpdatePlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err.Error() == "EOF" {
+			internal.WriteError(w, internal.MissingJSONBody(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	var params db.UpdatePlaylistParams
+	if body.Name != nil {
+		if strings.TrimSpace(*body.Name) == "" {
+			internal.WriteError(w, internal.MalformedJSONBody(errors.New("name cannot be empty")))
+			return
+		}
+		params.Name = pgtype.Text{String: strings.TrimSpace(*body.Name), Valid: true}
+	}
+	if body.Description != nil {
+		params.Description = pgtype.Text{String: *body.Description, Valid: true}
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	playlist, ok := lockOwnedPlaylist(w, r, qtx)
+	if !ok {
+		return
+	}
+	params.ID = playlist.ID
+	if playlist, err = qtx.UpdatePlaylist(r.Context(), params); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := playlistResponse(r.Context(), app, playlist)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func DeletePlaylist(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	playlist, ok := lockOwnedPlaylist(w, r, qtx)
+	if !ok {
+		return
+	}
+	if err := qtx.DeletePlaylist(r.Context(), playlist.ID); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddPlaylistItem inserts the track at the position, or appends it if no position is given.
+// items at and after the position move one position down.
+func AddPlaylistItem(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var body AddPlaylistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err.Error() == "EOF" {
+			internal.WriteError(w, internal.MissingJSONBody(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	if _, err := uuid.Parse(body.TrackID); err != nil {
+		internal.WriteError(w, internal.MalformedJSONBody(fmt.Errorf("trackId is not a uuid: %w", err)))
+		return
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	playlist, ok := lockOwnedPlaylist(w, r, qtx)
+	if !ok {
+		return
+	}
+	exists, err := qtx.TrackExists(r.Context(), body.TrackID)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if !exists {
+		internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("track %s does not exist", body.TrackID)))
+		return
+	}
+	count, err := qtx.CountPlaylistItems(r.Context(), playlist.ID)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var position = int32(count)
+	if body.Position != nil {
+		if *body.Position < 0 || int64(*body.Position) > count {
+			internal.WriteError(w, internal.MalformedJSONBody(fmt.Errorf("position must be between 0 and %d", count)))
+			return
+		}
+		position = *body.Position
+	}
+	if _, err := qtx.InsertPlaylistItem(r.Context(), db.InsertPlaylistItemParams{PlaylistID: playlist.ID, TrackID: body.TrackID, Position: position}); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := playlistResponse(r.Context(), app, playlist)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// MovePlaylistItem moves the item to the position, items in between move by one position
+func MovePlaylistItem(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var body MovePlaylistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err.Error() == "EOF" {
+			internal.WriteError(w, internal.MissingJSONBody(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	itemID, ok := playlistItemIDParam(w, r)
+	if !ok {
+		return
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	playlist, ok := lockOwnedPlaylist(w, r, qtx)
+	if !ok {
+		return
+	}
+	item, err := qtx.GetPlaylistItem(r.Context(), db.GetPlaylistItemParams{ID: itemID, PlaylistID: playlist.ID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	count, err := qtx.CountPlaylistItems(r.Context(), playlist.ID)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if body.Position < 0 || int64(body.Position) >= count {
+		internal.WriteError(w, internal.MalformedJSONBody(fmt.Errorf("position must be between 0 and %d", count-1)))
+		return
+	}
+	err = qtx.MovePlaylistItem(r.Context(), db.MovePlaylistItemParams{
+		ID:          item.ID,
+		PlaylistID:  playlist.ID,
+		OldPosition: item.Position,
+		NewPosition: body.Position,
+	})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := playlistResponse(r.Context(), app, playlist)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeletePlaylistItem removes the item, the items after it move one position up
+func DeletePlaylistItem(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	itemID, ok := playlistItemIDParam(w, r)
+	if !ok {
+		return
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	playlist, ok := lockOwnedPlaylist(w, r, qtx)
+	if !ok {
+		return
+	}
+	deleted, err := qtx.DeletePlaylistItem(r.Context(), db.DeletePlaylistItemParams{ID: itemID, PlaylistID: playlist.ID})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if deleted == 0 {
+		internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("item %s is not in playlist %s", itemID, playlist.ID)))
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := playlistResponse(r.Context(), app, playlist)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// lockOwnedPlaylist locks the playlist for the transaction of q and writes 403 unless the user of the token may
+// change it. playlists of users can only be changed by their user and playlists created with the cli by any user.
+// playlists of anonymous listeners cannot prove their owner and can only be changed with the cli.
+func lockOwnedPlaylist(w http.ResponseWriter, r *http.Request, q *db.Queries) (db.Playlist, bool) {
+	playlistID, ok := playlistIDParam(w, r)
+	if !ok {
+		return db.Playlist{}, false
+	}
+	playlist, err := q.TouchPlaylist(r.Context(), playlistID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return playlist, false
+		}
+		internal.ServerError(w, err)
+		return playlist, false
+	}
+	var (
+		user, authenticated = internal.UserFromContext(r.Context())
+		allowed             bool
+	)
+	switch {
+	case playlist.UserID.Valid:
+		allowed = authenticated && user.ID == playlist.UserID.String
+	case playlist.AnonID.Valid:
+		allowed = false
+	default:
+		allowed = authenticated
+	}
+	if !allowed {
+		internal.WriteError(w, internal.Forbidden(fmt.Errorf("playlist %s cannot be changed by user %q", playlist.ID, user.Username)))
+		return playlist, false
+	}
+	return playlist, true
+}
+
+func playlistResponse(ctx context.Context, app internal.AppCtx, playlist db.Playlist) (PlaylistResponse, error) {
+	var response = PlaylistResponse{Playlist: playlistSummary(playlist)}
+	items, err := app.DB.ListPlaylistItems(ctx, playlist.ID)
+	if err != nil {
+		return response, err
+	}
+	response.Items = make([]PlaylistItem, 0, len(items))
+	for _, item := range items {
+		summary := trackSummary(catalogue.Track{
+			ID:            item.ID,
+			AlbumID:       item.AlbumID,
+			AlbumName:     item.AlbumName,
+			TotalDuration: item.TotalDuration,
+			Info:          item.Info,
+			Instrumental:  item.Instrumental,
+			Tempo:         item.Tempo,
+			Key:           item.Key,
+			CreatedAt:     item.CreatedAt,
+		})
+		response.TrackCount++
+		response.Length += summary.Length
+		response.Items = append(response.Items, PlaylistItem{
+			ID:       item.ItemID,
+			Position: item.Position,
+			AddedAt:  item.AddedAt.Time,
+			Track:    summary,
+		})
+	}
+	return response, nil
+}
+
+func playlistSummary(playlist db.Playlist) Playlist {
+	var summary = Playlist{
+		ID:        playlist.ID,
+		Name:      playlist.Name,
+		CreatedAt: playlist.CreatedAt.Time,
+		UpdatedAt: playlist.UpdatedAt.Time,
+	}
+	if playlist.Description.Valid {
+		summary.Description = &playlist.Description.String
+	}
+	if playlist.AnonID.Valid {
+		summary.AnonID = &playlist.AnonID.String
+	}
+	if playlist.UserID.Valid {
+		summary.UserID = &playlist.UserID.String
+	}
+	return summary
+}
+
+// playlistIDParam writes 404 if the playlist id is not a uuid
+func playlistIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var playlistID = chi.URLParam(r, "playlistId")
+	if _, err := uuid.Parse(playlistID); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return "", false
+	}
+	return playlistID, true
+}
+
+func playlistItemIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var itemID = chi.URLParam(r, "itemId")
+	if _, err := uuid.Parse(itemID); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return "", false
+	}
+	return itemID, true
+}
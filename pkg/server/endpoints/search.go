@@ -0,0 +1,196 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/valyala/fastjson"
+)
+
+type TrackSearchResult struct {
+	ID           string  `json:"id"`
+	Title        string  `json:"title"`
+	Artist       string  `json:"artist"`
+	AlbumID      string  `json:"album_id"`
+	AlbumName    string  `json:"album_name"`
+	Genre        string  `json:"genre"`
+	Length       float64 `json:"length"`
+	Instrumental bool    `json:"instrumental"`
+	Rank         float64 `json:"rank"`
+	Highlights   struct {
+		Title  string `json:"title"`
+		Artist string `json:"artist"`
+		Album  string `json:"album"`
+	} `json:"highlights"`
+}
+
+type AlbumSearchResult struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Artist     string  `json:"artist"`
+	Cover      *string `json:"cover"`
+	Year       *int32  `json:"year"`
+	Genre      *string `json:"genre"`
+	TrackCount int32   `json:"track_count"`
+	Rank       float64 `json:"rank"`
+	Highlights struct {
+		Name   string `json:"name"`
+		Artist string `json:"artist"`
+	} `json:"highlights"`
+}
+
+type ArtistSearchResult struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	SortName   string   `json:"sort_name"`
+	Aliases    []string `json:"aliases"`
+	Rank       float64  `json:"rank"`
+	Highlights struct {
+		Name string `json:"name"`
+	} `json:"highlights"`
+}
+
+type SearchResponse struct {
+	Tracks  []TrackSearchResult  `json:"tracks"`
+	Albums  []AlbumSearchResult  `json:"albums"`
+	Artists []ArtistSearchResult `json:"artists"`
+}
+
+type Suggestion struct {
+	Kind  string `json:"kind"`
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+// Search ranks tracks, albums and artists matching the q query parameter.
+// every word is matched as a prefix and small typos in titles and names are tolerated,
+// highlights are HTML escaped with the matched words wrapped with <mark></mark>.
+func Search(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	term, prefixQuery, limit, err := searchParams(r)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	var response = SearchResponse{
+		Tracks:  []TrackSearchResult{},
+		Albums:  []AlbumSearchResult{},
+		Artists: []ArtistSearchResult{},
+	}
+	tracks, err := app.DB.SearchTracks(r.Context(), db.SearchTracksParams{PrefixQuery: prefixQuery, Term: term, ResultLimit: limit})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	for _, track := range tracks {
+		length, err := track.TotalDuration.Float64Value()
+		if err != nil {
+			internal.ServerError(w, err)
+			return
+		}
+		var result = TrackSearchResult{
+			ID:           track.ID,
+			Title:        fastjson.GetString(track.Info, "Title"),
+			Artist:       fastjson.GetString(track.Info, "Artist"),
+			AlbumID:      track.AlbumID,
+			AlbumName:    track.AlbumName,
+			Genre:        fastjson.GetString(track.Info, "Genre"),
+			Length:       length.Float64,
+			Instrumental: track.Instrumental,
+			Rank:         track.Rank,
+		}
+		result.Highlights.Title = track.TitleHighlight
+		result.Highlights.Artist = track.ArtistHighlight
+		result.Highlights.Album = track.AlbumHighlight
+		response.Tracks = append(response.Tracks, result)
+	}
+	albums, err := app.DB.SearchAlbums(r.Context(), db.SearchAlbumsParams{PrefixQuery: prefixQuery, Term: term, ResultLimit: limit})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	for _, album := range albums {
+		var result = AlbumSearchResult{
+			ID:         album.ID,
+			Name:       album.Name,
+			Artist:     album.Artist,
+			TrackCount: album.TrackCount,
+			Rank:       album.Rank,
+		}
+		if album.Cover.Valid {
+			result.Cover = &album.Cover.String
+		}
+		if album.Year.Valid {
+			result.Year = &album.Year.Int32
+		}
+		if album.Genre.Valid {
+			result.Genre = &album.Genre.String
+		}
+		result.Highlights.Name = album.NameHighlight
+		result.Highlights.Artist = album.ArtistHighlight
+		response.Albums = append(response.Albums, result)
+	}
+	artists, err := app.DB.SearchArtists(r.Context(), db.SearchArtistsParams{PrefixQuery: prefixQuery, Term: term, ResultLimit: limit})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	for _, artist := range artists {
+		var result = ArtistSearchResult{
+			ID:       artist.ID,
+			Name:     artist.Name,
+			SortName: artist.SortName,
+			Aliases:  artist.Aliases,
+			Rank:     artist.Rank,
+		}
+		result.Highlights.Name = artist.NameHighlight
+		response.Artists = append(response.Artists, result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Suggest returns track titles, album names and artist names starting with the words typed so far in q, for autocomplete
+func Suggest(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	_, prefixQuery, limit, err := searchParams(r)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	rows, err := app.DB.AutocompleteSearch(r.Context(), db.AutocompleteSearchParams{PrefixQuery: prefixQuery, ResultLimit: limit})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = make([]Suggestion, 0, len(rows))
+	for _, row := range rows {
+		response = append(response, Suggestion{Kind: row.Kind, ID: row.ID, Label: row.Label})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func searchParams(r *http.Request) (term string, prefixQuery string, limit int32, err error) {
+	term = r.URL.Query().Get("q")
+	prefixQuery = internal.PrefixTSQuery(term)
+	if prefixQuery == "" {
+		return "", "", 0, errors.New("q must contain at least one letter or number")
+	}
+	limit = 10
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			return "", "", 0, errors.New("limit must be between 1 and 100")
+		}
+		limit = int32(parsed)
+	}
+	return term, prefixQuery, limit, nil
+}
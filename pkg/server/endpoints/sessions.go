@@ -0,0 +1,447 @@
+package endpoints
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// tracks appended to the queue of a session at once
+	shuffleBatchSize = 100
+	maxPeek          = 10
+)
+
+type CreateSessionRequest struct {
+	AnonID string      `json:"anonId"`
+	Filter TrackFilter `json:"filter"`
+	// the queue of the same seed, filter and library is always shuffled the same way, the anon id by default
+	Seed string `json:"seed"`
+}
+
+type Session struct {
+	ID        string      `json:"id"`
+	AnonID    string      `json:"anon_id"`
+	Filter    TrackFilter `json:"filter"`
+	Seed      string      `json:"seed"`
+	Position  int32       `json:"position"`
+	Queued    int64       `json:"queued"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type SessionTrack struct {
+	Position int32 `json:"position"`
+	Track
+}
+
+// CreateSession creates a shuffle session with the tracks matching the filter queued, unlistened tracks first.
+// the session is positioned before the first track, the first next request returns the first track.
+func CreateSession(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var body CreateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err.Error() == "EOF" {
+			internal.WriteError(w, internal.MissingJSONBody(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	if body.AnonID == "" {
+		internal.WriteError(w, internal.MalformedJSONBody(errors.New("anonId is required")))
+		return
+	}
+	filter, err := body.Filter.params()
+	if err != nil {
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	if body.Seed == "" {
+		body.Seed = body.AnonID
+	}
+	rawFilter, err := json.Marshal(body.Filter)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	var params = db.CreateShuffleSessionParams{AnonID: body.AnonID, Filter: rawFilter, Seed: body.Seed}
+	if user, ok := internal.UserFromContext(r.Context()); ok {
+		params.UserID = pgtype.Text{String: user.ID, Valid: true}
+	}
+	session, err := qtx.CreateShuffleSession(r.Context(), params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	shuffled, err := qtx.OrderShuffleSessionCycle(r.Context(), shuffleSessionParams(filter, session))
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if shuffled == 0 {
+		internal.WriteError(w, internal.ResourceNotFound(errors.New("no track matches the filter")))
+		return
+	}
+	if _, err := qtx.AppendShuffleSessionTracks(r.Context(), appendShuffleSessionParams(session)); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := sessionResponse(r.Context(), app, session)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func GetSession(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	sessionID, ok := sessionIDParam(w, r)
+	if !ok {
+		return
+	}
+	session, err := app.DB.GetShuffleSession(r.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	if !sessionOwned(w, r, session) {
+		return
+	}
+	response, err := sessionResponse(r.Context(), app, session)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func DeleteSession(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	sessionID, ok := sessionIDParam(w, r)
+	if !ok {
+		return
+	}
+	session, err := app.DB.GetShuffleSession(r.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	if !sessionOwned(w, r, session) {
+		return
+	}
+	if err := app.DB.DeleteShuffleSession(r.Context(), session.ID); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NextSessionTrack moves the session to the next track and returns it, the queue is extended as it runs out.
+// once every matching track was played the queue starts over with a new shuffle.
+func NextSessionTrack(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	sessionID, ok := sessionIDParam(w, r)
+	if !ok {
+		return
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	session, err := qtx.LockShuffleSession(r.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	if !sessionOwned(w, r, session) {
+		return
+	}
+	upcoming, err := upcomingSessionTracks(r.Context(), qtx, session, 1)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if len(upcoming) == 0 {
+		internal.WriteError(w, internal.ResourceNotFound(errors.New("no track matches the filter of the session anymore")))
+		return
+	}
+	if err := qtx.SetShuffleSessionPosition(r.Context(), db.SetShuffleSessionPositionParams{ID: session.ID, Position: upcoming[0].Position}); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := sessionTrack(r.Context(), app, upcoming[0].Position, upcoming[0].TrackID)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	// handed out like /track/random so that the rotation of the listener skips the track
+	err = app.DB.RecordListeningHistory(r.Context(), db.RecordListeningHistoryParams{
+		TrackID:    response.ID,
+		AnonID:     session.AnonID,
+		ListenedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// PrevSessionTrack moves the session back to the previous track and returns it, 404 at the first track
+func PrevSessionTrack(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	sessionID, ok := sessionIDParam(w, r)
+	if !ok {
+		return
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	session, err := qtx.LockShuffleSession(r.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	if !sessionOwned(w, r, session) {
+		return
+	}
+	previous, err := qtx.GetShuffleSessionTrackBefore(r.Context(), db.GetShuffleSessionTrackBeforeParams{SessionID: session.ID, BeforePosition: session.Position})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(errors.New("session is at the first track")))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	if err := qtx.SetShuffleSessionPosition(r.Context(), db.SetShuffleSessionPositionParams{ID: session.ID, Position: previous.Position}); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := sessionTrack(r.Context(), app, previous.Position, previous.TrackID)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// PeekSessionTracks returns the next n tracks (3 by default, at most 10) without moving the session,
+// clients prefetch their metadata and playlists
+func PeekSessionTracks(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	sessionID, ok := sessionIDParam(w, r)
+	if !ok {
+		return
+	}
+	var n int32 = 3
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || parsed <= 0 || parsed > maxPeek {
+			internal.WriteError(w, internal.InvalidQueryParameter(fmt.Errorf("n must be between 1 and %d", maxPeek)))
+			return
+		}
+		n = int32(parsed)
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	session, err := qtx.LockShuffleSession(r.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	if !sessionOwned(w, r, session) {
+		return
+	}
+	upcoming, err := upcomingSessionTracks(r.Context(), qtx, session, n)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = make([]SessionTrack, 0, len(upcoming))
+	for _, queued := range upcoming {
+		track, err := sessionTrack(r.Context(), app, queued.Position, queued.TrackID)
+		if err != nil {
+			internal.ServerError(w, err)
+			return
+		}
+		response = append(response, track)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// upcomingSessionTracks lists the next n queued tracks after the position of the session, appending the next
+// batch of the shuffle if fewer are queued. the session must be locked by the transaction of q.
+func upcomingSessionTracks(ctx context.Context, q *db.Queries, session db.ShuffleSession, n int32) ([]db.ListShuffleSessionTracksAfterRow, error) {
+	var params = db.ListShuffleSessionTracksAfterParams{SessionID: session.ID, AfterPosition: session.Position, ResultLimit: n}
+	upcoming, err := q.ListShuffleSessionTracksAfter(ctx, params)
+	if err != nil || int32(len(upcoming)) == n {
+		return upcoming, err
+	}
+	var filter TrackFilter
+	if err := json.Unmarshal(session.Filter, &filter); err != nil {
+		return nil, fmt.Errorf("failed to parse filter of session %s: %w", session.ID, err)
+	}
+	filterParams, err := filter.params()
+	if err != nil {
+		return nil, fmt.Errorf("filter of session %s is invalid: %w", session.ID, err)
+	}
+	for int32(len(upcoming)) < n {
+		appended, err := q.AppendShuffleSessionTracks(ctx, appendShuffleSessionParams(session))
+		if err != nil {
+			return nil, err
+		}
+		if appended == 0 {
+			// the shuffle of this cycle was queued, start over with a new shuffle
+			if err := q.StartShuffleSessionCycle(ctx, session.ID); err != nil {
+				return nil, err
+			}
+			session.Cycle++
+			shuffled, err := q.OrderShuffleSessionCycle(ctx, shuffleSessionParams(filterParams, session))
+			if err != nil {
+				return nil, err
+			}
+			if shuffled == 0 {
+				// no track matches the filter anymore
+				break
+			}
+			if _, err = q.AppendShuffleSessionTracks(ctx, appendShuffleSessionParams(session)); err != nil {
+				return nil, err
+			}
+		}
+		if upcoming, err = q.ListShuffleSessionTracksAfter(ctx, params); err != nil {
+			return nil, err
+		}
+	}
+	return upcoming, nil
+}
+
+func appendShuffleSessionParams(session db.ShuffleSession) db.AppendShuffleSessionTracksParams {
+	return db.AppendShuffleSessionTracksParams{SessionID: session.ID, Cycle: session.Cycle, BatchSize: shuffleBatchSize}
+}
+
+func sessionTrack(ctx context.Context, app internal.AppCtx, position int32, trackID string) (SessionTrack, error) {
+	track, err := app.DB.GetTrackByID(ctx, trackID)
+	if err != nil {
+		return SessionTrack{}, err
+	}
+	response, err := trackResponse(ctx, app, track)
+	if err != nil {
+		return SessionTrack{}, err
+	}
+	return SessionTrack{Position: position, Track: response}, nil
+}
+
+func sessionResponse(ctx context.Context, app internal.AppCtx, session db.ShuffleSession) (Session, error) {
+	var response = Session{
+		ID:        session.ID,
+		AnonID:    session.AnonID,
+		Seed:      session.Seed,
+		Position:  session.Position,
+		CreatedAt: session.CreatedAt.Time,
+	}
+	if err := json.Unmarshal(session.Filter, &response.Filter); err != nil {
+		return response, fmt.Errorf("failed to parse filter of session %s: %w", session.ID, err)
+	}
+	var err error
+	response.Queued, err = app.DB.CountShuffleSessionTracks(ctx, session.ID)
+	return response, err
+}
+
+// sessionOwned writes 404 for sessions of other users, their ids are not revealed. sessions of anonymous listeners
+// are reached by anyone with their id, like uploads.
+func sessionOwned(w http.ResponseWriter, r *http.Request, session db.ShuffleSession) bool {
+	if user, _ := internal.UserFromContext(r.Context()); session.UserID.Valid && session.UserID.String != user.ID {
+		internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("session %s does not exist", session.ID)))
+		return false
+	}
+	return true
+}
+
+// sessionIDParam writes 404 if the session id is not a uuid
+func sessionIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var sessionID = chi.URLParam(r, "sessionId")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return "", false
+	}
+	return sessionID, true
+}
@@ -0,0 +1,403 @@
+package endpoints
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// the schedule of every station is kept at least this far ahead
+	stationHorizon   = time.Hour
+	stationBatchSize = 20
+	// tracks among the last scheduled tracks are not scheduled again, unless the station has fewer tracks
+	stationRecentTracks = 50
+	// ended tracks are kept this long
+	stationRetention         = 24 * time.Hour
+	stationSchedulerInterval = time.Minute
+	// proxies close idle connections, a comment is sent if no track change was sent for this long
+	stationKeepAlive = 15 * time.Second
+)
+
+var (
+	stationNamePattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	errNothingScheduled = errors.New("no track matches the filter of the station")
+)
+
+type Station struct {
+	Name      string      `json:"name"`
+	Filter    TrackFilter `json:"filter"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type CreateStationRequest struct {
+	// lowercase letters, digits, - and _, used in urls
+	Name   string      `json:"name"`
+	Filter TrackFilter `json:"filter"`
+}
+
+type StationTrack struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Track
+}
+
+// NowPlaying is what every listener of the station hears at ServerTime, clients start Current at Offset
+// and correct for the difference of their clock to ServerTime.
+type NowPlaying struct {
+	Station    string    `json:"station"`
+	ServerTime time.Time `json:"server_time"`
+	// seconds into the current track, negative if the station is silent until the track starts
+	Offset  float64       `json:"offset"`
+	Current StationTrack  `json:"current"`
+	Next    *StationTrack `json:"next"`
+}
+
+// ListStations lists the stations by name
+func ListStations(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	stations, err := app.DB.ListStations(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = make([]Station, 0, len(stations))
+	for _, station := range stations {
+		summary, err := stationResponse(station)
+		if err != nil {
+			internal.ServerError(w, err)
+			return
+		}
+		response = append(response, summary)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateStation creates a station playing the tracks matching the filter, the station starts playing right away
+func CreateStation(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var body CreateStationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if err.Error() == "EOF" {
+			internal.WriteError(w, internal.MissingJSONBody(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	if !stationNamePattern.MatchString(body.Name) {
+		internal.WriteError(w, internal.MalformedJSONBody(fmt.Errorf("name must be lowercase letters, digits, - and _, got %q", body.Name)))
+		return
+	}
+	if _, err := body.Filter.params(); err != nil {
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	rawFilter, err := json.Marshal(body.Filter)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	tx, err := app.Conn.Begin(r.Context())
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.DB.WithTx(tx)
+	station, err := qtx.CreateStation(r.Context(), db.CreateStationParams{Name: body.Name, Filter: rawFilter})
+	if err != nil {
+		if db.IsUniqueViolation(err) {
+			internal.WriteError(w, internal.ResourceConflict(fmt.Errorf("station %s already exists", body.Name)))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	if err := extendStationSchedule(r.Context(), qtx, station); err != nil {
+		if errors.Is(err, errNothingScheduled) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	response, err := stationResponse(station)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteStation deletes the station with its schedule
+func DeleteStation(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	deleted, err := app.DB.DeleteStation(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	if deleted == 0 {
+		internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("station %s does not exist", chi.URLParam(r, "name"))))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNowPlaying returns the track the station is playing, how far into it the station is and the next track
+func GetNowPlaying(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	station, ok := stationParam(w, r, app)
+	if !ok {
+		return
+	}
+	response, err := nowPlaying(r.Context(), app, station)
+	if err != nil {
+		if errors.Is(err, errNothingScheduled) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// StreamStation sends what the station is playing as a server-sent event right away and again on every track change
+func StreamStation(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	station, ok := stationParam(w, r, app)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internal.ServerError(w, errors.New("response writer does not support flushing"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx buffers responses otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(stationKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		now, err := nowPlaying(r.Context(), app, station)
+		if err != nil {
+			if r.Context().Err() == nil {
+				log.Error().Err(err).Str("station", station.Name).Msg("failed to get now playing")
+			}
+			return
+		}
+		payload, err := json.Marshal(now)
+		if err != nil {
+			log.Error().Err(err).Str("station", station.Name).Msg("failed to encode now playing")
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: track\ndata: %s\n\n", payload); err != nil {
+			return
+		}
+		flusher.Flush()
+		// the next change is the end of the current track, or its start if the station is silent until then
+		change := now.Current.EndsAt
+		if now.Offset < 0 {
+			change = now.Current.StartsAt
+		}
+		next := time.NewTimer(time.Until(change))
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				next.Stop()
+				return
+			case <-app.Shutdown.Done():
+				next.Stop()
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					next.Stop()
+					return
+				}
+				flusher.Flush()
+			case <-next.C:
+				break wait
+			}
+		}
+	}
+}
+
+// RunStationScheduler keeps the schedule of every station stationHorizon ahead until ctx is done.
+// every server can run it, servers extending the same station at the same time are serialized.
+func RunStationScheduler(ctx context.Context, app internal.AppCtx) {
+	ticker := time.NewTicker(stationSchedulerInterval)
+	defer ticker.Stop()
+	for {
+		stations, err := app.DB.ListStations(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to list stations")
+		}
+		for _, station := range stations {
+			if err := scheduleStation(ctx, app, station); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Str("station", station.Name).Msg("failed to extend station schedule")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func scheduleStation(ctx context.Context, app internal.AppCtx, station db.Station) error {
+	tx, err := app.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	qtx := app.DB.WithTx(tx)
+	if _, err := qtx.LockStation(ctx, station.ID); err != nil {
+		return err
+	}
+	if err := extendStationSchedule(ctx, qtx, station); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// extendStationSchedule schedules tracks until the schedule reaches stationHorizon and deletes the tracks that
+// ended before stationRetention. recently played tracks are scheduled again if the station has too few tracks.
+func extendStationSchedule(ctx context.Context, q *db.Queries, station db.Station) error {
+	var filter TrackFilter
+	if err := json.Unmarshal(station.Filter, &filter); err != nil {
+		return fmt.Errorf("failed to parse filter of station %s: %w", station.Name, err)
+	}
+	params, err := filter.params()
+	if err != nil {
+		return fmt.Errorf("invalid filter of station %s: %w", station.Name, err)
+	}
+	horizon := time.Now().Add(stationHorizon)
+	for {
+		end, err := q.GetStationScheduleEnd(ctx, station.ID)
+		if err != nil {
+			return err
+		}
+		if end.Valid && end.Time.After(horizon) {
+			break
+		}
+		scheduled, err := q.AppendStationSchedule(ctx, stationScheduleParams(params, station.ID, stationRecentTracks))
+		if err != nil {
+			return err
+		}
+		if scheduled == 0 {
+			scheduled, err = q.AppendStationSchedule(ctx, stationScheduleParams(params, station.ID, 0))
+			if err != nil {
+				return err
+			}
+		}
+		if scheduled == 0 {
+			return errNothingScheduled
+		}
+	}
+	_, err = q.PruneStationSchedule(ctx, db.PruneStationScheduleParams{
+		StationID: station.ID,
+		EndsAt:    pgtype.Timestamptz{Time: time.Now().Add(-stationRetention), Valid: true},
+	})
+	return err
+}
+
+// nowPlaying extends the schedule first if it ran out, such as after the servers were down
+func nowPlaying(ctx context.Context, app internal.AppCtx, station db.Station) (NowPlaying, error) {
+	var response = NowPlaying{Station: station.Name, ServerTime: time.Now()}
+	at := pgtype.Timestamptz{Time: response.ServerTime, Valid: true}
+	schedule, err := app.DB.ListStationSchedule(ctx, db.ListStationScheduleParams{StationID: station.ID, At: at, ResultLimit: 2})
+	if err != nil {
+		return response, err
+	}
+	if len(schedule) < 2 {
+		// a station with a single matching track keeps playing it
+		if err := scheduleStation(ctx, app, station); err != nil && !errors.Is(err, errNothingScheduled) {
+			return response, err
+		}
+		if schedule, err = app.DB.ListStationSchedule(ctx, db.ListStationScheduleParams{StationID: station.ID, At: at, ResultLimit: 2}); err != nil {
+			return response, err
+		}
+		if len(schedule) == 0 {
+			return response, errNothingScheduled
+		}
+	}
+	if response.Current, err = stationTrack(ctx, app, schedule[0]); err != nil {
+		return response, err
+	}
+	response.Offset = response.ServerTime.Sub(response.Current.StartsAt).Seconds()
+	if len(schedule) > 1 {
+		next, err := stationTrack(ctx, app, schedule[1])
+		if err != nil {
+			return response, err
+		}
+		response.Next = &next
+	}
+	return response, nil
+}
+
+func stationTrack(ctx context.Context, app internal.AppCtx, scheduled db.StationSchedule) (StationTrack, error) {
+	track, err := app.DB.GetTrackByID(ctx, scheduled.TrackID)
+	if err != nil {
+		return StationTrack{}, err
+	}
+	response, err := trackResponse(ctx, app, track)
+	if err != nil {
+		return StationTrack{}, err
+	}
+	return StationTrack{StartsAt: scheduled.StartsAt.Time, EndsAt: scheduled.EndsAt.Time, Track: response}, nil
+}
+
+func stationResponse(station db.Station) (Station, error) {
+	var response = Station{Name: station.Name, CreatedAt: station.CreatedAt.Time}
+	if err := json.Unmarshal(station.Filter, &response.Filter); err != nil {
+		return response, fmt.Errorf("failed to parse filter of station %s: %w", station.Name, err)
+	}
+	return response, nil
+}
+
+// stationParam writes 404 if the station does not exist
+func stationParam(w http.ResponseWriter, r *http.Request, app internal.AppCtx) (db.Station, bool) {
+	station, err := app.DB.GetStationByName(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return station, false
+		}
+		internal.ServerError(w, err)
+		return station, false
+	}
+	return station, true
+}
@@ -0,0 +1,248 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/valyala/fastjson"
+)
+
+// PlayCounts aggregates play events and random picks. plays are started playbacks, picks are the times
+// random selection handed the track out, skips in the last 10% of a track count as completes.
+type PlayCounts struct {
+	Plays           int64   `json:"plays"`
+	Completes       int64   `json:"completes"`
+	Skips           int64   `json:"skips"`
+	SkipRate        float64 `json:"skip_rate"`
+	ListenedSeconds float64 `json:"listened_seconds"`
+	Picks           int64   `json:"picks"`
+}
+
+type TrackPlays struct {
+	ID        string  `json:"id"`
+	Title     string  `json:"title"`
+	Artist    string  `json:"artist"`
+	AlbumName string  `json:"album_name"`
+	Length    float64 `json:"length"`
+	Listeners int64   `json:"listeners"`
+	PlayCounts
+}
+
+type ArtistPlays struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	TrackCount int64  `json:"track_count"`
+	PlayCounts
+}
+
+type HistoryEntry struct {
+	TrackID    string    `json:"track_id"`
+	Title      string    `json:"title"`
+	Artist     string    `json:"artist"`
+	AlbumName  string    `json:"album_name"`
+	Length     float64   `json:"length"`
+	ListenedAt time.Time `json:"listened_at"`
+}
+
+type TopTracksResponse struct {
+	internal.Window
+	Tracks []TrackPlays `json:"tracks"`
+}
+
+type TopArtistsResponse struct {
+	internal.Window
+	Artists []ArtistPlays `json:"artists"`
+}
+
+type HistoryResponse struct {
+	internal.Window
+	Totals     PlayCounts         `json:"totals"`
+	TrackCount int64              `json:"track_count"`
+	History    Page[HistoryEntry] `json:"history"`
+}
+
+// TopTracks ranks tracks by plays in the window, see parseWindow
+func TopTracks(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	window, limit, err := parseStatsRequest(r)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	since, until := window.Bounds()
+	rows, err := app.DB.TopTracks(r.Context(), db.TopTracksParams{ResultLimit: limit, Since: since, Until: until})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = TopTracksResponse{Window: window, Tracks: make([]TrackPlays, 0, len(rows))}
+	for _, row := range rows {
+		length, _ := row.TotalDuration.Float64Value()
+		response.Tracks = append(response.Tracks, TrackPlays{
+			ID:         row.ID,
+			Title:      fastjson.GetString(row.Info, "Title"),
+			Artist:     fastjson.GetString(row.Info, "Artist"),
+			AlbumName:  row.AlbumName,
+			Length:     length.Float64,
+			Listeners:  row.Listeners,
+			PlayCounts: playCounts(row.Plays, row.Completes, row.Skips, row.ListenedSeconds, row.Picks),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// TopArtists ranks artists by plays of the tracks they are credited on in the window, see parseWindow
+func TopArtists(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	window, limit, err := parseStatsRequest(r)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	since, until := window.Bounds()
+	rows, err := app.DB.TopArtists(r.Context(), db.TopArtistsParams{ResultLimit: limit, Since: since, Until: until})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = TopArtistsResponse{Window: window, Artists: make([]ArtistPlays, 0, len(rows))}
+	for _, row := range rows {
+		response.Artists = append(response.Artists, ArtistPlays{
+			ID:         row.ID,
+			Name:       row.Name,
+			TrackCount: row.TrackCount,
+			PlayCounts: playCounts(row.Plays, row.Completes, row.Skips, row.ListenedSeconds, row.Picks),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetListeningHistory lists the tracks handed out to the anonymous listener newest first with their play totals
+// in the window. the history is paginated with limit and cursor like the listings, see parsePageRequest.
+func GetListeningHistory(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var anonId = chi.URLParam(r, "anonId")
+	window, err := parseWindow(r)
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	page, err := parsePageRequest(r, []string{"added"})
+	if err != nil {
+		internal.WriteError(w, internal.InvalidQueryParameter(err))
+		return
+	}
+	if !page.Descending {
+		internal.WriteError(w, internal.InvalidQueryParameter(errors.New("history is listed newest first")))
+		return
+	}
+	since, until := window.Bounds()
+	var params = db.GetListeningHistoryParams{
+		AnonID:      anonId,
+		Since:       since,
+		Until:       until,
+		ResultLimit: page.Limit + 1,
+	}
+	if page.After != nil {
+		if params.AfterTrackID, _, _, params.AfterListenedAt, err = page.After.afterValues(); err != nil {
+			internal.WriteError(w, internal.InvalidQueryParameter(err))
+			return
+		}
+	}
+	rows, err := app.DB.GetListeningHistory(r.Context(), params)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	totals, err := app.DB.GetListenerPlayTotals(r.Context(), db.GetListenerPlayTotalsParams{AnonID: anonId, Since: since, Until: until})
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	var response = HistoryResponse{
+		Window:     window,
+		Totals:     playCounts(totals.Plays, totals.Completes, totals.Skips, totals.ListenedSeconds, totals.Picks),
+		TrackCount: totals.TrackCount,
+		History:    Page[HistoryEntry]{Items: make([]HistoryEntry, 0, len(rows))},
+	}
+	for i, row := range rows {
+		if i == int(page.Limit) {
+			last := rows[i-1]
+			next := cursor{Sort: page.Sort, Descending: page.Descending, ID: last.TrackID, Value: last.ListenedAt.Time.Format(time.RFC3339Nano)}.encode()
+			response.History.NextCursor = &next
+			break
+		}
+		length, _ := row.TotalDuration.Float64Value()
+		response.History.Items = append(response.History.Items, HistoryEntry{
+			TrackID:    row.TrackID,
+			Title:      fastjson.GetString(row.Info, "Title"),
+			Artist:     fastjson.GetString(row.Info, "Artist"),
+			AlbumName:  row.AlbumName,
+			Length:     length.Float64,
+			ListenedAt: row.ListenedAt.Time,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseWindow reads the window query parameter, internal.DefaultStatsWindow by default, see internal.ParseWindow.
+// the window ends now unless until is given as an RFC 3339 timestamp.
+func parseWindow(r *http.Request) (internal.Window, error) {
+	var until = time.Now()
+	if raw := r.URL.Query().Get("until"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return internal.Window{}, fmt.Errorf("until must be an RFC 3339 timestamp: %w", err)
+		}
+		until = parsed
+	}
+	var window = r.URL.Query().Get("window")
+	if window == "" {
+		window = internal.DefaultStatsWindow
+	}
+	return internal.ParseWindow(window, until)
+}
+
+// parseStatsRequest reads the window and the number of entries to rank, 10 by default
+func parseStatsRequest(r *http.Request) (internal.Window, int32, error) {
+	window, err := parseWindow(r)
+	if err != nil {
+		return window, 0, err
+	}
+	var limit int32 = 10
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			return window, 0, errors.New("limit must be between 1 and 100")
+		}
+		limit = int32(parsed)
+	}
+	return window, limit, nil
+}
+
+func playCounts(plays int64, completes int64, skips int64, listenedSeconds pgtype.Numeric, picks int64) PlayCounts {
+	listened, _ := listenedSeconds.Float64Value()
+	return PlayCounts{
+		Plays:           plays,
+		Completes:       completes,
+		Skips:           skips,
+		SkipRate:        internal.SkipRate(completes, skips),
+		ListenedSeconds: listened.Float64,
+		Picks:           picks,
+	}
+}
@@ -0,0 +1,337 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	// audio is sent this far ahead of the station clock, players keep playing through slow segment downloads
+	streamLead = 3 * time.Second
+	// frames are sent in chunks of about this long
+	streamChunkDuration = 250 * time.Millisecond
+	// segments are encoded with this bitrate
+	streamAACBitrate = 320
+	streamMP3Bitrate = 192
+)
+
+type streamFormat struct {
+	extension   string
+	contentType string
+	bitrate     int
+}
+
+var (
+	streamAAC = streamFormat{extension: "aac", contentType: "audio/aac", bitrate: streamAACBitrate}
+	streamMP3 = streamFormat{extension: "mp3", contentType: "audio/mpeg", bitrate: streamMP3Bitrate}
+)
+
+// StreamStationAAC streams the station as continuous ADTS, see streamStation
+func StreamStationAAC(w http.ResponseWriter, r *http.Request) {
+	streamStation(w, r, streamAAC)
+}
+
+// StreamStationMP3 streams the station transcoded to MP3 for players without AAC support, requires ffmpeg on the server
+func StreamStationMP3(w http.ResponseWriter, r *http.Request) {
+	streamStation(w, r, streamMP3)
+}
+
+// streamStation sends the segments of the scheduled tracks one after another as a single stream, like an Icecast
+// or SHOUTcast mount. every listener of a station hears the same audio at the same time as GET /station/{name}/now,
+// clients that send Icy-MetaData: 1 get the current track as StreamTitle. stem is instrumental by default and
+// instrumental tracks fall back to it for vocal.
+func streamStation(w http.ResponseWriter, r *http.Request, format streamFormat) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var stem = r.URL.Query().Get("stem")
+	if stem == "" {
+		stem = "instrumental"
+	}
+	if stem != "instrumental" && stem != "vocal" {
+		internal.WriteError(w, internal.InvalidQueryParameter(fmt.Errorf("stem must be instrumental or vocal, got %s", stem)))
+		return
+	}
+	station, ok := stationParam(w, r, app)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internal.ServerError(w, errors.New("response writer does not support flushing"))
+		return
+	}
+	var produce internal.StreamProducer = func(ctx context.Context, send func(internal.StreamChunk)) error {
+		return produceStation(ctx, app, station, stem, send)
+	}
+	if format == streamMP3 {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			internal.WriteError(w, internal.ServiceUnavailable(fmt.Errorf("mp3 streams require ffmpeg on the server: %w", err)))
+			return
+		}
+		produce = transcodeMP3(produce)
+	}
+	listener := app.Streams.Listen(fmt.Sprintf("%s/%s.%s", station.Name, stem, format.extension), produce)
+	defer listener.Close()
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	// nginx buffers responses otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Set("icy-name", station.Name)
+	w.Header().Set("icy-description", "strafe station "+station.Name)
+	w.Header().Set("icy-br", strconv.Itoa(format.bitrate))
+	w.Header().Set("icy-pub", "0")
+	var out io.Writer = w
+	var icy *internal.IcyWriter
+	if r.Header.Get("Icy-MetaData") == "1" {
+		w.Header().Set("icy-metaint", strconv.Itoa(internal.IcyMetaInterval))
+		icy = internal.NewIcyWriter(w, internal.IcyMetaInterval)
+		out = icy
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-app.Shutdown.Done():
+			return
+		case chunk, ok := <-listener.Chunks():
+			if !ok {
+				return
+			}
+			if icy != nil {
+				icy.SetTitle(chunk.Title)
+			}
+			if _, err := out.Write(chunk.Data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// produceStation sends the frames of the scheduled tracks streamLead before the station plays them, starting
+// from the current position of the station
+func produceStation(ctx context.Context, app internal.AppCtx, station db.Station, stem string, send func(internal.StreamChunk)) error {
+	var cursor = time.Now()
+	for {
+		scheduled, err := stationScheduleAt(ctx, app, station, cursor)
+		if err != nil {
+			return err
+		}
+		if err := produceStationTrack(ctx, app, scheduled, cursor, stem, send); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// listeners hear silence until the next track instead of being disconnected, at least a second passes
+			// so that a failing store or database is not retried in a loop
+			log.Error().Err(err).Str("station", station.Name).Str("track", scheduled.TrackID).Msg("failed to stream track")
+			silence := time.NewTimer(max(time.Until(scheduled.EndsAt.Time), time.Second))
+			select {
+			case <-ctx.Done():
+				silence.Stop()
+				return ctx.Err()
+			case <-silence.C:
+			}
+		}
+		cursor = scheduled.EndsAt.Time
+	}
+}
+
+// stationScheduleAt returns the track that plays at the given time, or the next one if the station is silent then
+func stationScheduleAt(ctx context.Context, app internal.AppCtx, station db.Station, at time.Time) (db.StationSchedule, error) {
+	params := db.ListStationScheduleParams{StationID: station.ID, At: pgtype.Timestamptz{Time: at, Valid: true}, ResultLimit: 1}
+	schedule, err := app.DB.ListStationSchedule(ctx, params)
+	if err != nil {
+		return db.StationSchedule{}, err
+	}
+	if len(schedule) == 0 {
+		if err := scheduleStation(ctx, app, station); err != nil {
+			return db.StationSchedule{}, err
+		}
+		if schedule, err = app.DB.ListStationSchedule(ctx, params); err != nil {
+			return db.StationSchedule{}, err
+		}
+		if len(schedule) == 0 {
+			return db.StationSchedule{}, errNothingScheduled
+		}
+	}
+	return schedule[0], nil
+}
+
+// produceStationTrack sends the frames of the track from the position the station is at the given time until
+// the track ends, segments before that position are not downloaded
+func produceStationTrack(ctx context.Context, app internal.AppCtx, scheduled db.StationSchedule, from time.Time, stem string, send func(internal.StreamChunk)) error {
+	track, err := app.DB.GetTrackByID(ctx, scheduled.TrackID)
+	if err != nil {
+		return err
+	}
+	var folderPath = track.InstrumentalFolderPath
+	if stem == "vocal" && track.VocalFolderPath.Valid {
+		folderPath = track.VocalFolderPath.String
+	}
+	var playlistKey = internal.PlaylistKey(folderPath)
+	playlist, err := app.Store.Get(ctx, playlistKey)
+	if err != nil {
+		return err
+	}
+	segments, err := internal.ReadM3U8Segments(playlist)
+	if err != nil {
+		return fmt.Errorf("invalid playlist %s: %w", playlistKey, err)
+	}
+	var (
+		title    = fmt.Sprintf("%s - %s", fastjson.GetString(track.Info, "Artist"), fastjson.GetString(track.Info, "Title"))
+		startsAt = scheduled.StartsAt.Time
+		offset   = max(from.Sub(startsAt), 0)
+		position time.Duration
+		chunk    []byte
+		// station time of the first frame of the chunk
+		chunkAt time.Time
+	)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := waitUntil(ctx, chunkAt.Add(-streamLead)); err != nil {
+			return err
+		}
+		send(internal.StreamChunk{Data: chunk, Title: title})
+		chunk = nil
+		return nil
+	}
+	for _, segment := range segments {
+		end := position + time.Duration(segment.Duration*float64(time.Second))
+		if end <= offset {
+			position = end
+			continue
+		}
+		contents, err := app.Store.Get(ctx, path.Join(path.Dir(playlistKey), segment.URI))
+		if err != nil {
+			return err
+		}
+		stream, err := internal.DemuxADTS(contents)
+		if err != nil {
+			return fmt.Errorf("failed to read segment %s of %s: %w", segment.URI, playlistKey, err)
+		}
+		for _, frame := range internal.SplitADTS(stream) {
+			at := startsAt.Add(position)
+			position += frame.Duration
+			if position <= offset {
+				continue
+			}
+			if !at.Before(scheduled.EndsAt.Time) {
+				return flush()
+			}
+			if len(chunk) == 0 {
+				chunkAt = at
+			}
+			chunk = append(chunk, frame.Data...)
+			if startsAt.Add(position).Sub(chunkAt) >= streamChunkDuration {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return flush()
+}
+
+// transcodeMP3 pipes the ADTS stream of source through ffmpeg, chunks carry the title of the audio last written to it
+func transcodeMP3(source internal.StreamProducer) internal.StreamProducer {
+	return func(ctx context.Context, send func(internal.StreamChunk)) error {
+		transcodeCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var stderr bytes.Buffer
+		command := exec.CommandContext(transcodeCtx, "ffmpeg",
+			"-hide_banner", "-loglevel", "error",
+			// the input is paced, probing the default 5 MB would hold the stream back for minutes
+			"-probesize", "32768", "-analyzeduration", "0",
+			"-f", "aac", "-i", "pipe:0",
+			"-c:a", "libmp3lame", "-b:a", fmt.Sprintf("%dk", streamMP3Bitrate), "-ar", "44100", "-ac", "2",
+			"-flush_packets", "1", "-f", "mp3", "pipe:1",
+		)
+		command.Stderr = &stderr
+		stdin, err := command.StdinPipe()
+		if err != nil {
+			return err
+		}
+		stdout, err := command.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := command.Start(); err != nil {
+			return fmt.Errorf("failed to start ffmpeg: %w", err)
+		}
+		var (
+			titleMu   sync.Mutex
+			title     string
+			sourceErr = make(chan error, 1)
+		)
+		go func() {
+			err := source(transcodeCtx, func(chunk internal.StreamChunk) {
+				titleMu.Lock()
+				title = chunk.Title
+				titleMu.Unlock()
+				if _, err := stdin.Write(chunk.Data); err != nil {
+					cancel()
+				}
+			})
+			stdin.Close()
+			sourceErr <- err
+		}()
+		var buffer = make([]byte, 8<<10)
+		for {
+			n, err := stdout.Read(buffer)
+			if n > 0 {
+				titleMu.Lock()
+				send(internal.StreamChunk{Data: bytes.Clone(buffer[:n]), Title: title})
+				titleMu.Unlock()
+			}
+			if err != nil {
+				break
+			}
+		}
+		cancel()
+		waitErr := command.Wait()
+		err = <-sourceErr
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if waitErr != nil && stderr.Len() > 0 {
+			return fmt.Errorf("ffmpeg failed: %w: %s", waitErr, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return err
+	}
+}
+
+// waitUntil returns ctx.Err() if ctx is done before the given time
+func waitUntil(ctx context.Context, at time.Time) error {
+	wait := time.Until(at)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
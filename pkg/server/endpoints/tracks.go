@@ -1,27 +1,35 @@
 package endpoints
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/caner-cetin/strafe/internal"
 	"github.com/caner-cetin/strafe/pkg/db"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/valyala/fastjson"
 )
 
 type Track struct {
-	ID                          string    `json:"id"`
-	Cover                       string    `json:"cover"`
-	Info                        TrackInfo `json:"info"`
-	SavedVocalFolderPath        string    `json:"saved_vocal_folder_path"`
-	SavedInstrumentalFolderPath string    `json:"saved_instrumental_folder_path"`
+	ID                          string         `json:"id"`
+	Cover                       string         `json:"cover"`
+	CoverURL                    string         `json:"cover_url"`
+	Info                        TrackInfo      `json:"info"`
+	Artists                     []ArtistCredit `json:"artists"`
+	SavedVocalFolderPath        string         `json:"saved_vocal_folder_path"`
+	SavedInstrumentalFolderPath string         `json:"saved_instrumental_folder_path"`
+	VocalPlaylistURL            string         `json:"vocal_playlist_url,omitempty"`
+	InstrumentalPlaylistURL     string         `json:"instrumental_playlist_url"`
+	PlayCount                   int64          `json:"play_count"`
+	SkipRate                    float64        `json:"skip_rate"`
 }
 
 type TrackInfo struct {
@@ -38,7 +46,8 @@ type TrackInfo struct {
 }
 
 type GetRandomTrackRequest struct {
-	AnonID string `json:"anonId"`
+	AnonID string      `json:"anonId"`
+	Filter TrackFilter `json:"filter"`
 }
 
 func GetRandomTrack(w http.ResponseWriter, r *http.Request) {
@@ -52,9 +61,13 @@ func GetRandomTrack(w http.ResponseWriter, r *http.Request) {
 		internal.WriteError(w, internal.MalformedJSONBody(err))
 		return
 	}
-	var anonId = pgtype.Text{String: body.AnonID, Valid: true}
-	var err error
-	track, err := app.DB.GetRandomUnlistenedTrack(r.Context(), anonId)
+	var anonId = body.AnonID
+	filter, err := body.Filter.params()
+	if err != nil {
+		internal.WriteError(w, internal.MalformedJSONBody(err))
+		return
+	}
+	track, err := app.DB.PickRandomUnlistenedTrack(r.Context(), unlistenedTrackParams(filter, anonId))
 	no_rows := errors.Is(err, sql.ErrNoRows)
 	if err != nil && (!no_rows) {
 		internal.ServerError(w, err)
@@ -68,12 +81,17 @@ func GetRandomTrack(w http.ResponseWriter, r *http.Request) {
 		}
 		defer tx.Rollback(r.Context())
 		qtx := app.DB.WithTx(tx)
-		if err := qtx.DeleteListeningHistoryByAnonID(r.Context(), anonId); err != nil {
+		if err := qtx.StartListenerRotation(r.Context(), anonId); err != nil {
 			internal.ServerError(w, err)
 			return
 		}
-		track, err = qtx.GetRandomTrack(r.Context())
+		track, err = qtx.PickRandomTrack(r.Context(), randomTrackParams(filter))
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				// no track matches the filter, keep the current rotation
+				internal.WriteError(w, internal.ResourceNotFound(err))
+				return
+			}
 			internal.ServerError(w, err)
 			return
 		}
@@ -86,9 +104,9 @@ func GetRandomTrack(w http.ResponseWriter, r *http.Request) {
 	err = app.DB.RecordListeningHistory(
 		r.Context(),
 		db.RecordListeningHistoryParams{
-			TrackID:    pgtype.Text{String: track.ID, Valid: true},
+			TrackID:    track.ID,
 			AnonID:     anonId,
-			ListenedAt: pgtype.Timestamptz{Time: time.Now(), InfinityModifier: pgtype.Infinity, Valid: true},
+			ListenedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
 		},
 	)
 	if err != nil {
@@ -100,8 +118,16 @@ func GetRandomTrack(w http.ResponseWriter, r *http.Request) {
 func GetTrack(w http.ResponseWriter, r *http.Request) {
 	var trackId = chi.URLParam(r, "trackId")
 	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	if _, err := uuid.Parse(trackId); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return
+	}
 	track, err := app.DB.GetTrackByID(r.Context(), trackId)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
 		internal.ServerError(w, err)
 		return
 	}
@@ -109,74 +135,161 @@ func GetTrack(w http.ResponseWriter, r *http.Request) {
 }
 
 func streamTrackInfo(w http.ResponseWriter, track db.Track, app internal.AppCtx) {
-	cover, err := app.DB.GetAlbumCoverByID(app.Context, track.AlbumID.String)
+	response, err := trackResponse(app.Context, app, track)
 	if err != nil {
 		internal.ServerError(w, err)
 		return
 	}
-	var response Track
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// trackResponse collects the cover, credits, playlist urls, play stats and waveforms of the track
+func trackResponse(ctx context.Context, app internal.AppCtx, track db.Track) (Track, error) {
+	var response = Track{ID: track.ID}
+	cover, err := app.DB.GetAlbumCoverByID(ctx, track.AlbumID)
+	if err != nil {
+		return response, err
+	}
 	response.Cover = cover.String
-	response.ID = track.ID
+
+	credits, err := app.DB.GetArtistsByTrackID(ctx, track.ID)
+	if err != nil {
+		return response, err
+	}
+	response.Artists = make([]ArtistCredit, 0, len(credits))
+	for _, credit := range credits {
+		response.Artists = append(response.Artists, ArtistCredit{ID: credit.ID, Name: credit.Name, Role: credit.Role})
+	}
 
 	response.SavedVocalFolderPath = track.VocalFolderPath.String
-	response.SavedInstrumentalFolderPath = track.InstrumentalFolderPath.String
+	response.SavedInstrumentalFolderPath = track.InstrumentalFolderPath
+	if response.CoverURL, err = app.Assets.URL(ctx, cover.String); err != nil {
+		return response, err
+	}
+	if response.InstrumentalPlaylistURL, err = playlistURL(app, track.ID, "instrumental", track.InstrumentalFolderPath); err != nil {
+		return response, err
+	}
+	if track.VocalFolderPath.Valid {
+		if response.VocalPlaylistURL, err = playlistURL(app, track.ID, "vocal", track.VocalFolderPath.String); err != nil {
+			return response, err
+		}
+	}
+
+	stats, err := app.DB.GetTrackPlayStats(ctx, track.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return response, err
+	}
+	response.PlayCount = stats.PlayCount
+	response.SkipRate = internal.SkipRate(stats.CompleteCount, stats.SkipCount)
 
 	length, err := track.TotalDuration.Float64Value()
 	if err != nil {
-		internal.ServerError(w, err)
-		return
+		return response, err
 	}
 
 	tempo, err := track.Tempo.Float64Value()
 	if err != nil {
-		internal.ServerError(w, err)
-		return
+		return response, err
 	}
 
-	trackInfo, err := fastjson.ParseBytes(track.Info)
-	if err != nil {
-		internal.ServerError(w, err)
-		return
+	if err := fastjson.ValidateBytes(track.Info); err != nil {
+		return response, err
 	}
-	getString := func(key string) string {
-		val := trackInfo.Get(key)
-		if val == nil {
-			return ""
-		}
-		str, err := strconv.Unquote(string(val.MarshalTo(nil)))
-		if err != nil {
-			internal.ServerError(w, err)
-			return ""
-		}
-		return str
-	}
-
 	response.Info = TrackInfo{
-		Artist:       getString("Artist"),
-		Album:        getString("Album"),
-		Genre:        getString("Genre"),
-		Title:        getString("Title"),
+		Artist:       fastjson.GetString(track.Info, "Artist"),
+		Album:        fastjson.GetString(track.Info, "Album"),
+		Genre:        fastjson.GetString(track.Info, "Genre"),
+		Title:        fastjson.GetString(track.Info, "Title"),
 		Length:       length.Float64,
 		Tempo:        tempo.Float64,
-		Key:          track.Key.String,
-		Instrumental: track.Instrumental.Bool,
+		Key:          track.Key,
+		Instrumental: track.Instrumental,
 	}
 
 	var instrumentalWf []int32
 	if err = internal.DecompressJSON(track.InstrumentalWaveform, &instrumentalWf); err != nil {
-		internal.ServerError(w, err)
-		return
+		return response, err
 	}
 	response.Info.InstrumentalWaveform = instrumentalWf
-	if !track.Instrumental.Bool {
+	if !track.Instrumental {
 		var vocalWf []int32
 		if err = internal.DecompressJSON(track.VocalWaveform, &vocalWf); err != nil {
+			return response, err
+		}
+		response.Info.VocalWaveform = vocalWf
+	}
+	return response, nil
+}
+
+// GetTrackPlaylist serves the vocal or instrumental playlist.m3u8 of the track with segment lines
+// rewritten to presigned urls. playlists under the public base url are redirected to instead.
+func GetTrackPlaylist(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	var trackId = chi.URLParam(r, "trackId")
+	if _, err := uuid.Parse(trackId); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return
+	}
+	track, err := app.DB.GetTrackByID(r.Context(), trackId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	var folderPath string
+	switch chi.URLParam(r, "stem") {
+	case "instrumental":
+		folderPath = track.InstrumentalFolderPath
+	case "vocal":
+		if !track.VocalFolderPath.Valid {
+			internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("track %s is instrumental", trackId)))
+			return
+		}
+		folderPath = track.VocalFolderPath.String
+	default:
+		internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("unknown stem %s", chi.URLParam(r, "stem"))))
+		return
+	}
+	var key = internal.PlaylistKey(folderPath)
+	if app.Assets.Public() {
+		location, err := app.Assets.URL(r.Context(), key)
+		if err != nil {
 			internal.ServerError(w, err)
 			return
 		}
-		response.Info.VocalWaveform = vocalWf
+		http.Redirect(w, r, location, http.StatusFound)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
+	playlist, err := app.Store.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, internal.ErrObjectNotFound) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	rewritten, err := app.Assets.RewritePlaylist(r.Context(), key, playlist)
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	// the playlist must not outlive the presigned segment urls in it
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(app.Assets.TTL.Seconds()/2)))
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	w.Write(rewritten)
+}
+
+// playlistURL points to the playlist under the public base url, or to GetTrackPlaylist if the bucket is private
+func playlistURL(app internal.AppCtx, trackID string, stem string, folderPath string) (string, error) {
+	if app.Assets.Public() {
+		return app.Assets.URL(app.Context, internal.PlaylistKey(folderPath))
+	}
+	return fmt.Sprintf("/track/%s/playlist/%s.m3u8", trackID, stem), nil
 }
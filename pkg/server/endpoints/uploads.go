@@ -0,0 +1,341 @@
+package endpoints
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/caner-cetin/strafe/internal"
+	"github.com/caner-cetin/strafe/pkg/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// parts of the multipart form up to this size are kept in memory, the rest is written to temporary files
+	uploadMemory = 32 << 20
+	// workers write events to the database, streams check for new ones this often
+	uploadEventsPoll = time.Second
+	// proxies close idle connections, a comment is sent if no event was sent for this long
+	uploadEventsKeepAlive = 15 * time.Second
+	uploadEventsBatch     = 500
+)
+
+type Upload struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	Stage        string     `json:"stage"`
+	Filename     string     `json:"filename"`
+	Instrumental bool       `json:"instrumental"`
+	HasCover     bool       `json:"has_cover"`
+	HasLyrics    bool       `json:"has_lyrics"`
+	Attempts     int32      `json:"attempts"`
+	Error        *string    `json:"error"`
+	TrackID      *string    `json:"track_id"`
+	UserID       *string    `json:"user_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+}
+
+// CreateUpload stages the audio file of the multipart form, and the cover art and the lyrics if given, in the object
+// store and queues an ingest job for `strafe worker`. the job is created after every file is stored, files of
+// uploads that fail before are deleted again.
+//
+// form fields are audio (required file), cover (optional file), lyrics (optional LRC or text file) and instrumental
+// (optional bool)
+func CreateUpload(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	maxSize, err := internal.MaxUploadSize()
+	if err != nil {
+		internal.ServerError(w, err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			internal.WriteError(w, internal.UploadTooLarge(err))
+			return
+		}
+		internal.WriteError(w, internal.MalformedUpload(err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	var instrumental bool
+	if value := r.FormValue("instrumental"); value != "" {
+		instrumental, err = strconv.ParseBool(value)
+		if err != nil {
+			internal.WriteError(w, internal.MalformedUpload(fmt.Errorf("instrumental must be a boolean: %w", err)))
+			return
+		}
+	}
+	audio, audioHeader, err := r.FormFile("audio")
+	if err != nil {
+		internal.WriteError(w, internal.MalformedUpload(fmt.Errorf("audio file is required: %w", err)))
+		return
+	}
+	defer audio.Close()
+	// the format of the stems is taken from the extension
+	audioExt, err := internal.UploadExtension(audioHeader.Filename, internal.UploadAudioExtensions)
+	if err != nil {
+		internal.WriteError(w, internal.MalformedUpload(err))
+		return
+	}
+	cover, coverHeader, err := r.FormFile("cover")
+	if err != nil && !errors.Is(err, http.ErrMissingFile) {
+		internal.WriteError(w, internal.MalformedUpload(err))
+		return
+	}
+	var coverExt string
+	if cover != nil {
+		defer cover.Close()
+		if coverExt, err = internal.UploadExtension(coverHeader.Filename, internal.UploadCoverExtensions); err != nil {
+			internal.WriteError(w, internal.MalformedUpload(err))
+			return
+		}
+	}
+	lyrics, lyricsHeader, err := r.FormFile("lyrics")
+	if err != nil && !errors.Is(err, http.ErrMissingFile) {
+		internal.WriteError(w, internal.MalformedUpload(err))
+		return
+	}
+	if lyrics != nil {
+		defer lyrics.Close()
+	}
+
+	var params = db.CreateIngestJobParams{
+		ID:            uuid.NewString(),
+		AudioFilename: path.Base(audioHeader.Filename),
+		Instrumental:  instrumental,
+	}
+	params.AudioKey = internal.UploadKey(params.ID, "audio"+audioExt)
+	if cover != nil {
+		params.CoverKey = pgtype.Text{String: internal.UploadKey(params.ID, "cover"+coverExt), Valid: true}
+	}
+	if lyrics != nil {
+		params.LyricsKey = pgtype.Text{String: internal.UploadKey(params.ID, "lyrics.lrc"), Valid: true}
+	}
+	if user, ok := internal.UserFromContext(r.Context()); ok {
+		params.UserID = pgtype.Text{String: user.ID, Valid: true}
+	}
+	var staged []string
+	var stage = func(key string, file multipart.File, header *multipart.FileHeader) error {
+		staged = append(staged, key)
+		return stageUpload(r, app, key, file, header.Size)
+	}
+	err = stage(params.AudioKey, audio, audioHeader)
+	if err == nil && cover != nil {
+		err = stage(params.CoverKey.String, cover, coverHeader)
+	}
+	if err == nil && lyrics != nil {
+		err = stage(params.LyricsKey.String, lyrics, lyricsHeader)
+	}
+	var job db.IngestJob
+	if err == nil {
+		job, err = app.DB.CreateIngestJob(r.Context(), params)
+	}
+	if err != nil {
+		for _, key := range staged {
+			// the request may have been cancelled, the files are deleted regardless
+			if err := app.Store.Delete(context.WithoutCancel(r.Context()), key); err != nil {
+				log.Warn().Err(err).Str("key", key).Msg("failed to delete staged upload")
+			}
+		}
+		internal.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/uploads/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(uploadResponse(job))
+}
+
+// GetUpload reports the status and the stage of the ingest job, see ownedUpload
+func GetUpload(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	job, ok := ownedUpload(w, r, app)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(uploadResponse(job))
+}
+
+// StreamUploadEvents streams the progress of the ingest job as server-sent events. reconnecting clients continue after
+// the Last-Event-ID header, other clients can start after an event id with ?after=. the stream ends once the job
+// succeeded or failed for good and every event was sent.
+func StreamUploadEvents(w http.ResponseWriter, r *http.Request) {
+	app := r.Context().Value(internal.APP_CONTEXT_KEY).(internal.AppCtx)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internal.ServerError(w, errors.New("response writer does not support flushing"))
+		return
+	}
+	var after int64
+	var lastEventID = r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("after")
+	}
+	if lastEventID != "" {
+		parsed, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || parsed < 0 {
+			internal.WriteError(w, internal.InvalidQueryParameter(fmt.Errorf("event id must be a positive integer, got %s", lastEventID)))
+			return
+		}
+		after = parsed
+	}
+	job, ok := ownedUpload(w, r, app)
+	if !ok {
+		return
+	}
+	var uploadID = job.ID
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx buffers responses otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(uploadEventsPoll)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	// workers write the last event after the status, the stream ends at the last event or one poll after the job
+	// finished. jobs whose worker disappeared are failed without an event.
+	var finished bool
+	for {
+		job, err := app.DB.GetIngestJob(r.Context(), uploadID)
+		if err != nil {
+			if r.Context().Err() == nil {
+				log.Error().Err(err).Str("upload", uploadID).Msg("failed to get upload")
+			}
+			return
+		}
+		events, err := app.DB.ListIngestJobEvents(r.Context(), db.ListIngestJobEventsParams{JobID: uploadID, AfterID: after, ResultLimit: uploadEventsBatch})
+		if err != nil {
+			if r.Context().Err() == nil {
+				log.Error().Err(err).Str("upload", uploadID).Msg("failed to list upload events")
+			}
+			return
+		}
+		var last bool
+		for _, event := range events {
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.EventType, event.Payload); err != nil {
+				return
+			}
+			after = event.ID
+			last = last || event.EventType == string(internal.ProgressDone) || event.EventType == string(internal.ProgressFailed)
+		}
+		if len(events) > 0 {
+			flusher.Flush()
+			lastWrite = time.Now()
+		}
+		if last || (finished && len(events) == 0) {
+			return
+		}
+		if len(events) == uploadEventsBatch {
+			continue
+		}
+		finished = job.Status == db.IngestJobStatusSucceeded || job.Status == db.IngestJobStatusFailed
+		if time.Since(lastWrite) >= uploadEventsKeepAlive {
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastWrite = time.Now()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-app.Shutdown.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stageUpload streams the file to the object store, files larger than uploadMemory are read from their temporary file
+func stageUpload(r *http.Request, app internal.AppCtx, key string, file multipart.File, size int64) error {
+	if err := app.Store.PutReader(r.Context(), key, file, size); err != nil {
+		return fmt.Errorf("failed to stage uploaded file %s: %w", key, err)
+	}
+	return nil
+}
+
+// ownedUpload gets the ingest job of the upload id and writes 404 unless the user of the token created it.
+// jobs created before uploads were tied to users can be read by every user.
+func ownedUpload(w http.ResponseWriter, r *http.Request, app internal.AppCtx) (db.IngestJob, bool) {
+	uploadID, ok := uploadIDParam(w, r)
+	if !ok {
+		return db.IngestJob{}, false
+	}
+	job, err := app.DB.GetIngestJob(r.Context(), uploadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			internal.WriteError(w, internal.ResourceNotFound(err))
+			return job, false
+		}
+		internal.ServerError(w, err)
+		return job, false
+	}
+	// uploads of other users are not found rather than forbidden, their ids are not revealed
+	if user, _ := internal.UserFromContext(r.Context()); job.UserID.Valid && job.UserID.String != user.ID {
+		internal.WriteError(w, internal.ResourceNotFound(fmt.Errorf("upload %s does not exist", uploadID)))
+		return job, false
+	}
+	return job, true
+}
+
+func uploadResponse(job db.IngestJob) Upload {
+	var response = Upload{
+		ID:           job.ID,
+		Status:       string(job.Status),
+		Stage:        job.Stage,
+		Filename:     job.AudioFilename,
+		Instrumental: job.Instrumental,
+		HasCover:     job.CoverKey.Valid,
+		HasLyrics:    job.LyricsKey.Valid,
+		Attempts:     job.Attempts,
+		CreatedAt:    job.CreatedAt.Time,
+		UpdatedAt:    job.UpdatedAt.Time,
+	}
+	if job.Error.Valid {
+		response.Error = &job.Error.String
+	}
+	if job.TrackID.Valid {
+		response.TrackID = &job.TrackID.String
+	}
+	if job.UserID.Valid {
+		response.UserID = &job.UserID.String
+	}
+	if job.StartedAt.Valid {
+		response.StartedAt = &job.StartedAt.Time
+	}
+	if job.FinishedAt.Valid {
+		response.FinishedAt = &job.FinishedAt.Time
+	}
+	return response
+}
+
+// uploadIDParam writes 404 if the upload id is not a uuid
+func uploadIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var uploadID = chi.URLParam(r, "uploadId")
+	if _, err := uuid.Parse(uploadID); err != nil {
+		internal.WriteError(w, internal.ResourceNotFound(err))
+		return "", false
+	}
+	return uploadID, true
+}
@@ -1,41 +1,47 @@
 -- name: GetTracksByArtist :many
--- Gets basic track information filtered by artist
+-- Gets basic track information of the tracks the artist is credited on
 SELECT id,
-    vocal_folder_path,
-    instrumental_folder_path,
     album_id,
+    album_name,
     total_duration,
     info,
     instrumental,
     tempo,
-    "key"
+    "key",
+    created_at
 FROM tracks
-WHERE info->>'Artist' = $1;
+WHERE id IN (
+        SELECT track_id
+        FROM track_artists
+        WHERE artist_id = $1
+    );
 -- name: GetTracksByAlbumId :many
--- Gets basic track information filtered by album ID, sorted by track list
+-- Gets basic track information filtered by album ID, sorted by disc and track number
 SELECT id,
-    vocal_folder_path,
-    instrumental_folder_path,
     album_id,
+    album_name,
     total_duration,
     info,
     instrumental,
     tempo,
-    "key"
+    "key",
+    created_at
 FROM tracks
 WHERE album_id = $1
-ORDER BY info->>'Track';
+ORDER BY substring(info->>'PartOfSet' FROM '^\d+')::int NULLS FIRST,
+    substring(info->>'Track' FROM '^\d+')::int NULLS LAST,
+    info->>'Title';
 -- name: GetTracksByGenre :many
 -- Gets basic track information filtered by genre
 SELECT id,
-    vocal_folder_path,
-    instrumental_folder_path,
     album_id,
+    album_name,
     total_duration,
     info,
     instrumental,
     tempo,
-    "key"
+    "key",
+    created_at
 FROM tracks
 WHERE info->>'Genre' = $1;
 -- name: GetTrackCount :one
@@ -43,42 +49,305 @@ WHERE info->>'Genre' = $1;
 SELECT COUNT(*)
 FROM tracks;
 -- name: SearchTracks :many
--- Searches tracks by title, artist, or genre
-SELECT id,
-    vocal_folder_path,
-    instrumental_folder_path,
-    album_id,
-    total_duration,
-    info,
-    instrumental,
-    tempo,
-    "key"
-FROM tracks
-WHERE info->>'Title' ILIKE '%' || $1 || '%'
-    OR info->>'Artist' ILIKE '%' || $1 || '%'
-    OR info->>'Genre' ILIKE '%' || $1 || '%'
-LIMIT $2 OFFSET $3;
+-- Searches tracks by title, artist, album and genre, ranked by full-text match and title/artist similarity.
+-- prefix_query is a to_tsquery expression where every term is a prefix ("lov:* & son:*"), term is the raw
+-- search text used for typo tolerant trigram matching.
+SELECT t.id,
+    t.album_id,
+    t.album_name,
+    t.total_duration,
+    t.info,
+    t.instrumental,
+    t.tempo,
+    t."key",
+    (
+        ts_rank(
+            t.search_vector,
+            to_tsquery('simple', sqlc.arg(prefix_query))
+        ) + word_similarity(sqlc.arg(term), t.info->>'Title') + word_similarity(sqlc.arg(term), t.info->>'Artist') / 2
+    )::float8 AS rank,
+    ts_headline(
+        'simple',
+        html_escape(COALESCE(t.info->>'Title', '')),
+        to_tsquery('simple', sqlc.arg(prefix_query)),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS title_highlight,
+    ts_headline(
+        'simple',
+        html_escape(COALESCE(t.info->>'Artist', '')),
+        to_tsquery('simple', sqlc.arg(prefix_query)),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS artist_highlight,
+    ts_headline(
+        'simple',
+        html_escape(t.album_name),
+        to_tsquery('simple', sqlc.arg(prefix_query)),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS album_highlight
+FROM tracks t
+WHERE t.search_vector @@ to_tsquery('simple', sqlc.arg(prefix_query))
+    OR (t.info->>'Title') %> sqlc.arg(term)
+    OR (t.info->>'Artist') %> sqlc.arg(term)
+ORDER BY rank DESC,
+    t.id
+LIMIT sqlc.arg(result_limit);
+-- name: SearchAlbums :many
+-- Searches albums by name, artist and genre, see SearchTracks for the arguments
+SELECT a.*,
+    (
+        ts_rank(
+            a.search_vector,
+            to_tsquery('simple', sqlc.arg(prefix_query))
+        ) + word_similarity(sqlc.arg(term), a."name")
+    )::float8 AS rank,
+    ts_headline(
+        'simple',
+        html_escape(a."name"),
+        to_tsquery('simple', sqlc.arg(prefix_query)),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS name_highlight,
+    ts_headline(
+        'simple',
+        html_escape(a.artist),
+        to_tsquery('simple', sqlc.arg(prefix_query)),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS artist_highlight
+FROM albums a
+WHERE a.search_vector @@ to_tsquery('simple', sqlc.arg(prefix_query))
+    OR a."name" %> sqlc.arg(term)
+ORDER BY rank DESC,
+    a.id
+LIMIT sqlc.arg(result_limit);
+-- name: SearchArtists :many
+-- Searches artists by name, see SearchTracks for the arguments
+SELECT a.id,
+    a."name",
+    a.sort_name,
+    a.aliases,
+    (
+        ts_rank(
+            a.search_vector,
+            to_tsquery('simple', sqlc.arg(prefix_query))
+        ) + word_similarity(sqlc.arg(term), a."name")
+    )::float8 AS rank,
+    ts_headline(
+        'simple',
+        html_escape(a."name"),
+        to_tsquery('simple', sqlc.arg(prefix_query)),
+        'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'
+    )::text AS name_highlight
+FROM artists a
+WHERE a.search_vector @@ to_tsquery('simple', sqlc.arg(prefix_query))
+    OR a."name" %> sqlc.arg(term)
+ORDER BY rank DESC,
+    a.id
+LIMIT sqlc.arg(result_limit);
+-- name: AutocompleteSearch :many
+-- Suggests track titles, album names and artist names starting with the typed words, see SearchTracks for the arguments
+SELECT s.kind::text AS kind,
+    s.id::uuid AS id,
+    s.label::text AS label
+FROM (
+        (
+            SELECT 'track' AS kind,
+                t.id,
+                t.info->>'Title' AS label,
+                ts_rank(
+                    t.search_vector,
+                    to_tsquery('simple', sqlc.arg(prefix_query))
+                ) AS rank
+            FROM tracks t
+            WHERE t.search_vector @@ to_tsquery('simple', sqlc.arg(prefix_query))
+            ORDER BY rank DESC
+            LIMIT sqlc.arg(result_limit)
+        )
+        UNION ALL
+        (
+            SELECT 'album' AS kind,
+                a.id,
+                a."name" AS label,
+                ts_rank(
+                    a.search_vector,
+                    to_tsquery('simple', sqlc.arg(prefix_query))
+                ) AS rank
+            FROM albums a
+            WHERE a.search_vector @@ to_tsquery('simple', sqlc.arg(prefix_query))
+            ORDER BY rank DESC
+            LIMIT sqlc.arg(result_limit)
+        )
+        UNION ALL
+        (
+            SELECT 'artist' AS kind,
+                ar.id,
+                ar."name" AS label,
+                ts_rank(
+                    ar.search_vector,
+                    to_tsquery('simple', sqlc.arg(prefix_query))
+                ) AS rank
+            FROM artists ar
+            WHERE ar.search_vector @@ to_tsquery('simple', sqlc.arg(prefix_query))
+            ORDER BY rank DESC
+            LIMIT sqlc.arg(result_limit)
+        )
+    ) s
+ORDER BY s.rank DESC
+LIMIT sqlc.arg(result_limit);
 -- name: GetRandomUnlistenedTrack :one
--- Get a random track that hasn't been listened to by the given anonymous user
+-- Get a random track matching the filters that hasn't been listened to by the given anonymous user
+-- since their current rotation started, see StartListenerRotation. see filtered_tracks for the filters.
+-- the candidates are the tracks following the random start in random_key order, the pick is weighted among them
+-- so that the index is walked instead of sorting the catalogue. no rows if no track follows start, see PickRandomTrack in random.go.
+WITH candidates AS (
+    SELECT t.id,
+        ps.complete_count,
+        ps.skip_count
+    FROM filtered_tracks(
+            sqlc.narg(min_tempo)::numeric,
+            sqlc.narg(max_tempo)::numeric,
+            sqlc.narg(keys)::text[],
+            sqlc.narg(genres)::text[],
+            sqlc.narg(min_duration)::numeric,
+            sqlc.narg(max_duration)::numeric,
+            sqlc.arg(instrumental_only)::bool,
+            sqlc.narg(min_year)::int,
+            sqlc.narg(max_year)::int,
+            sqlc.narg(exclude_track_ids)::text[]::uuid[],
+            sqlc.narg(exclude_album_ids)::text[]::uuid[],
+            sqlc.narg(exclude_genres)::text[],
+            sqlc.narg(exclude_artist_ids)::text[]::uuid[]
+        ) t
+        LEFT JOIN track_play_stats ps ON ps.track_id = t.id
+    WHERE t.random_key >= sqlc.arg(start)::float8
+        AND NOT EXISTS (
+            SELECT 1
+            FROM listening_histories lh
+            WHERE lh.track_id = t.id
+                AND lh.anon_id = sqlc.arg(anon_id)
+                AND lh.listened_at >= COALESCE(
+                    (
+                        SELECT lr.started_at
+                        FROM listener_rotations lr
+                        WHERE lr.anon_id = sqlc.arg(anon_id)
+                    ),
+                    '-infinity'
+                )
+        )
+    ORDER BY t.random_key
+    LIMIT sqlc.arg(candidates)::int
+)
 SELECT t.*
-FROM tracks t
-    LEFT JOIN albums a ON a.id = t.album_id
-    LEFT JOIN listening_histories lh ON t.id = lh.track_id
-    AND lh.anon_id = $1
-WHERE lh.track_id IS NULL
-ORDER BY RANDOM()
+FROM candidates c
+    JOIN tracks t ON t.id = c.id
+-- weighted random sampling, tracks that are often completed come up more and tracks that are often skipped less
+ORDER BY power(
+        RANDOM(),
+        1 / play_weight(c.complete_count, c.skip_count)
+    ) DESC
 LIMIT 1;
--- name: DeleteListeningHistoryByAnonID :exec
--- Delete all listening history for a given anonymous user
-DELETE FROM listening_histories
-WHERE anon_id = $1;
+-- name: StartListenerRotation :exec
+-- Starts over the rotation of the anonymous user once they listened to every track, every track is unlistened again.
+-- the listening history is kept for statistics.
+INSERT INTO listener_rotations (anon_id, started_at)
+VALUES ($1, now()) ON CONFLICT (anon_id) DO
+UPDATE
+SET started_at = EXCLUDED.started_at;
 -- name: GetRandomTrack :one
--- Get a completely random track
+-- Get a completely random track matching the filters, see filtered_tracks for the filters.
+-- candidates are picked like GetRandomUnlistenedTrack.
+WITH candidates AS (
+    SELECT t.id,
+        ps.complete_count,
+        ps.skip_count
+    FROM filtered_tracks(
+            sqlc.narg(min_tempo)::numeric,
+            sqlc.narg(max_tempo)::numeric,
+            sqlc.narg(keys)::text[],
+            sqlc.narg(genres)::text[],
+            sqlc.narg(min_duration)::numeric,
+            sqlc.narg(max_duration)::numeric,
+            sqlc.arg(instrumental_only)::bool,
+            sqlc.narg(min_year)::int,
+            sqlc.narg(max_year)::int,
+            sqlc.narg(exclude_track_ids)::text[]::uuid[],
+            sqlc.narg(exclude_album_ids)::text[]::uuid[],
+            sqlc.narg(exclude_genres)::text[],
+            sqlc.narg(exclude_artist_ids)::text[]::uuid[]
+        ) t
+        LEFT JOIN track_play_stats ps ON ps.track_id = t.id
+    WHERE t.random_key >= sqlc.arg(start)::float8
+    ORDER BY t.random_key
+    LIMIT sqlc.arg(candidates)::int
+)
 SELECT t.*
-FROM tracks t
-    LEFT JOIN albums a ON a.id = t.album_id
-ORDER BY RANDOM()
+FROM candidates c
+    JOIN tracks t ON t.id = c.id
+-- weighted random sampling, tracks that are often completed come up more and tracks that are often skipped less
+ORDER BY power(
+        RANDOM(),
+        1 / play_weight(c.complete_count, c.skip_count)
+    ) DESC
 LIMIT 1;
+-- name: TrackFacets :many
+-- Counts the tracks matching the filters by genre, key, instrumental flag, tempo (in 10 BPM buckets) and album year.
+-- the filters are the arguments of the filtered_tracks function, NULL or empty filters match every track.
+-- tracks with an excluded id, album, genre or credited artist never match.
+WITH filtered AS (
+    SELECT t.info->>'Genre' AS genre,
+        t."key",
+        t.instrumental,
+        (floor(t.tempo / 10) * 10)::int AS tempo,
+        a."year"
+    FROM filtered_tracks(
+            sqlc.narg(min_tempo)::numeric,
+            sqlc.narg(max_tempo)::numeric,
+            sqlc.narg(keys)::text[],
+            sqlc.narg(genres)::text[],
+            sqlc.narg(min_duration)::numeric,
+            sqlc.narg(max_duration)::numeric,
+            sqlc.arg(instrumental_only)::bool,
+            sqlc.narg(min_year)::int,
+            sqlc.narg(max_year)::int,
+            sqlc.narg(exclude_track_ids)::text[]::uuid[],
+            sqlc.narg(exclude_album_ids)::text[]::uuid[],
+            sqlc.narg(exclude_genres)::text[],
+            sqlc.narg(exclude_artist_ids)::text[]::uuid[]
+        ) t
+        JOIN albums a ON a.id = t.album_id
+)
+SELECT 'genre'::text AS facet,
+    genre::text AS value,
+    COUNT(*) AS count
+FROM filtered
+WHERE genre IS NOT NULL
+GROUP BY genre
+UNION ALL
+SELECT 'key',
+    "key",
+    COUNT(*)
+FROM filtered
+GROUP BY "key"
+UNION ALL
+SELECT 'instrumental',
+    instrumental::text,
+    COUNT(*)
+FROM filtered
+GROUP BY instrumental
+UNION ALL
+SELECT 'tempo',
+    tempo::text,
+    COUNT(*)
+FROM filtered
+GROUP BY tempo
+UNION ALL
+SELECT 'year',
+    "year"::text,
+    COUNT(*)
+FROM filtered
+WHERE "year" IS NOT NULL
+GROUP BY "year"
+ORDER BY facet,
+    count DESC,
+    value;
 -- name: RecordListeningHistory :exec
 INSERT INTO listening_histories (track_id, anon_id, listened_at)
 VALUES ($1, $2, $3);
@@ -110,9 +379,25 @@ WHERE a.name = $1
     AND a.artist = $2;
 -- name: InsertAlbum :one
 -- returns id
-INSERT INTO public.albums (id, "name", cover, artist)
-VALUES($1, $2, $3, $4)
+INSERT INTO public.albums (id, "name", cover, artist, "year", genre)
+VALUES($1, $2, $3, $4, $5, $6)
 RETURNING id;
+-- name: UpsertAlbum :one
+-- Inserts the album if no album with the same name and artist exists, returns id of the new or existing album
+-- and whether the album is inserted by this call
+INSERT INTO public.albums (id, "name", cover, artist, "year", genre)
+VALUES($1, $2, $3, $4, $5, $6) ON CONFLICT ("name", artist) DO
+UPDATE
+SET "name" = EXCLUDED."name"
+RETURNING id,
+    (xmax = 0)::bool AS inserted;
+-- name: RefreshAlbumStats :exec
+-- Recalculates track count, total duration, disc count, year and genre of the album from its tracks
+SELECT refresh_album_stats(sqlc.arg(album_id)::uuid);
+-- name: RefreshAllAlbumStats :execrows
+-- Recalculates derived columns of every album, returns the number of albums processed
+SELECT refresh_album_stats(a.id)
+FROM albums a;
 -- name: GetTrackByID :one
 -- Get track by ID (all columns, use GetTrackBasicByID if waveforms are not needed)
 SELECT t.*
@@ -136,7 +421,9 @@ INSERT INTO public.tracks (
         "key",
         vocal_waveform,
         instrumental_waveform,
-        album_name
+        album_name,
+        musicbrainz_recording_id,
+        canonical_title
     )
 VALUES(
         $1,
@@ -150,5 +437,1324 @@ VALUES(
         $9,
         $10,
         $11,
-        $12
-    );
\ No newline at end of file
+        $12,
+        $13,
+        $14
+    );
+-- name: SetAlbumMusicBrainz :exec
+-- Sets the musicbrainz release of the album, values the album already has are kept
+UPDATE albums
+SET musicbrainz_release_id = COALESCE(musicbrainz_release_id, sqlc.narg(musicbrainz_release_id)::uuid),
+    musicbrainz_release_group_id = COALESCE(
+        musicbrainz_release_group_id,
+        sqlc.narg(musicbrainz_release_group_id)::uuid
+    ),
+    canonical_name = COALESCE(canonical_name, sqlc.narg(canonical_name)),
+    release_date = COALESCE(release_date, sqlc.narg(release_date))
+WHERE id = sqlc.arg(id);
+-- name: SetArtistMusicBrainzID :exec
+-- Sets the musicbrainz id of the artist with the match name or alias if it has none
+UPDATE artists
+SET musicbrainz_id = sqlc.arg(musicbrainz_id)::uuid
+WHERE musicbrainz_id IS NULL
+    AND (
+        match_name = sqlc.arg(match_name)
+        OR sqlc.arg(match_name)::text = ANY(aliases)
+    );
+-- name: UpsertArtist :one
+-- Inserts the artist if no artist with the same match name exists, returns id of the new or existing artist
+INSERT INTO public.artists (id, "name", sort_name, match_name)
+VALUES($1, $2, $3, $4) ON CONFLICT (match_name) DO
+UPDATE
+SET match_name = EXCLUDED.match_name
+RETURNING id;
+-- name: GetArtistByMatchNameOrAlias :one
+SELECT a.*
+FROM artists a
+WHERE a.match_name = sqlc.arg(match_name)
+    OR sqlc.arg(match_name)::text = ANY(a.aliases)
+LIMIT 1;
+-- name: GetKnownArtistMatchNames :many
+-- Gets the given match names that belong to an artist or are an alias of one
+SELECT m.match_name::text
+FROM unnest(sqlc.arg(match_names)::text[]) AS m(match_name)
+WHERE EXISTS (
+        SELECT 1
+        FROM artists a
+        WHERE a.match_name = m.match_name
+            OR m.match_name = ANY(a.aliases)
+    );
+-- name: GetArtistByID :one
+SELECT a.*
+FROM artists a
+WHERE a.id = $1;
+-- name: AddArtistAlias :exec
+UPDATE artists
+SET aliases = array_append(aliases, sqlc.arg(alias)::text)
+WHERE id = sqlc.arg(id)
+    AND NOT (sqlc.arg(alias)::text = ANY(aliases));
+-- name: SetArtistSortName :exec
+UPDATE artists
+SET sort_name = $2
+WHERE id = $1;
+-- name: ListArtists :many
+-- Lists artists ordered by sort name with the number of tracks they are credited on
+SELECT a.id,
+    a."name",
+    a.sort_name,
+    a.aliases,
+    COUNT(DISTINCT ta.track_id) AS track_count
+FROM artists a
+    LEFT JOIN track_artists ta ON ta.artist_id = a.id
+GROUP BY a.id
+ORDER BY a.sort_name
+LIMIT $1 OFFSET $2;
+-- name: InsertTrackArtist :exec
+INSERT INTO public.track_artists (track_id, artist_id, "role", "position")
+VALUES($1, $2, $3, $4) ON CONFLICT DO NOTHING;
+-- name: GetArtistsByTrackID :many
+-- Gets credited artists of the track in credit order
+SELECT a.id,
+    a."name",
+    ta."role"
+FROM track_artists ta
+    JOIN artists a ON a.id = ta.artist_id
+WHERE ta.track_id = $1
+ORDER BY ta."position",
+    ta."role";
+-- name: GetTracksByArtistID :many
+-- Gets basic track information of every track the artist is credited on, with the credit role
+SELECT t.id,
+    t.album_id,
+    t.album_name,
+    t.total_duration,
+    t.info,
+    t.instrumental,
+    t.tempo,
+    t."key",
+    ta."role"
+FROM track_artists ta
+    JOIN tracks t ON t.id = ta.track_id
+WHERE ta.artist_id = $1
+ORDER BY t.album_name,
+    substring(t.info->>'PartOfSet' FROM '^\d+')::int NULLS FIRST,
+    substring(t.info->>'Track' FROM '^\d+')::int NULLS LAST,
+    t.info->>'Title';
+-- name: GetTracksWithoutArtists :many
+-- Gets tracks that have no artist credits yet, used for backfilling credits of tracks ingested before artists existed
+SELECT t.id,
+    t.info
+FROM tracks t
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM track_artists ta
+        WHERE ta.track_id = t.id
+    );
+-- name: GetArtistRolesByTrackIDs :many
+-- Gets the roles the artist is credited with on the given tracks
+SELECT ta.track_id,
+    ta."role"
+FROM track_artists ta
+WHERE ta.artist_id = sqlc.arg(artist_id)
+    AND ta.track_id = ANY(sqlc.arg(track_ids)::text[]::uuid[])
+ORDER BY ta.track_id,
+    ta.position;
+-- name: InsertPlayEvents :copyfrom
+INSERT INTO play_events (
+        track_id,
+        anon_id,
+        event_type,
+        "position",
+        duration,
+        created_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6);
+-- name: InsertPlayEvent :exec
+-- Inserts a single event, used when a batch is rejected to keep the valid events of the batch
+INSERT INTO play_events (
+        track_id,
+        anon_id,
+        event_type,
+        "position",
+        duration,
+        created_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6);
+-- name: TrackExists :one
+SELECT EXISTS (
+        SELECT 1
+        FROM tracks
+        WHERE id = $1
+    );
+-- name: GetTrackPlayStats :one
+SELECT ps.*
+FROM track_play_stats ps
+WHERE ps.track_id = $1;
+-- name: TopTracks :many
+-- Ranks tracks by plays between since and until, NULL bounds are open.
+-- picks count the times the track was handed out by random selection, plays count the started playbacks.
+WITH plays AS (
+    SELECT e.track_id,
+        COUNT(*) FILTER (
+            WHERE e.event_type = 'start'
+        ) AS plays,
+        COUNT(*) FILTER (
+            WHERE is_completed_play(e.event_type, e."position", t.total_duration)
+        ) AS completes,
+        COUNT(*) FILTER (
+            WHERE is_skipped_play(e.event_type, e."position", t.total_duration)
+        ) AS skips,
+        SUM(e.duration) AS listened_seconds,
+        COUNT(DISTINCT e.anon_id) AS listeners
+    FROM play_events e
+        JOIN tracks t ON t.id = e.track_id
+    WHERE (
+            sqlc.narg(since)::timestamptz IS NULL
+            OR e.created_at >= sqlc.narg(since)::timestamptz
+        )
+        AND (
+            sqlc.narg(until)::timestamptz IS NULL
+            OR e.created_at < sqlc.narg(until)::timestamptz
+        )
+    GROUP BY e.track_id
+),
+picks AS (
+    SELECT lh.track_id,
+        COUNT(*) AS picks
+    FROM listening_histories lh
+    WHERE (
+            sqlc.narg(since)::timestamptz IS NULL
+            OR lh.listened_at >= sqlc.narg(since)::timestamptz
+        )
+        AND (
+            sqlc.narg(until)::timestamptz IS NULL
+            OR lh.listened_at < sqlc.narg(until)::timestamptz
+        )
+    GROUP BY lh.track_id
+)
+SELECT t.id,
+    t.info,
+    a.name AS album_name,
+    t.total_duration,
+    COALESCE(p.plays, 0)::int8 AS plays,
+    COALESCE(p.completes, 0)::int8 AS completes,
+    COALESCE(p.skips, 0)::int8 AS skips,
+    COALESCE(p.listened_seconds, 0)::numeric AS listened_seconds,
+    COALESCE(p.listeners, 0)::int8 AS listeners,
+    COALESCE(k.picks, 0)::int8 AS picks
+FROM plays p
+    FULL JOIN picks k ON k.track_id = p.track_id
+    JOIN tracks t ON t.id = COALESCE(p.track_id, k.track_id)
+    JOIN albums a ON a.id = t.album_id
+ORDER BY plays DESC,
+    picks DESC,
+    listened_seconds DESC,
+    t.id
+LIMIT sqlc.arg(result_limit);
+-- name: TopArtists :many
+-- Ranks artists by plays of the tracks they are credited on between since and until, NULL bounds are open.
+-- an artist credited with several roles on a track counts the plays of the track once.
+WITH plays AS (
+    SELECT e.track_id,
+        COUNT(*) FILTER (
+            WHERE e.event_type = 'start'
+        ) AS plays,
+        COUNT(*) FILTER (
+            WHERE is_completed_play(e.event_type, e."position", t.total_duration)
+        ) AS completes,
+        COUNT(*) FILTER (
+            WHERE is_skipped_play(e.event_type, e."position", t.total_duration)
+        ) AS skips,
+        SUM(e.duration) AS listened_seconds
+    FROM play_events e
+        JOIN tracks t ON t.id = e.track_id
+    WHERE (
+            sqlc.narg(since)::timestamptz IS NULL
+            OR e.created_at >= sqlc.narg(since)::timestamptz
+        )
+        AND (
+            sqlc.narg(until)::timestamptz IS NULL
+            OR e.created_at < sqlc.narg(until)::timestamptz
+        )
+    GROUP BY e.track_id
+),
+picks AS (
+    SELECT lh.track_id,
+        COUNT(*) AS picks
+    FROM listening_histories lh
+    WHERE (
+            sqlc.narg(since)::timestamptz IS NULL
+            OR lh.listened_at >= sqlc.narg(since)::timestamptz
+        )
+        AND (
+            sqlc.narg(until)::timestamptz IS NULL
+            OR lh.listened_at < sqlc.narg(until)::timestamptz
+        )
+    GROUP BY lh.track_id
+),
+credits AS (
+    SELECT DISTINCT ta.track_id,
+        ta.artist_id
+    FROM track_artists ta
+)
+SELECT ar.id,
+    ar.name,
+    COUNT(DISTINCT c.track_id) AS track_count,
+    COALESCE(SUM(p.plays), 0)::int8 AS plays,
+    COALESCE(SUM(p.completes), 0)::int8 AS completes,
+    COALESCE(SUM(p.skips), 0)::int8 AS skips,
+    COALESCE(SUM(p.listened_seconds), 0)::numeric AS listened_seconds,
+    COALESCE(SUM(k.picks), 0)::int8 AS picks
+FROM plays p
+    FULL JOIN picks k ON k.track_id = p.track_id
+    JOIN credits c ON c.track_id = COALESCE(p.track_id, k.track_id)
+    JOIN artists ar ON ar.id = c.artist_id
+GROUP BY ar.id
+ORDER BY plays DESC,
+    picks DESC,
+    listened_seconds DESC,
+    ar.id
+LIMIT sqlc.arg(result_limit);
+-- name: GetListeningHistory :many
+-- Lists the tracks handed out to the anonymous listener newest first, between since and until.
+-- after_listened_at and after_track_id point to the last entry of the previous page.
+SELECT lh.track_id,
+    lh.listened_at,
+    t.info,
+    a.name AS album_name,
+    t.total_duration
+FROM listening_histories lh
+    JOIN tracks t ON t.id = lh.track_id
+    JOIN albums a ON a.id = t.album_id
+WHERE lh.anon_id = sqlc.arg(anon_id)
+    AND (
+        sqlc.narg(since)::timestamptz IS NULL
+        OR lh.listened_at >= sqlc.narg(since)::timestamptz
+    )
+    AND (
+        sqlc.narg(until)::timestamptz IS NULL
+        OR lh.listened_at < sqlc.narg(until)::timestamptz
+    )
+    AND (
+        sqlc.narg(after_listened_at)::timestamptz IS NULL
+        OR (lh.listened_at, lh.track_id) < (
+            sqlc.narg(after_listened_at)::timestamptz,
+            sqlc.narg(after_track_id)::uuid
+        )
+    )
+ORDER BY lh.listened_at DESC,
+    lh.track_id DESC
+LIMIT sqlc.arg(result_limit);
+-- name: GetListenerPlayTotals :one
+-- Sums the play events and random picks of the anonymous listener between since and until.
+SELECT COUNT(*) FILTER (
+        WHERE e.event_type = 'start'
+    ) AS plays,
+    COUNT(*) FILTER (
+        WHERE is_completed_play(e.event_type, e."position", t.total_duration)
+    ) AS completes,
+    COUNT(*) FILTER (
+        WHERE is_skipped_play(e.event_type, e."position", t.total_duration)
+    ) AS skips,
+    COALESCE(SUM(e.duration), 0)::numeric AS listened_seconds,
+    COUNT(DISTINCT e.track_id) AS track_count,
+    (
+        SELECT COUNT(*)
+        FROM listening_histories lh
+        WHERE lh.anon_id = sqlc.arg(anon_id)
+            AND (
+                sqlc.narg(since)::timestamptz IS NULL
+                OR lh.listened_at >= sqlc.narg(since)::timestamptz
+            )
+            AND (
+                sqlc.narg(until)::timestamptz IS NULL
+                OR lh.listened_at < sqlc.narg(until)::timestamptz
+            )
+    ) AS picks
+FROM play_events e
+    JOIN tracks t ON t.id = e.track_id
+WHERE e.anon_id = sqlc.arg(anon_id)
+    AND (
+        sqlc.narg(since)::timestamptz IS NULL
+        OR e.created_at >= sqlc.narg(since)::timestamptz
+    )
+    AND (
+        sqlc.narg(until)::timestamptz IS NULL
+        OR e.created_at < sqlc.narg(until)::timestamptz
+    );
+-- name: PlayTrends :many
+-- Counts plays, skips, listeners and picks per day between since and until, days without any activity are omitted.
+WITH plays AS (
+    SELECT date_trunc('day', e.created_at) AS day,
+        COUNT(*) FILTER (
+            WHERE e.event_type = 'start'
+        ) AS plays,
+        COUNT(*) FILTER (
+            WHERE is_completed_play(e.event_type, e."position", t.total_duration)
+        ) AS completes,
+        COUNT(*) FILTER (
+            WHERE is_skipped_play(e.event_type, e."position", t.total_duration)
+        ) AS skips,
+        SUM(e.duration) AS listened_seconds,
+        COUNT(DISTINCT e.anon_id) AS listeners
+    FROM play_events e
+        JOIN tracks t ON t.id = e.track_id
+    WHERE (
+            sqlc.narg(since)::timestamptz IS NULL
+            OR e.created_at >= sqlc.narg(since)::timestamptz
+        )
+        AND (
+            sqlc.narg(until)::timestamptz IS NULL
+            OR e.created_at < sqlc.narg(until)::timestamptz
+        )
+    GROUP BY 1
+),
+picks AS (
+    SELECT date_trunc('day', lh.listened_at) AS day,
+        COUNT(*) AS picks
+    FROM listening_histories lh
+    WHERE (
+            sqlc.narg(since)::timestamptz IS NULL
+            OR lh.listened_at >= sqlc.narg(since)::timestamptz
+        )
+        AND (
+            sqlc.narg(until)::timestamptz IS NULL
+            OR lh.listened_at < sqlc.narg(until)::timestamptz
+        )
+    GROUP BY 1
+)
+SELECT COALESCE(p.day, k.day)::timestamptz AS day,
+    COALESCE(p.plays, 0)::int8 AS plays,
+    COALESCE(p.completes, 0)::int8 AS completes,
+    COALESCE(p.skips, 0)::int8 AS skips,
+    COALESCE(p.listened_seconds, 0)::numeric AS listened_seconds,
+    COALESCE(p.listeners, 0)::int8 AS listeners,
+    COALESCE(k.picks, 0)::int8 AS picks
+FROM plays p
+    FULL JOIN picks k ON k.day = p.day
+ORDER BY 1;
+-- name: GetLibraryTotals :one
+-- Sums the library, the number of tracks is counted by GetTrackCount.
+SELECT COALESCE(SUM(t.total_duration), 0)::numeric AS total_duration,
+    COUNT(*) FILTER (
+        WHERE t.instrumental
+    ) AS instrumental_count,
+    (
+        SELECT COUNT(*)
+        FROM albums
+    ) AS album_count,
+    (
+        SELECT COUNT(*)
+        FROM artists
+    ) AS artist_count
+FROM tracks t;
+-- name: CreateShuffleSession :one
+INSERT INTO shuffle_sessions (anon_id, filter, seed, user_id)
+VALUES ($1, $2, $3, sqlc.narg(user_id))
+RETURNING *;
+-- name: GetShuffleSession :one
+SELECT *
+FROM shuffle_sessions
+WHERE id = $1;
+-- name: LockShuffleSession :one
+-- Locks the session until the end of the transaction, concurrent next and prev requests of the session are serialized.
+SELECT *
+FROM shuffle_sessions
+WHERE id = $1 FOR
+UPDATE;
+-- name: SetShuffleSessionPosition :exec
+UPDATE shuffle_sessions
+SET "position" = $2,
+    updated_at = now()
+WHERE id = $1;
+-- name: StartShuffleSessionCycle :exec
+-- Starts over the queue with a new shuffle, tracks of the previous cycles can be queued again.
+UPDATE shuffle_sessions
+SET cycle = cycle + 1,
+    updated_at = now()
+WHERE id = $1;
+-- name: CountShuffleSessionTracks :one
+SELECT COUNT(*)
+FROM shuffle_session_tracks
+WHERE session_id = $1;
+-- name: ListShuffleSessionTracksAfter :many
+-- Lists the queued tracks after the position, positions of deleted tracks are skipped.
+SELECT "position",
+    track_id
+FROM shuffle_session_tracks
+WHERE session_id = sqlc.arg(session_id)
+    AND "position" > sqlc.arg(after_position)
+ORDER BY "position"
+LIMIT sqlc.arg(result_limit);
+-- name: GetShuffleSessionTrackBefore :one
+-- Gets the queued track before the position, positions of deleted tracks are skipped.
+SELECT "position",
+    track_id
+FROM shuffle_session_tracks
+WHERE session_id = sqlc.arg(session_id)
+    AND "position" < sqlc.arg(before_position)
+ORDER BY "position" DESC
+LIMIT 1;
+-- name: OrderShuffleSessionCycle :execrows
+-- Shuffles the tracks matching the filters for the current cycle of the session, see filtered_tracks for the filters.
+-- tracks the listener has not heard since their rotation started come first, see GetRandomUnlistenedTrack.
+-- the order is derived from the seed and the cycle so that the same seed shuffles the library the same way.
+-- the library is sorted once per cycle, AppendShuffleSessionTracks moves batches of the order to the queue.
+-- tracks added to the library during the cycle are shuffled into the next one.
+INSERT INTO shuffle_session_order (session_id, "rank", track_id)
+SELECT sqlc.arg(session_id)::uuid,
+    row_number() OVER (
+        ORDER BY shuffled.listened,
+            shuffled.shuffle_key
+    ),
+    shuffled.id
+FROM (
+        SELECT t.id,
+            EXISTS (
+                SELECT 1
+                FROM listening_histories lh
+                WHERE lh.track_id = t.id
+                    AND lh.anon_id = sqlc.arg(anon_id)
+                    AND lh.listened_at >= COALESCE(
+                        (
+                            SELECT lr.started_at
+                            FROM listener_rotations lr
+                            WHERE lr.anon_id = sqlc.arg(anon_id)
+                        ),
+                        '-infinity'
+                    )
+            ) AS listened,
+            md5(sqlc.arg(seed)::text || ':' || sqlc.arg(cycle)::int4::text || ':' || t.id::text) AS shuffle_key
+        FROM filtered_tracks(
+                sqlc.narg(min_tempo)::numeric,
+                sqlc.narg(max_tempo)::numeric,
+                sqlc.narg(keys)::text[],
+                sqlc.narg(genres)::text[],
+                sqlc.narg(min_duration)::numeric,
+                sqlc.narg(max_duration)::numeric,
+                sqlc.arg(instrumental_only)::bool,
+                sqlc.narg(min_year)::int,
+                sqlc.narg(max_year)::int,
+                sqlc.narg(exclude_track_ids)::text[]::uuid[],
+                sqlc.narg(exclude_album_ids)::text[]::uuid[],
+                sqlc.narg(exclude_genres)::text[],
+                sqlc.narg(exclude_artist_ids)::text[]::uuid[]
+            ) t
+    ) shuffled;
+-- name: AppendShuffleSessionTracks :execrows
+-- Moves the next batch of the order of the current cycle to the queue of the session, see OrderShuffleSessionCycle.
+-- the batch is read from the primary key of the order, no rows are appended once the order is used up.
+WITH batch AS (
+    DELETE FROM shuffle_session_order o
+    WHERE o.session_id = sqlc.arg(session_id)::uuid
+        AND o."rank" IN (
+            SELECT so."rank"
+            FROM shuffle_session_order so
+            WHERE so.session_id = sqlc.arg(session_id)::uuid
+            ORDER BY so."rank"
+            LIMIT sqlc.arg(batch_size)::int
+        )
+    RETURNING o."rank",
+        o.track_id
+)
+INSERT INTO shuffle_session_tracks (session_id, "position", track_id, cycle)
+SELECT sqlc.arg(session_id)::uuid,
+    COALESCE(
+        (
+            SELECT MAX(st."position")
+            FROM shuffle_session_tracks st
+            WHERE st.session_id = sqlc.arg(session_id)::uuid
+        ),
+        -1
+    ) + row_number() OVER (
+        ORDER BY batch."rank"
+    ),
+    batch.track_id,
+    sqlc.arg(cycle)::int4
+FROM batch;
+-- name: DeleteShuffleSession :exec
+DELETE FROM shuffle_sessions
+WHERE id = $1;
+-- name: CreatePlaylist :one
+INSERT INTO public.playlists ("name", description, anon_id, user_id)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+-- name: GetPlaylist :one
+SELECT *
+FROM playlists
+WHERE id = $1;
+-- name: GetPlaylistsByName :many
+SELECT *
+FROM playlists
+WHERE "name" = $1
+ORDER BY created_at;
+-- name: ListPlaylists :many
+-- Lists playlists newest first with the number and the total duration of their tracks, optionally only the playlists of the listener or of the user.
+SELECT p.*,
+    COUNT(t.id) AS track_count,
+    COALESCE(SUM(t.total_duration), 0)::numeric AS total_duration
+FROM playlists p
+    LEFT JOIN playlist_items pi ON pi.playlist_id = p.id
+    LEFT JOIN tracks t ON t.id = pi.track_id
+WHERE (
+        sqlc.narg(anon_id)::text IS NULL
+        OR p.anon_id = sqlc.narg(anon_id)::text
+    )
+    AND (
+        sqlc.narg(user_id)::text IS NULL
+        OR p.user_id = sqlc.narg(user_id)::text::uuid
+    )
+GROUP BY p.id
+ORDER BY p.created_at DESC
+LIMIT sqlc.arg(result_limit) OFFSET sqlc.arg(result_offset);
+-- name: UpdatePlaylist :one
+-- Updates the name and the description of the playlist, NULL keeps the current value.
+UPDATE playlists
+SET "name" = COALESCE(sqlc.narg(name), "name"),
+    description = COALESCE(sqlc.narg(description), description),
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+-- name: TouchPlaylist :one
+-- Locks the playlist while its items are changed and bumps updated_at.
+UPDATE playlists
+SET updated_at = now()
+WHERE id = $1
+RETURNING *;
+-- name: DeletePlaylist :exec
+DELETE FROM playlists
+WHERE id = $1;
+-- name: ListPlaylistItems :many
+-- Lists the tracks of the playlist in order.
+SELECT pi.id AS item_id,
+    pi."position",
+    pi.added_at,
+    t.id,
+    t.album_id,
+    t.album_name,
+    t.total_duration,
+    t.info,
+    t.instrumental,
+    t.tempo,
+    t."key",
+    t.created_at,
+    t.instrumental_folder_path,
+    t.vocal_folder_path
+FROM playlist_items pi
+    JOIN tracks t ON t.id = pi.track_id
+WHERE pi.playlist_id = $1
+ORDER BY pi."position";
+-- name: GetPlaylistItem :one
+SELECT *
+FROM playlist_items
+WHERE id = $1
+    AND playlist_id = $2;
+-- name: CountPlaylistItems :one
+SELECT COUNT(*)
+FROM playlist_items
+WHERE playlist_id = $1;
+-- name: InsertPlaylistItem :one
+-- Inserts the track at the position, items at and after the position move one position down.
+-- the position must be between 0 and the number of items, lock the playlist with TouchPlaylist first.
+WITH shifted AS (
+    UPDATE playlist_items
+    SET "position" = "position" + 1
+    WHERE playlist_id = sqlc.arg(playlist_id)
+        AND "position" >= sqlc.arg(position)
+)
+INSERT INTO playlist_items (playlist_id, track_id, "position")
+VALUES (
+        sqlc.arg(playlist_id),
+        sqlc.arg(track_id),
+        sqlc.arg(position)
+    )
+RETURNING *;
+-- name: MovePlaylistItem :exec
+-- Moves the item from its current position to the new one, items in between move by one position.
+-- the new position must be less than the number of items, lock the playlist with TouchPlaylist first.
+UPDATE playlist_items
+SET "position" = CASE
+        WHEN id = sqlc.arg(id) THEN sqlc.arg(new_position)::int4
+        WHEN sqlc.arg(old_position)::int4 < sqlc.arg(new_position)::int4 THEN "position" - 1
+        ELSE "position" + 1
+    END
+WHERE playlist_id = sqlc.arg(playlist_id)
+    AND "position" BETWEEN LEAST(sqlc.arg(old_position)::int4, sqlc.arg(new_position)::int4)
+    AND GREATEST(sqlc.arg(old_position)::int4, sqlc.arg(new_position)::int4);
+-- name: DeletePlaylistItem :execrows
+-- Deletes the item, the items after it are renumbered by a trigger.
+DELETE FROM playlist_items
+WHERE id = $1
+    AND playlist_id = $2;
+-- name: CreateUser :one
+INSERT INTO public.users (username, password_hash)
+VALUES ($1, $2)
+RETURNING *;
+-- name: GetUserByUsername :one
+-- Usernames are case insensitive.
+SELECT *
+FROM users
+WHERE lower(username) = lower(sqlc.arg(username));
+-- name: ListUsers :many
+SELECT u.id,
+    u.username,
+    u.created_at,
+    COUNT(t.id) FILTER (
+        WHERE t.expires_at IS NULL
+            OR t.expires_at > now()
+    ) AS active_tokens,
+    MAX(t.last_used_at)::timestamptz AS last_used_at
+FROM users u
+    LEFT JOIN api_tokens t ON t.user_id = u.id
+GROUP BY u.id
+ORDER BY u.username;
+-- name: SetUserPassword :execrows
+UPDATE users
+SET password_hash = $2,
+    updated_at = now()
+WHERE id = $1;
+-- name: CreateAPIToken :one
+INSERT INTO public.api_tokens (user_id, token_hash, "name", expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+-- name: GetUserByAPIToken :one
+-- Gets the user of the token unless the token expired.
+SELECT u.id,
+    u.username,
+    t.id AS token_id,
+    t.expires_at,
+    t.last_used_at
+FROM api_tokens t
+    JOIN users u ON u.id = t.user_id
+WHERE t.token_hash = $1
+    AND (
+        t.expires_at IS NULL
+        OR t.expires_at > now()
+    );
+-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET last_used_at = now()
+WHERE id = $1;
+-- name: DeleteAPIToken :exec
+DELETE FROM api_tokens
+WHERE id = $1;
+-- name: DeleteUserAPITokens :execrows
+-- Revokes every token of the user, passwords changes log out every client.
+DELETE FROM api_tokens
+WHERE user_id = $1;
+-- name: CreateIngestJob :one
+INSERT INTO public.ingest_jobs (
+        id,
+        audio_key,
+        audio_filename,
+        cover_key,
+        instrumental,
+        user_id,
+        lyrics_key
+    )
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+-- name: GetIngestJob :one
+SELECT *
+FROM ingest_jobs
+WHERE id = $1;
+-- name: ClaimIngestJob :one
+-- Claims the oldest queued job that is due, concurrent workers skip the jobs other workers are claiming.
+UPDATE ingest_jobs j
+SET status = 'running',
+    stage = 'claimed',
+    attempts = j.attempts + 1,
+    locked_by = sqlc.arg(worker)::text,
+    lease_expires_at = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8),
+    started_at = now(),
+    finished_at = NULL,
+    updated_at = now()
+FROM (
+        SELECT id
+        FROM ingest_jobs
+        WHERE status = 'queued'
+            AND run_after <= now()
+        ORDER BY run_after,
+            created_at
+        LIMIT 1 FOR
+        UPDATE SKIP LOCKED
+    ) next
+WHERE j.id = next.id
+RETURNING j.*;
+-- name: RenewIngestJobLease :execrows
+-- Extends the lease of a running job, no rows are updated if the worker lost the job.
+UPDATE ingest_jobs
+SET lease_expires_at = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8),
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+    AND locked_by = sqlc.arg(worker)::text
+    AND status = 'running';
+-- name: SetIngestJobStage :execrows
+UPDATE ingest_jobs
+SET stage = sqlc.arg(stage),
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+    AND locked_by = sqlc.arg(worker)::text
+    AND status = 'running';
+-- name: CompleteIngestJob :execrows
+UPDATE ingest_jobs
+SET status = 'succeeded',
+    stage = 'done',
+    track_id = sqlc.arg(track_id)::uuid,
+    error = NULL,
+    locked_by = NULL,
+    lease_expires_at = NULL,
+    finished_at = now(),
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+    AND locked_by = sqlc.arg(worker)::text
+    AND status = 'running';
+-- name: FailIngestJob :one
+-- Queues the job again after the backoff, or fails it for good once it ran out of attempts.
+-- The stage the job failed at is kept.
+UPDATE ingest_jobs
+SET status = CASE
+        WHEN attempts >= max_attempts THEN 'failed'::ingest_job_status
+        ELSE 'queued'::ingest_job_status
+    END,
+    run_after = now() + make_interval(secs => sqlc.arg(backoff_seconds)::float8),
+    error = sqlc.arg(error)::text,
+    locked_by = NULL,
+    lease_expires_at = NULL,
+    finished_at = CASE
+        WHEN attempts >= max_attempts THEN now()
+    END,
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+    AND locked_by = sqlc.arg(worker)::text
+    AND status = 'running'
+RETURNING status;
+-- name: ReleaseIngestJob :execrows
+-- Queues the job again without counting the attempt, for workers that are shut down while processing.
+UPDATE ingest_jobs
+SET status = 'queued',
+    stage = 'queued',
+    attempts = GREATEST(attempts - 1, 0),
+    run_after = now(),
+    locked_by = NULL,
+    lease_expires_at = NULL,
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+    AND locked_by = sqlc.arg(worker)::text
+    AND status = 'running';
+-- name: RecoverExpiredIngestJobs :many
+-- Jobs of workers that stopped renewing their lease are queued again, or failed if they ran out of attempts.
+UPDATE ingest_jobs
+SET status = CASE
+        WHEN attempts >= max_attempts THEN 'failed'::ingest_job_status
+        ELSE 'queued'::ingest_job_status
+    END,
+    run_after = now(),
+    error = 'lease of worker ' || locked_by || ' expired at stage ' || stage,
+    locked_by = NULL,
+    lease_expires_at = NULL,
+    finished_at = CASE
+        WHEN attempts >= max_attempts THEN now()
+    END,
+    updated_at = now()
+WHERE status = 'running'
+    AND lease_expires_at < now()
+RETURNING id,
+    status,
+    error;
+-- name: ListIngestJobs :many
+-- Running jobs whose lease expired are reported as stuck until a worker recovers them.
+SELECT *,
+    (
+        status = 'running'
+        AND lease_expires_at < now()
+    )::bool AS stuck
+FROM ingest_jobs
+WHERE sqlc.narg(status)::ingest_job_status IS NULL
+    OR status = sqlc.narg(status)::ingest_job_status
+ORDER BY created_at DESC
+LIMIT sqlc.arg(result_limit);
+-- name: CountIngestJobs :many
+SELECT status,
+    COUNT(*) AS jobs
+FROM ingest_jobs
+GROUP BY status
+ORDER BY status;
+-- name: InsertIngestJobEvent :exec
+INSERT INTO public.ingest_job_events (job_id, event_type, payload)
+VALUES ($1, $2, $3);
+-- name: ListIngestJobEvents :many
+-- Events of the job after the given event id, oldest first.
+SELECT id,
+    event_type,
+    payload
+FROM ingest_job_events
+WHERE job_id = sqlc.arg(job_id)
+    AND id > sqlc.arg(after_id)::int8
+ORDER BY id
+LIMIT sqlc.arg(result_limit);
+-- name: CreateStation :one
+INSERT INTO public.stations ("name", filter)
+VALUES ($1, $2)
+RETURNING *;
+-- name: GetStationByName :one
+SELECT *
+FROM stations
+WHERE "name" = $1;
+-- name: ListStations :many
+SELECT *
+FROM stations
+ORDER BY "name";
+-- name: DeleteStation :execrows
+DELETE FROM stations
+WHERE "name" = $1;
+-- name: LockStation :one
+-- Locks the station until the end of the transaction, servers extending the schedule at the same time are serialized.
+SELECT *
+FROM stations
+WHERE id = $1 FOR
+UPDATE;
+-- name: GetStationScheduleEnd :one
+-- Gets the end of the last scheduled track, null if nothing is scheduled.
+SELECT MAX(ends_at)::timestamptz AS ends_at
+FROM station_schedule
+WHERE station_id = $1;
+-- name: AppendStationSchedule :execrows
+-- Schedules the next batch of tracks matching the filters after the last scheduled track, or from now on if the
+-- schedule ran out, see filtered_tracks for the filters. every slot of the batch is picked like GetRandomTrack
+-- among the candidates following its own random start in random_key order, wrapping around to the start of the
+-- key range, so that the index is walked instead of sorting the catalogue. a track picked for two slots is
+-- scheduled once, the batch can be shorter than batch_size.
+-- tracks among the last recent_tracks scheduled tracks of the station are not scheduled again.
+WITH last AS (
+    SELECT COALESCE(MAX("position"), -1)::int8 AS "position",
+        GREATEST(COALESCE(MAX(ends_at), now()), now()) AS ends_at
+    FROM station_schedule
+    WHERE station_id = sqlc.arg(station_id)::uuid
+),
+schedulable AS NOT MATERIALIZED (
+    SELECT t.id,
+        t.random_key,
+        t.total_duration::float8 AS duration,
+        ps.complete_count,
+        ps.skip_count
+    FROM filtered_tracks(
+            sqlc.narg(min_tempo)::numeric,
+            sqlc.narg(max_tempo)::numeric,
+            sqlc.narg(keys)::text[],
+            sqlc.narg(genres)::text[],
+            sqlc.narg(min_duration)::numeric,
+            sqlc.narg(max_duration)::numeric,
+            sqlc.arg(instrumental_only)::bool,
+            sqlc.narg(min_year)::int,
+            sqlc.narg(max_year)::int,
+            sqlc.narg(exclude_track_ids)::text[]::uuid[],
+            sqlc.narg(exclude_album_ids)::text[]::uuid[],
+            sqlc.narg(exclude_genres)::text[],
+            sqlc.narg(exclude_artist_ids)::text[]::uuid[]
+        ) t
+        LEFT JOIN track_play_stats ps ON ps.track_id = t.id
+    WHERE t.total_duration > 0
+        AND NOT EXISTS (
+            SELECT 1
+            FROM station_schedule ss
+            WHERE ss.station_id = sqlc.arg(station_id)::uuid
+                AND ss."position" > (
+                    SELECT "position"
+                    FROM last
+                ) - sqlc.arg(recent_tracks)::int8
+                AND ss.track_id = t.id
+        )
+),
+slots AS (
+    SELECT s.slot,
+        RANDOM() AS "start"
+    FROM generate_series(1, sqlc.arg(batch_size)::int) AS s(slot)
+),
+picks AS (
+    SELECT DISTINCT ON (p.id) s.slot,
+        p.id,
+        p.duration
+    FROM slots s
+        CROSS JOIN LATERAL (
+            SELECT c.id,
+                c.duration
+            FROM (
+                    (
+                        SELECT *
+                        FROM schedulable
+                        WHERE random_key >= s."start"
+                        ORDER BY random_key
+                        LIMIT sqlc.arg(candidates)::int
+                    )
+                    UNION ALL
+                    (
+                        SELECT *
+                        FROM schedulable
+                        WHERE random_key < s."start"
+                        ORDER BY random_key
+                        LIMIT sqlc.arg(candidates)::int
+                    )
+                    LIMIT sqlc.arg(candidates)::int
+                ) c
+            -- weighted random sampling, see GetRandomTrack
+            ORDER BY power(
+                    RANDOM(),
+                    1 / play_weight(c.complete_count, c.skip_count)
+                ) DESC
+            LIMIT 1
+        ) p
+    ORDER BY p.id,
+        s.slot
+),
+picked AS (
+    SELECT id,
+        duration,
+        row_number() OVER (
+            ORDER BY slot
+        ) AS n
+    FROM picks
+)
+INSERT INTO station_schedule (station_id, "position", track_id, starts_at, ends_at)
+SELECT sqlc.arg(station_id)::uuid,
+    last."position" + p.n,
+    p.id,
+    last.ends_at + make_interval(secs => SUM(p.duration) OVER (ORDER BY p.n) - p.duration),
+    last.ends_at + make_interval(secs => SUM(p.duration) OVER (ORDER BY p.n))
+FROM picked p
+    CROSS JOIN last;
+-- name: ListStationSchedule :many
+-- Lists the scheduled tracks that did not end at the given time, the first one is playing unless it starts later.
+SELECT *
+FROM station_schedule
+WHERE station_id = sqlc.arg(station_id)
+    AND ends_at > sqlc.arg(at)::timestamptz
+ORDER BY "position"
+LIMIT sqlc.arg(result_limit);
+-- name: PruneStationSchedule :execrows
+-- Deletes the tracks that ended before the given time.
+DELETE FROM station_schedule
+WHERE station_id = $1
+    AND ends_at < $2;
+-- name: UpsertLyrics :exec
+-- Sets the lyrics of the track, replacing the lyrics it had.
+INSERT INTO public.lyrics (
+        track_id,
+        "language",
+        plain,
+        synced,
+        "source"
+    )
+VALUES ($1, $2, $3, $4, $5) ON CONFLICT (track_id) DO
+UPDATE
+SET "language" = EXCLUDED."language",
+    plain = EXCLUDED.plain,
+    synced = EXCLUDED.synced,
+    "source" = EXCLUDED."source",
+    updated_at = now();
+-- name: GetLyrics :one
+SELECT *
+FROM lyrics
+WHERE track_id = $1;
+-- name: ExportAlbums :many
+-- Lists albums in id order after the given id, derived columns are recalculated on import.
+-- only the albums of the given ids if ids is not NULL, imports read back what they wrote.
+SELECT id,
+    "name",
+    cover,
+    artist,
+    "year",
+    genre,
+    musicbrainz_release_id,
+    musicbrainz_release_group_id,
+    canonical_name,
+    release_date,
+    created_at
+FROM albums
+WHERE id > sqlc.arg(after_id)::uuid
+    AND (
+        sqlc.narg(ids)::text[] IS NULL
+        OR id = ANY(sqlc.narg(ids)::text[]::uuid[])
+    )
+ORDER BY id
+LIMIT sqlc.arg(result_limit);
+-- name: ExportArtists :many
+-- Lists artists like ExportAlbums.
+SELECT *
+FROM artists
+WHERE id > sqlc.arg(after_id)::uuid
+    AND (
+        sqlc.narg(ids)::text[] IS NULL
+        OR id = ANY(sqlc.narg(ids)::text[]::uuid[])
+    )
+ORDER BY id
+LIMIT sqlc.arg(result_limit);
+-- name: ExportTracks :many
+-- Lists tracks like ExportAlbums, numeric columns as text to keep their precision.
+SELECT id,
+    album_id,
+    album_name,
+    vocal_folder_path,
+    instrumental_folder_path,
+    total_duration::text AS total_duration,
+    info,
+    instrumental,
+    tempo::text AS tempo,
+    "key",
+    vocal_waveform,
+    instrumental_waveform,
+    musicbrainz_recording_id,
+    canonical_title,
+    created_at
+FROM tracks
+WHERE id > sqlc.arg(after_id)::uuid
+    AND (
+        sqlc.narg(ids)::text[] IS NULL
+        OR id = ANY(sqlc.narg(ids)::text[]::uuid[])
+    )
+ORDER BY id
+LIMIT sqlc.arg(result_limit);
+-- name: ExportTrackArtists :many
+SELECT *
+FROM track_artists
+WHERE track_id = ANY(sqlc.arg(track_ids)::text[]::uuid[])
+ORDER BY track_id,
+    "position",
+    "role";
+-- name: ExportLyrics :many
+SELECT *
+FROM lyrics
+WHERE track_id = ANY(sqlc.arg(track_ids)::text[]::uuid[])
+ORDER BY track_id;
+-- name: ExportListeningHistories :many
+-- Lists listening history oldest first after the given entry, identical entries are exported once.
+SELECT DISTINCT track_id,
+    anon_id,
+    listened_at
+FROM listening_histories
+WHERE (listened_at, track_id, anon_id) > (
+        sqlc.arg(after_listened_at)::timestamptz,
+        sqlc.arg(after_track_id)::uuid,
+        sqlc.arg(after_anon_id)::text
+    )
+ORDER BY listened_at,
+    track_id,
+    anon_id
+LIMIT sqlc.arg(result_limit);
+-- name: ExportPlayEvents :many
+SELECT id,
+    track_id,
+    anon_id,
+    event_type,
+    "position"::text AS "position",
+    duration::text AS duration,
+    created_at
+FROM play_events
+WHERE id > sqlc.arg(after_id)::int8
+ORDER BY id
+LIMIT sqlc.arg(result_limit);
+-- name: AlbumExists :one
+SELECT EXISTS (
+        SELECT 1
+        FROM albums
+        WHERE id = $1
+    );
+-- name: ArtistExists :one
+SELECT EXISTS (
+        SELECT 1
+        FROM artists
+        WHERE id = $1
+    );
+-- name: ImportAlbum :exec
+-- Inserts the album of an archive, or replaces the album with the same id. track count, total duration and disc
+-- count are left for refresh_album_stats.
+INSERT INTO public.albums (
+        id,
+        "name",
+        cover,
+        artist,
+        "year",
+        genre,
+        musicbrainz_release_id,
+        musicbrainz_release_group_id,
+        canonical_name,
+        release_date,
+        created_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ON CONFLICT (id) DO
+UPDATE
+SET "name" = EXCLUDED."name",
+    cover = EXCLUDED.cover,
+    artist = EXCLUDED.artist,
+    "year" = EXCLUDED."year",
+    genre = EXCLUDED.genre,
+    musicbrainz_release_id = EXCLUDED.musicbrainz_release_id,
+    musicbrainz_release_group_id = EXCLUDED.musicbrainz_release_group_id,
+    canonical_name = EXCLUDED.canonical_name,
+    release_date = EXCLUDED.release_date,
+    created_at = EXCLUDED.created_at;
+-- name: ImportArtist :exec
+-- Inserts the artist of an archive, or replaces the artist with the same id.
+INSERT INTO public.artists (
+        id,
+        "name",
+        sort_name,
+        match_name,
+        aliases,
+        musicbrainz_id,
+        created_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO
+UPDATE
+SET "name" = EXCLUDED."name",
+    sort_name = EXCLUDED.sort_name,
+    match_name = EXCLUDED.match_name,
+    aliases = EXCLUDED.aliases,
+    musicbrainz_id = EXCLUDED.musicbrainz_id,
+    created_at = EXCLUDED.created_at;
+-- name: ImportTrack :exec
+-- Inserts the track of an archive, or replaces the track with the same id. random_key is kept for existing tracks.
+INSERT INTO public.tracks (
+        id,
+        album_id,
+        album_name,
+        vocal_folder_path,
+        instrumental_folder_path,
+        total_duration,
+        info,
+        instrumental,
+        tempo,
+        "key",
+        vocal_waveform,
+        instrumental_waveform,
+        musicbrainz_recording_id,
+        canonical_title,
+        created_at
+    )
+VALUES (
+        $1,
+        $2,
+        $3,
+        $4,
+        $5,
+        sqlc.arg(total_duration)::text::numeric,
+        $6,
+        $7,
+        sqlc.arg(tempo)::text::numeric,
+        $8,
+        $9,
+        $10,
+        $11,
+        $12,
+        $13
+    ) ON CONFLICT (id) DO
+UPDATE
+SET album_id = EXCLUDED.album_id,
+    album_name = EXCLUDED.album_name,
+    vocal_folder_path = EXCLUDED.vocal_folder_path,
+    instrumental_folder_path = EXCLUDED.instrumental_folder_path,
+    total_duration = EXCLUDED.total_duration,
+    info = EXCLUDED.info,
+    instrumental = EXCLUDED.instrumental,
+    tempo = EXCLUDED.tempo,
+    "key" = EXCLUDED."key",
+    vocal_waveform = EXCLUDED.vocal_waveform,
+    instrumental_waveform = EXCLUDED.instrumental_waveform,
+    musicbrainz_recording_id = EXCLUDED.musicbrainz_recording_id,
+    canonical_title = EXCLUDED.canonical_title,
+    created_at = EXCLUDED.created_at;
+-- name: DeleteTrackArtists :exec
+DELETE FROM track_artists
+WHERE track_id = $1;
+-- name: ImportLyrics :exec
+-- Sets the lyrics of the track from an archive, keeping the time they were last changed.
+INSERT INTO public.lyrics (
+        track_id,
+        "language",
+        plain,
+        synced,
+        "source",
+        updated_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (track_id) DO
+UPDATE
+SET "language" = EXCLUDED."language",
+    plain = EXCLUDED.plain,
+    synced = EXCLUDED.synced,
+    "source" = EXCLUDED."source",
+    updated_at = EXCLUDED.updated_at;
+-- name: ImportListeningHistories :execrows
+-- Inserts the entries that are not in the listening history yet, returns the number of entries inserted.
+INSERT INTO listening_histories (track_id, anon_id, listened_at)
+SELECT h.track_id,
+    h.anon_id,
+    h.listened_at
+FROM (
+        -- set returning functions of the same select are read in step
+        SELECT unnest(sqlc.arg(track_ids)::text[])::uuid AS track_id,
+            unnest(sqlc.arg(anon_ids)::text[]) AS anon_id,
+            unnest(sqlc.arg(listened_ats)::timestamptz[]) AS listened_at
+    ) h
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM listening_histories lh
+        WHERE lh.track_id = h.track_id
+            AND lh.anon_id = h.anon_id
+            AND lh.listened_at = h.listened_at
+    );
+-- name: ImportPlayEvents :execrows
+-- Inserts the events that are not stored yet, events are the same if track, listener, type, position and time
+-- are. returns the number of events inserted.
+INSERT INTO play_events (
+        track_id,
+        anon_id,
+        event_type,
+        "position",
+        duration,
+        created_at
+    )
+SELECT e.track_id,
+    e.anon_id,
+    e.event_type,
+    e.position,
+    e.duration,
+    e.created_at
+FROM (
+        SELECT unnest(sqlc.arg(track_ids)::text[])::uuid AS track_id,
+            unnest(sqlc.arg(anon_ids)::text[]) AS anon_id,
+            unnest(sqlc.arg(event_types)::text[])::play_event_type AS event_type,
+            unnest(sqlc.arg(positions)::text[])::numeric AS "position",
+            unnest(sqlc.arg(durations)::text[])::numeric AS duration,
+            unnest(sqlc.arg(created_ats)::timestamptz[]) AS created_at
+    ) e
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM play_events pe
+        WHERE pe.track_id = e.track_id
+            AND pe.anon_id = e.anon_id
+            AND pe.event_type = e.event_type
+            AND pe.position = e.position
+            AND pe.created_at = e.created_at
+    );
+-- name: CountLibraryRows :one
+-- Counts the rows of the given ids, used to verify an import.
+SELECT (
+        SELECT COUNT(*)
+        FROM albums
+        WHERE id = ANY(sqlc.arg(album_ids)::text[]::uuid[])
+    ) AS albums,
+    (
+        SELECT COUNT(*)
+        FROM artists
+        WHERE id = ANY(sqlc.arg(artist_ids)::text[]::uuid[])
+    ) AS artists,
+    (
+        SELECT COUNT(*)
+        FROM tracks
+        WHERE id = ANY(sqlc.arg(track_ids)::text[]::uuid[])
+    ) AS tracks,
+    (
+        SELECT COUNT(*)
+        FROM lyrics
+        WHERE track_id = ANY(sqlc.arg(lyrics_track_ids)::text[]::uuid[])
+    ) AS lyrics;